@@ -0,0 +1,116 @@
+package je
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Artifact is a file produced by a job in its working directory and kept
+// with its data once the job is done
+type Artifact struct {
+	// Name is the path of the file relative to the working directory of
+	// the job with / as separator
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+}
+
+// ScratchDir is where the working directories of jobs are created. Each job
+// gets a new directory named after its id with a random suffix, so that
+// daemons sharing ScratchDir never use each other's, which is removed once
+// the job is done and its artifacts have been collected.
+var ScratchDir = filepath.Join(os.TempDir(), "je-jobs")
+
+// CheckArtifactPattern returns an error if pattern is not a valid glob of
+// files in the working directory of a job
+func CheckArtifactPattern(pattern string) error {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return fmt.Errorf("invalid artifact pattern %q: %s", pattern, err)
+	}
+	if !validArtifactName(pattern) {
+		return fmt.Errorf("invalid artifact pattern %q: must be relative to the working directory", pattern)
+	}
+	return nil
+}
+
+// validArtifactName returns true if name is a clean relative path that stays
+// within the working directory of a job
+func validArtifactName(name string) bool {
+	return name != "" && name != "." && path.Clean(name) == name &&
+		!path.IsAbs(name) && name != ".." && !strings.HasPrefix(name, "../")
+}
+
+// newScratchDir creates a new working directory for a job
+func newScratchDir(id ID) (string, error) {
+	if err := os.MkdirAll(ScratchDir, 0755); err != nil {
+		return "", err
+	}
+	return ioutil.TempDir(ScratchDir, fmt.Sprintf("%d-", id))
+}
+
+// collectArtifacts copies the regular files in dir matching any of patterns
+// to the artifacts of the job with the given id
+func collectArtifacts(id ID, dir string, patterns []string) ([]Artifact, error) {
+	seen := make(map[string]bool)
+	var names []string
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(filepath.Join(dir, filepath.FromSlash(pattern)))
+		if err != nil {
+			return nil, err
+		}
+		for _, match := range matches {
+			fi, err := os.Lstat(match)
+			if err != nil || !fi.Mode().IsRegular() {
+				continue
+			}
+			rel, err := filepath.Rel(dir, match)
+			if err != nil {
+				return nil, err
+			}
+			name := filepath.ToSlash(rel)
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+
+	artifacts := []Artifact{}
+	for _, name := range names {
+		n, err := copyArtifact(id, filepath.Join(dir, filepath.FromSlash(name)), name)
+		if err != nil {
+			log.Errorf("error collecting artifact %s of job #%d: %s", name, id, err)
+			return artifacts, err
+		}
+		artifacts = append(artifacts, Artifact{Name: name, Size: n})
+	}
+	return artifacts, nil
+}
+
+func copyArtifact(id ID, src, name string) (int64, error) {
+	f, err := os.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	w, err := data.WriteArtifact(id, name)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := io.Copy(w, f)
+	if err != nil {
+		w.Close()
+		return n, err
+	}
+	return n, w.Close()
+}
@@ -0,0 +1,112 @@
+package je
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckArtifactPattern(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, pattern := range []string{"report.txt", "*.tar.gz", "out/*.csv", "[ab]?.log"} {
+		assert.NoError(CheckArtifactPattern(pattern), pattern)
+	}
+	for _, pattern := range []string{"", ".", "/etc/passwd", "../*", "out/../../x", "./x", "[", "out//x"} {
+		assert.Error(CheckArtifactPattern(pattern), pattern)
+	}
+}
+
+func TestAPIv2_Artifacts(t *testing.T) {
+	assert := assert.New(t)
+
+	script := "mkdir out; echo report > report.txt; echo 1,2 > out/a.csv; echo no > b.log; ln -s /etc/passwd c.txt; pwd"
+	qs := url.Values{
+		"name":     {"sh"},
+		"arg":      {"-c", script},
+		"artifact": {"*.txt", "out/*.csv", "report.*"},
+		"wait":     {"1"},
+	}
+	res, err := http.Post(testAPIURL+"/jobs?"+qs.Encode(), "text/plain", nil)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+
+	var job Job
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&job))
+	assert.Equal(STATE_STOPPED, job.State)
+	assert.Equal([]string{"*.txt", "out/*.csv", "report.*"}, job.ArtifactGlobs)
+
+	get := func(path string) (int, string) {
+		res, err := http.Get(fmt.Sprintf("%s/jobs/%d/%s", testAPIURL, job.ID, path))
+		require.NoError(t, err)
+		defer res.Body.Close()
+		buf, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res.StatusCode, string(buf)
+	}
+
+	// Jobs run in a scratch directory removed once they are done
+	_, dir := get("output")
+	dir = strings.TrimSpace(dir)
+	assert.True(strings.HasPrefix(dir, filepath.Join(ScratchDir, fmt.Sprintf("%d-", job.ID))), dir)
+	_, err = os.Stat(dir)
+	assert.True(os.IsNotExist(err))
+
+	status, body := get("artifacts")
+	assert.Equal(http.StatusOK, status)
+	var artifacts []Artifact
+	require.NoError(t, json.Unmarshal([]byte(body), &artifacts))
+	assert.Equal([]Artifact{{Name: "out/a.csv", Size: 4}, {Name: "report.txt", Size: 7}}, artifacts)
+
+	status, body = get("artifacts/out/a.csv")
+	assert.Equal(http.StatusOK, status)
+	assert.Equal("1,2\n", body)
+
+	status, _ = get("artifacts/b.log")
+	assert.Equal(http.StatusNotFound, status)
+
+	require.NoError(t, DeleteJob(job.ID))
+	_, err = data.ReadArtifact(job.ID, "report.txt")
+	assert.True(os.IsNotExist(err))
+
+	res, err = http.Post(testAPIURL+"/jobs?name=true&artifact=../x", "text/plain", nil)
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(http.StatusBadRequest, res.StatusCode)
+}
+
+func TestAPIv2_WorkDir(t *testing.T) {
+	assert := assert.New(t)
+
+	cwd, err := os.Getwd()
+	require.NoError(t, err)
+
+	// Directories of other daemons sharing the scratch directory are left
+	// alone
+	other := filepath.Join(ScratchDir, fmt.Sprint(db.NextId()+1))
+	require.NoError(t, os.MkdirAll(other, 0755))
+	defer os.RemoveAll(other)
+
+	// Jobs without input files or artifacts run in the daemon's directory
+	// and get no scratch directory
+	script := `pwd; test -z "$JE_WORKDIR" && echo ok; head -n 1 je_test.go`
+	qs := url.Values{"name": {"sh"}, "arg": {"-c", script}, "wait": {"1"}}
+	status, job := createTestJob(t, qs, "text/plain", &bytes.Buffer{})
+	require.Equal(t, http.StatusCreated, status)
+	assert.Equal(0, job.Status)
+	assert.Equal(cwd+"\nok\npackage je\n", getTestData(t, job.ID, DATA_OUTPUT))
+
+	_, err = os.Stat(other)
+	assert.NoError(err)
+}
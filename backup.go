@@ -0,0 +1,530 @@
+package je
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrStoreNotEmpty is returned when restoring into a store that has jobs
+var ErrStoreNotEmpty = errors.New("store is not empty")
+
+const (
+	// BackupVersion is the version of the backup archive format
+	BackupVersion = 1
+
+	backupManifest = "manifest.json"
+	backupJobs     = "jobs.ndjson"
+	backupStore    = "store/"
+	backupData     = "data/"
+)
+
+// Snapshotter is implemented by stores that can take a consistent snapshot
+// of their database files for backups
+type Snapshotter interface {
+	// Snapshot calls fn with the name, size and contents of each file
+	Snapshot(fn func(name string, size int64, r io.Reader) error) error
+}
+
+// BackupManifest describes the contents of a backup archive
+type BackupManifest struct {
+	Version int       `json:"version"`
+	Created time.Time `json:"created"`
+	Store   string    `json:"store"`
+	Codec   string    `json:"codec,omitempty"`
+	Jobs    int       `json:"jobs"`
+	Data    bool      `json:"data"`
+}
+
+// RestoreResult describes what was restored from a backup archive
+type RestoreResult struct {
+	Manifest *BackupManifest `json:"manifest"`
+	Jobs     int             `json:"jobs"`
+	Files    int             `json:"files"`
+	Snapshot bool            `json:"snapshot"`
+	// Interrupted is how many jobs were still active when backed up and
+	// restored as errored as nothing runs them anymore
+	Interrupted int `json:"interrupted"`
+}
+
+// storeType returns the db uri scheme of a store
+func storeType(store Store) string {
+	switch store.(type) {
+	case *MemoryStore:
+		return "memory"
+	case *BoltStore:
+		return "bolt"
+	case *BitcaskStore:
+		return "bitcask"
+	case *SQLiteStore:
+		return "sqlite"
+	case *PostgresStore:
+		return "postgres"
+	default:
+		return fmt.Sprintf("%T", store)
+	}
+}
+
+// Backup writes a tar archive of the store to w. The archive holds a
+// manifest, a snapshot of the store's files if it supports it and every job
+// as JSON so it can be restored into any type of store. The search index is
+// not included as it is rebuilt when restoring. If withData is true the
+// input, output, logs, artifacts and input files of every job are included
+// too.
+func Backup(w io.Writer, withData bool) error {
+	jobs, err := db.All()
+	if err != nil {
+		log.Errorf("error fetching jobs to backup: %s", err)
+		return err
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].ID < jobs[j].ID })
+
+	manifest := &BackupManifest{
+		Version: BackupVersion,
+		Created: time.Now(),
+		Store:   storeType(db),
+		Jobs:    len(jobs),
+		Data:    withData,
+	}
+	if recoder, ok := db.(Recoder); ok {
+		manifest.Codec = recoder.Codec().Name()
+	}
+
+	tw := tar.NewWriter(w)
+
+	buf, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeTarFile(tw, backupManifest, int64(len(buf)), bytes.NewReader(buf)); err != nil {
+		return err
+	}
+
+	if snapshotter, ok := db.(Snapshotter); ok {
+		err := snapshotter.Snapshot(func(name string, size int64, r io.Reader) error {
+			return writeTarFile(tw, backupStore+name, size, r)
+		})
+		if err != nil {
+			log.Errorf("error writing store snapshot: %s", err)
+			return err
+		}
+	}
+
+	var ndjson bytes.Buffer
+	enc := json.NewEncoder(&ndjson)
+	for _, job := range jobs {
+		job.RLock()
+		err := enc.Encode(job)
+		job.RUnlock()
+		if err != nil {
+			log.Errorf("error encoding job #%d: %s", job.ID, err)
+			return err
+		}
+	}
+	if err := writeTarFile(tw, backupJobs, int64(ndjson.Len()), &ndjson); err != nil {
+		return err
+	}
+
+	if withData {
+		for _, job := range jobs {
+			if err := backupJobData(tw, job); err != nil {
+				return err
+			}
+		}
+	}
+
+	return tw.Close()
+}
+
+func backupJobData(tw *tar.Writer, job *Job) error {
+	id := job.ID
+	for _, dtype := range dataTypes {
+		var size int64
+		r, err := readKept(job, dtype, func(n int64) (int64, int64, error) {
+			size = n
+			return 0, n, nil
+		})
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			log.Errorf("error reading %s data for job #%d: %s", dtype, id, err)
+			return err
+		}
+
+		name := fmt.Sprintf("%s%d.%s", backupData, id, dtype)
+		err = writeTarFile(tw, name, size, r)
+		r.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	job.RLock()
+	artifacts, inputs := job.Artifacts, job.InputFiles
+	job.RUnlock()
+	if err := backupJobFiles(tw, id, "artifacts", artifacts, data.ReadArtifact); err != nil {
+		return err
+	}
+	return backupJobFiles(tw, id, "inputs", inputs, data.ReadInputFile)
+}
+
+// backupJobFiles writes the files of a job read with read to the archive as
+// data/<id>.<kind>/<name>
+func backupJobFiles(tw *tar.Writer, id ID, kind string, files []Artifact, read func(ID, string) (io.ReadCloser, error)) error {
+	for _, file := range files {
+		r, err := read(id, file.Name)
+		if err != nil {
+			log.Errorf("error reading %s %s of job #%d: %s", kind, file.Name, id, err)
+			return err
+		}
+
+		name := fmt.Sprintf("%s%d.%s/%s", backupData, id, kind, file.Name)
+		err = writeTarFile(tw, name, file.Size, r)
+		r.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeTarFile writes size bytes of r to the archive. Files that are still
+// being written to, such as the output of running jobs, are truncated.
+func writeTarFile(tw *tar.Writer, name string, size int64, r io.Reader) error {
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    size,
+		ModTime: time.Now(),
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		log.Errorf("error writing %s to backup: %s", name, err)
+		return err
+	}
+
+	if _, err := io.CopyN(tw, r, size); err != nil {
+		log.Errorf("error writing %s to backup: %s", name, err)
+		return err
+	}
+
+	return nil
+}
+
+// Restore restores a backup archive into the store at dburi and the data
+// directory datadir which must not exist yet. Jobs are restored from the
+// store's snapshot if the archive has one for the same type of store and are
+// saved one by one otherwise, so archives can be restored into any type of
+// store. The search index is rebuilt and the store closed once restored.
+func Restore(r io.Reader, dburi, datadir string) (*RestoreResult, error) {
+	u, err := ParseURI(dburi)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Type {
+	case "memory":
+		return nil, fmt.Errorf("cannot restore into a memory store")
+	case "bolt", "bitcask", "sqlite":
+		if _, err := os.Stat(u.Path); err == nil {
+			return nil, fmt.Errorf("cannot restore into existing store %s", u.Path)
+		}
+	}
+
+	if files, err := ioutil.ReadDir(datadir); err == nil && len(files) > 0 {
+		return nil, fmt.Errorf("cannot restore into non-empty data directory %s", datadir)
+	}
+
+	if _, err := InitData(datadir); err != nil {
+		return nil, err
+	}
+
+	snapshot := func(manifest *BackupManifest, name string, r io.Reader) (bool, error) {
+		if manifest.Store != u.Type {
+			return false, nil
+		}
+		return true, restoreSnapshotFile(u, name, r)
+	}
+
+	var store Store
+	open := func(snapshot bool) error {
+		if store, err = InitDB(dburi); err != nil {
+			return err
+		}
+		if snapshot {
+			return nil
+		}
+		return checkEmpty()
+	}
+
+	res, err := restoreArchive(r, snapshot, open)
+
+	if store != nil {
+		if err := store.Close(); err != nil {
+			log.Errorf("error closing store %s: %s", dburi, err)
+		}
+	}
+
+	return res, err
+}
+
+// RestoreJobs restores the jobs and data of a backup archive into the store
+// and data of a running server. The store must not have any jobs yet.
+func RestoreJobs(r io.Reader) (*RestoreResult, error) {
+	return restoreArchive(r, nil, func(bool) error { return checkEmpty() })
+}
+
+func checkEmpty() error {
+	jobs, err := db.All()
+	if err != nil {
+		return err
+	}
+	if len(jobs) > 0 {
+		return fmt.Errorf("%w: cannot restore into a store with %d jobs", ErrStoreNotEmpty, len(jobs))
+	}
+	return nil
+}
+
+// restoreSnapshotFile writes a file of a store snapshot to where the store
+// at u expects it
+func restoreSnapshotFile(u *URI, name string, r io.Reader) error {
+	var path string
+	switch u.Type {
+	case "bolt", "sqlite":
+		path = u.Path
+	case "bitcask":
+		path = filepath.Join(u.Path, filepath.Base(name))
+	default:
+		return fmt.Errorf("cannot restore a snapshot into a %s store", u.Type)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// restoreArchive reads a backup archive restoring the files of the store's
+// snapshot with snapshot (if not nil), then opening the store with open and
+// restoring or reindexing the jobs and finally restoring the data.
+func restoreArchive(r io.Reader, snapshot func(*BackupManifest, string, io.Reader) (bool, error), open func(snapshot bool) error) (*RestoreResult, error) {
+	tr := tar.NewReader(r)
+
+	hdr, err := tr.Next()
+	if err != nil {
+		log.Errorf("error reading backup: %s", err)
+		return nil, err
+	}
+	if hdr.Name != backupManifest {
+		return nil, fmt.Errorf("invalid backup: expected %s got %s", backupManifest, hdr.Name)
+	}
+
+	var manifest BackupManifest
+	if err := json.NewDecoder(tr).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("invalid backup manifest: %s", err)
+	}
+	if manifest.Version > BackupVersion {
+		return nil, fmt.Errorf("unsupported backup version %d", manifest.Version)
+	}
+
+	res := &RestoreResult{Manifest: &manifest}
+	opened := false
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			log.Errorf("error reading backup: %s", err)
+			return nil, err
+		}
+
+		switch {
+		case strings.HasPrefix(hdr.Name, backupStore):
+			if snapshot == nil {
+				continue
+			}
+			ok, err := snapshot(&manifest, strings.TrimPrefix(hdr.Name, backupStore), tr)
+			if err != nil {
+				log.Errorf("error restoring %s: %s", hdr.Name, err)
+				return nil, err
+			}
+			res.Snapshot = res.Snapshot || ok
+		case hdr.Name == backupJobs:
+			if err := open(res.Snapshot); err != nil {
+				return nil, err
+			}
+			opened = true
+
+			if res.Snapshot {
+				res.Jobs, err = Reindex()
+			} else {
+				res.Jobs, err = restoreJobs(tr)
+			}
+			if err != nil {
+				return nil, err
+			}
+		case strings.HasPrefix(hdr.Name, backupData):
+			if !opened {
+				return nil, fmt.Errorf("invalid backup: %s before %s", hdr.Name, backupJobs)
+			}
+			if err := restoreData(strings.TrimPrefix(hdr.Name, backupData), tr); err != nil {
+				log.Errorf("error restoring %s: %s", hdr.Name, err)
+				return nil, err
+			}
+			res.Files++
+		default:
+			log.Warnf("ignoring unknown file %s in backup", hdr.Name)
+		}
+	}
+
+	if !opened {
+		return nil, fmt.Errorf("invalid backup: missing %s", backupJobs)
+	}
+
+	if res.Interrupted, err = interruptJobs(); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// interruptJobs marks the restored jobs that were still active when backed
+// up as errored, along with a line in their logs saying why, returning how
+// many there were
+func interruptJobs() (int, error) {
+	jobs, err := db.All()
+	if err != nil {
+		log.Errorf("error fetching restored jobs: %s", err)
+		return 0, err
+	}
+
+	n := 0
+	for _, job := range jobs {
+		job.Lock()
+		if !job.interrupt("it was still active when backed up") {
+			job.Unlock()
+			continue
+		}
+		err := db.Save(job)
+		job.Unlock()
+		if err != nil {
+			log.Errorf("error saving job #%d: %s", job.ID, err)
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// restoreJobs saves every job in a stream of JSON encoded jobs
+func restoreJobs(r io.Reader) (int, error) {
+	n := 0
+	dec := json.NewDecoder(bufio.NewReader(r))
+	for {
+		var job Job
+		if err := dec.Decode(&job); err == io.EOF {
+			return n, nil
+		} else if err != nil {
+			log.Errorf("error decoding job: %s", err)
+			return n, err
+		}
+
+		job.done = make(chan bool, 1)
+		job.reason = "restored"
+		if err := db.Save(&job); err != nil {
+			return n, err
+		}
+		n++
+	}
+}
+
+// restoreData writes a data file named <id>.<type> of a backup, or a file
+// of a job named <id>.<kind>/<name>
+func restoreData(name string, r io.Reader) error {
+	if parts := strings.SplitN(name, "/", 2); len(parts) == 2 {
+		return restoreJobFile(parts[0], parts[1], r)
+	}
+
+	ext := filepath.Ext(name)
+	id := ParseId(strings.TrimSuffix(name, ext))
+	if id == ID(0) {
+		return fmt.Errorf("invalid data file name %s", name)
+	}
+
+	dtype := DataType(-1)
+	for _, t := range dataTypes {
+		if strings.TrimPrefix(ext, ".") == t.String() {
+			dtype = t
+		}
+	}
+	if dtype < 0 {
+		return fmt.Errorf("invalid data file name %s", name)
+	}
+
+	w, err := data.Write(id, dtype)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(w, r); err != nil {
+		w.Close()
+		return err
+	}
+
+	return w.Close()
+}
+
+// restoreJobFile writes the file name of a job from the directory
+// <id>.<kind> of a backup
+func restoreJobFile(dir, name string, r io.Reader) error {
+	ext := filepath.Ext(dir)
+	id := ParseId(strings.TrimSuffix(dir, ext))
+	if id == ID(0) || !validArtifactName(name) {
+		return fmt.Errorf("invalid data file name %s/%s", dir, name)
+	}
+
+	var write func(ID, string) (io.WriteCloser, error)
+	switch ext {
+	case ".artifacts":
+		write = data.WriteArtifact
+	case ".inputs":
+		write = data.WriteInputFile
+	default:
+		return fmt.Errorf("invalid data file name %s/%s", dir, name)
+	}
+
+	w, err := write(id, name)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(w, r); err != nil {
+		w.Close()
+		return err
+	}
+
+	return w.Close()
+}
@@ -0,0 +1,221 @@
+package je
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// withGlobals restores the global store and data once the test finishes.
+// Jobs still running on the test server would be saved in whatever store is
+// global when they finish so it waits for them first.
+func withGlobals(t *testing.T) {
+	for i := 0; ; i++ {
+		jobs, err := db.All()
+		require.NoError(t, err)
+
+		active := false
+		for _, job := range jobs {
+			job.RLock()
+			active = active || !job.State.Done()
+			job.RUnlock()
+		}
+		if !active {
+			break
+		}
+		require.True(t, i < 100, "timed out waiting for jobs to finish")
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	store, dir := db, data
+	t.Cleanup(func() {
+		db, data = store, dir
+	})
+}
+
+func writeTestData(t *testing.T, id ID, dtype DataType, s string) {
+	w, err := data.Write(id, dtype)
+	require.NoError(t, err)
+	_, err = w.Write([]byte(s))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+}
+
+func readTestData(t *testing.T, id ID, dtype DataType) string {
+	r, err := data.Read(id, dtype)
+	require.NoError(t, err)
+	defer r.Close()
+	buf, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	return string(buf)
+}
+
+// backupTestStore creates a store with a few jobs and their data and
+// returns a backup of it
+func backupTestStore(t *testing.T, dburi string) []byte {
+	tmpdir := t.TempDir()
+
+	_, err := InitData(filepath.Join(tmpdir, "data"))
+	require.NoError(t, err)
+	store, err := InitDB(dburi)
+	require.NoError(t, err)
+	defer store.Close()
+
+	for _, name := range []string{"foo", "bar", "baz"} {
+		job := &Job{ID: db.NextId(), Name: name, State: STATE_STOPPED}
+		if name == "baz" {
+			job.State = STATE_RUNNING
+		}
+		writeTestData(t, job.ID, DATA_INPUT, "input of "+name)
+		writeTestData(t, job.ID, DATA_OUTPUT, "output of "+name)
+
+		artifact := "report of " + name
+		w, err := data.WriteArtifact(job.ID, "reports/"+name+".txt")
+		require.NoError(t, err)
+		_, err = io.WriteString(w, artifact)
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+		job.Artifacts = []Artifact{{Name: "reports/" + name + ".txt", Size: int64(len(artifact))}}
+
+		file := "config of " + name
+		w, err = data.WriteInputFile(job.ID, name+".conf")
+		require.NoError(t, err)
+		_, err = io.WriteString(w, file)
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+		job.InputFiles = []Artifact{{Name: name + ".conf", Size: int64(len(file))}}
+		require.NoError(t, db.Save(job))
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, Backup(&buf, true))
+	return buf.Bytes()
+}
+
+func TestBackupRestore(t *testing.T) {
+	tests := []struct {
+		name     string
+		from     string
+		to       string
+		snapshot bool
+	}{
+		{"Bolt", "bolt://%s/je.db", "bolt://%s/je.db", true},
+		{"Bitcask", "bitcask://%s/je.db", "bitcask://%s/je.db", true},
+		{"SQLite", "sqlite://%s/je.db", "sqlite://%s/je.db", true},
+		{"BoltToSQLite", "bolt://%s/je.db", "sqlite://%s/je.db", false},
+		{"SQLiteToBitcask", "sqlite://%s/je.db", "bitcask://%s/je.db", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withGlobals(t)
+			assert := assert.New(t)
+
+			archive := backupTestStore(t, fmt.Sprintf(test.from, t.TempDir()))
+
+			tmpdir := t.TempDir()
+			dburi := fmt.Sprintf(test.to, tmpdir)
+			datadir := filepath.Join(tmpdir, "data")
+
+			res, err := Restore(bytes.NewReader(archive), dburi, datadir)
+			require.NoError(t, err)
+			assert.Equal(test.snapshot, res.Snapshot)
+			assert.Equal(3, res.Jobs)
+			assert.Equal(12, res.Files)
+			assert.Equal(1, res.Interrupted)
+			assert.Equal(3, res.Manifest.Jobs)
+
+			store, err := InitDB(dburi)
+			require.NoError(t, err)
+			defer store.Close()
+
+			jobs, err := store.All()
+			require.NoError(t, err)
+			sort.Slice(jobs, func(i, j int) bool { return jobs[i].ID < jobs[j].ID })
+			require.Len(t, jobs, 3)
+			assert.Equal(STATE_STOPPED, jobs[0].State)
+			assert.Equal(STATE_ERRORED, jobs[2].State, "running when backed up")
+			assert.Contains(readTestData(t, jobs[2].ID, DATA_LOGS), "interrupted")
+			for i, name := range []string{"foo", "bar", "baz"} {
+				assert.Equal(name, jobs[i].Name)
+				assert.Equal("input of "+name, readTestData(t, jobs[i].ID, DATA_INPUT))
+				assert.Equal("output of "+name, readTestData(t, jobs[i].ID, DATA_OUTPUT))
+
+				r, err := data.ReadArtifact(jobs[i].ID, "reports/"+name+".txt")
+				require.NoError(t, err)
+				buf, err := ioutil.ReadAll(r)
+				r.Close()
+				require.NoError(t, err)
+				assert.Equal("report of "+name, string(buf))
+
+				r, err = data.ReadInputFile(jobs[i].ID, name+".conf")
+				require.NoError(t, err)
+				buf, err = ioutil.ReadAll(r)
+				r.Close()
+				require.NoError(t, err)
+				assert.Equal("config of "+name, string(buf))
+			}
+
+			// Restored stores keep allocating ids after the restored jobs
+			assert.Equal(jobs[2].ID+1, store.NextId())
+
+			_, err = Restore(bytes.NewReader(archive), dburi, datadir)
+			assert.Error(err)
+		})
+	}
+}
+
+func TestRestoreNotEmpty(t *testing.T) {
+	withGlobals(t)
+	assert := assert.New(t)
+
+	archive := backupTestStore(t, fmt.Sprintf("bolt://%s/je.db", t.TempDir()))
+
+	_, err := InitData(t.TempDir())
+	require.NoError(t, err)
+	store, err := InitDB("memory://")
+	require.NoError(t, err)
+	defer store.Close()
+
+	require.NoError(t, db.Save(&Job{ID: db.NextId(), Name: "existing"}))
+
+	_, err = RestoreJobs(bytes.NewReader(archive))
+	assert.True(errors.Is(err, ErrStoreNotEmpty))
+}
+
+func TestBackupHandler(t *testing.T) {
+	assert := assert.New(t)
+
+	res, err := http.Get("http://127.0.0.1:8000/admin/backup")
+	require.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(http.StatusOK, res.StatusCode)
+	assert.Equal("application/x-tar", res.Header.Get("Content-Type"))
+
+	tr := tar.NewReader(res.Body)
+	hdr, err := tr.Next()
+	require.NoError(t, err)
+	assert.Equal(backupManifest, hdr.Name)
+
+	// The test server's store always has jobs by now
+	require.NoError(t, db.Save(&Job{ID: db.NextId(), Name: "existing", State: STATE_STOPPED}))
+
+	var buf bytes.Buffer
+	require.NoError(t, Backup(&buf, false))
+
+	res, err = http.Post("http://127.0.0.1:8000/admin/restore", "application/x-tar", &buf)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(http.StatusConflict, res.StatusCode)
+}
@@ -1,38 +1,99 @@
 package je
 
 import (
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"path"
-	"time"
+	"path/filepath"
+	"sync"
 
 	log "github.com/sirupsen/logrus"
 
-	"github.com/blevesearch/bleve"
 	"github.com/prologic/bitcask"
 
 	"github.com/prologic/je/codec"
-	"github.com/prologic/je/codec/json"
+)
+
+var (
+	// nextIdKey is the key of the last allocated job ID
+	nextIdKey = []byte("nextid")
+
+	// errStopScan stops a scan of the keys early
+	errStopScan = errors.New("stop scan")
 )
 
 type BitcaskStore struct {
+	sync.Mutex // guards nextid
+
+	// events serializes recording events as bitcask has no transactions
+	events sync.Mutex
+
+	// snapshot is held by writers and exclusively while snapshotting
+	snapshot sync.RWMutex
+
+	path   string
 	db     *bitcask.Bitcask
-	nextid *IdGenerator
-	index  bleve.Index
+	nextid ID
+	index  *Indexer
 	codec  codec.MarshalUnmarshaler
 }
 
 func (store *BitcaskStore) Close() error {
+	if err := store.index.Close(); err != nil {
+		log.Errorf("error closing index: %s", err)
+	}
 	return store.db.Close()
 }
 
+// NextId allocates the next ID persisting it so that IDs are not reused
+// when the store is reopened
 func (store *BitcaskStore) NextId() ID {
-	return ID(0)
+	store.snapshot.RLock()
+	defer store.snapshot.RUnlock()
+
+	store.Lock()
+	defer store.Unlock()
+
+	id := store.nextid + 1
+	if err := store.db.Put(nextIdKey, id.Bytes()); err != nil {
+		log.Errorf("error generating new job id: %s", err)
+		return ID(0)
+	}
+
+	store.nextid = id
+	return id
+}
+
+// reserveId ensures NextId never returns id, e.g. when restoring jobs
+func (store *BitcaskStore) reserveId(id ID) error {
+	store.snapshot.RLock()
+	defer store.snapshot.RUnlock()
+
+	store.Lock()
+	defer store.Unlock()
+
+	if id <= store.nextid {
+		return nil
+	}
+
+	if err := store.db.Put(nextIdKey, id.Bytes()); err != nil {
+		log.Errorf("error reserving job id #%d: %s", id, err)
+		return err
+	}
+
+	store.nextid = id
+	return nil
 }
 
 func (store *BitcaskStore) Save(job *Job) error {
 	if job.ID == ID(0) {
-		job.ID = store.nextid.Next()
+		job.ID = store.NextId()
+	} else if err := store.reserveId(job.ID); err != nil {
+		return err
 	}
 
 	val, err := store.codec.Marshal(job)
@@ -43,53 +104,98 @@ func (store *BitcaskStore) Save(job *Job) error {
 
 	key := []byte(fmt.Sprintf("job_%d", job.ID))
 
-	if err := store.db.Put(key, val); err != nil {
+	store.snapshot.RLock()
+	err = store.db.Put(key, val)
+	if err == nil {
+		err = store.appendEvent(job)
+	}
+	store.snapshot.RUnlock()
+	if err != nil {
 		log.Errorf("error saving job: %s", err)
 		return err
 	}
 
-	t := time.Now()
-	store.index.Index(job.ID.String(), job)
-	metrics.Summary("job", "index").Observe(time.Now().Sub(t).Seconds())
+	return store.index.Index(job)
+}
 
-	return nil
+// appendEvent records the event of saving job if its state changed
+func (store *BitcaskStore) appendEvent(job *Job) error {
+	store.events.Lock()
+	defer store.events.Unlock()
+
+	key := []byte(fmt.Sprintf("events_%d", job.ID))
+
+	buf, err := store.db.Get(key)
+	if err != nil && err != bitcask.ErrKeyNotFound {
+		return err
+	}
+
+	events, err := appendEvent(buf, job)
+	if err != nil || events == nil {
+		return err
+	}
+	return store.db.Put(key, events)
 }
 
-func (store *BitcaskStore) Get(id ID) (job *Job, err error) {
-	key := []byte(fmt.Sprintf("job_%s", id))
+func (store *BitcaskStore) Delete(id ID) error {
+	key := []byte(fmt.Sprintf("job_%d", id))
+	if !store.db.Has(key) {
+		return &KeyError{id, ErrNotExist}
+	}
+
+	store.snapshot.RLock()
+	err := store.db.Delete(key)
+	if err == nil {
+		err = store.db.Delete([]byte(fmt.Sprintf("events_%d", id)))
+	}
+	store.snapshot.RUnlock()
+	if err != nil {
+		log.Errorf("error deleting job #%d: %s", id, err)
+		return err
+	}
+
+	return store.index.Delete(id)
+}
+
+func (store *BitcaskStore) Get(id ID) (*Job, error) {
+	key := []byte(fmt.Sprintf("job_%d", id))
 	val, err := store.db.Get(key)
 	if err != nil {
 		if err == bitcask.ErrKeyNotFound {
 			log.Errorf("job #%d not found", id)
-			err = &KeyError{id, ErrNotExist}
-			return
+			return nil, &KeyError{id, ErrNotExist}
 		}
 		log.Errorf("error feteching job #%d : %s", id, err)
-		return
+		return nil, err
 	}
 
-	err = store.codec.Unmarshal(val, &job)
-	if err != nil {
-		log.Errorf("error deserializing job #%s: %s", id, err)
-		return
+	var job Job
+	if err := store.codec.Unmarshal(val, &job); err != nil {
+		log.Errorf("error deserializing job #%d: %s", id, err)
+		return nil, err
 	}
 
-	return
+	return &job, nil
 }
 
 func (store *BitcaskStore) Find(ids ...ID) (jobs []*Job, err error) {
-	jobs = make([]*Job, len(ids))
-	for i, id := range ids {
+	for _, id := range ids {
 		key := []byte(fmt.Sprintf("job_%d", id))
 		val, err := store.db.Get(key)
-		if err != nil {
+		if err == bitcask.ErrKeyNotFound {
+			continue
+		} else if err != nil {
+			log.Errorf("error feteching job #%d : %s", id, err)
 			return nil, err
 		}
 
-		if err := store.codec.Unmarshal(val, &jobs[i]); err != nil {
-			log.Errorf("error deserializing job #%s: %s", id, err)
+		var job Job
+		if err := store.codec.Unmarshal(val, &job); err != nil {
+			log.Errorf("error deserializing job #%d: %s", id, err)
 			return nil, err
 		}
+
+		jobs = append(jobs, &job)
 	}
 	return
 }
@@ -115,54 +221,191 @@ func (store *BitcaskStore) All() (jobs []*Job, err error) {
 	return
 }
 
-func (store *BitcaskStore) Search(q string) (jobs []*Job, err error) {
-	size, err := store.index.DocCount()
+func (store *BitcaskStore) Events(id ID) ([]*JobEvent, error) {
+	buf, err := store.db.Get([]byte(fmt.Sprintf("events_%d", id)))
+	if err != nil && err != bitcask.ErrKeyNotFound {
+		log.Errorf("error fetching events of job #%d: %s", id, err)
+		return nil, err
+	}
+
+	events, err := decodeEvents(buf)
 	if err != nil {
-		log.Errorf("error getting index size: %s", err)
-		return
+		log.Errorf("error deserializing events of job #%d: %s", id, err)
+		return nil, err
 	}
+	return events, nil
+}
+
+func (store *BitcaskStore) indexer() *Indexer {
+	return store.index
+}
 
-	query := bleve.NewQueryStringQuery(q)
-	req := bleve.NewSearchRequestOptions(query, int(size), 0, false)
-	res, err := store.index.Search(req)
+func (store *BitcaskStore) Search(q string, options *SearchOptions) (*SearchResult, error) {
+	ids, res, err := store.index.Search(q, options)
 	if err != nil {
-		log.Errorf("error performing index search %s: %s", q, err)
-		return
+		return nil, err
 	}
 
-	var ids []ID
-	for _, hit := range res.Hits {
-		ids = append(ids, ParseId(hit.ID))
+	res.Jobs, err = store.Find(ids...)
+	if err != nil {
+		return nil, err
 	}
 
-	jobs, err = store.Find(ids...)
+	return res, nil
+}
 
-	return
+// Snapshot implements Snapshotter. Writes are blocked while the datafiles are
+// merged, so that the order they are loaded in when restored does not
+// matter, and copied. The index file is rebuilt from them when restored.
+func (store *BitcaskStore) Snapshot(fn func(name string, size int64, r io.Reader) error) error {
+	store.snapshot.Lock()
+	defer store.snapshot.Unlock()
+
+	if err := store.db.Merge(); err != nil {
+		log.Errorf("error merging datafiles: %s", err)
+		return err
+	}
+
+	if err := store.db.Sync(); err != nil {
+		log.Errorf("error syncing datafiles: %s", err)
+		return err
+	}
+
+	files, err := ioutil.ReadDir(store.path)
+	if err != nil {
+		return err
+	}
+
+	for _, fi := range files {
+		if fi.IsDir() || fi.Name() == "lock" || fi.Name() == "index" {
+			continue
+		}
+
+		f, err := os.Open(filepath.Join(store.path, fi.Name()))
+		if err != nil {
+			return err
+		}
+		err = fn(fi.Name(), fi.Size(), f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (store *BitcaskStore) Codec() codec.MarshalUnmarshaler {
+	return store.codec
+}
+
+// Recode implements Recoder. Bitcask has no transactions so an interrupted
+// recode leaves some jobs in each codec; recoding again completes it.
+func (store *BitcaskStore) Recode(to codec.MarshalUnmarshaler) (int, error) {
+	store.snapshot.RLock()
+	defer store.snapshot.RUnlock()
+
+	var keys [][]byte
+	err := store.db.Scan([]byte("job_"), func(key []byte) error {
+		keys = append(keys, append([]byte{}, key...))
+		return nil
+	})
+	if err != nil {
+		log.Errorf("error scanning jobs: %s", err)
+		return 0, err
+	}
+
+	for _, key := range keys {
+		val, err := store.db.Get(key)
+		if err != nil {
+			log.Errorf("error fetching job %s : %s", string(key), err)
+			return 0, err
+		}
+
+		buf, err := recodeJob(val, store.codec, to)
+		if err != nil {
+			log.Errorf("error recoding job %s: %s", string(key), err)
+			return 0, err
+		}
+
+		if err := store.db.Put(key, buf); err != nil {
+			log.Errorf("error saving job %s: %s", string(key), err)
+			return 0, err
+		}
+	}
+
+	if err := store.setMeta("codec", to.Name()); err != nil {
+		log.Errorf("error recording codec: %s", err)
+		return 0, err
+	}
+
+	store.codec = to
+	return len(keys), nil
+}
+
+func (store *BitcaskStore) getMeta(key string) (string, error) {
+	val, err := store.db.Get([]byte("meta_" + key))
+	if err == bitcask.ErrKeyNotFound {
+		return "", nil
+	}
+	return string(val), err
 }
 
-func NewBitcaskStore(dbpath string) (Store, error) {
+func (store *BitcaskStore) setMeta(key, value string) error {
+	return store.db.Put([]byte("meta_"+key), []byte(value))
+}
+
+func (store *BitcaskStore) empty() (bool, error) {
+	empty := true
+	err := store.db.Scan([]byte("job_"), func(key []byte) error {
+		empty = false
+		return errStopScan
+	})
+	if err != nil && err != errStopScan {
+		return false, err
+	}
+	return empty, nil
+}
+
+func NewBitcaskStore(dbpath string, options *StoreOptions) (Store, error) {
+	if options == nil {
+		options = &StoreOptions{}
+	}
+
 	db, err := bitcask.Open(dbpath)
 	if err != nil {
 		log.Errorf("error opening store %s: %s", dbpath, err)
 		return nil, err
 	}
 
-	var index bleve.Index
-	indexpath := path.Join(path.Dir(dbpath), "index.db")
-	if _, err = os.Stat(indexpath); err == nil {
-		index, err = bleve.Open(indexpath)
-	} else {
-		index, err = bleve.New(indexpath, bleve.NewIndexMapping())
+	var nextid ID
+	if buf, err := db.Get(nextIdKey); err == nil {
+		nextid = ID(binary.BigEndian.Uint64(buf))
+	} else if err != bitcask.ErrKeyNotFound {
+		log.Errorf("error reading next job id from %s: %s", dbpath, err)
+		return nil, err
+	}
+
+	store := &BitcaskStore{path: dbpath, db: db, nextid: nextid}
+
+	empty, err := store.empty()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	store.codec, err = openCodec(store, options.Codec, empty)
+	if err != nil {
+		log.Errorf("error opening store %s: %s", dbpath, err)
+		db.Close()
+		return nil, err
 	}
+
+	store.index, err = NewIndexer(options.indexPath(path.Join(path.Dir(dbpath), "index.db")))
 	if err != nil {
-		log.Errorf("error creating index: %s", err)
+		db.Close()
 		return nil, err
 	}
 
-	return &BitcaskStore{
-		db:     db,
-		nextid: &IdGenerator{},
-		index:  index,
-		codec:  json.Codec,
-	}, nil
+	return store, nil
 }
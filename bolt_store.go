@@ -1,32 +1,53 @@
 package je
 
 import (
-	"os"
+	"encoding/binary"
+	"io"
 	"path"
-	"time"
+	"path/filepath"
 
 	log "github.com/sirupsen/logrus"
 
-	"github.com/blevesearch/bleve"
 	bolt "go.etcd.io/bbolt"
 
 	"github.com/prologic/je/codec"
-	"github.com/prologic/je/codec/json"
 )
 
 type BoltStore struct {
-	db     *bolt.DB
-	nextid *IdGenerator
-	index  bleve.Index
-	codec  codec.MarshalUnmarshaler
+	db    *bolt.DB
+	index *Indexer
+	codec codec.MarshalUnmarshaler
 }
 
 func (store *BoltStore) Close() error {
+	if err := store.index.Close(); err != nil {
+		log.Errorf("error closing index: %s", err)
+	}
 	return store.db.Close()
 }
 
+// NextId allocates the next ID from the sequence of the jobs bucket which is
+// also used to allocate IDs of jobs saved without one
 func (store *BoltStore) NextId() ID {
-	return ID(0)
+	var id uint64
+
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte("jobs"))
+		if err != nil {
+			log.Errorf("error creating jobs bucket: %s", err)
+			return err
+		}
+
+		id, err = b.NextSequence()
+		return err
+	})
+
+	if err != nil {
+		log.Errorf("error generating new job id: %s", err)
+		return ID(0)
+	}
+
+	return ID(id)
 }
 
 func (store *BoltStore) Save(job *Job) error {
@@ -44,6 +65,12 @@ func (store *BoltStore) Save(job *Job) error {
 				return err
 			}
 			job.ID = ID(id)
+		} else if uint64(job.ID) > b.Sequence() {
+			// Reserve IDs of jobs saved with one, e.g. when restoring
+			if err := b.SetSequence(uint64(job.ID)); err != nil {
+				log.Errorf("error reserving job id #%d: %s", job.ID, err)
+				return err
+			}
 		}
 
 		buf, err := store.codec.Marshal(job)
@@ -53,7 +80,25 @@ func (store *BoltStore) Save(job *Job) error {
 		}
 
 		key := job.ID.Bytes()
-		return b.Put(key, buf)
+		if err := b.Put(key, buf); err != nil {
+			return err
+		}
+
+		eb, err := tx.CreateBucketIfNotExists([]byte("events"))
+		if err != nil {
+			log.Errorf("error creating events bucket: %s", err)
+			return err
+		}
+
+		events, err := appendEvent(eb.Get(key), job)
+		if err != nil {
+			log.Errorf("error recording event for job #%d: %s", job.ID, err)
+			return err
+		}
+		if events == nil {
+			return nil
+		}
+		return eb.Put(key, events)
 	})
 
 	if err != nil {
@@ -61,11 +106,37 @@ func (store *BoltStore) Save(job *Job) error {
 		return err
 	}
 
-	t := time.Now()
-	store.index.Index(job.ID.String(), job)
-	metrics.Summary("job", "index").Observe(time.Now().Sub(t).Seconds())
+	return store.index.Index(job)
+}
+
+func (store *BoltStore) Delete(id ID) error {
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("jobs"))
+		if b == nil {
+			return &KeyError{id, ErrNotExist}
+		}
+
+		key := id.Bytes()
+		if b.Get(key) == nil {
+			return &KeyError{id, ErrNotExist}
+		}
+
+		if err := b.Delete(key); err != nil {
+			return err
+		}
+
+		if eb := tx.Bucket([]byte("events")); eb != nil {
+			return eb.Delete(key)
+		}
+		return nil
+	})
+
+	if err != nil {
+		log.Errorf("error deleting job #%d: %s", id, err)
+		return err
+	}
 
-	return nil
+	return store.index.Delete(id)
 }
 
 func (store *BoltStore) Get(id ID) (*Job, error) {
@@ -74,7 +145,7 @@ func (store *BoltStore) Get(id ID) (*Job, error) {
 	err := store.db.View(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte("jobs"))
 		if b == nil {
-			return nil
+			return &KeyError{id, ErrNotExist}
 		}
 
 		key := id.Bytes()
@@ -87,14 +158,18 @@ func (store *BoltStore) Get(id ID) (*Job, error) {
 
 		err := store.codec.Unmarshal(buf, &job)
 		if err != nil {
-			log.Errorf("error deserializing job #%s: %s", id, err)
+			log.Errorf("error deserializing job #%d: %s", id, err)
 			return err
 		}
 
 		return nil
 	})
 
-	return &job, err
+	if err != nil {
+		return nil, err
+	}
+
+	return &job, nil
 }
 
 func (store *BoltStore) Find(ids ...ID) (jobs []*Job, err error) {
@@ -108,9 +183,13 @@ func (store *BoltStore) Find(ids ...ID) (jobs []*Job, err error) {
 			var job Job
 			key := id.Bytes()
 			buf := b.Get(key)
+			if buf == nil {
+				continue
+			}
+
 			err := store.codec.Unmarshal(buf, &job)
 			if err != nil {
-				log.Errorf("error deserializing job #%s: %s", id, err)
+				log.Errorf("error deserializing job #%d: %s", id, err)
 				return err
 			}
 
@@ -129,7 +208,7 @@ func (store *BoltStore) All() (jobs []*Job, err error) {
 			return nil
 		}
 
-		b.ForEach(func(k, v []byte) error {
+		return b.ForEach(func(k, v []byte) error {
 			var job Job
 			err := store.codec.Unmarshal(v, &job)
 			if err != nil {
@@ -140,60 +219,166 @@ func (store *BoltStore) All() (jobs []*Job, err error) {
 			jobs = append(jobs, &job)
 			return nil
 		})
-		return nil
 	})
 
 	return
 }
 
-func (store *BoltStore) Search(q string) (jobs []*Job, err error) {
-	size, err := store.index.DocCount()
+func (store *BoltStore) Events(id ID) (events []*JobEvent, err error) {
+	err = store.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("events"))
+		if b == nil {
+			return nil
+		}
+
+		events, err = decodeEvents(b.Get(id.Bytes()))
+		if err != nil {
+			log.Errorf("error deserializing events of job #%d: %s", id, err)
+		}
+		return err
+	})
+
+	return
+}
+
+func (store *BoltStore) indexer() *Indexer {
+	return store.index
+}
+
+func (store *BoltStore) Search(q string, options *SearchOptions) (*SearchResult, error) {
+	ids, res, err := store.index.Search(q, options)
 	if err != nil {
-		log.Errorf("error getting index size: %s", err)
-		return
+		return nil, err
 	}
 
-	query := bleve.NewQueryStringQuery(q)
-	req := bleve.NewSearchRequestOptions(query, int(size), 0, false)
-	res, err := store.index.Search(req)
+	res.Jobs, err = store.Find(ids...)
 	if err != nil {
-		log.Errorf("error performing index search %s: %s", q, err)
-		return
+		return nil, err
 	}
 
-	var ids []ID
-	for _, hit := range res.Hits {
-		ids = append(ids, ParseId(hit.ID))
+	return res, nil
+}
+
+// Snapshot implements Snapshotter writing the database in a read transaction
+func (store *BoltStore) Snapshot(fn func(name string, size int64, r io.Reader) error) error {
+	return store.db.View(func(tx *bolt.Tx) error {
+		pr, pw := io.Pipe()
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			_, err := tx.WriteTo(pw)
+			pw.CloseWithError(err)
+		}()
+
+		err := fn(filepath.Base(store.db.Path()), tx.Size(), pr)
+		pr.CloseWithError(io.ErrClosedPipe)
+		<-done
+		return err
+	})
+}
+
+func (store *BoltStore) Codec() codec.MarshalUnmarshaler {
+	return store.codec
+}
+
+// Recode implements Recoder rewriting all jobs in a single transaction
+func (store *BoltStore) Recode(to codec.MarshalUnmarshaler) (n int, err error) {
+	err = store.db.Update(func(tx *bolt.Tx) error {
+		if b := tx.Bucket([]byte("jobs")); b != nil {
+			c := b.Cursor()
+			for k, v := c.First(); k != nil; k, v = c.Next() {
+				buf, err := recodeJob(v, store.codec, to)
+				if err != nil {
+					log.Errorf("error recoding job #%d: %s", binary.BigEndian.Uint64(k), err)
+					return err
+				}
+				if err := b.Put(k, buf); err != nil {
+					return err
+				}
+				n++
+			}
+		}
+
+		b, err := tx.CreateBucketIfNotExists([]byte("meta"))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("codec"), []byte(to.Name()))
+	})
+
+	if err != nil {
+		log.Errorf("error recoding jobs: %s", err)
+		return 0, err
 	}
 
-	jobs, err = store.Find(ids...)
+	store.codec = to
+	return n, nil
+}
+
+func (store *BoltStore) getMeta(key string) (value string, err error) {
+	err = store.db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket([]byte("meta")); b != nil {
+			value = string(b.Get([]byte(key)))
+		}
+		return nil
+	})
+	return
+}
+
+func (store *BoltStore) setMeta(key, value string) error {
+	return store.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte("meta"))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(key), []byte(value))
+	})
+}
 
+func (store *BoltStore) empty() (empty bool, err error) {
+	err = store.db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket([]byte("jobs")); b != nil {
+			k, _ := b.Cursor().First()
+			empty = k == nil
+		} else {
+			empty = true
+		}
+		return nil
+	})
 	return
 }
 
-func NewBoltStore(dbpath string) (Store, error) {
+func NewBoltStore(dbpath string, options *StoreOptions) (Store, error) {
+	if options == nil {
+		options = &StoreOptions{}
+	}
+
 	db, err := bolt.Open(dbpath, 0644, &bolt.Options{})
 	if err != nil {
 		log.Errorf("error opening store %s: %s", dbpath, err)
 		return nil, err
 	}
 
-	var index bleve.Index
-	indexpath := path.Join(path.Dir(dbpath), "index.db")
-	if _, err = os.Stat(indexpath); err == nil {
-		index, err = bleve.Open(indexpath)
-	} else {
-		index, err = bleve.New(indexpath, bleve.NewIndexMapping())
+	store := &BoltStore{db: db}
+
+	empty, err := store.empty()
+	if err != nil {
+		db.Close()
+		return nil, err
 	}
+
+	store.codec, err = openCodec(store, options.Codec, empty)
+	if err != nil {
+		log.Errorf("error opening store %s: %s", dbpath, err)
+		db.Close()
+		return nil, err
+	}
+
+	store.index, err = NewIndexer(options.indexPath(path.Join(path.Dir(dbpath), "index.db")))
 	if err != nil {
-		log.Errorf("error creating index: %s", err)
+		db.Close()
 		return nil, err
 	}
 
-	return &BoltStore{
-		db:     db,
-		nextid: &IdGenerator{},
-		index:  index,
-		codec:  json.Codec,
-	}, nil
+	return store, nil
 }
@@ -0,0 +1,134 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/prologic/je"
+)
+
+// Backup writes a backup archive of the server's store and, if withData is
+// true, the data of every job to w
+func (c *Client) Backup(w io.Writer, withData bool) error {
+	url := fmt.Sprintf("%s/admin/backup", c.url)
+	if withData {
+		url += "?data=1"
+	}
+
+	response, err := http.Get(url)
+	if err != nil {
+		log.Errorf("error sending request to %s: %s", url, err)
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected response %s from GET %s", response.Status, url)
+	}
+
+	if _, err := io.Copy(w, response.Body); err != nil {
+		log.Errorf("error reading backup from %s: %s", url, err)
+		return err
+	}
+
+	return nil
+}
+
+// Restore restores a backup archive into the server's store which must not
+// have any jobs yet
+func (c *Client) Restore(r io.Reader) (*je.RestoreResult, error) {
+	url := fmt.Sprintf("%s/admin/restore", c.url)
+
+	response, err := http.Post(url, "application/x-tar", r)
+	if err != nil {
+		log.Errorf("error sending request to %s: %s", url, err)
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, responseError(response, "POST", url)
+	}
+
+	var res je.RestoreResult
+	if err := json.NewDecoder(response.Body).Decode(&res); err != nil {
+		log.Errorf("error decoding response from %s: %s", url, err)
+		return nil, err
+	}
+
+	return &res, nil
+}
+
+// CheckIndex reports whether the server's search index is consistent with
+// its store
+func (c *Client) CheckIndex() (*je.IndexCheck, error) {
+	url := fmt.Sprintf("%s/admin/index", c.url)
+
+	response, err := http.Get(url)
+	if err != nil {
+		log.Errorf("error sending request to %s: %s", url, err)
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, responseError(response, "GET", url)
+	}
+
+	var check je.IndexCheck
+	if err := json.NewDecoder(response.Body).Decode(&check); err != nil {
+		log.Errorf("error decoding response from %s: %s", url, err)
+		return nil, err
+	}
+
+	return &check, nil
+}
+
+// Reindex rebuilds the server's search index from its store. If wait is
+// true it returns the number of jobs reindexed once done, otherwise the
+// index is rebuilt in the background and -1 is returned.
+func (c *Client) Reindex(wait bool) (int, error) {
+	url := fmt.Sprintf("%s/admin/reindex", c.url)
+	if wait {
+		url += "?wait=1"
+	}
+
+	response, err := http.Post(url, "", nil)
+	if err != nil {
+		log.Errorf("error sending request to %s: %s", url, err)
+		return 0, err
+	}
+	defer response.Body.Close()
+
+	switch response.StatusCode {
+	case http.StatusAccepted:
+		return -1, nil
+	case http.StatusOK:
+	default:
+		return 0, responseError(response, "POST", url)
+	}
+
+	var res struct {
+		Jobs int `json:"jobs"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&res); err != nil {
+		log.Errorf("error decoding response from %s: %s", url, err)
+		return 0, err
+	}
+
+	return res.Jobs, nil
+}
+
+// responseError returns the error of an unsuccessful response
+func responseError(response *http.Response, method, url string) error {
+	var e je.APIError
+	if json.NewDecoder(response.Body).Decode(&e) == nil && e.Message != "" {
+		return errors.New(e.Message)
+	}
+	return fmt.Errorf("unexpected response %s from %s %s", response.Status, method, url)
+}
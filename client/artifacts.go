@@ -0,0 +1,61 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/prologic/je"
+)
+
+// Artifacts returns the artifacts collected from a job
+func (c *Client) Artifacts(id string) (artifacts []je.Artifact, err error) {
+	url := fmt.Sprintf("%s%s/jobs/%s/artifacts", c.url, je.APIPrefix, id)
+
+	response, err := http.Get(url)
+	if err != nil {
+		log.Errorf("error sending request to %s: %s", url, err)
+		return
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		err = responseError(response, "GET", url)
+		return
+	}
+
+	err = json.NewDecoder(response.Body).Decode(&artifacts)
+	if err != nil {
+		log.Errorf("error decoding response from %s: %s", url, err)
+		return
+	}
+
+	return
+}
+
+// Artifact returns a reader of an artifact of a job by its name
+func (c *Client) Artifact(id, name string) (io.ReadCloser, error) {
+	parts := strings.Split(name, "/")
+	for i, part := range parts {
+		parts[i] = url.PathEscape(part)
+	}
+	url := fmt.Sprintf("%s%s/jobs/%s/artifacts/%s", c.url, je.APIPrefix, id, strings.Join(parts, "/"))
+
+	response, err := http.Get(url)
+	if err != nil {
+		log.Errorf("error sending request to %s: %s", url, err)
+		return nil, err
+	}
+
+	if response.StatusCode != http.StatusOK {
+		defer response.Body.Close()
+		return nil, responseError(response, "GET", url)
+	}
+
+	return response.Body, nil
+}
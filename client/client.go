@@ -29,19 +29,33 @@ func NewClient(url string, options *Options) *Client {
 }
 
 func (c *Client) request(method, url string, body io.Reader) (res []*je.Job, err error) {
-	client := &http.Client{}
+	res, _, err = c.do(method, url, body)
+	return
+}
 
+func (c *Client) do(method, url string, body io.Reader) (res []*je.Job, header http.Header, err error) {
 	request, err := http.NewRequest(method, url, body)
 	if err != nil {
 		log.Errorf("error constructing request to %s: %s", url, err)
 		return
 	}
 
+	return c.send(request)
+}
+
+// send sends request returning the jobs in the response
+func (c *Client) send(request *http.Request) (res []*je.Job, header http.Header, err error) {
+	client := &http.Client{}
+	method, url := request.Method, request.URL.String()
+
 	response, err := client.Do(request)
 	if err != nil {
 		log.Errorf("error sending request to %s: %s", url, err)
 		return
 	}
+	defer response.Body.Close()
+
+	header = response.Header
 
 	if response.StatusCode == http.StatusNotFound {
 		return
@@ -1,14 +1,130 @@
 package client
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+
+	log "github.com/sirupsen/logrus"
 
 	"github.com/prologic/je"
 )
 
+// CreateOptions are optional settings of a new job
+type CreateOptions struct {
+	// MaxOutput is the most output and logs kept, e.g. 10MB
+	MaxOutput string
+	// OutputPolicy is what happens once MaxOutput is reached: truncate,
+	// rotate or kill
+	OutputPolicy string
+	// Artifacts are the globs of the files in the working directory of
+	// the job to keep as its artifacts
+	Artifacts []string
+	// Combined records the output and logs of the job interleaved in its
+	// combined log
+	Combined bool
+	// StdinFrom is the id of the job whose output is the input of the job
+	StdinFrom string
+	// Files are the files to copy into the working directory of the job
+	// by their name there, a relative path with / as separator, and path
+	Files map[string]string
+}
+
+// query returns the options as query parameters to append to a url
+func (o *CreateOptions) query() string {
+	if o == nil {
+		return ""
+	}
+
+	var s string
+	if o.MaxOutput != "" {
+		s += "&max_output=" + url.QueryEscape(o.MaxOutput)
+	}
+	if o.OutputPolicy != "" {
+		s += "&output_policy=" + url.QueryEscape(o.OutputPolicy)
+	}
+	for _, pattern := range o.Artifacts {
+		s += "&artifact=" + url.QueryEscape(pattern)
+	}
+	if o.Combined {
+		s += "&combined=1"
+	}
+	if o.StdinFrom != "" {
+		s += "&stdin_from=" + url.QueryEscape(o.StdinFrom)
+	}
+	return s
+}
+
+// form returns a reader of a multipart/form-data body with input as its
+// stdin part and each of files as a part named after it and its content
+// type. The definition of a pipeline, if any, is its first part.
+func form(pipeline *je.PipelineRequest, input io.Reader, files map[string]string) (io.Reader, string) {
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+
+	go func() {
+		err := writeForm(mw, pipeline, input, files)
+		if err == nil {
+			err = mw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	return pr, mw.FormDataContentType()
+}
+
+func writeForm(mw *multipart.Writer, pipeline *je.PipelineRequest, input io.Reader, files map[string]string) error {
+	if pipeline != nil {
+		w, err := mw.CreateFormField(je.PIPELINE_PART)
+		if err != nil {
+			return err
+		}
+		if err := json.NewEncoder(w).Encode(pipeline); err != nil {
+			return err
+		}
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		f, err := os.Open(files[name])
+		if err != nil {
+			return err
+		}
+		w, err := mw.CreateFormFile(name, filepath.Base(files[name]))
+		if err == nil {
+			_, err = io.Copy(w, f)
+		}
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	if input != nil {
+		w, err := mw.CreateFormFile(je.STDIN_PART, je.STDIN_PART)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(w, input); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Create ...
-func (c *Client) Create(name string, args []string, input io.Reader, interactive, wait bool) (res []*je.Job, err error) {
+func (c *Client) Create(name string, args []string, input io.Reader, interactive, wait bool, options *CreateOptions) (res []*je.Job, err error) {
 
 	url := fmt.Sprintf("%s/create/%s?args=%s", c.url, name, JoinArgs(args))
 
@@ -20,5 +136,20 @@ func (c *Client) Create(name string, args []string, input io.Reader, interactive
 		url += "&wait=1"
 	}
 
-	return c.request("POST", url, input)
+	url += options.query()
+
+	if options == nil || len(options.Files) == 0 {
+		return c.request("POST", url, input)
+	}
+
+	body, contentType := form(nil, input, options.Files)
+	request, err := http.NewRequest("POST", url, body)
+	if err != nil {
+		log.Errorf("error constructing request to %s: %s", url, err)
+		return
+	}
+	request.Header.Set("Content-Type", contentType)
+
+	res, _, err = c.send(request)
+	return
 }
@@ -0,0 +1,43 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/prologic/je"
+)
+
+// Delete deletes a completed job and its data
+func (c *Client) Delete(id string) (err error) {
+	url := fmt.Sprintf("%s%s/jobs/%s", c.url, je.APIPrefix, id)
+	client := &http.Client{}
+
+	request, err := http.NewRequest("DELETE", url, nil)
+	if err != nil {
+		log.Errorf("error constructing request to %s: %s", url, err)
+		return
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		log.Errorf("error sending request to %s: %s", url, err)
+		return
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusNoContent {
+		var e je.APIError
+		if json.NewDecoder(response.Body).Decode(&e) == nil && e.Message != "" {
+			err = errors.New(e.Message)
+		} else {
+			err = fmt.Errorf("unexpected response %s from DELETE %s", response.Status, url)
+		}
+		return
+	}
+
+	return
+}
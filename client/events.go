@@ -0,0 +1,72 @@
+package client
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/prologic/je"
+)
+
+// Events returns the state transitions of a job in the order they happened
+func (c *Client) Events(id string) (events []*je.JobEvent, err error) {
+	url := fmt.Sprintf("%s%s/jobs/%s/events", c.url, je.APIPrefix, id)
+
+	response, err := http.Get(url)
+	if err != nil {
+		log.Errorf("error sending request to %s: %s", url, err)
+		return
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		err = responseError(response, "GET", url)
+		return
+	}
+
+	err = json.NewDecoder(response.Body).Decode(&events)
+	if err != nil {
+		log.Errorf("error decoding response from %s: %s", url, err)
+		return
+	}
+
+	return
+}
+
+// FollowEvents calls fn with each state transition of a job as it happens
+// until the job is done
+func (c *Client) FollowEvents(id string, fn func(event *je.JobEvent)) error {
+	url := fmt.Sprintf("%s%s/jobs/%s/events?follow=1", c.url, je.APIPrefix, id)
+
+	response, err := http.Get(url)
+	if err != nil {
+		log.Errorf("error sending request to %s: %s", url, err)
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return responseError(response, "GET", url)
+	}
+
+	s := bufio.NewScanner(response.Body)
+	for s.Scan() {
+		line := s.Text()
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+
+		var event je.JobEvent
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event); err != nil {
+			log.Errorf("error decoding event from %s: %s", url, err)
+			return err
+		}
+		fn(&event)
+	}
+
+	return s.Err()
+}
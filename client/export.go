@@ -0,0 +1,73 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/prologic/je"
+)
+
+// Export writes the jobs matching the query q (or all jobs if empty) to w as
+// JSON Lines including, if withData is true, their input, output and logs
+func (c *Client) Export(w io.Writer, q string, withData bool) error {
+	qs := url.Values{}
+	if q != "" {
+		qs.Set("q", q)
+	}
+	if withData {
+		qs.Set("data", "1")
+	}
+
+	url := fmt.Sprintf("%s/export?%s", c.url, qs.Encode())
+
+	response, err := http.Get(url)
+	if err != nil {
+		log.Errorf("error sending request to %s: %s", url, err)
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return responseError(response, "GET", url)
+	}
+
+	if _, err := io.Copy(w, response.Body); err != nil {
+		log.Errorf("error reading export from %s: %s", url, err)
+		return err
+	}
+
+	return nil
+}
+
+// Import loads jobs written by Export into the server's store. Jobs already
+// in the store are skipped unless renumber is true.
+func (c *Client) Import(r io.Reader, renumber bool) (*je.ImportResult, error) {
+	url := fmt.Sprintf("%s/import", c.url)
+	if renumber {
+		url += "?renumber=1"
+	}
+
+	response, err := http.Post(url, "application/x-ndjson", r)
+	if err != nil {
+		log.Errorf("error sending request to %s: %s", url, err)
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, responseError(response, "POST", url)
+	}
+
+	var res je.ImportResult
+	if err := json.NewDecoder(response.Body).Decode(&res); err != nil {
+		log.Errorf("error decoding response from %s: %s", url, err)
+		return nil, err
+	}
+
+	return &res, nil
+}
@@ -0,0 +1,138 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/prologic/je"
+)
+
+var (
+	// FollowRetries is how many times in a row following the output or
+	// logs of a job reconnects after losing its connection
+	FollowRetries = 10
+
+	// FollowRetryDelay is how long to wait before reconnecting
+	FollowRetryDelay = time.Second
+)
+
+// FollowReader reads the output or logs of a job as they are written until
+// the job is done. If the connection is lost before the server signals that
+// the job is done with the X-Job-State trailer it reconnects and resumes from
+// the offset it got to.
+type FollowReader struct {
+	url      string
+	offset   int64
+	retries  int
+	response *http.Response
+
+	state  string
+	status int
+}
+
+func newFollowReader(url string) (*FollowReader, error) {
+	r := &FollowReader{url: url}
+	if err := r.connect(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *FollowReader) connect() error {
+	url := fmt.Sprintf("%s&offset=%d", r.url, r.offset)
+
+	response, err := http.Get(url)
+	if err != nil {
+		log.Errorf("error sending request to %s: %s", url, err)
+		return err
+	}
+
+	if response.StatusCode != http.StatusOK {
+		defer response.Body.Close()
+		return responseError(response, "GET", url)
+	}
+
+	r.response = response
+	return nil
+}
+
+func (r *FollowReader) Read(p []byte) (int, error) {
+	for {
+		if r.response == nil {
+			if err := r.connect(); err != nil {
+				if r.retries++; r.retries > FollowRetries {
+					return 0, err
+				}
+				time.Sleep(FollowRetryDelay)
+				continue
+			}
+		}
+
+		n, err := r.response.Body.Read(p)
+		r.offset += int64(n)
+		if n > 0 {
+			r.retries = 0
+			return n, nil
+		}
+		if err == nil {
+			continue
+		}
+
+		r.response.Body.Close()
+		if err == io.EOF {
+			if state := r.response.Trailer.Get("X-Job-State"); state != "" {
+				r.state = state
+				r.status, _ = strconv.Atoi(r.response.Trailer.Get("X-Job-Status"))
+				return 0, io.EOF
+			}
+			err = io.ErrUnexpectedEOF
+		}
+		r.response = nil
+
+		log.Warnf("lost connection following %s at offset %d, reconnecting: %s", r.url, r.offset, err)
+		if r.retries++; r.retries > FollowRetries {
+			return 0, err
+		}
+		time.Sleep(FollowRetryDelay)
+	}
+}
+
+// State returns the state of the job, e.g. STOPPED, once Read has returned
+// io.EOF or "" before then
+func (r *FollowReader) State() string {
+	return r.state
+}
+
+// Status returns the exit status of the job once Read has returned io.EOF
+func (r *FollowReader) Status() int {
+	return r.status
+}
+
+// ExitCode returns the exit code a command following a job should exit with
+// once Read has returned io.EOF: the exit status of the job if it stopped,
+// 137 (128 + SIGKILL) if it was killed and 1 if it errored
+func (r *FollowReader) ExitCode() int {
+	switch r.state {
+	case je.STATE_STOPPED.String():
+		if r.status < 0 || r.status > 255 {
+			return 1
+		}
+		return r.status
+	case je.STATE_KILLED.String():
+		return 137
+	default:
+		return 1
+	}
+}
+
+func (r *FollowReader) Close() error {
+	if r.response != nil {
+		return r.response.Body.Close()
+	}
+	return nil
+}
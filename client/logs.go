@@ -4,20 +4,29 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 
 	log "github.com/sirupsen/logrus"
+
+	"github.com/prologic/je"
 )
 
 // Logs ...
+//
+// If follow is true the logs are read as they are written until the job is
+// done with a *FollowReader which gives the job's exit status once done.
 func (c *Client) Logs(id string, follow bool) (r io.Reader, err error) {
-	var url string
-
+	// Following resumes from where it got to if the connection is lost
 	if follow {
-		url = fmt.Sprintf("%s/logs/%s?follow=1", c.url, id)
-	} else {
-		url = fmt.Sprintf("%s/logs/%s", c.url, id)
+		fr, err := newFollowReader(fmt.Sprintf("%s/logs/%s?follow=1", c.url, id))
+		if err != nil {
+			return nil, err
+		}
+		return fr, nil
 	}
 
+	url := fmt.Sprintf("%s/logs/%s", c.url, id)
+
 	client := &http.Client{}
 
 	request, err := http.NewRequest("GET", url, nil)
@@ -34,3 +43,31 @@ func (c *Client) Logs(id string, follow bool) (r io.Reader, err error) {
 
 	return response.Body, nil
 }
+
+// Combined calls fn with each entry of the combined log of a job, its output
+// and logs interleaved as they were written, written since the given time or
+// duration ago if since is not empty. If follow is true new entries are
+// passed to fn as they are written.
+func (c *Client) Combined(id, since string, follow bool, fn func(entry *je.CombinedEntry) error) error {
+	qs := url.Values{"format": {"json"}}
+	if since != "" {
+		qs.Set("since", since)
+	}
+	if follow {
+		qs.Set("follow", "1")
+	}
+	url := fmt.Sprintf("%s%s/jobs/%s/combined?%s", c.url, je.APIPrefix, id, qs.Encode())
+
+	response, err := http.Get(url)
+	if err != nil {
+		log.Errorf("error sending request to %s: %s", url, err)
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return responseError(response, "GET", url)
+	}
+
+	return je.ReadCombined(response.Body, nil, fn)
+}
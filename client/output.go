@@ -9,15 +9,21 @@ import (
 )
 
 // Output ...
+//
+// If follow is true the output are read as they are written until the job is
+// done with a *FollowReader which gives the job's exit status once done.
 func (c *Client) Output(id string, follow bool) (r io.Reader, err error) {
-	var url string
-
+	// Following resumes from where it got to if the connection is lost
 	if follow {
-		url = fmt.Sprintf("%s/output/%s?follow=1", c.url, id)
-	} else {
-		url = fmt.Sprintf("%s/output/%s", c.url, id)
+		fr, err := newFollowReader(fmt.Sprintf("%s/output/%s?follow=1", c.url, id))
+		if err != nil {
+			return nil, err
+		}
+		return fr, nil
 	}
 
+	url := fmt.Sprintf("%s/output/%s", c.url, id)
+
 	client := &http.Client{}
 
 	request, err := http.NewRequest("GET", url, nil)
@@ -0,0 +1,56 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/prologic/je"
+)
+
+// Pipe creates a pipeline running each of stages, a name followed by its
+// arguments, with input as the input of its first stage. The files and
+// stdin from of the options are given to the first stage and the others to
+// the last.
+func (c *Client) Pipe(stages [][]string, input io.Reader, wait bool, options *CreateOptions) (pipeline *je.Pipeline, err error) {
+	req := &je.PipelineRequest{}
+	for _, stage := range stages {
+		req.Stages = append(req.Stages, je.PipelineStage{Name: stage[0], Args: stage[1:]})
+	}
+
+	qs := options.query()
+	if wait {
+		qs += "&wait=1"
+	}
+	url := fmt.Sprintf("%s%s/pipelines?%s", c.url, je.APIPrefix, strings.TrimPrefix(qs, "&"))
+
+	var files map[string]string
+	if options != nil {
+		files = options.Files
+	}
+	body, contentType := form(req, input, files)
+
+	response, err := http.Post(url, contentType, body)
+	if err != nil {
+		log.Errorf("error sending request to %s: %s", url, err)
+		return
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusCreated {
+		err = responseError(response, "POST", url)
+		return
+	}
+
+	err = json.NewDecoder(response.Body).Decode(&pipeline)
+	if err != nil {
+		log.Errorf("error decoding response from %s: %s", url, err)
+		return
+	}
+
+	return
+}
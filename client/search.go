@@ -2,6 +2,10 @@ package client
 
 import (
 	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/prologic/je"
 )
@@ -11,27 +15,128 @@ type SearchFilter struct {
 	ID    string
 	Name  string
 	State string
+
+	// Since and Until restrict jobs to those created in the given range
+	Since time.Time
+	Until time.Time
+
+	// MinDuration and MaxDuration restrict jobs to those that ran for at
+	// least and at most the given durations
+	MinDuration time.Duration
+	MaxDuration time.Duration
+
+	// Status restricts jobs to those that exited with the given status
+	Status *int
+}
+
+// Query returns the query string of the filter (excluding the ID)
+func (f *SearchFilter) Query() string {
+	var terms []string
+
+	if f.Name != "" {
+		terms = append(terms, "+name:"+je.QuoteTerm(f.Name))
+	}
+	if f.State != "" {
+		terms = append(terms, fmt.Sprintf("+state:%d", je.ParseState(f.State)))
+	}
+	if !f.Since.IsZero() {
+		terms = append(terms, fmt.Sprintf("+created:>=%q", f.Since.Format(time.RFC3339Nano)))
+	}
+	if !f.Until.IsZero() {
+		terms = append(terms, fmt.Sprintf("+created:<%q", f.Until.Format(time.RFC3339Nano)))
+	}
+	if f.MinDuration > 0 {
+		terms = append(terms, fmt.Sprintf("+duration:>=%g", f.MinDuration.Seconds()))
+	}
+	if f.MaxDuration > 0 {
+		terms = append(terms, fmt.Sprintf("+duration:<=%g", f.MaxDuration.Seconds()))
+	}
+	if f.Status != nil {
+		terms = append(terms, fmt.Sprintf("+status:%d", *f.Status))
+	}
+
+	return strings.Join(terms, " ")
 }
 
 // SearchOptions ...
 type SearchOptions struct {
 	Filter *SearchFilter
+
+	// Limit is the maximum number of jobs to return (0 for no limit)
+	Limit int
+	// Offset is the number of matching jobs to skip
+	Offset int
+	// Cursor continues a previous search from the Next cursor of a Page
+	Cursor string
+	// Sort is one of created, started, stopped, duration, status or state
+	Sort string
+	// Order is either asc or desc
+	Order string
+}
+
+// Page is a page of search results
+type Page struct {
+	Jobs []*je.Job
+	// Total is the number of matching jobs across all pages
+	Total uint64
+	// Next is the cursor of the next page or empty if this is the last page
+	Next string
 }
 
 // Search ...
 func (c *Client) Search(options *SearchOptions) (res []*je.Job, err error) {
-	url := fmt.Sprintf("%s/search", c.url)
+	page, err := c.SearchPage(options)
+	if err != nil {
+		return nil, err
+	}
+	return page.Jobs, nil
+}
+
+// SearchPage performs a search returning a single page of results
+func (c *Client) SearchPage(options *SearchOptions) (*Page, error) {
+	u := fmt.Sprintf("%s/search", c.url)
+
+	qs := url.Values{}
+
+	if filter := options.Filter; filter != nil {
+		if filter.ID != "" {
+			u += fmt.Sprintf("/%s", filter.ID)
+		} else if q := filter.Query(); q != "" {
+			qs.Set("q", q)
+		}
+	}
+
+	if options.Limit > 0 {
+		qs.Set("limit", strconv.Itoa(options.Limit))
+	}
+	if options.Offset > 0 {
+		qs.Set("offset", strconv.Itoa(options.Offset))
+	}
+	if options.Cursor != "" {
+		qs.Set("cursor", options.Cursor)
+	}
+	if options.Sort != "" {
+		qs.Set("sort", options.Sort)
+	}
+	if options.Order != "" {
+		qs.Set("order", options.Order)
+	}
+
+	if len(qs) > 0 {
+		u += "?" + qs.Encode()
+	}
 
-	filter := options.Filter
+	res, header, err := c.do("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
 
-	switch {
-	case filter.ID != "":
-		url += fmt.Sprintf("/%s", filter.ID)
-	case filter.Name != "":
-		url += fmt.Sprintf("?q=name:%s", filter.Name)
-	case filter.State != "":
-		url += fmt.Sprintf("?q=state:%d", je.ParseState(filter.State))
+	page := &Page{Jobs: res, Next: header.Get("X-Next-Cursor")}
+	if total := header.Get("X-Total-Count"); total != "" {
+		page.Total, _ = strconv.ParseUint(total, 10, 64)
+	} else {
+		page.Total = uint64(len(res))
 	}
 
-	return c.request("GET", url, nil)
+	return page, nil
 }
@@ -0,0 +1,48 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/prologic/je"
+)
+
+// Stats returns statistics over jobs matching the query q (or all jobs if
+// empty) with a histogram of jobs created over the given number of hours
+func (c *Client) Stats(q string, hours int) (stats *je.Stats, err error) {
+	qs := url.Values{}
+	if q != "" {
+		qs.Set("q", q)
+	}
+	if hours > 0 {
+		qs.Set("hours", strconv.Itoa(hours))
+	}
+
+	url := fmt.Sprintf("%s/stats?%s", c.url, qs.Encode())
+
+	response, err := http.Get(url)
+	if err != nil {
+		log.Errorf("error sending request to %s: %s", url, err)
+		return
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		err = fmt.Errorf("unexpected response %s from GET %s", response.Status, url)
+		log.Error(err)
+		return
+	}
+
+	err = json.NewDecoder(response.Body).Decode(&stats)
+	if err != nil {
+		log.Errorf("error decoding response from %s: %s", url, err)
+		return
+	}
+
+	return
+}
@@ -6,6 +6,7 @@ import (
 	"os"
 	"os/signal"
 	"runtime"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 
@@ -24,17 +25,55 @@ func main() {
 		bind    string
 		threads int
 		backlog int
+
+		indexData int64
+
+		maxOutput    string
+		outputPolicy string
+
+		compress string
+
+		encryptionKeys string
+
+		scratchDir string
+
+		retention    je.RetentionPolicies
+		reapInterval time.Duration
 	)
 
 	flag.BoolVar(&version, "v", false, "display version information")
 	flag.BoolVar(&debug, "d", false, "enable debug logging")
 
-	flag.StringVar(&datadir, "datadir", "./data", "data directory")
+	flag.StringVar(&datadir, "datadir", "./data", "data directory or s3://bucket/prefix uri")
 	flag.StringVar(&dburi, "dburi", "memory://", "database to use")
 	flag.StringVar(&bind, "bind", "0.0.0.0:8000", "[int]:<port> to bind to")
 	flag.IntVar(&threads, "threads", runtime.NumCPU(), "worker threads")
 	flag.IntVar(&backlog, "backlog", runtime.NumCPU()*2, "backlog size")
 
+	flag.Int64Var(&indexData, "index-data", 0, "max bytes of job output and logs to index (0 to disable)")
+
+	flag.StringVar(&maxOutput, "max-output", "", "max bytes of output and of logs kept per job, e.g. 100MB (empty for no limit)")
+	flag.StringVar(&outputPolicy, "output-policy", string(je.OUTPUT_TRUNCATE), "what to do when a job reaches -max-output: truncate, rotate or kill")
+
+	flag.StringVar(&compress, "compress", "", "compress the output and logs of jobs once done: zstd, gzip or none (unencrypted local data only)")
+
+	flag.StringVar(&encryptionKeys, "encryption-keys", "", "keyfile of <id>:<base64 key> to encrypt job data with, the first key encrypts (default $JE_ENCRYPTION_KEYS)")
+
+	flag.StringVar(&scratchDir, "scratch-dir", je.ScratchDir, "directory the working directories of jobs are created in")
+
+	flag.Var(&retention, "retention", "retention policy [name=<name>,][state=<state>,][max-age=<duration>,][max-count=<n>] (may be repeated)")
+	flag.DurationVar(&reapInterval, "reap-interval", je.DefaultReapInterval, "how often to enforce retention policies")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] [command]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Commands:\n")
+		fmt.Fprintf(os.Stderr, "  migrate <codec>    rewrite all jobs in the store with another codec\n")
+		fmt.Fprintf(os.Stderr, "  reindex            rebuild the search index from the store\n")
+		fmt.Fprintf(os.Stderr, "  restore <archive>  restore a backup into a new store and data directory\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		flag.PrintDefaults()
+	}
+
 	flag.Parse()
 
 	if debug {
@@ -48,6 +87,52 @@ func main() {
 		os.Exit(0)
 	}
 
+	metrics := je.InitMetrics("je")
+
+	je.IndexDataLimit = indexData
+	je.ScratchDir = scratchDir
+
+	outputLimit, err := je.ParseOutputLimit(maxOutput, outputPolicy)
+	if err != nil {
+		log.Errorf("error parsing output limit: %s", err)
+		os.Exit(2)
+	}
+	je.DefaultOutputLimit = *outputLimit
+
+	je.DataCompression, err = je.ParseCompression(compress)
+	if err != nil {
+		log.Errorf("error parsing compression: %s", err)
+		os.Exit(2)
+	}
+
+	je.DataKeys, err = je.LoadKeyring(encryptionKeys)
+	if err != nil {
+		log.Errorf("error loading encryption keys: %s", err)
+		os.Exit(2)
+	}
+
+	if flag.NArg() > 0 {
+		var err error
+
+		switch flag.Arg(0) {
+		case "migrate":
+			err = migrate(dburi, flag.Args()[1:])
+		case "reindex":
+			err = reindex(dburi, datadir, flag.Args()[1:])
+		case "restore":
+			err = restore(dburi, datadir, flag.Args()[1:])
+		default:
+			flag.Usage()
+			os.Exit(2)
+		}
+
+		if err != nil {
+			log.Errorf("error running %s: %s", flag.Arg(0), err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
 	if debug {
 		go professor.Launch(":6060")
 	}
@@ -58,9 +143,7 @@ func main() {
 		Backlog: backlog,
 	}
 
-	metrics := je.InitMetrics("je")
-
-	_, err := je.InitData(datadir)
+	_, err = je.InitData(datadir)
 	if err != nil {
 		log.Errorf("error initializing data storage: %s", err)
 		os.Exit(1)
@@ -73,6 +156,18 @@ func main() {
 	}
 	defer db.Close()
 
+	// Rebuild the search index in the background if it was lost or is
+	// otherwise out of sync with the store
+	go func() {
+		if _, err := je.RepairIndex(); err != nil {
+			log.Errorf("error repairing search index: %s", err)
+		}
+	}()
+
+	reaper := je.NewReaper(retention, reapInterval)
+	go reaper.Run()
+	defer reaper.Stop()
+
 	server := je.NewServer(bind, opts)
 	server.AddRoute("GET", "/metrics", metrics.Handler())
 
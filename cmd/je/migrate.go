@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/prologic/je"
+)
+
+// migrate rewrites every job in the store at dburi with another codec. The
+// daemon must not be running while migrating.
+func migrate(dburi string, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: je [-dburi <uri>] migrate <codec>")
+	}
+
+	to, err := je.ParseCodec(args[0])
+	if err != nil {
+		return err
+	}
+
+	db, err := je.InitDB(dburi)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	recoder, ok := db.(je.Recoder)
+	if !ok {
+		return fmt.Errorf("store %s does not support codecs", dburi)
+	}
+
+	from := recoder.Codec()
+	if from.Name() == to.Name() {
+		log.Infof("store %s already uses the %s codec", dburi, to.Name())
+		return nil
+	}
+
+	n, err := recoder.Recode(to)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("migrated %d jobs from %s to %s", n, from.Name(), to.Name())
+	return nil
+}
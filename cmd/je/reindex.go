@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/prologic/je"
+)
+
+// reindex rebuilds the search index of the store at dburi, including the
+// data in datadir if -index-data is given. The daemon must not be running
+// while reindexing; use job admin reindex instead.
+func reindex(dburi, datadir string, args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("usage: je [-dburi <uri>] [-datadir <dir>] reindex")
+	}
+
+	if _, err := je.InitData(datadir); err != nil {
+		return err
+	}
+
+	db, err := je.InitDB(dburi)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	n, err := je.Reindex()
+	if err != nil {
+		return err
+	}
+
+	log.Infof("reindexed %d jobs", n)
+	return nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/prologic/je"
+)
+
+// restore restores a backup archive into a new store and data directory
+func restore(dburi, datadir string, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: je [-dburi <uri>] [-datadir <dir>] restore <archive>")
+	}
+
+	var r io.Reader = os.Stdin
+	if args[0] != "-" {
+		f, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	res, err := je.Restore(r, dburi, datadir)
+	if err != nil {
+		return err
+	}
+
+	how := "saved"
+	if res.Snapshot {
+		how = "snapshot"
+	}
+
+	log.Infof(
+		"restored %d jobs (%s) and %d data files from a %s backup of %s",
+		res.Jobs, how, res.Files, res.Manifest.Store, res.Manifest.Created,
+	)
+	if res.Interrupted > 0 {
+		log.Warnf("%d jobs were still active when backed up and are restored as errored", res.Interrupted)
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/prologic/je/client"
+)
+
+// adminCmd represents the admin command
+var adminCmd = &cobra.Command{
+	Use:   "admin",
+	Short: "Administer the server",
+	Long: `This groups commands that administer the server such as backups and
+rebuilding the search index.`,
+}
+
+// backupCmd represents the admin backup command
+var backupCmd = &cobra.Command{
+	Use:   "backup [flags]",
+	Short: "Backup the server's store",
+	Long: `This writes a backup archive (tar) of the server's store to a file or
+standard output. With -d/--data the input, output, logs, artifacts and
+input files of every job are included too. The archive can be restored with "job admin restore" or, into
+a fresh data directory, "je restore".`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		uri := viper.GetString("uri")
+		client := client.NewClient(uri, nil)
+
+		withData, err := cmd.Flags().GetBool("data")
+		if err != nil {
+			log.Errorf("error getting -d/--data flag: %s", err)
+			os.Exit(1)
+		}
+
+		output, err := cmd.Flags().GetString("output")
+		if err != nil {
+			log.Errorf("error getting -o/--output flag: %s", err)
+			os.Exit(1)
+		}
+
+		os.Exit(backup(client, output, withData))
+	},
+}
+
+// restoreCmd represents the admin restore command
+var restoreCmd = &cobra.Command{
+	Use:   "restore [flags] <archive>",
+	Short: "Restore a backup into the server's store",
+	Long: `This restores the jobs and data in a backup archive, or standard input
+if the archive is -, into the server's store which must not have any jobs.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		uri := viper.GetString("uri")
+		client := client.NewClient(uri, nil)
+
+		os.Exit(restore(client, args[0]))
+	},
+}
+
+// reindexCmd represents the admin reindex command
+var reindexCmd = &cobra.Command{
+	Use:   "reindex [flags]",
+	Short: "Rebuild the server's search index",
+	Long: `This rebuilds the server's search index from its store in the background.
+With -w/--wait it waits for the index to be rebuilt. With -c/--check it only
+reports whether the index is consistent with the store and exits non-zero if
+it is not.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		uri := viper.GetString("uri")
+		client := client.NewClient(uri, nil)
+
+		check, err := cmd.Flags().GetBool("check")
+		if err != nil {
+			log.Errorf("error getting -c/--check flag: %s", err)
+			os.Exit(1)
+		}
+
+		wait, err := cmd.Flags().GetBool("wait")
+		if err != nil {
+			log.Errorf("error getting -w/--wait flag: %s", err)
+			os.Exit(1)
+		}
+
+		if check {
+			os.Exit(checkIndex(client))
+		}
+		os.Exit(reindex(client, wait))
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(adminCmd)
+	adminCmd.AddCommand(backupCmd)
+	adminCmd.AddCommand(restoreCmd)
+	adminCmd.AddCommand(reindexCmd)
+
+	reindexCmd.Flags().BoolP(
+		"check", "c", false,
+		"Only check whether the index is consistent with the store",
+	)
+
+	reindexCmd.Flags().BoolP(
+		"wait", "w", false,
+		"Wait for the index to be rebuilt",
+	)
+
+	backupCmd.Flags().BoolP(
+		"data", "d", false,
+		"Include the input, output, logs, artifacts and input files of every job",
+	)
+
+	backupCmd.Flags().StringP(
+		"output", "o", "-",
+		"File to write the backup to (- for standard output)",
+	)
+}
+
+func backup(c *client.Client, output string, withData bool) int {
+	var w io.Writer = os.Stdout
+
+	if output != "-" {
+		f, err := os.Create(output)
+		if err != nil {
+			log.Errorf("error creating %s: %s", output, err)
+			return 1
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if err := c.Backup(w, withData); err != nil {
+		log.Errorf("error backing up: %s", err)
+		return 1
+	}
+
+	return 0
+}
+
+func restore(c *client.Client, archive string) int {
+	var r io.Reader = os.Stdin
+
+	if archive != "-" {
+		f, err := os.Open(archive)
+		if err != nil {
+			log.Errorf("error opening %s: %s", archive, err)
+			return 1
+		}
+		defer f.Close()
+		r = f
+	}
+
+	res, err := c.Restore(r)
+	if err != nil {
+		log.Errorf("error restoring %s: %s", archive, err)
+		return 1
+	}
+
+	fmt.Printf("restored %d jobs and %d data files\n", res.Jobs, res.Files)
+	if res.Interrupted > 0 {
+		fmt.Printf("%d jobs were still active when backed up and are restored as errored\n", res.Interrupted)
+	}
+	return 0
+}
+
+func checkIndex(c *client.Client) int {
+	check, err := c.CheckIndex()
+	if err != nil {
+		log.Errorf("error checking index: %s", err)
+		return 1
+	}
+
+	fmt.Printf(
+		"jobs: %d indexed: %d missing: %d stale: %d reindexing: %t\n",
+		check.Jobs, check.Indexed, check.Missing, check.Stale, check.Reindexing,
+	)
+
+	if !check.Consistent() {
+		return 2
+	}
+	return 0
+}
+
+func reindex(c *client.Client, wait bool) int {
+	n, err := c.Reindex(wait)
+	if err != nil {
+		log.Errorf("error rebuilding index: %s", err)
+		return 1
+	}
+
+	if n < 0 {
+		fmt.Println("rebuilding index")
+	} else {
+		fmt.Printf("reindexed %d jobs\n", n)
+	}
+	return 0
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/prologic/je/client"
+)
+
+// artifactsCmd represents the artifacts command
+var artifactsCmd = &cobra.Command{
+	Use:   "artifacts [flags] <id> [<name> ...]",
+	Short: "Lists or downloads the artifacts of a job",
+	Long: `This lists the artifacts collected from the working directory of the
+job given by id once it is done along with their sizes. With -o/--output the
+artifacts, or only those given by name, are downloaded into the given
+directory instead keeping their relative paths.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		uri := viper.GetString("uri")
+		client := client.NewClient(uri, nil)
+
+		output, err := cmd.Flags().GetString("output")
+		if err != nil {
+			log.Errorf("error getting -o/--output flag: %s", err)
+			os.Exit(1)
+		}
+
+		os.Exit(artifacts(client, args[0], args[1:], output))
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(artifactsCmd)
+
+	artifactsCmd.Flags().StringP(
+		"output", "o", "",
+		"Directory to download the artifacts into",
+	)
+}
+
+func artifacts(c *client.Client, id string, names []string, output string) int {
+	res, err := c.Artifacts(id)
+	if err != nil {
+		log.Errorf("error retrieving artifacts of job #%s: %s", id, err)
+		return 1
+	}
+
+	if output == "" {
+		for _, artifact := range res {
+			fmt.Printf("%d\t%s\n", artifact.Size, artifact.Name)
+		}
+		return 0
+	}
+
+	wanted := make(map[string]bool)
+	for _, name := range names {
+		wanted[name] = true
+	}
+
+	for _, artifact := range res {
+		if len(wanted) > 0 && !wanted[artifact.Name] {
+			continue
+		}
+		delete(wanted, artifact.Name)
+
+		path := filepath.Join(output, filepath.FromSlash(artifact.Name))
+		if rel, err := filepath.Rel(output, path); err != nil || strings.HasPrefix(rel, "..") {
+			log.Errorf("invalid artifact name %q", artifact.Name)
+			return 1
+		}
+
+		if err := downloadArtifact(c, id, artifact.Name, path); err != nil {
+			log.Errorf("error downloading artifact %s of job #%s: %s", artifact.Name, id, err)
+			return 1
+		}
+		log.Infof("%s", path)
+	}
+
+	for name := range wanted {
+		log.Errorf("no artifact %s for job #%s", name, id)
+		return 1
+	}
+
+	return 0
+}
+
+func downloadArtifact(c *client.Client, id, name, path string) error {
+	r, err := c.Artifact(id, name)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/prologic/je"
+	"github.com/prologic/je/client"
+)
+
+// eventsCmd represents the events command
+var eventsCmd = &cobra.Command{
+	Use:   "events [flags] <id>",
+	Short: "Display the history of a job",
+	Long: `This displays the state transitions of a job: when it moved from one
+state to another, on which worker and why. With -f/--follow new transitions
+are displayed as they happen until the job is done.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		uri := viper.GetString("uri")
+		client := client.NewClient(uri, nil)
+
+		follow, err := cmd.Flags().GetBool("follow")
+		if err != nil {
+			log.Errorf("error getting -f/--follow flag: %s", err)
+			os.Exit(1)
+		}
+
+		os.Exit(events(client, args[0], follow))
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(eventsCmd)
+
+	eventsCmd.Flags().BoolP(
+		"follow", "f", false,
+		"Follow the job's events until it is done",
+	)
+}
+
+func printEvent(w io.Writer, event *je.JobEvent) {
+	from := "-"
+	if event.From != 0 {
+		from = event.From.String()
+	}
+	fmt.Fprintf(
+		w, "%s\t%s\t%s\t%s\t%s\n",
+		event.At.Local().Format("2006-01-02 15:04:05"), from, event.To, event.Worker, event.Reason,
+	)
+}
+
+func events(c *client.Client, id string, follow bool) int {
+	w := tabwriter.NewWriter(os.Stdout, 10, 4, 3, ' ', 0)
+	fmt.Fprint(w, "AT\tFROM\tTO\tWORKER\tREASON\n")
+
+	if follow {
+		err := c.FollowEvents(id, func(event *je.JobEvent) {
+			printEvent(w, event)
+			w.Flush()
+		})
+		if err != nil {
+			log.Errorf("error following events of job #%s: %s", id, err)
+			return 1
+		}
+		return 0
+	}
+
+	res, err := c.Events(id)
+	if err != nil {
+		log.Errorf("error retrieving events of job #%s: %s", id, err)
+		return 1
+	}
+
+	for _, event := range res {
+		printEvent(w, event)
+	}
+	w.Flush()
+
+	return 0
+}
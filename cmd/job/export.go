@@ -0,0 +1,83 @@
+package main
+
+import (
+	"io"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/prologic/je/client"
+)
+
+// exportCmd represents the export command
+var exportCmd = &cobra.Command{
+	Use:   "export [flags] [<query>]",
+	Short: "Export jobs as JSON Lines",
+	Long: `This writes all jobs, or those matching the given query, as JSON Lines
+(one job per line) to a file or standard output. With -d/--data the input,
+output and logs of each job are included base64 encoded. Exports can be
+loaded into any server with "job import".`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		uri := viper.GetString("uri")
+		client := client.NewClient(uri, nil)
+
+		var q string
+
+		if len(args) == 1 {
+			q = args[0]
+		}
+
+		withData, err := cmd.Flags().GetBool("data")
+		if err != nil {
+			log.Errorf("error getting -d/--data flag: %s", err)
+			os.Exit(1)
+		}
+
+		output, err := cmd.Flags().GetString("output")
+		if err != nil {
+			log.Errorf("error getting -o/--output flag: %s", err)
+			os.Exit(1)
+		}
+
+		os.Exit(export(client, q, output, withData))
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(exportCmd)
+
+	exportCmd.Flags().BoolP(
+		"data", "d", false,
+		"Include the input, output and logs of each job",
+	)
+
+	exportCmd.Flags().StringP(
+		"output", "o", "-",
+		"File to write the jobs to (- for standard output)",
+	)
+}
+
+func export(c *client.Client, q, output string, withData bool) int {
+	var w io.Writer = os.Stdout
+
+	if output != "-" {
+		f, err := os.Create(output)
+		if err != nil {
+			log.Errorf("error creating %s: %s", output, err)
+			return 1
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if err := c.Export(w, q, withData); err != nil {
+		log.Errorf("error exporting jobs: %s", err)
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/prologic/je/client"
+)
+
+// importCmd represents the import command
+var importCmd = &cobra.Command{
+	Use:   "import [flags] [<file>]",
+	Short: "Import jobs from JSON Lines",
+	Long: `This loads jobs written by "job export" from a file or standard input
+into the server's store. Jobs keep their ids and those already in the store
+are skipped unless -r/--renumber is given, which gives every job a new id.
+Renumbered jobs reading the output of, or in a pipeline with, jobs that are
+not imported before them are rejected. Jobs which were still active when
+exported are imported as errored.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		uri := viper.GetString("uri")
+		client := client.NewClient(uri, nil)
+
+		input := "-"
+
+		if len(args) == 1 {
+			input = args[0]
+		}
+
+		renumber, err := cmd.Flags().GetBool("renumber")
+		if err != nil {
+			log.Errorf("error getting -r/--renumber flag: %s", err)
+			os.Exit(1)
+		}
+
+		os.Exit(importJobs(client, input, renumber))
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(importCmd)
+
+	importCmd.Flags().BoolP(
+		"renumber", "r", false,
+		"Give every imported job a new id",
+	)
+}
+
+func importJobs(c *client.Client, input string, renumber bool) int {
+	var r io.Reader = os.Stdin
+
+	if input != "-" {
+		f, err := os.Open(input)
+		if err != nil {
+			log.Errorf("error opening %s: %s", input, err)
+			return 1
+		}
+		defer f.Close()
+		r = f
+	}
+
+	res, err := c.Import(r, renumber)
+	if err != nil {
+		log.Errorf("error importing jobs: %s", err)
+		return 1
+	}
+
+	fmt.Printf("imported %d jobs (%d skipped)\n", res.Imported, res.Skipped)
+	if res.Rejected > 0 {
+		fmt.Printf("%d jobs were rejected as they refer to jobs not imported\n", res.Rejected)
+	}
+	if res.Interrupted > 0 {
+		fmt.Printf("%d jobs were still active when exported and are imported as errored\n", res.Interrupted)
+	}
+	return 0
+}
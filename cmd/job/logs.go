@@ -1,14 +1,17 @@
 package main
 
 import (
+	"fmt"
 	"io"
 	"os"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
+	"github.com/prologic/je"
 	"github.com/prologic/je/client"
 )
 
@@ -17,8 +20,16 @@ var logsCmd = &cobra.Command{
 	Use:     "logs [flags] <id>",
 	Aliases: []string{"log"},
 	Short:   "Retrieves logs for a job",
-	Long:    `This retrives and display the logs for the job given by id`,
-	Args:    cobra.MinimumNArgs(1),
+	Long: `This retrives and display the logs for the job given by id
+
+With -t/--timestamps or --since the output and logs of the job are displayed
+interleaved as they were written, like docker logs, with the output written to
+stdout and the logs to stderr. This needs the job to have been created with
+--combined.
+
+With -f/--follow the logs are displayed as they are written until the job is
+done and the command exits with the job's exit status.`,
+	Args: cobra.MinimumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		uri := viper.GetString("uri")
 		client := client.NewClient(uri, nil)
@@ -31,6 +42,22 @@ var logsCmd = &cobra.Command{
 			os.Exit(1)
 		}
 
+		timestamps, err := cmd.Flags().GetBool("timestamps")
+		if err != nil {
+			log.Errorf("error getting -t/--timestamps flag: %s", err)
+			os.Exit(1)
+		}
+
+		since, err := cmd.Flags().GetString("since")
+		if err != nil {
+			log.Errorf("error getting --since flag: %s", err)
+			os.Exit(1)
+		}
+
+		if timestamps || since != "" {
+			os.Exit(combined(client, id, since, timestamps, follow))
+		}
+
 		os.Exit(logs(client, id, follow))
 	},
 }
@@ -43,16 +70,57 @@ func init() {
 		"Follow logs as it is written to",
 	)
 
+	logsCmd.Flags().BoolP(
+		"timestamps", "t", false,
+		"Show when each line of output and logs was written",
+	)
+
+	logsCmd.Flags().String(
+		"since", "",
+		"Show output and logs written since a duration ago (e.g. 5m) or a timestamp",
+	)
 }
 
-func logs(client *client.Client, id string, follow bool) int {
-	r, err := client.Logs(id, follow)
+func logs(c *client.Client, id string, follow bool) int {
+	r, err := c.Logs(id, follow)
 	if err != nil {
 		log.Errorf("error retrieving logs for job %s: %s", id, err)
 		return 1
 	}
 
-	io.Copy(os.Stdout, r)
+	if _, err := io.Copy(os.Stdout, r); err != nil {
+		log.Errorf("error retrieving logs for job %s: %s", id, err)
+		return 1
+	}
+
+	// Following exits with the job's exit status
+	if fr, ok := r.(*client.FollowReader); ok {
+		return fr.ExitCode()
+	}
+
+	return 0
+}
+
+func combined(client *client.Client, id, since string, timestamps, follow bool) int {
+	err := client.Combined(id, since, follow, func(entry *je.CombinedEntry) error {
+		w := os.Stdout
+		if entry.Stream == je.STREAM_STDERR {
+			w = os.Stderr
+		}
+		if timestamps {
+			fmt.Fprintf(w, "%s ", entry.Time.Local().Format(time.RFC3339Nano))
+		}
+		buf, err := entry.Bytes()
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(buf)
+		return err
+	})
+	if err != nil {
+		log.Errorf("error retrieving combined log for job %s: %s", id, err)
+		return 1
+	}
 
 	return 0
 }
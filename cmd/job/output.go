@@ -18,7 +18,10 @@ var outputCmd = &cobra.Command{
 	Aliases: []string{"out"},
 	Short:   "Retrieve and display job output",
 	Long: `This retrieves and views the job's output. That is the standard
-output of the job.`,
+output of the job.
+
+With -f/--follow the output is displayed as it is written until the job is
+done and the command exits with the job's exit status.`,
 	Args: cobra.MinimumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		uri := viper.GetString("uri")
@@ -45,14 +48,22 @@ func init() {
 	)
 }
 
-func output(client *client.Client, id string, follow bool) int {
-	r, err := client.Output(id, follow)
+func output(c *client.Client, id string, follow bool) int {
+	r, err := c.Output(id, follow)
 	if err != nil {
 		log.Errorf("error retrieving logs for job %s: %s", id, err)
 		return 1
 	}
 
-	io.Copy(os.Stdout, r)
+	if _, err := io.Copy(os.Stdout, r); err != nil {
+		log.Errorf("error retrieving output for job %s: %s", id, err)
+		return 1
+	}
+
+	// Following exits with the job's exit status
+	if fr, ok := r.(*client.FollowReader); ok {
+		return fr.ExitCode()
+	}
 
 	return 0
 }
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/prologic/je/client"
+)
+
+// pipeCmd represents the pipe command
+var pipeCmd = &cobra.Command{
+	Use:   "pipe [flags] <name> [args] -- <name> [args] [-- ...]",
+	Short: "Runs the given jobs as a pipeline",
+	Long: `This runs the jobs given by the provided names and arguments, separated
+by --, as a pipeline where the output of each job is the input of the next one
+as it is written, like a shell pipeline. It waits for every job to complete
+before returning and printing the pipeline and its stages.
+
+Input can also be provided to the first job of the pipeline by passing it on
+standard input. The --file and --stdin-from flags apply to the first job and
+the other job flags to the last one, whose output is that of the pipeline.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		uri := viper.GetString("uri")
+		client := client.NewClient(uri, nil)
+
+		raw, err := cmd.Flags().GetBool("raw")
+		if err != nil {
+			log.Errorf("error getting -r/--raw flag: %s", err)
+			os.Exit(1)
+		}
+
+		detach, err := cmd.Flags().GetBool("detach")
+		if err != nil {
+			log.Errorf("error getting --detach flag: %s", err)
+			os.Exit(1)
+		}
+
+		options, err := createOptions(cmd)
+		if err != nil {
+			log.Errorf("error getting job option flags: %s", err)
+			os.Exit(1)
+		}
+
+		stages, err := splitStages(args)
+		if err != nil {
+			log.Errorf("error parsing pipeline: %s", err)
+			os.Exit(1)
+		}
+
+		stat, _ := os.Stdin.Stat()
+		if (stat.Mode() & os.ModeCharDevice) == 0 {
+			os.Exit(pipe(client, stages, os.Stdin, !detach, raw, options))
+		} else {
+			os.Exit(pipe(client, stages, nil, !detach, raw, options))
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(pipeCmd)
+
+	// Flags after the name of the first job are its arguments
+	pipeCmd.Flags().SetInterspersed(false)
+
+	pipeCmd.Flags().BoolP(
+		"raw", "r", false,
+		"Output the output of the last job only",
+	)
+
+	pipeCmd.Flags().Bool(
+		"detach", false,
+		"Do not wait for the pipeline to complete",
+	)
+
+	createFlags(pipeCmd)
+}
+
+// splitStages splits args into the name and arguments of each stage of a
+// pipeline on --
+func splitStages(args []string) ([][]string, error) {
+	stages := [][]string{nil}
+	for _, arg := range args {
+		if arg == "--" {
+			stages = append(stages, nil)
+			continue
+		}
+		stages[len(stages)-1] = append(stages[len(stages)-1], arg)
+	}
+
+	for i, stage := range stages {
+		if len(stage) == 0 {
+			return nil, fmt.Errorf("stage %d has no name", i+1)
+		}
+	}
+	return stages, nil
+}
+
+func pipe(client *client.Client, stages [][]string, input io.Reader, wait, raw bool, options *client.CreateOptions) int {
+	pipeline, err := client.Pipe(stages, input, wait, options)
+	if err != nil {
+		log.Errorf("error running pipeline: %s", err)
+		return 1
+	}
+
+	if raw {
+		last := pipeline.Stages[len(pipeline.Stages)-1]
+		// Detached pipelines are followed until they are done
+		return output(client, fmt.Sprintf("%d", last.ID), !wait)
+	}
+
+	out, err := json.Marshal(pipeline)
+	if err != nil {
+		log.Errorf("error encoding pipeline: %s", err)
+		return 1
+	}
+	fmt.Println(string(out))
+
+	return 0
+}
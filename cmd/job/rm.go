@@ -0,0 +1,44 @@
+package main
+
+import (
+	"os"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/prologic/je/client"
+)
+
+// rmCmd represents the rm command
+var rmCmd = &cobra.Command{
+	Use:     "rm [flags] <id> [<id>...]",
+	Aliases: []string{"delete", "remove"},
+	Short:   "Delete one or more completed jobs",
+	Long: `This deletes the given completed jobs along with their input, output
+and logs. Jobs that are still active cannot be deleted and must be killed
+first.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		uri := viper.GetString("uri")
+		client := client.NewClient(uri, nil)
+
+		os.Exit(rm(client, args))
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(rmCmd)
+}
+
+func rm(c *client.Client, ids []string) int {
+	status := 0
+	for _, id := range ids {
+		if err := c.Delete(id); err != nil {
+			log.Errorf("error deleting job #%s: %s", id, err)
+			status = 1
+		}
+	}
+	return status
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"strings"
 
 	log "github.com/sirupsen/logrus"
 
@@ -43,11 +45,17 @@ to pass stadard input to the job.`,
 			os.Exit(1)
 		}
 
+		options, err := createOptions(cmd)
+		if err != nil {
+			log.Errorf("error getting job option flags: %s", err)
+			os.Exit(1)
+		}
+
 		stat, _ := os.Stdin.Stat()
 		if (stat.Mode() & os.ModeCharDevice) == 0 {
-			os.Exit(run(client, args[0], args[1:], os.Stdin, interactive, raw))
+			os.Exit(run(client, args[0], args[1:], os.Stdin, interactive, raw, options))
 		} else {
-			os.Exit(run(client, args[0], args[1:], nil, interactive, raw))
+			os.Exit(run(client, args[0], args[1:], nil, interactive, raw, options))
 		}
 	},
 }
@@ -64,10 +72,12 @@ func init() {
 		"raw", "r", false,
 		"Output job response in raw form (output only)",
 	)
+
+	createFlags(runCmd)
 }
 
-func run(client *client.Client, name string, args []string, input io.Reader, interactive, raw bool) int {
-	res, err := client.Create(name, args, input, interactive, true)
+func run(client *client.Client, name string, args []string, input io.Reader, interactive, raw bool, options *client.CreateOptions) int {
+	res, err := client.Create(name, args, input, interactive, true, options)
 	if err != nil {
 		log.Errorf("error running job %s: %s", name, err)
 		return 1
@@ -86,3 +96,91 @@ func run(client *client.Client, name string, args []string, input io.Reader, int
 
 	return 0
 }
+
+// createFlags adds the flags setting the options of new jobs to cmd
+func createFlags(cmd *cobra.Command) {
+	cmd.Flags().String(
+		"max-output", "",
+		"Max bytes of output and of logs to keep (e.g. 10MB)",
+	)
+
+	cmd.Flags().String(
+		"output-policy", "",
+		"What to do when --max-output is reached: truncate, rotate or kill",
+	)
+
+	cmd.Flags().StringArrayP(
+		"artifact", "a", nil,
+		"Glob of files in the job's working directory to keep as artifacts (may be repeated)",
+	)
+
+	cmd.Flags().Bool(
+		"combined", false,
+		"Record the output and logs interleaved for \"job logs --timestamps\"",
+	)
+
+	cmd.Flags().StringArrayP(
+		"file", "F", nil,
+		"File to copy into the job's working directory as [name=]path (may be repeated)",
+	)
+
+	cmd.Flags().String(
+		"stdin-from", "",
+		"Id of a job whose output is the job's input, read as it is written",
+	)
+}
+
+// createOptions returns the options of a new job given by the flags added
+// by createFlags
+func createOptions(cmd *cobra.Command) (*client.CreateOptions, error) {
+	maxOutput, err := cmd.Flags().GetString("max-output")
+	if err != nil {
+		return nil, err
+	}
+
+	outputPolicy, err := cmd.Flags().GetString("output-policy")
+	if err != nil {
+		return nil, err
+	}
+
+	artifacts, err := cmd.Flags().GetStringArray("artifact")
+	if err != nil {
+		return nil, err
+	}
+
+	combined, err := cmd.Flags().GetBool("combined")
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := cmd.Flags().GetStringArray("file")
+	if err != nil {
+		return nil, err
+	}
+
+	stdinFrom, err := cmd.Flags().GetString("stdin-from")
+	if err != nil {
+		return nil, err
+	}
+
+	options := &client.CreateOptions{
+		MaxOutput:    maxOutput,
+		OutputPolicy: outputPolicy,
+		Artifacts:    artifacts,
+		Combined:     combined,
+		StdinFrom:    stdinFrom,
+	}
+
+	for _, file := range files {
+		if options.Files == nil {
+			options.Files = make(map[string]string)
+		}
+		name, path := filepath.Base(file), file
+		if i := strings.Index(file, "="); i >= 0 {
+			name, path = file[:i], file[i+1:]
+		}
+		options.Files[filepath.ToSlash(name)] = path
+	}
+
+	return options, nil
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 
@@ -24,7 +25,7 @@ If no jobs are found matching the criteria, an empy list is returned.`,
 	Args: cobra.MaximumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		uri := viper.GetString("uri")
-		client := client.NewClient(uri, nil)
+		c := client.NewClient(uri, nil)
 
 		var id string
 
@@ -44,7 +45,91 @@ If no jobs are found matching the criteria, an empy list is returned.`,
 			os.Exit(1)
 		}
 
-		os.Exit(search(client, id, name, state))
+		limit, err := cmd.Flags().GetInt("limit")
+		if err != nil {
+			log.Errorf("error getting -l/--limit flag: %s", err)
+			os.Exit(1)
+		}
+
+		offset, err := cmd.Flags().GetInt("offset")
+		if err != nil {
+			log.Errorf("error getting --offset flag: %s", err)
+			os.Exit(1)
+		}
+
+		cursor, err := cmd.Flags().GetString("cursor")
+		if err != nil {
+			log.Errorf("error getting -c/--cursor flag: %s", err)
+			os.Exit(1)
+		}
+
+		sort, err := cmd.Flags().GetString("sort")
+		if err != nil {
+			log.Errorf("error getting --sort flag: %s", err)
+			os.Exit(1)
+		}
+
+		order, err := cmd.Flags().GetString("order")
+		if err != nil {
+			log.Errorf("error getting --order flag: %s", err)
+			os.Exit(1)
+		}
+
+		filter := &client.SearchFilter{
+			ID:    id,
+			Name:  name,
+			State: state,
+		}
+
+		since, err := cmd.Flags().GetString("since")
+		if err != nil {
+			log.Errorf("error getting --since flag: %s", err)
+			os.Exit(1)
+		}
+		if filter.Since, err = parseTime(since); err != nil {
+			log.Errorf("invalid --since %s: %s", since, err)
+			os.Exit(1)
+		}
+
+		until, err := cmd.Flags().GetString("until")
+		if err != nil {
+			log.Errorf("error getting --until flag: %s", err)
+			os.Exit(1)
+		}
+		if filter.Until, err = parseTime(until); err != nil {
+			log.Errorf("invalid --until %s: %s", until, err)
+			os.Exit(1)
+		}
+
+		filter.MinDuration, err = cmd.Flags().GetDuration("min-duration")
+		if err != nil {
+			log.Errorf("error getting --min-duration flag: %s", err)
+			os.Exit(1)
+		}
+
+		filter.MaxDuration, err = cmd.Flags().GetDuration("max-duration")
+		if err != nil {
+			log.Errorf("error getting --max-duration flag: %s", err)
+			os.Exit(1)
+		}
+
+		if cmd.Flags().Changed("status") {
+			status, err := cmd.Flags().GetInt("status")
+			if err != nil {
+				log.Errorf("error getting --status flag: %s", err)
+				os.Exit(1)
+			}
+			filter.Status = &status
+		}
+
+		os.Exit(search(c, &client.SearchOptions{
+			Filter: filter,
+			Limit:  limit,
+			Offset: offset,
+			Cursor: cursor,
+			Sort:   sort,
+			Order:  order,
+		}))
 	},
 }
 
@@ -60,23 +145,70 @@ func init() {
 		"state", "s", "",
 		"Search for jobs by state",
 	)
-}
 
-func search(c *client.Client, id, name, state string) int {
-	res, err := c.Search(&client.SearchOptions{
-		Filter: &client.SearchFilter{
-			ID:    id,
-			Name:  name,
-			State: state,
-		},
-	})
+	searchCmd.Flags().String(
+		"since", "",
+		"Search for jobs created since a time (RFC 3339) or duration ago (e.g. 24h)",
+	)
+
+	searchCmd.Flags().String(
+		"until", "",
+		"Search for jobs created before a time (RFC 3339) or duration ago",
+	)
+
+	searchCmd.Flags().Duration(
+		"min-duration", 0,
+		"Search for jobs that ran for at least this long",
+	)
+
+	searchCmd.Flags().Duration(
+		"max-duration", 0,
+		"Search for jobs that ran for at most this long",
+	)
+
+	searchCmd.Flags().Int(
+		"status", 0,
+		"Search for jobs that exited with this status",
+	)
+
+	searchCmd.Flags().IntP(
+		"limit", "l", 0,
+		"Limit the number of jobs returned (0 for no limit)",
+	)
+
+	searchCmd.Flags().Int(
+		"offset", 0,
+		"Skip this many matching jobs",
+	)
+
+	searchCmd.Flags().StringP(
+		"cursor", "c", "",
+		"Continue a previous search from its next cursor",
+	)
+
+	searchCmd.Flags().String(
+		"sort", "",
+		"Sort jobs by created, started, stopped, duration, status or state",
+	)
+
+	searchCmd.Flags().String(
+		"order", "",
+		"Sort order asc or desc",
+	)
+}
 
+func search(c *client.Client, options *client.SearchOptions) int {
+	page, err := c.SearchPage(options)
 	if err != nil {
 		log.Errorf("error searching for active jobs: %s", err)
 		return 1
 	}
 
-	out, err := json.Marshal(res)
+	if page.Next != "" {
+		fmt.Fprintf(os.Stderr, "next cursor: %s\n", page.Next)
+	}
+
+	out, err := json.Marshal(page.Jobs)
 	if err != nil {
 		log.Errorf("error encoding job results: %s", err)
 		return 1
@@ -86,3 +218,19 @@ func search(c *client.Client, id, name, state string) int {
 
 	return 0
 }
+
+// parseTime parses s as either an RFC 3339 time or a duration before now
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+
+	if d, err := time.ParseDuration(s); err == nil {
+		if d < 0 {
+			d = -d
+		}
+		return time.Now().Add(-d), nil
+	}
+
+	return time.Parse(time.RFC3339, s)
+}
@@ -43,11 +43,17 @@ to pass stadard input to the job.`,
 			os.Exit(1)
 		}
 
+		options, err := createOptions(cmd)
+		if err != nil {
+			log.Errorf("error getting job option flags: %s", err)
+			os.Exit(1)
+		}
+
 		stat, _ := os.Stdin.Stat()
 		if (stat.Mode() & os.ModeCharDevice) == 0 {
-			os.Exit(start(client, args[0], args[1:], os.Stdin, interactive, quiet))
+			os.Exit(start(client, args[0], args[1:], os.Stdin, interactive, quiet, options))
 		} else {
-			os.Exit(start(client, args[0], args[1:], nil, interactive, quiet))
+			os.Exit(start(client, args[0], args[1:], nil, interactive, quiet, options))
 		}
 	},
 }
@@ -64,10 +70,12 @@ func init() {
 		"quiet", "q", false,
 		"Only display numeric IDs",
 	)
+
+	createFlags(startCmd)
 }
 
-func start(client *client.Client, name string, args []string, input io.Reader, interactive, quiet bool) int {
-	res, err := client.Create(name, args, input, interactive, false)
+func start(client *client.Client, name string, args []string, input io.Reader, interactive, quiet bool, options *client.CreateOptions) int {
+	res, err := client.Create(name, args, input, interactive, false, options)
 	if err != nil {
 		log.Errorf("error running job %s: %s", name, err)
 		return 1
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/prologic/je/client"
+)
+
+// statsCmd represents the stats command
+var statsCmd = &cobra.Command{
+	Use:     "stats [flags] [<query>]",
+	Aliases: []string{"stat"},
+	Short:   "Display job statistics",
+	Long: `This displays statistics over all jobs or those matching the given
+query. It shows the number of jobs in each state and on each worker, success
+rates and durations per job name and the number of jobs created each hour.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		uri := viper.GetString("uri")
+		client := client.NewClient(uri, nil)
+
+		var q string
+
+		if len(args) == 1 {
+			q = args[0]
+		}
+
+		hours, err := cmd.Flags().GetInt("hours")
+		if err != nil {
+			log.Errorf("error getting -H/--hours flag: %s", err)
+			os.Exit(1)
+		}
+
+		os.Exit(stats(client, q, hours))
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(statsCmd)
+
+	statsCmd.Flags().IntP(
+		"hours", "H", 24,
+		"Number of hours of created jobs to display",
+	)
+}
+
+func sortedKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func stats(c *client.Client, q string, hours int) int {
+	res, err := c.Stats(q, hours)
+	if err != nil {
+		log.Errorf("error retrieving statistics: %s", err)
+		return 1
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 10, 4, 8, ' ', 0)
+
+	fmt.Fprintf(w, "TOTAL\t%d\n\n", res.Total)
+
+	w.Write([]byte("STATE\tCOUNT\n"))
+	for _, state := range sortedKeys(res.States) {
+		fmt.Fprintf(w, "%s\t%d\n", state, res.States[state])
+	}
+	w.Write([]byte("\n"))
+
+	w.Write([]byte("WORKER\tCOUNT\n"))
+	for _, worker := range sortedKeys(res.Workers) {
+		fmt.Fprintf(w, "%s\t%d\n", worker, res.Workers[worker])
+	}
+	w.Write([]byte("\n"))
+
+	names := make([]string, 0, len(res.Names))
+	for name := range res.Names {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w.Write([]byte("NAME\tCOUNT\tSUCCEEDED\tFAILED\tSUCCESS\tP50\tP95\n"))
+	for _, name := range names {
+		ns := res.Names[name]
+		fmt.Fprintf(
+			w, "%s\t%d\t%d\t%d\t%.1f%%\t%s\t%s\n",
+			name, ns.Count, ns.Succeeded, ns.Failed, ns.SuccessRate*100,
+			seconds(ns.P50), seconds(ns.P95),
+		)
+	}
+	w.Write([]byte("\n"))
+
+	w.Write([]byte("HOUR\tCREATED\n"))
+	for _, h := range res.Hourly {
+		fmt.Fprintf(w, "%s\t%d\n", h.Hour.Local().Format("2006-01-02 15:04"), h.Count)
+	}
+	w.Flush()
+
+	return 0
+}
+
+func seconds(s float64) string {
+	return time.Duration(s * float64(time.Second)).Round(time.Millisecond).String()
+}
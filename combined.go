@@ -0,0 +1,221 @@
+package je
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	STREAM_STDOUT = "stdout"
+	STREAM_STDERR = "stderr"
+)
+
+// maxCombinedChunk is the most data recorded in one entry of a combined log,
+// longer lines are split
+const maxCombinedChunk = 64 * 1024
+
+// CombinedEntry is a line of the output or logs of a job as recorded in its
+// combined log along with when it was written and to which stream
+type CombinedEntry struct {
+	Time   time.Time `json:"time"`
+	Stream string    `json:"stream"`
+	Data   string    `json:"data"`
+	// Encoding is base64 if Data is the base64 encoding of what was
+	// written as it is not valid UTF-8
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// ENCODING_BASE64 is the Encoding of entries with base64 encoded data
+const ENCODING_BASE64 = "base64"
+
+// newCombinedEntry returns an entry of p written to stream at t
+func newCombinedEntry(t time.Time, stream string, p []byte) *CombinedEntry {
+	entry := &CombinedEntry{Time: t, Stream: stream}
+	if utf8.Valid(p) {
+		entry.Data = string(p)
+	} else {
+		entry.Data = base64.StdEncoding.EncodeToString(p)
+		entry.Encoding = ENCODING_BASE64
+	}
+	return entry
+}
+
+// Bytes returns what was written, decoding Data if it is base64 encoded
+func (e *CombinedEntry) Bytes() ([]byte, error) {
+	switch e.Encoding {
+	case "":
+		return []byte(e.Data), nil
+	case ENCODING_BASE64:
+		return base64.StdEncoding.DecodeString(e.Data)
+	default:
+		return nil, fmt.Errorf("unsupported combined log encoding %q", e.Encoding)
+	}
+}
+
+// combinedLog records the output and logs of a job as JSON Lines of
+// CombinedEntry so that they can be replayed interleaved as they were
+// written. Times are taken from the monotonic clock relative to when the log
+// was created so that they never go backwards.
+type combinedLog struct {
+	sync.Mutex
+	enc    *json.Encoder
+	start  time.Time
+	failed bool
+}
+
+func newCombinedLog(w io.Writer) *combinedLog {
+	return &combinedLog{enc: json.NewEncoder(w), start: time.Now()}
+}
+
+// record writes an entry. Errors are only logged once as the combined log
+// must not get in the way of the output and logs themselves.
+func (c *combinedLog) record(stream string, p []byte) {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.failed {
+		return
+	}
+
+	entry := newCombinedEntry(c.start.Add(time.Since(c.start)), stream, p)
+	if err := c.enc.Encode(entry); err != nil {
+		log.Errorf("error writing combined log: %s", err)
+		c.failed = true
+	}
+}
+
+// stream returns a writer recording what is written to it line by line as
+// entries of the given stream
+func (c *combinedLog) stream(name string) *combinedStream {
+	return &combinedStream{log: c, name: name}
+}
+
+// combinedStream is a stream of a combinedLog
+type combinedStream struct {
+	log  *combinedLog
+	name string
+	buf  []byte
+}
+
+func (s *combinedStream) Write(p []byte) (int, error) {
+	s.buf = append(s.buf, p...)
+	for {
+		i := bytes.IndexByte(s.buf, '\n')
+		if i < 0 {
+			if len(s.buf) >= maxCombinedChunk {
+				s.Flush()
+			}
+			break
+		}
+		s.log.record(s.name, s.buf[:i+1])
+		s.buf = s.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush records what has been written since the last complete line. It
+// does nothing on a nil stream, that of a job without a combined log.
+func (s *combinedStream) Flush() {
+	if s != nil && len(s.buf) > 0 {
+		s.log.record(s.name, s.buf)
+		s.buf = nil
+	}
+}
+
+// CombinedFilter selects entries of a combined log
+type CombinedFilter struct {
+	// Since excludes entries written before it if not zero
+	Since time.Time
+	// Stream only includes entries of the given stream if not empty
+	Stream string
+}
+
+// Match returns true if the entry is selected by the filter
+func (f *CombinedFilter) Match(entry *CombinedEntry) bool {
+	if !f.Since.IsZero() && entry.Time.Before(f.Since) {
+		return false
+	}
+	if f.Stream != "" && entry.Stream != f.Stream {
+		return false
+	}
+	return true
+}
+
+// ParseSince parses a time given either as a duration before now (e.g. 5m),
+// an RFC 3339 timestamp or a Unix timestamp in seconds
+func ParseSince(s string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	if n, err := strconv.ParseFloat(s, 64); err == nil {
+		sec := int64(n)
+		return time.Unix(sec, int64((n-float64(sec))*1e9)), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q: expected a duration, an RFC 3339 or a Unix timestamp", s)
+}
+
+// ParseCombinedFilter parses the since and stream query parameters of a
+// request for a combined log
+func ParseCombinedFilter(since, stream string) (*CombinedFilter, error) {
+	filter := &CombinedFilter{}
+
+	if since != "" {
+		t, err := ParseSince(since, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		filter.Since = t
+	}
+
+	switch strings.ToLower(stream) {
+	case "":
+	case STREAM_STDOUT, "output":
+		filter.Stream = STREAM_STDOUT
+	case STREAM_STDERR, "logs":
+		filter.Stream = STREAM_STDERR
+	default:
+		return nil, fmt.Errorf("invalid stream %q", stream)
+	}
+
+	return filter, nil
+}
+
+// ReadCombined decodes the combined log read from r and calls fn with each
+// entry matching filter
+func ReadCombined(r io.Reader, filter *CombinedFilter, fn func(entry *CombinedEntry) error) error {
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadBytes('\n')
+		// The last line of the log of a running job may be incomplete
+		if len(line) > 0 && line[len(line)-1] == '\n' {
+			var entry CombinedEntry
+			if err := json.Unmarshal(line, &entry); err != nil {
+				return err
+			}
+			if filter == nil || filter.Match(&entry) {
+				if err := fn(&entry); err != nil {
+					return err
+				}
+			}
+		}
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package je
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSince(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Date(2020, 5, 20, 12, 0, 0, 0, time.UTC)
+	for s, expected := range map[string]time.Time{
+		"5m":                   now.Add(-5 * time.Minute),
+		"2020-05-20T11:00:00Z": now.Add(-time.Hour),
+		"1589972400":           now.Add(-time.Hour),
+		"1589972400.5":         now.Add(-time.Hour + 500*time.Millisecond),
+	} {
+		since, err := ParseSince(s, now)
+		require.NoError(t, err, s)
+		assert.True(expected.Equal(since), s)
+	}
+
+	_, err := ParseSince("yesterday", now)
+	assert.Error(err)
+}
+
+func TestCombinedLog(t *testing.T) {
+	assert := assert.New(t)
+
+	var buf bytes.Buffer
+	clog := newCombinedLog(&buf)
+	stdout, stderr := clog.stream(STREAM_STDOUT), clog.stream(STREAM_STDERR)
+
+	stdout.Write([]byte("hello "))
+	stderr.Write([]byte("oops\nwarn"))
+	stdout.Write([]byte("world\nbye"))
+	stdout.Flush()
+	stderr.Flush()
+
+	var entries []*CombinedEntry
+	require.NoError(t, ReadCombined(&buf, nil, func(entry *CombinedEntry) error {
+		entries = append(entries, entry)
+		return nil
+	}))
+	require.Len(t, entries, 4)
+
+	for i, expected := range []CombinedEntry{
+		{Stream: STREAM_STDERR, Data: "oops\n"},
+		{Stream: STREAM_STDOUT, Data: "hello world\n"},
+		{Stream: STREAM_STDOUT, Data: "bye"},
+		{Stream: STREAM_STDERR, Data: "warn"},
+	} {
+		assert.Equal(expected.Stream, entries[i].Stream)
+		assert.Equal(expected.Data, entries[i].Data)
+		if i > 0 {
+			assert.False(entries[i].Time.Before(entries[i-1].Time))
+		}
+	}
+
+	filter, err := ParseCombinedFilter("", "stderr")
+	require.NoError(t, err)
+	assert.True(filter.Match(entries[0]))
+	assert.False(filter.Match(entries[1]))
+
+	filter = &CombinedFilter{Since: entries[2].Time}
+	assert.False(filter.Match(entries[1]))
+	assert.True(filter.Match(entries[2]))
+
+	_, err = ParseCombinedFilter("", "stdin")
+	assert.Error(err)
+}
+
+func TestCombinedLogBinary(t *testing.T) {
+	assert := assert.New(t)
+
+	var buf bytes.Buffer
+	clog := newCombinedLog(&buf)
+	stdout := clog.stream(STREAM_STDOUT)
+
+	// Data which is not valid UTF-8 is base64 encoded
+	binary := []byte{0xff, 0xfe, 'a', '\n'}
+	stdout.Write(binary)
+	stdout.Write([]byte("héllo\n"))
+
+	var entries []*CombinedEntry
+	require.NoError(t, ReadCombined(&buf, nil, func(entry *CombinedEntry) error {
+		entries = append(entries, entry)
+		return nil
+	}))
+	require.Len(t, entries, 2)
+
+	assert.Equal(ENCODING_BASE64, entries[0].Encoding)
+	data, err := entries[0].Bytes()
+	require.NoError(t, err)
+	assert.Equal(binary, data)
+
+	assert.Equal("", entries[1].Encoding)
+	assert.Equal("héllo\n", entries[1].Data)
+	data, err = entries[1].Bytes()
+	require.NoError(t, err)
+	assert.Equal([]byte("héllo\n"), data)
+}
@@ -0,0 +1,226 @@
+package je
+
+import (
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	COMPRESS_ZSTD = "zstd"
+	COMPRESS_GZIP = "gzip"
+)
+
+// compressions are the encodings data may be compressed with in the order
+// they are looked for, each with the suffix of its files
+var compressions = []struct {
+	encoding string
+	suffix   string
+}{
+	{COMPRESS_ZSTD, ".zst"},
+	{COMPRESS_GZIP, ".gz"},
+}
+
+// compressedTypes are the types of data compressed once a job is done
+var compressedTypes = []DataType{DATA_OUTPUT, DATA_LOGS, DATA_COMBINED}
+
+// DataCompression is the encoding, zstd or gzip, the output and logs of jobs
+// are compressed with once they are done or "" to keep them uncompressed
+var DataCompression string
+
+// Compressor is implemented by Data backends that can keep the data of jobs
+// that are done compressed. Compressed data is still read uncompressed with
+// Read and ReadRange.
+type Compressor interface {
+	// Compress compresses the output and logs of a job that is done with
+	// the given encoding
+	Compress(id ID, encoding string) error
+
+	// ReadCompressed reads the data of a job as it is stored if it is
+	// compressed with one of encodings returning the encoding and the
+	// compressed size. It returns a nil reader if it is not.
+	ReadCompressed(id ID, dtype DataType, encodings []string) (io.ReadCloser, string, int64, error)
+}
+
+// ParseCompression parses the name of a compression: zstd, gzip or none
+func ParseCompression(s string) (string, error) {
+	switch s = strings.ToLower(s); s {
+	case "", "none":
+		return "", nil
+	case COMPRESS_ZSTD, COMPRESS_GZIP:
+		return s, nil
+	default:
+		return "", fmt.Errorf("invalid compression %q: expected zstd, gzip or none", s)
+	}
+}
+
+// compressData compresses the data of a job that is done with DataCompression
+// in the background if the Data backend supports it. The backend and
+// compression are those when it is called.
+func compressData(id ID) {
+	c, ok := data.(Compressor)
+	compression := DataCompression
+	if !ok || compression == "" {
+		return
+	}
+
+	go func() {
+		if err := c.Compress(id, compression); err != nil {
+			log.Errorf("error compressing data for job #%d: %s", id, err)
+		}
+	}()
+}
+
+// newDecompressor returns a reader decompressing r with encoding
+func newDecompressor(r io.Reader, encoding string) (io.ReadCloser, error) {
+	switch encoding {
+	case COMPRESS_ZSTD:
+		d, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	case COMPRESS_GZIP:
+		return gzip.NewReader(r)
+	default:
+		return nil, fmt.Errorf("unsupported compression %q", encoding)
+	}
+}
+
+// closers closes each of its closers in turn returning the first error
+type closers []io.Closer
+
+func (c closers) Close() (err error) {
+	for _, closer := range c {
+		if e := closer.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return
+}
+
+// compressFile compresses the file src of size bytes with encoding into dst.
+// The compressed file is written next to dst first so that dst is only ever
+// complete.
+func compressFile(src, dst, encoding string, size int64) (err error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp := dst + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		out.Close()
+		if err != nil {
+			os.Remove(tmp)
+		}
+	}()
+
+	var w io.WriteCloser
+	switch encoding {
+	case COMPRESS_ZSTD:
+		e, err := zstd.NewWriter(nil)
+		if err != nil {
+			return err
+		}
+		// Record the size in the frame header for decompressedSize
+		e.ResetContentSize(out, size)
+		w = e
+	case COMPRESS_GZIP:
+		w = gzip.NewWriter(out)
+	default:
+		return fmt.Errorf("unsupported compression %q", encoding)
+	}
+
+	if _, err = io.Copy(w, in); err != nil {
+		w.Close()
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	if err = out.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
+
+// maxDeflateRatio is the most data can be compressed with deflate
+const maxDeflateRatio = 1032
+
+// decompressedSize returns the size of the data in the compressed file at
+// path from its headers or by decompressing it if they do not have it
+func decompressedSize(path, encoding string) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	switch encoding {
+	case COMPRESS_ZSTD:
+		buf := make([]byte, zstd.HeaderMaxSize)
+		n, err := io.ReadFull(f, buf)
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return 0, err
+		}
+		var h zstd.Header
+		if err := h.Decode(buf[:n]); err == nil && h.HasFCS && h.FrameContentSize > 0 {
+			return int64(h.FrameContentSize), nil
+		}
+	case COMPRESS_GZIP:
+		// The trailer has the size modulo 4GiB, which is the size if
+		// the data cannot be larger than that at deflate's best ratio
+		if fi, err := f.Stat(); err == nil && fi.Size() >= 4 && fi.Size()*maxDeflateRatio < 1<<32 {
+			buf := make([]byte, 4)
+			if _, err := f.ReadAt(buf, fi.Size()-4); err != nil {
+				return 0, err
+			}
+			return int64(binary.LittleEndian.Uint32(buf)), nil
+		}
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	r, err := newDecompressor(f, encoding)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+	return io.Copy(ioutil.Discard, r)
+}
+
+// acceptsEncoding returns true if the Accept-Encoding header of a request
+// accepts encoding
+func acceptsEncoding(header, encoding string) bool {
+	for _, part := range strings.Split(header, ",") {
+		params := strings.Split(part, ";")
+		if !strings.EqualFold(strings.TrimSpace(params[0]), encoding) {
+			continue
+		}
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil && q == 0 {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,154 @@
+package je
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalDataCompress(t *testing.T) {
+	withGlobals(t)
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	_, err := InitData(dir)
+	require.NoError(t, err)
+
+	logs := strings.Repeat("the same line over and over again\n", 1000)
+
+	for id, encoding := range map[ID]string{1: COMPRESS_ZSTD, 2: COMPRESS_GZIP} {
+		writeTestData(t, id, DATA_LOGS, logs)
+		writeTestData(t, id, DATA_OUTPUT, "")
+		require.NoError(t, data.(Compressor).Compress(id, encoding))
+
+		// Compressed and uncompressed data coexist in the same directory
+		writeTestData(t, id, DATA_COMBINED, "uncompressed")
+
+		for _, c := range compressions {
+			_, err := os.Stat(filepath.Join(dir, fmt.Sprintf("%d.log%s", id, c.suffix)))
+			assert.Equal(c.encoding == encoding, err == nil, c.encoding)
+		}
+		_, err = os.Stat(filepath.Join(dir, fmt.Sprintf("%d.log", id)))
+		assert.True(os.IsNotExist(err))
+		_, err = os.Stat(filepath.Join(dir, fmt.Sprintf("%d.out", id)))
+		assert.NoError(err, "empty data is not compressed")
+
+		size, err := data.Size(id, DATA_LOGS)
+		require.NoError(t, err)
+		assert.Equal(int64(len(logs)), size)
+		assert.Equal(logs, readTestData(t, id, DATA_LOGS))
+		assert.Equal("uncompressed", readTestData(t, id, DATA_COMBINED))
+
+		r, err := readRange(id, DATA_LOGS, 34, 8)
+		require.NoError(t, err)
+		buf, err := ioutil.ReadAll(r)
+		r.Close()
+		require.NoError(t, err)
+		assert.Equal("the same", string(buf))
+
+		r, _, _, err = data.(Compressor).ReadCompressed(id, DATA_LOGS, []string{"br"})
+		require.NoError(t, err)
+		assert.Nil(r)
+
+		r, got, n, err := data.(Compressor).ReadCompressed(id, DATA_LOGS, []string{COMPRESS_ZSTD, COMPRESS_GZIP})
+		require.NoError(t, err)
+		require.NotNil(t, r)
+		r.Close()
+		assert.Equal(encoding, got)
+		assert.True(n < size/10, "%s compressed to %d bytes", encoding, n)
+
+		// Writing data replaces its compressed copy
+		writeTestData(t, id, DATA_LOGS, "new")
+		assert.Equal("new", readTestData(t, id, DATA_LOGS))
+	}
+
+	require.NoError(t, data.Delete(1))
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	for _, fi := range files {
+		assert.False(strings.HasPrefix(fi.Name(), "1."), fi.Name())
+	}
+}
+
+func TestAcceptsEncoding(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(acceptsEncoding("gzip, deflate, br", COMPRESS_GZIP))
+	assert.True(acceptsEncoding("zstd;q=0.5, gzip;q=1.0", COMPRESS_ZSTD))
+	assert.False(acceptsEncoding("gzip;q=0", COMPRESS_GZIP))
+	assert.False(acceptsEncoding("gzip", COMPRESS_ZSTD))
+	assert.False(acceptsEncoding("", COMPRESS_GZIP))
+}
+
+func TestAPIv2_CompressedData(t *testing.T) {
+	assert := assert.New(t)
+
+	DataCompression = COMPRESS_ZSTD
+	t.Cleanup(func() { DataCompression = "" })
+
+	res, err := http.Post(testAPIURL+"/jobs?name=samples/hello.sh&wait=1", "text/plain", nil)
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	var job Job
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&job))
+
+	// Data is compressed in the background once the job is done
+	for i := 0; ; i++ {
+		r, _, _, err := data.(Compressor).ReadCompressed(job.ID, DATA_OUTPUT, []string{COMPRESS_ZSTD})
+		require.NoError(t, err)
+		if r != nil {
+			r.Close()
+			break
+		}
+		require.True(t, i < 50, "timed out waiting for data to be compressed")
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	get := func(encoding, ranges string) *http.Response {
+		req, err := http.NewRequest("GET", fmt.Sprintf("%s/jobs/%d/output", testAPIURL, job.ID), nil)
+		require.NoError(t, err)
+		req.Header.Set("Accept-Encoding", encoding)
+		if ranges != "" {
+			req.Header.Set("Range", ranges)
+		}
+		res, err := http.DefaultTransport.RoundTrip(req)
+		require.NoError(t, err)
+		return res
+	}
+	body := func(res *http.Response) string {
+		defer res.Body.Close()
+		buf, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		return string(buf)
+	}
+
+	res = get("", "")
+	assert.Equal("", res.Header.Get("Content-Encoding"))
+	assert.Equal("Hello World!\n", body(res))
+
+	res = get("gzip, zstd", "")
+	assert.Equal(COMPRESS_ZSTD, res.Header.Get("Content-Encoding"))
+	r, err := newDecompressor(res.Body, COMPRESS_ZSTD)
+	require.NoError(t, err)
+	buf, err := ioutil.ReadAll(r)
+	r.Close()
+	res.Body.Close()
+	require.NoError(t, err)
+	assert.Equal("Hello World!\n", string(buf))
+
+	// Ranges are of the uncompressed data
+	res = get("zstd", "bytes=6-")
+	assert.Equal(http.StatusPartialContent, res.StatusCode)
+	assert.Equal("", res.Header.Get("Content-Encoding"))
+	assert.Equal("World!\n", body(res))
+}
@@ -1,10 +1,13 @@
 package je
 
 import (
+	"bufio"
 	"context"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 
 	log "github.com/sirupsen/logrus"
 
@@ -15,8 +18,12 @@ const (
 	DATA_INPUT DataType = iota
 	DATA_OUTPUT
 	DATA_LOGS
+	DATA_COMBINED
 )
 
+// dataTypes are all the types of data kept for a job
+var dataTypes = []DataType{DATA_INPUT, DATA_OUTPUT, DATA_LOGS, DATA_COMBINED}
+
 type DataType int
 
 func (dt DataType) String() string {
@@ -27,15 +34,53 @@ func (dt DataType) String() string {
 		return "out"
 	case 2:
 		return "log"
+	case 3:
+		return "combined"
 	default:
 		return "???"
 	}
 }
 
 type Data interface {
+	Size(id ID, dtype DataType) (int64, error)
 	Read(id ID, dtype DataType) (io.ReadCloser, error)
 	Write(id ID, dtype DataType) (io.WriteCloser, error)
 	Tail(id ID, dtype DataType, ctx context.Context) (chan string, chan error)
+	Delete(id ID) error
+
+	// WriteArtifact and ReadArtifact write and read the artifacts of a job
+	// by their name, a relative path with / as separator. They are deleted
+	// with the rest of the data of the job.
+	WriteArtifact(id ID, name string) (io.WriteCloser, error)
+	ReadArtifact(id ID, name string) (io.ReadCloser, error)
+
+	// WriteInputFile and ReadInputFile write and read the input files of a
+	// job, which are copied into its working directory before it runs, by
+	// their name like artifacts
+	WriteInputFile(id ID, name string) (io.WriteCloser, error)
+	ReadInputFile(id ID, name string) (io.ReadCloser, error)
+}
+
+// RangeReader is implemented by Data backends that can read part of the data
+// of a job without reading everything before it
+type RangeReader interface {
+	// ReadRange reads length bytes from offset, or everything from offset
+	// if length is negative
+	ReadRange(id ID, dtype DataType, offset, length int64) (io.ReadCloser, error)
+}
+
+// Appender is implemented by Data backends that can write to the data of a
+// job after what it already holds without writing all of it again
+type Appender interface {
+	// Append opens the data of a job to write after what it holds
+	Append(id ID, dtype DataType) (io.WriteCloser, error)
+}
+
+// truncater is implemented by Data backends that can drop the end of the
+// data of a job
+type truncater interface {
+	// truncate drops the data of a job past size
+	truncate(id ID, dtype DataType, size int64) error
 }
 
 type LocalData struct {
@@ -59,18 +104,277 @@ func (d *LocalData) makepath(id ID, dtype DataType) string {
 	return fmt.Sprintf("%s/%d.%s", d.path, id, dtype)
 }
 
+// find returns the path of the data of a job and, if it is compressed, its
+// encoding. Uncompressed data is preferred as both exist while compressing.
+func (d *LocalData) find(id ID, dtype DataType) (string, string, error) {
+	path := d.makepath(id, dtype)
+	_, err := os.Stat(path)
+	if err == nil || !os.IsNotExist(err) {
+		return path, "", err
+	}
+
+	for _, c := range compressions {
+		if _, err := os.Stat(path + c.suffix); err == nil {
+			return path + c.suffix, c.encoding, nil
+		}
+	}
+	return path, "", err
+}
+
+// open opens the data of a job returning its encoding if it is compressed
+func (d *LocalData) open(id ID, dtype DataType) (*os.File, string, error) {
+	path, encoding, err := d.find(id, dtype)
+	if err != nil {
+		return nil, "", err
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) && encoding == "" {
+		// Compressed since it was found
+		if path, encoding, err = d.find(id, dtype); err != nil {
+			return nil, "", err
+		}
+		f, err = os.Open(path)
+	}
+	return f, encoding, err
+}
+
+func (d *LocalData) Size(id ID, dtype DataType) (int64, error) {
+	path, encoding, err := d.find(id, dtype)
+	if err != nil {
+		return 0, err
+	}
+	if encoding != "" {
+		return decompressedSize(path, encoding)
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	return fi.Size(), nil
+}
+
 func (d *LocalData) Read(id ID, dtype DataType) (io.ReadCloser, error) {
-	return os.Open(d.makepath(id, dtype))
+	return d.ReadRange(id, dtype, 0, -1)
 }
 
+// ReadRange reads length bytes of the data of a job from offset, or
+// everything from offset if length is negative. Compressed data is
+// decompressed from the start.
+func (d *LocalData) ReadRange(id ID, dtype DataType, offset, length int64) (io.ReadCloser, error) {
+	f, encoding, err := d.open(id, dtype)
+	if err != nil {
+		return nil, err
+	}
+
+	var r io.ReadCloser = f
+	if encoding != "" {
+		dr, err := newDecompressor(f, encoding)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		r = struct {
+			io.Reader
+			io.Closer
+		}{dr, closers{dr, f}}
+		if _, err := io.CopyN(ioutil.Discard, r, offset); err != nil && err != io.EOF {
+			r.Close()
+			return nil, err
+		}
+	} else if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	if length < 0 {
+		return r, nil
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(r, length), r}, nil
+}
+
+// Write opens the data of a job for writing replacing it and any compressed
+// copy
 func (d *LocalData) Write(id ID, dtype DataType) (io.WriteCloser, error) {
-	return os.OpenFile(d.makepath(id, dtype), os.O_RDWR|os.O_CREATE, 0644)
+	path := d.makepath(id, dtype)
+	for _, c := range compressions {
+		if err := os.Remove(path + c.suffix); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	return os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+}
+
+// Append opens the data of a job to write after what it holds. Compressed
+// data is written again uncompressed.
+func (d *LocalData) Append(id ID, dtype DataType) (io.WriteCloser, error) {
+	if _, encoding, err := d.find(id, dtype); err == nil && encoding != "" {
+		return rewriteData(d, id, dtype)
+	}
+	return os.OpenFile(d.makepath(id, dtype), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+}
+
+func (d *LocalData) truncate(id ID, dtype DataType, size int64) error {
+	path, encoding, err := d.find(id, dtype)
+	if err != nil {
+		return err
+	}
+	if encoding != "" {
+		return fmt.Errorf("cannot truncate %s data compressed with %s", dtype, encoding)
+	}
+	return os.Truncate(path, size)
+}
+
+func (d *LocalData) artifactpath(id ID, name string) string {
+	return filepath.Join(d.path, fmt.Sprintf("%d.artifacts", id), filepath.FromSlash(name))
+}
+
+func (d *LocalData) inputfilepath(id ID, name string) string {
+	return filepath.Join(d.path, fmt.Sprintf("%d.inputs", id), filepath.FromSlash(name))
+}
+
+// createFile creates the file at path and the directories leading to it
+func createFile(path string) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	return os.Create(path)
+}
+
+func (d *LocalData) WriteArtifact(id ID, name string) (io.WriteCloser, error) {
+	return createFile(d.artifactpath(id, name))
+}
+
+func (d *LocalData) ReadArtifact(id ID, name string) (io.ReadCloser, error) {
+	return os.Open(d.artifactpath(id, name))
+}
+
+func (d *LocalData) WriteInputFile(id ID, name string) (io.WriteCloser, error) {
+	return createFile(d.inputfilepath(id, name))
+}
+
+func (d *LocalData) ReadInputFile(id ID, name string) (io.ReadCloser, error) {
+	return os.Open(d.inputfilepath(id, name))
+}
+
+func (d *LocalData) Delete(id ID) error {
+	if err := os.RemoveAll(d.artifactpath(id, "")); err != nil {
+		log.Errorf("error deleting artifacts for job #%d: %s", id, err)
+		return err
+	}
+	if err := os.RemoveAll(d.inputfilepath(id, "")); err != nil {
+		log.Errorf("error deleting input files for job #%d: %s", id, err)
+		return err
+	}
+
+	for _, dtype := range dataTypes {
+		paths := []string{d.makepath(id, dtype)}
+		for _, c := range compressions {
+			paths = append(paths, paths[0]+c.suffix)
+		}
+		for _, path := range paths {
+			err := os.Remove(path)
+			if err != nil && !os.IsNotExist(err) {
+				log.Errorf("error deleting %s data for job #%d: %s", dtype, id, err)
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Compress compresses the output and logs of a job that is done with
+// encoding. Data that is empty or already compressed is left as is.
+func (d *LocalData) Compress(id ID, encoding string) error {
+	suffix := ""
+	for _, c := range compressions {
+		if c.encoding == encoding {
+			suffix = c.suffix
+		}
+	}
+	if suffix == "" {
+		return fmt.Errorf("unsupported compression %q", encoding)
+	}
+
+	for _, dtype := range compressedTypes {
+		path := d.makepath(id, dtype)
+		fi, err := os.Stat(path)
+		if os.IsNotExist(err) || err == nil && fi.Size() == 0 {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		if err := compressFile(path, path+suffix, encoding, fi.Size()); err != nil {
+			log.Errorf("error compressing %s data for job #%d: %s", dtype, id, err)
+			return err
+		}
+		if err := os.Remove(path); err != nil {
+			log.Errorf("error removing %s data for job #%d: %s", dtype, id, err)
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadCompressed reads the data of a job as it is stored if it is compressed
+// with one of encodings
+func (d *LocalData) ReadCompressed(id ID, dtype DataType, encodings []string) (io.ReadCloser, string, int64, error) {
+	path, encoding, err := d.find(id, dtype)
+	if err != nil || encoding == "" {
+		return nil, "", 0, err
+	}
+
+	for _, e := range encodings {
+		if e != encoding {
+			continue
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, "", 0, err
+		}
+		fi, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, "", 0, err
+		}
+		return f, encoding, fi.Size(), nil
+	}
+	return nil, "", 0, nil
 }
 
 func (d *LocalData) Tail(id ID, dtype DataType, ctx context.Context) (lines chan string, errors chan error) {
 	lines = make(chan string)
 	errors = make(chan error)
 
+	// Compressed data is complete so is only read
+	if _, encoding, err := d.find(id, dtype); err == nil && encoding != "" {
+		go func() {
+			r, err := d.Read(id, dtype)
+			if err != nil {
+				errors <- err
+				return
+			}
+			defer r.Close()
+
+			scanner := bufio.NewScanner(r)
+			for scanner.Scan() {
+				select {
+				case <-ctx.Done():
+					return
+				case lines <- scanner.Text():
+				}
+			}
+			if err := scanner.Err(); err != nil {
+				errors <- err
+			}
+		}()
+		return
+	}
+
 	t, err := tail.TailFile(
 		d.makepath(id, dtype),
 		tail.Config{Follow: true},
@@ -97,3 +401,128 @@ func (d *LocalData) Tail(id ID, dtype DataType, ctx context.Context) (lines chan
 	}()
 	return
 }
+
+// readRange reads length bytes of the data of a job from offset, or
+// everything from offset if length is negative, with ReadRange if the Data
+// backend implements RangeReader and by skipping the start otherwise. The
+// data is opened between rotations of it.
+func readRange(id ID, dtype DataType, offset, length int64) (io.ReadCloser, error) {
+	rotating.RLock()
+	defer rotating.RUnlock()
+	return readDataRange(data, id, dtype, offset, length)
+}
+
+// readDataRange is readRange reading from d
+func readDataRange(d Data, id ID, dtype DataType, offset, length int64) (io.ReadCloser, error) {
+	if rr, ok := d.(RangeReader); ok {
+		return rr.ReadRange(id, dtype, offset, length)
+	}
+
+	r, err := d.Read(id, dtype)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.CopyN(ioutil.Discard, r, offset); err != nil && err != io.EOF {
+		r.Close()
+		return nil, err
+	}
+	if length < 0 {
+		return r, nil
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(r, length), r}, nil
+}
+
+// sharedData returns true if d keeps the data of jobs where every instance
+// sharing a store can read it
+func sharedData(d Data) bool {
+	switch d := d.(type) {
+	case *S3Data:
+		return true
+	case *EncryptedData:
+		return sharedData(d.Data)
+	default:
+		return false
+	}
+}
+
+// appendData opens the data of a job to write after what it holds, with
+// Append if the Data backend is an Appender or else by writing it again
+func appendData(id ID, dtype DataType) (io.WriteCloser, error) {
+	if a, ok := data.(Appender); ok {
+		return a.Append(id, dtype)
+	}
+	return rewriteData(data, id, dtype)
+}
+
+// rewriteData writes the data of a job held by d again and returns the
+// writer to write after it
+func rewriteData(d Data, id ID, dtype DataType) (io.WriteCloser, error) {
+	var buf []byte
+	r, err := d.Read(id, dtype)
+	if err == nil {
+		buf, err = ioutil.ReadAll(r)
+		r.Close()
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	w, err := d.Write(id, dtype)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(buf); err != nil {
+		w.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// tailChunkSize is how much data is read at once when looking for the
+// start of the last lines of data
+const tailChunkSize = 64 * 1024
+
+// tailOffset returns the offset of the start of the last n lines of the data
+// of a job. A last line without a trailing newline counts as a line.
+func tailOffset(id ID, dtype DataType, n int) (int64, error) {
+	size, err := data.Size(id, dtype)
+	if err != nil {
+		return 0, err
+	}
+	if n <= 0 {
+		return size, nil
+	}
+
+	end := size
+	for end > 0 {
+		start := end - tailChunkSize
+		if start < 0 {
+			start = 0
+		}
+
+		r, err := readRange(id, dtype, start, end-start)
+		if err != nil {
+			return 0, err
+		}
+		buf, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil {
+			return 0, err
+		}
+
+		for i := len(buf) - 1; i >= 0; i-- {
+			// The newline ending the data does not start a line
+			if buf[i] != '\n' || start+int64(i) == size-1 {
+				continue
+			}
+			if n--; n == 0 {
+				return start + int64(i) + 1, nil
+			}
+		}
+		end = start
+	}
+	return 0, nil
+}
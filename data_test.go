@@ -0,0 +1,111 @@
+package je
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalDataReadRange(t *testing.T) {
+	withGlobals(t)
+	assert := assert.New(t)
+
+	_, err := InitData(t.TempDir())
+	require.NoError(t, err)
+	writeTestData(t, 1, DATA_OUTPUT, "hello world")
+
+	for _, test := range []struct {
+		offset, length int64
+		expected       string
+	}{
+		{0, -1, "hello world"},
+		{6, -1, "world"},
+		{0, 5, "hello"},
+		{6, 100, "world"},
+		{20, -1, ""},
+	} {
+		r, err := data.(RangeReader).ReadRange(1, DATA_OUTPUT, test.offset, test.length)
+		require.NoError(t, err)
+		buf, err := ioutil.ReadAll(r)
+		r.Close()
+		require.NoError(t, err)
+		assert.Equal(test.expected, string(buf))
+	}
+}
+
+func TestLocalDataAppend(t *testing.T) {
+	withGlobals(t)
+	assert := assert.New(t)
+
+	_, err := InitData(t.TempDir())
+	require.NoError(t, err)
+
+	appendTestData := func(id ID, s string) {
+		w, err := data.(Appender).Append(id, DATA_LOGS)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(s))
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+	}
+
+	appendTestData(1, "hello")
+	appendTestData(1, " world")
+	assert.Equal("hello world", readTestData(t, 1, DATA_LOGS))
+
+	// Compressed data is appended to uncompressed
+	writeTestData(t, 2, DATA_LOGS, "hello")
+	require.NoError(t, data.(Compressor).Compress(2, COMPRESS_GZIP))
+	appendTestData(2, " world")
+	assert.Equal("hello world", readTestData(t, 2, DATA_LOGS))
+}
+
+func TestJobLog(t *testing.T) {
+	withGlobals(t)
+	assert := assert.New(t)
+
+	t.Cleanup(func() { DataKeys = nil })
+
+	for _, keys := range []string{"", testKey1} {
+		var err error
+		DataKeys = nil
+		if keys != "" {
+			DataKeys, err = ParseKeyring(keys)
+			require.NoError(t, err)
+		}
+		_, err = InitData(t.TempDir())
+		require.NoError(t, err)
+
+		// Messages are added to what the job logged
+		job := &Job{ID: 1}
+		writeTestData(t, job.ID, DATA_LOGS, "started\n")
+		require.NoError(t, job.Log("something went wrong"))
+		require.NoError(t, job.Log("giving up\n"))
+		assert.Equal("started\nsomething went wrong\ngiving up\n", readTestData(t, job.ID, DATA_LOGS))
+	}
+}
+
+func TestTailOffset(t *testing.T) {
+	withGlobals(t)
+	assert := assert.New(t)
+
+	_, err := InitData(t.TempDir())
+	require.NoError(t, err)
+	writeTestData(t, 1, DATA_OUTPUT, "one\ntwo\nthree\n")
+	writeTestData(t, 2, DATA_OUTPUT, "one\ntwo\nthree")
+
+	for _, id := range []ID{1, 2} {
+		for n, expected := range map[int]string{0: "", 1: "three", 2: "two\nthree", 3: "one\ntwo\nthree", 10: "one\ntwo\nthree"} {
+			offset, err := tailOffset(id, DATA_OUTPUT, n)
+			require.NoError(t, err)
+			r, err := readRange(id, DATA_OUTPUT, offset, -1)
+			require.NoError(t, err)
+			buf, err := ioutil.ReadAll(r)
+			r.Close()
+			require.NoError(t, err)
+			assert.Equal(expected, strings.TrimSuffix(string(buf), "\n"), "#%d tail %d", id, n)
+		}
+	}
+}
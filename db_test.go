@@ -2,6 +2,7 @@ package je
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -13,3 +14,108 @@ func TestInitDB_Valid(t *testing.T) {
 	assert.NoError(err)
 	//assert.Implements((*Store)(nil), store)
 }
+
+func TestSearch_Paging(t *testing.T) {
+	assert := assert.New(t)
+
+	store, err := NewMemoryStore()
+	assert.NoError(err)
+	defer store.Close()
+
+	now := time.Now()
+	for i := 1; i <= 5; i++ {
+		job := &Job{
+			ID:        store.NextId(),
+			Name:      "paging",
+			State:     STATE_STOPPED,
+			CreatedAt: now.Add(time.Duration(i) * time.Second),
+			StartedAt: now,
+			StoppedAt: now.Add(time.Duration(10-i) * time.Second),
+		}
+		assert.NoError(store.Save(job))
+	}
+
+	res, err := store.Search("name:paging", &SearchOptions{Limit: 2})
+	assert.NoError(err)
+	assert.Equal(uint64(5), res.Total)
+	assert.Len(res.Jobs, 2)
+	assert.Equal(ID(1), res.Jobs[0].ID)
+	assert.NotEmpty(res.Next)
+
+	var ids []ID
+	options := &SearchOptions{Limit: 2}
+	for {
+		res, err := store.Search("name:paging", options)
+		assert.NoError(err)
+		for _, job := range res.Jobs {
+			ids = append(ids, job.ID)
+		}
+		if res.Next == "" {
+			break
+		}
+		options.Cursor = res.Next
+	}
+	assert.Equal([]ID{1, 2, 3, 4, 5}, ids)
+
+	res, err = store.Search("", &SearchOptions{Offset: 3, Sort: "duration", Order: "asc"})
+	assert.NoError(err)
+	assert.Len(res.Jobs, 2)
+	assert.Equal(ID(2), res.Jobs[0].ID)
+	assert.Equal(ID(1), res.Jobs[1].ID)
+
+	_, err = store.Search("", &SearchOptions{Sort: "bogus"})
+	assert.Error(err)
+}
+
+func TestSearch_Ranges(t *testing.T) {
+	assert := assert.New(t)
+
+	store, err := NewMemoryStore()
+	assert.NoError(err)
+	defer store.Close()
+
+	now := time.Now()
+	jobs := []*Job{
+		{Name: "backup", Status: 1, CreatedAt: now.Add(-48 * time.Hour), StartedAt: now.Add(-48 * time.Hour), StoppedAt: now.Add(-47 * time.Hour)},
+		{Name: "backup", Status: 1, CreatedAt: now.Add(-2 * time.Hour), StartedAt: now.Add(-2 * time.Hour), StoppedAt: now.Add(-2*time.Hour + time.Minute)},
+		{Name: "backup", Status: 0, CreatedAt: now.Add(-1 * time.Hour), StartedAt: now.Add(-1 * time.Hour), StoppedAt: now.Add(-1*time.Hour + 20*time.Minute)},
+	}
+	for _, job := range jobs {
+		job.ID = store.NextId()
+		job.State = STATE_STOPPED
+		assert.NoError(store.Save(job))
+	}
+
+	tests := []struct {
+		q   string
+		ids []ID
+	}{
+		{`+name:backup +status:>=1 +created:>-24h`, []ID{2}},
+		{`+duration:>10m`, []ID{1, 3}},
+		{`+duration:<=3600`, []ID{1, 2, 3}},
+		{`+created:<"` + now.Add(-24*time.Hour).Format(time.RFC3339) + `"`, []ID{1}},
+		{`+status:0`, []ID{3}},
+	}
+
+	for _, test := range tests {
+		res, err := store.Search(test.q, nil)
+		assert.NoError(err)
+
+		var ids []ID
+		for _, job := range res.Jobs {
+			ids = append(ids, job.ID)
+		}
+		assert.Equal(test.ids, ids, test.q)
+	}
+}
+
+func TestRewriteQuery(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	assert.Equal(`duration:>600`, rewriteQuery(`duration:>10m`, now))
+	assert.Equal(`+created:>"2020-04-30T12:00:00Z"`, rewriteQuery(`+created:>-24h`, now))
+	assert.Equal(`name:backup stopped:<="2020-05-01T11:30:00Z"`, rewriteQuery(`name:backup stopped:<=30m`, now))
+	assert.Equal(`created:>"2020-01-01T00:00:00Z"`, rewriteQuery(`created:>"2020-01-01T00:00:00Z"`, now))
+}
@@ -0,0 +1,169 @@
+package je
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/rs/xid"
+
+	"github.com/prologic/je/worker"
+)
+
+// DefaultClaimInterval is how often a server sharing its store with other
+// instances polls it for waiting jobs
+const DefaultClaimInterval = time.Second
+
+// claimedJob is a job claimed from a shared store. It is already marked as
+// running so it must not be put back into the waiting state when queued.
+type claimedJob struct {
+	*Job
+}
+
+func (j claimedJob) Enqueue() error {
+	return nil
+}
+
+// dispatcher claims waiting jobs from a store shared with other instances
+// and runs them in the local worker pool. Jobs created by this instance are
+// tracked until they finish so that anyone waiting on them is notified even
+// if another instance ran them.
+type dispatcher struct {
+	sync.Mutex
+
+	id       string
+	claimer  Claimer
+	pool     *worker.Pool
+	interval time.Duration
+
+	pending map[ID]*Job
+
+	wake chan struct{}
+	stop chan struct{}
+}
+
+func newDispatcher(claimer Claimer, pool *worker.Pool, interval time.Duration) *dispatcher {
+	return &dispatcher{
+		id:       xid.New().String(),
+		claimer:  claimer,
+		pool:     pool,
+		interval: interval,
+		pending:  make(map[ID]*Job),
+		wake:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+	}
+}
+
+// Enqueue marks a job as waiting to be claimed by any instance
+func (d *dispatcher) Enqueue(job *Job) error {
+	d.Lock()
+	d.pending[job.ID] = job
+	d.Unlock()
+
+	if err := job.Enqueue(); err != nil {
+		d.Lock()
+		delete(d.pending, job.ID)
+		d.Unlock()
+		return err
+	}
+
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// Run claims jobs whenever there are idle workers until stopped
+func (d *dispatcher) Run() {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		d.claim()
+		d.check()
+
+		select {
+		case <-ticker.C:
+		case <-d.wake:
+		case <-d.stop:
+			return
+		}
+	}
+}
+
+func (d *dispatcher) Stop() {
+	close(d.stop)
+}
+
+func (d *dispatcher) claim() {
+	for d.pool.Idle() > 0 {
+		job, err := d.claimer.Claim(d.id)
+		if err != nil {
+			log.Errorf("error claiming job: %s", err)
+			return
+		}
+		if job == nil {
+			return
+		}
+
+		// Run our own copy of jobs created here so waiters are notified
+		d.Lock()
+		if local, ok := d.pending[job.ID]; ok {
+			delete(d.pending, job.ID)
+			local.Lock()
+			local.Worker = job.Worker
+			local.State = job.State
+			local.StartedAt = job.StartedAt
+			local.Unlock()
+			job = local
+		}
+		d.Unlock()
+
+		log.Debugf("claimed job #%d", job.ID)
+
+		if err := d.pool.Submit(claimedJob{job}); err != nil {
+			log.Errorf("error submitting claimed job #%d: %s", job.ID, err)
+			if err := job.Enqueue(); err != nil {
+				log.Errorf("error releasing job #%d: %s", job.ID, err)
+			}
+			return
+		}
+	}
+}
+
+// check notifies waiters of jobs created here that another instance ran
+func (d *dispatcher) check() {
+	d.Lock()
+	defer d.Unlock()
+
+	for id, local := range d.pending {
+		job, err := db.Get(id)
+		if err == nil && !job.State.Done() {
+			continue
+		}
+
+		if err != nil {
+			// Deleted jobs are as good as finished
+			if _, ok := err.(*KeyError); !ok {
+				log.Warnf("error checking job #%d: %s", id, err)
+				continue
+			}
+		} else {
+			local.Lock()
+			local.Worker = job.Worker
+			local.State = job.State
+			local.Status = job.Status
+			local.StartedAt = job.StartedAt
+			local.StoppedAt = job.StoppedAt
+			local.KilledAt = job.KilledAt
+			local.ErroredAt = job.ErroredAt
+			local.Unlock()
+		}
+
+		delete(d.pending, id)
+		local.done <- true
+	}
+}
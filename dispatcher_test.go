@@ -0,0 +1,112 @@
+package je
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/prologic/je/worker"
+)
+
+// testClaimer claims jobs from the global store in the order given
+type testClaimer struct {
+	sync.Mutex
+	ids []ID
+}
+
+func (c *testClaimer) Claim(worker string) (*Job, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	if len(c.ids) == 0 {
+		return nil, nil
+	}
+
+	id := c.ids[0]
+	c.ids = c.ids[1:]
+
+	job, err := db.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	job.Lock()
+	defer job.Unlock()
+	job.Worker = worker
+	job.State = STATE_RUNNING
+	job.StartedAt = time.Now()
+	return job, db.Save(job)
+}
+
+func newTestJob(t *testing.T, name string, args ...string) *Job {
+	job, err := NewJob(name, args, false)
+	require.NoError(t, err)
+
+	input, err := data.Write(job.ID, DATA_INPUT)
+	require.NoError(t, err)
+	require.NoError(t, input.Close())
+
+	return job
+}
+
+func TestDispatcher(t *testing.T) {
+	assert := assert.New(t)
+
+	claimer := &testClaimer{}
+	pool := worker.NewPool(1, 1)
+	d := newDispatcher(claimer, pool, 10*time.Millisecond)
+	go d.Run()
+	defer d.Stop()
+
+	// Claimed and run here
+	local := newTestJob(t, "true")
+	require.NoError(t, d.Enqueue(local))
+	claimer.Lock()
+	claimer.ids = append(claimer.ids, local.ID)
+	claimer.Unlock()
+
+	local.Wait()
+	assert.Equal(STATE_STOPPED, local.State)
+
+	// Run by another instance
+	remote := newTestJob(t, "true")
+	require.NoError(t, d.Enqueue(remote))
+	assert.Equal(STATE_WAITING, remote.State)
+
+	require.NoError(t, db.Save(&Job{
+		ID:        remote.ID,
+		Name:      "true",
+		Worker:    "elsewhere",
+		State:     STATE_STOPPED,
+		CreatedAt: remote.CreatedAt,
+		StartedAt: time.Now(),
+		StoppedAt: time.Now(),
+	}))
+
+	remote.Wait()
+	assert.Equal(STATE_STOPPED, remote.State)
+	assert.Equal("elsewhere", remote.Worker)
+}
+
+func TestNewServerDispatcher(t *testing.T) {
+	withGlobals(t)
+	assert := assert.New(t)
+
+	db = struct {
+		Store
+		Claimer
+	}{db, &testClaimer{}}
+
+	// Jobs are only shared if their data is
+	_, err := InitData(t.TempDir())
+	require.NoError(t, err)
+	assert.Nil(NewServer(":0", nil).dispatcher)
+
+	data = &S3Data{}
+	assert.NotNil(NewServer(":0", nil).dispatcher)
+	data = &EncryptedData{Data: &S3Data{}}
+	assert.NotNil(NewServer(":0", nil).dispatcher)
+}
@@ -0,0 +1,800 @@
+package je
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// encryptedMagic starts every encrypted file. It is followed by the length
+// of the id of the key the file is encrypted with, the key id and the nonce
+// the nonces of its chunks are derived from.
+var encryptedMagic = []byte("\x89JEEN2\r\n")
+
+// encryptedMagicV1 starts files encrypted before their last chunk was
+// marked, which are read without checking that they are complete
+var encryptedMagicV1 = []byte("\x89JEENC\r\n")
+
+// finalChunkFlag is set in the size of the last chunk of an encrypted file,
+// which is empty and sealed with the header followed by 1 as additional
+// data so that truncating the file is detected
+const finalChunkFlag = 1 << 31
+
+const (
+	// encryptedNonceSize is the size of the AES-GCM nonces
+	encryptedNonceSize = 12
+	// maxEncryptedChunk is the most data encrypted in one chunk, longer
+	// writes are split
+	maxEncryptedChunk = 64 * 1024
+)
+
+// ErrUnknownKey is returned when reading data encrypted with a key that is
+// not in the keyring
+var ErrUnknownKey = errors.New("data encrypted with unknown key")
+
+// ErrTruncated is returned when reading encrypted data which ends before its
+// last chunk and is not being written
+var ErrTruncated = errors.New("encrypted data is truncated")
+
+// DataKeys are the keys the data of jobs is encrypted with by every Data
+// backend set up with InitData or nil to keep it unencrypted
+var DataKeys *Keyring
+
+// Keyring holds the AES keys data is encrypted with by their id. New data is
+// encrypted with the first key, the others are only used to decrypt data
+// encrypted before the keys were rotated.
+type Keyring struct {
+	current string
+	keys    map[string]cipher.AEAD
+}
+
+// ParseKeyring parses keys given as <id>:<base64 key> separated by
+// whitespace or newlines. Lines starting with # are ignored. Keys must be 16,
+// 24 or 32 bytes long for AES-128, AES-192 or AES-256.
+func ParseKeyring(s string) (*Keyring, error) {
+	keyring := &Keyring{keys: make(map[string]cipher.AEAD)}
+
+	for _, line := range strings.Split(s, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		for _, field := range strings.Fields(line) {
+			parts := strings.SplitN(field, ":", 2)
+			if len(parts) != 2 || parts[0] == "" || len(parts[0]) > 255 {
+				return nil, fmt.Errorf("invalid key %q: expected <id>:<base64 key>", field)
+			}
+			id := parts[0]
+
+			key, err := base64.StdEncoding.DecodeString(parts[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid key %s: %s", id, err)
+			}
+			block, err := aes.NewCipher(key)
+			if err != nil {
+				return nil, fmt.Errorf("invalid key %s: %s", id, err)
+			}
+			aead, err := cipher.NewGCM(block)
+			if err != nil {
+				return nil, fmt.Errorf("invalid key %s: %s", id, err)
+			}
+
+			if _, ok := keyring.keys[id]; ok {
+				return nil, fmt.Errorf("duplicate key %s", id)
+			}
+			if keyring.current == "" {
+				keyring.current = id
+			}
+			keyring.keys[id] = aead
+		}
+	}
+
+	if keyring.current == "" {
+		return nil, fmt.Errorf("no keys")
+	}
+	return keyring, nil
+}
+
+// LoadKeyring reads the keys in the keyfile at path (see ParseKeyring) or,
+// if path is empty, in $JE_ENCRYPTION_KEYS. It returns nil if neither is
+// given.
+func LoadKeyring(path string) (*Keyring, error) {
+	if path == "" {
+		if s := os.Getenv("JE_ENCRYPTION_KEYS"); s != "" {
+			return ParseKeyring(s)
+		}
+		return nil, nil
+	}
+
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseKeyring(string(buf))
+}
+
+// Current returns the id of the key new data is encrypted with
+func (k *Keyring) Current() string {
+	return k.current
+}
+
+// EncryptedData encrypts the data of jobs written to another Data backend
+// with AES-GCM and decrypts it when it is read. Data is encrypted in chunks,
+// one per write, so that it can be read while it is written, and ends with
+// an empty last chunk so that reading it truncated fails once written. Data
+// written before encryption was enabled is read as is.
+type EncryptedData struct {
+	Data
+	keys *Keyring
+
+	sync.Mutex
+	indexes map[string]*chunkIndex
+	// writing counts the writers of the data of each job
+	writing map[string]int
+}
+
+// NewEncryptedData returns data encrypting and decrypting d with keys
+func NewEncryptedData(d Data, keys *Keyring) *EncryptedData {
+	return &EncryptedData{Data: d, keys: keys}
+}
+
+// encryptedHeader returns the header of a file encrypted with key id and
+// nonce, which is also the additional data of its chunks
+func encryptedHeader(id string, nonce []byte) []byte {
+	header := append([]byte{}, encryptedMagic...)
+	header = append(header, byte(len(id)))
+	header = append(header, id...)
+	return append(header, nonce...)
+}
+
+// finalChunkData returns the additional data of the last chunk of a file
+// with the given header
+func finalChunkData(header []byte) []byte {
+	return append(append([]byte{}, header...), 1)
+}
+
+// dataKey identifies the data of a job in the state of EncryptedData
+func dataKey(id ID, dtype DataType) string {
+	return fmt.Sprintf("%d.%s", id, dtype)
+}
+
+// writingData records that the data of a job is written, or no longer is
+// if n is -1, so that reading it up to an incomplete chunk is not mistaken
+// for reading truncated data
+func (d *EncryptedData) writingData(key string, n int) {
+	d.Lock()
+	defer d.Unlock()
+
+	if d.writing == nil {
+		d.writing = make(map[string]int)
+	}
+	if d.writing[key] += n; d.writing[key] <= 0 {
+		delete(d.writing, key)
+	}
+}
+
+// isWriting returns true if the data of a job is being written
+func (d *EncryptedData) isWriting(id ID, dtype DataType) bool {
+	d.Lock()
+	defer d.Unlock()
+	return d.writing[dataKey(id, dtype)] > 0
+}
+
+// chunkNonce returns the nonce of the nth chunk of a file
+func chunkNonce(nonce []byte, n uint64) []byte {
+	chunk := append([]byte{}, nonce...)
+	counter := binary.BigEndian.Uint64(chunk[4:])
+	binary.BigEndian.PutUint64(chunk[4:], counter^n)
+	return chunk
+}
+
+func (d *EncryptedData) Write(id ID, dtype DataType) (io.WriteCloser, error) {
+	key := dataKey(id, dtype)
+	d.writingData(key, 1)
+
+	w, err := d.Data.Write(id, dtype)
+	if err != nil {
+		d.writingData(key, -1)
+		return nil, err
+	}
+	e, err := d.encrypt(w)
+	if err != nil {
+		d.writingData(key, -1)
+		return nil, err
+	}
+	e.done = func() { d.writingData(key, -1) }
+	return e, nil
+}
+
+func (d *EncryptedData) WriteArtifact(id ID, name string) (io.WriteCloser, error) {
+	w, err := d.Data.WriteArtifact(id, name)
+	if err != nil {
+		return nil, err
+	}
+	return d.encrypt(w)
+}
+
+func (d *EncryptedData) WriteInputFile(id ID, name string) (io.WriteCloser, error) {
+	w, err := d.Data.WriteInputFile(id, name)
+	if err != nil {
+		return nil, err
+	}
+	return d.encrypt(w)
+}
+
+// encrypt returns a writer encrypting what is written to w
+func (d *EncryptedData) encrypt(w io.WriteCloser) (*encryptWriter, error) {
+	nonce := make([]byte, encryptedNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		w.Close()
+		return nil, err
+	}
+	key := d.keys.current
+	header := encryptedHeader(key, nonce)
+
+	if _, err := w.Write(header); err != nil {
+		w.Close()
+		return nil, err
+	}
+
+	return &encryptWriter{w: w, aead: d.keys.keys[key], header: header, nonce: nonce}, nil
+}
+
+// encryptWriter encrypts each write as one or more chunks of a 4 byte
+// length followed by the sealed data and ends them with an empty last chunk
+// when closed
+type encryptWriter struct {
+	w      io.WriteCloser
+	aead   cipher.AEAD
+	header []byte
+	nonce  []byte
+	chunks uint64
+	// done is called once closed
+	done func()
+}
+
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := len(p)
+		if n > maxEncryptedChunk {
+			n = maxEncryptedChunk
+		}
+
+		chunk := make([]byte, 4, 4+n+e.aead.Overhead())
+		chunk = e.aead.Seal(chunk, chunkNonce(e.nonce, e.chunks), p[:n], e.header)
+		binary.BigEndian.PutUint32(chunk, uint32(len(chunk)-4))
+		if _, err := e.w.Write(chunk); err != nil {
+			return written, err
+		}
+
+		e.chunks++
+		written += n
+		p = p[n:]
+	}
+	return written, nil
+}
+
+func (e *encryptWriter) Close() error {
+	if e.done != nil {
+		defer e.done()
+	}
+
+	chunk := make([]byte, 4, 4+e.aead.Overhead())
+	chunk = e.aead.Seal(chunk, chunkNonce(e.nonce, e.chunks), nil, finalChunkData(e.header))
+	binary.BigEndian.PutUint32(chunk, uint32(len(chunk)-4)|finalChunkFlag)
+	if _, err := e.w.Write(chunk); err != nil {
+		e.w.Close()
+		return err
+	}
+	return e.w.Close()
+}
+
+// encryptedFile is what the header of an encrypted file holds
+type encryptedFile struct {
+	header []byte
+	nonce  []byte
+	aead   cipher.AEAD
+	// final is set if the file ends with a last chunk
+	final bool
+}
+
+// end returns the error of reading up to the end of the data of a file
+// before its last chunk: none if it is being written or predates them
+func (f *encryptedFile) end(live bool) error {
+	if !f.final || live {
+		return io.EOF
+	}
+	return ErrTruncated
+}
+
+// readHeader reads the header of the encrypted data read by br or returns nil
+// if the data is not encrypted. Data too short to hold its header, as when it
+// has only just been created, fails with io.ErrUnexpectedEOF.
+func (d *EncryptedData) readHeader(br *bufio.Reader) (*encryptedFile, error) {
+	magic, err := br.Peek(len(encryptedMagic))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	final := bytes.Equal(magic, encryptedMagic)
+	if !final && !bytes.Equal(magic, encryptedMagicV1) {
+		return nil, nil
+	}
+
+	prefix := make([]byte, len(encryptedMagic)+1)
+	if _, err := io.ReadFull(br, prefix); err != nil {
+		return nil, err
+	}
+	rest := make([]byte, int(prefix[len(prefix)-1])+encryptedNonceSize)
+	if _, err := io.ReadFull(br, rest); err != nil {
+		return nil, err
+	}
+	key := string(rest[:len(rest)-encryptedNonceSize])
+
+	aead, ok := d.keys.keys[key]
+	if !ok {
+		return nil, fmt.Errorf("%w %s", ErrUnknownKey, key)
+	}
+	return &encryptedFile{
+		header: append(prefix, rest...),
+		nonce:  rest[len(key):],
+		aead:   aead,
+		final:  final,
+	}, nil
+}
+
+// decrypt returns a reader decrypting r if it is encrypted or reading it as
+// is if it is not
+func (d *EncryptedData) decrypt(r io.ReadCloser) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	file, err := d.readHeader(br)
+	if err != nil {
+		r.Close()
+		if err == io.ErrUnexpectedEOF {
+			return nil, ErrTruncated
+		}
+		return nil, err
+	}
+	if file == nil {
+		return struct {
+			io.Reader
+			io.Closer
+		}{br, r}, nil
+	}
+
+	start := chunkMark{cipher: int64(len(file.header))}
+	return &decryptReader{r: br, c: r, file: file, pos: start}, nil
+}
+
+// chunkMark is where a chunk of an encrypted file starts
+type chunkMark struct {
+	// plain is the offset of its decrypted data
+	plain int64
+	// cipher is its offset in the file
+	cipher int64
+	// chunk is its index
+	chunk uint64
+}
+
+// chunkIndexInterval is how much decrypted data there is at most between the
+// chunks recorded by a chunkIndex
+const chunkIndexInterval = 256 * 1024
+
+// maxChunkIndexes is the most encrypted files whose chunks are recorded
+const maxChunkIndexes = 1024
+
+// chunkIndex records where the chunks of an encrypted file start, one every
+// chunkIndexInterval bytes of decrypted data, and where the last chunk read
+// ends so that it can be read from any offset and its size known without
+// decrypting everything before.
+type chunkIndex struct {
+	sync.Mutex
+
+	// nonce identifies the file, which is given a new one when rewritten
+	nonce []byte
+	marks []chunkMark
+	end   chunkMark
+}
+
+// seek returns the last chunk recorded starting at or before offset
+func (x *chunkIndex) seek(offset int64) chunkMark {
+	x.Lock()
+	defer x.Unlock()
+
+	if x.end.plain <= offset {
+		return x.end
+	}
+	i := sort.Search(len(x.marks), func(i int) bool { return x.marks[i].plain > offset })
+	return x.marks[i-1]
+}
+
+// record records that a chunk ends at m
+func (x *chunkIndex) record(m chunkMark) {
+	x.Lock()
+	defer x.Unlock()
+
+	if m.cipher > x.end.cipher {
+		x.end = m
+	}
+	if last := x.marks[len(x.marks)-1]; m.plain-last.plain >= chunkIndexInterval {
+		x.marks = append(x.marks, m)
+	}
+}
+
+// chunkIndex returns the index of the chunks of the data of a job
+func (d *EncryptedData) chunkIndex(id ID, dtype DataType, file *encryptedFile) *chunkIndex {
+	d.Lock()
+	defer d.Unlock()
+
+	key := fmt.Sprintf("%d.%s", id, dtype)
+	x, ok := d.indexes[key]
+	if ok && bytes.Equal(x.nonce, file.nonce) {
+		return x
+	}
+
+	if d.indexes == nil {
+		d.indexes = make(map[string]*chunkIndex)
+	}
+	if !ok && len(d.indexes) >= maxChunkIndexes {
+		for key := range d.indexes {
+			delete(d.indexes, key)
+			break
+		}
+	}
+	start := chunkMark{cipher: int64(len(file.header))}
+	x = &chunkIndex{nonce: file.nonce, marks: []chunkMark{start}, end: start}
+	d.indexes[key] = x
+	return x
+}
+
+// readChunkSize reads the size of the next chunk of an encrypted file and
+// whether it is its last. It returns io.EOF if there is no complete size to
+// read.
+func readChunkSize(r io.Reader, file *encryptedFile) (int64, bool, error) {
+	size := make([]byte, 4)
+	if _, err := io.ReadFull(r, size); err == io.ErrUnexpectedEOF {
+		return 0, false, io.EOF
+	} else if err != nil {
+		return 0, false, err
+	}
+
+	n := binary.BigEndian.Uint32(size)
+	final := file.final && n&finalChunkFlag != 0
+	n &^= finalChunkFlag
+	overhead := uint32(file.aead.Overhead())
+	if n < overhead || n > maxEncryptedChunk+overhead || final && n != overhead {
+		return 0, false, fmt.Errorf("invalid encrypted chunk of %d bytes", n)
+	}
+	return int64(n), final, nil
+}
+
+// decryptReader decrypts the chunks written by encryptWriter from pos,
+// recording them in index if it has one. Data ending before its last chunk
+// fails with ErrTruncated unless it is live, i.e. being written, in which
+// case the chunks written so far are read.
+type decryptReader struct {
+	r     io.Reader
+	c     io.Closer
+	file  *encryptedFile
+	index *chunkIndex
+	pos   chunkMark
+	live  bool
+	buf   []byte
+	// final is set once the last chunk has been read
+	final bool
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.buf) == 0 {
+		if d.final {
+			if _, err := io.ReadFull(d.r, make([]byte, 1)); err == nil {
+				return 0, fmt.Errorf("invalid encrypted data after its last chunk")
+			} else if err != io.EOF {
+				return 0, err
+			}
+			return 0, io.EOF
+		}
+
+		n, final, err := readChunkSize(d.r, d.file)
+		if err == io.EOF {
+			return 0, d.file.end(d.live)
+		} else if err != nil {
+			return 0, err
+		}
+		chunk := make([]byte, n)
+		if _, err := io.ReadFull(d.r, chunk); err == io.EOF || err == io.ErrUnexpectedEOF {
+			return 0, d.file.end(d.live)
+		} else if err != nil {
+			return 0, err
+		}
+
+		aad := d.file.header
+		if final {
+			aad = finalChunkData(aad)
+		}
+		buf, err := d.file.aead.Open(chunk[:0], chunkNonce(d.file.nonce, d.pos.chunk), chunk, aad)
+		if err != nil {
+			return 0, fmt.Errorf("error decrypting chunk %d: %s", d.pos.chunk, err)
+		}
+		// The last chunk is not recorded so that reads from the end
+		// still check it
+		if d.final = final; final {
+			continue
+		}
+		d.pos = chunkMark{d.pos.plain + int64(len(buf)), d.pos.cipher + 4 + n, d.pos.chunk + 1}
+		if d.index != nil {
+			d.index.record(d.pos)
+		}
+		d.buf = buf
+	}
+
+	n := copy(p, d.buf)
+	d.buf = d.buf[n:]
+	return n, nil
+}
+
+func (d *decryptReader) Close() error {
+	return d.c.Close()
+}
+
+func (d *EncryptedData) Read(id ID, dtype DataType) (io.ReadCloser, error) {
+	return d.ReadRange(id, dtype, 0, -1)
+}
+
+func (d *EncryptedData) ReadArtifact(id ID, name string) (io.ReadCloser, error) {
+	r, err := d.Data.ReadArtifact(id, name)
+	if err != nil {
+		return nil, err
+	}
+	return d.decrypt(r)
+}
+
+func (d *EncryptedData) ReadInputFile(id ID, name string) (io.ReadCloser, error) {
+	r, err := d.Data.ReadInputFile(id, name)
+	if err != nil {
+		return nil, err
+	}
+	return d.decrypt(r)
+}
+
+// open opens the data of a job from the chunk recorded starting at or
+// before offset. It returns nil and the reader of the data from its start
+// if the data is not encrypted.
+func (d *EncryptedData) open(id ID, dtype DataType, offset int64) (*decryptReader, io.ReadCloser, error) {
+	r, err := readDataRange(d.Data, id, dtype, 0, -1)
+	if err != nil {
+		return nil, nil, err
+	}
+	live := d.isWriting(id, dtype)
+	br := bufio.NewReader(r)
+	file, err := d.readHeader(br)
+	if err != nil {
+		r.Close()
+		// The header of data that has only just been created may not
+		// have been written yet
+		if err == io.ErrUnexpectedEOF && live {
+			return nil, ioutil.NopCloser(bytes.NewReader(nil)), nil
+		} else if err == io.ErrUnexpectedEOF {
+			return nil, nil, ErrTruncated
+		}
+		return nil, nil, err
+	}
+	if file == nil {
+		return nil, struct {
+			io.Reader
+			io.Closer
+		}{br, r}, nil
+	}
+
+	index := d.chunkIndex(id, dtype, file)
+	pos := index.seek(offset)
+	if pos.cipher == int64(len(file.header)) {
+		return &decryptReader{r: br, c: r, file: file, index: index, pos: pos, live: live}, nil, nil
+	}
+
+	r.Close()
+	if r, err = readDataRange(d.Data, id, dtype, pos.cipher, -1); err != nil {
+		return nil, nil, err
+	}
+	return &decryptReader{r: bufio.NewReader(r), c: r, file: file, index: index, pos: pos, live: live}, nil, nil
+}
+
+// ReadRange reads length bytes of the decrypted data of a job from offset,
+// or everything from offset if length is negative. Decryption starts from
+// the chunk recorded closest before offset.
+func (d *EncryptedData) ReadRange(id ID, dtype DataType, offset, length int64) (io.ReadCloser, error) {
+	dr, plain, err := d.open(id, dtype, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	var r io.ReadCloser = dr
+	skip := offset
+	if dr != nil {
+		skip -= dr.pos.plain
+	} else {
+		r = plain
+	}
+	if _, err := io.CopyN(ioutil.Discard, r, skip); err != nil && err != io.EOF {
+		r.Close()
+		return nil, err
+	}
+	if length < 0 {
+		return r, nil
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(r, length), r}, nil
+}
+
+// Size returns the size of the decrypted data of a job from the sizes of
+// its chunks, which are only read from the last chunk recorded
+func (d *EncryptedData) Size(id ID, dtype DataType) (int64, error) {
+	dr, plain, err := d.open(id, dtype, math.MaxInt64)
+	if err != nil {
+		return 0, err
+	}
+	if dr == nil {
+		plain.Close()
+		return d.Data.Size(id, dtype)
+	}
+	defer dr.Close()
+
+	pos, err := dr.skip()
+	if err != nil && err != io.EOF {
+		return 0, err
+	}
+	return pos.plain, nil
+}
+
+// skip reads the sizes of the remaining chunks without decrypting them and
+// returns where the last one starts, or where the data ends with
+// the error of reading it to its end if it has no last chunk
+func (d *decryptReader) skip() (chunkMark, error) {
+	overhead := int64(d.file.aead.Overhead())
+	for {
+		n, final, err := readChunkSize(d.r, d.file)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return d.pos, err
+		}
+		if _, err := io.CopyN(ioutil.Discard, d.r, n); err == io.EOF {
+			break
+		} else if err != nil {
+			return d.pos, err
+		}
+		if final {
+			return d.pos, nil
+		}
+		d.pos = chunkMark{d.pos.plain + n - overhead, d.pos.cipher + 4 + n, d.pos.chunk + 1}
+		d.index.record(d.pos)
+	}
+	return d.pos, d.file.end(d.live)
+}
+
+// Append opens the data of a job to write new chunks after its last ones,
+// which replace its last chunk, if the data is encrypted and kept by a
+// backend that can append to it and drop its end. Otherwise the data is
+// encrypted and written again.
+func (d *EncryptedData) Append(id ID, dtype DataType) (io.WriteCloser, error) {
+	a, ok := d.Data.(Appender)
+	t, ok2 := d.Data.(truncater)
+	if !ok || !ok2 {
+		return rewriteData(d, id, dtype)
+	}
+
+	dr, plain, err := d.open(id, dtype, math.MaxInt64)
+	if os.IsNotExist(err) {
+		return d.Write(id, dtype)
+	} else if err != nil {
+		return nil, err
+	}
+	if dr == nil || !dr.file.final {
+		if plain != nil {
+			plain.Close()
+		} else {
+			dr.Close()
+		}
+		return rewriteData(d, id, dtype)
+	}
+
+	pos, err := dr.skip()
+	dr.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	key := dataKey(id, dtype)
+	d.writingData(key, 1)
+	if err := t.truncate(id, dtype, pos.cipher); err != nil {
+		d.writingData(key, -1)
+		return nil, err
+	}
+	w, err := a.Append(id, dtype)
+	if err != nil {
+		d.writingData(key, -1)
+		return nil, err
+	}
+	return &encryptWriter{
+		w:      w,
+		aead:   dr.file.aead,
+		header: dr.file.header,
+		nonce:  dr.file.nonce,
+		chunks: pos.chunk,
+		done:   func() { d.writingData(key, -1) },
+	}, nil
+}
+
+// Tail follows the decrypted data of a job line by line polling it every
+// DataPollInterval
+func (d *EncryptedData) Tail(id ID, dtype DataType, ctx context.Context) (chan string, chan error) {
+	lines := make(chan string)
+	errors := make(chan error)
+
+	go func() {
+		ticker := time.NewTicker(DataPollInterval)
+		defer ticker.Stop()
+
+		var (
+			offset int64
+			buf    []byte
+		)
+		for {
+			r, err := d.ReadRange(id, dtype, offset, -1)
+			if err == nil {
+				var more []byte
+				more, err = ioutil.ReadAll(r)
+				r.Close()
+				offset += int64(len(more))
+				buf = append(buf, more...)
+			}
+			if err != nil && !os.IsNotExist(err) {
+				log.Errorf("error tailing %s data for job #%d: %s", dtype, id, err)
+				select {
+				case errors <- err:
+				case <-ctx.Done():
+				}
+				return
+			}
+
+			for {
+				i := bytes.IndexByte(buf, '\n')
+				if i < 0 {
+					break
+				}
+				select {
+				case lines <- string(buf[:i]):
+				case <-ctx.Done():
+					return
+				}
+				buf = buf[i+1:]
+			}
+
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return lines, errors
+}
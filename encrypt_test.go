@@ -0,0 +1,336 @@
+package je
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testKey1 = "k1:MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="
+	testKey2 = "k2:ZmVkY2JhOTg3NjU0MzIxMA=="
+)
+
+func TestParseKeyring(t *testing.T) {
+	assert := assert.New(t)
+
+	keys, err := ParseKeyring("# rotated on 2020-05-01\n" + testKey2 + "\n" + testKey1 + "\n")
+	require.NoError(t, err)
+	assert.Equal("k2", keys.Current())
+	assert.Len(keys.keys, 2)
+
+	keys, err = ParseKeyring(testKey1 + " " + testKey2)
+	require.NoError(t, err)
+	assert.Equal("k1", keys.Current())
+
+	for _, s := range []string{
+		"",
+		"# no keys",
+		"k1",
+		":MDEyMzQ1Njc4OWFiY2RlZg==",
+		"k1:not-base64",
+		"k1:c2hvcnQ=",
+		testKey1 + " " + testKey1,
+	} {
+		_, err := ParseKeyring(s)
+		assert.Error(err, s)
+	}
+}
+
+func TestEncryptedData(t *testing.T) {
+	withGlobals(t)
+	assert := assert.New(t)
+
+	t.Cleanup(func() { DataKeys = nil })
+
+	var err error
+	DataKeys, err = ParseKeyring(testKey1)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	_, err = InitData(dir)
+	require.NoError(t, err)
+	require.IsType(t, &EncryptedData{}, data)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	lines, errs := data.Tail(1, DATA_INPUT, ctx)
+
+	w, err := data.Write(1, DATA_INPUT)
+	require.NoError(t, err)
+	_, err = w.Write([]byte("secret\n"))
+	require.NoError(t, err)
+	_, err = w.Write(bytes.Repeat([]byte("x"), maxEncryptedChunk+1))
+	require.NoError(t, err)
+	_, err = w.Write([]byte("\ndone\n"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	expected := "secret\n" + strings.Repeat("x", maxEncryptedChunk+1) + "\ndone\n"
+
+	raw, err := ioutil.ReadFile(filepath.Join(dir, "1.in"))
+	require.NoError(t, err)
+	assert.True(bytes.HasPrefix(raw, encryptedMagic))
+	assert.False(bytes.Contains(raw, []byte("secret")))
+
+	assert.Equal(expected, readTestData(t, 1, DATA_INPUT))
+	size, err := data.Size(1, DATA_INPUT)
+	require.NoError(t, err)
+	assert.Equal(int64(len(expected)), size)
+
+	r, err := readRange(1, DATA_INPUT, 2, 4)
+	require.NoError(t, err)
+	buf, err := ioutil.ReadAll(r)
+	r.Close()
+	require.NoError(t, err)
+	assert.Equal("cret", string(buf))
+
+	for _, line := range []string{"secret", strings.Repeat("x", maxEncryptedChunk+1), "done"} {
+		select {
+		case got := <-lines:
+			assert.Equal(line, got)
+		case err := <-errs:
+			require.NoError(t, err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out tailing data")
+		}
+	}
+
+	// Artifacts are encrypted too
+	w, err = data.WriteArtifact(1, "out/report.txt")
+	require.NoError(t, err)
+	_, err = w.Write([]byte("confidential"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	raw2, err := ioutil.ReadFile(filepath.Join(dir, "1.artifacts", "out", "report.txt"))
+	require.NoError(t, err)
+	assert.False(bytes.Contains(raw2, []byte("confidential")))
+	r, err = data.ReadArtifact(1, "out/report.txt")
+	require.NoError(t, err)
+	buf, err = ioutil.ReadAll(r)
+	r.Close()
+	require.NoError(t, err)
+	assert.Equal("confidential", string(buf))
+
+	// Data being written is read up to its last complete chunk
+	w, err = data.Write(2, DATA_OUTPUT)
+	require.NoError(t, err)
+	_, err = w.Write([]byte("partial\n"))
+	require.NoError(t, err)
+	assert.Equal("partial\n", readTestData(t, 2, DATA_OUTPUT))
+	size, err = data.Size(2, DATA_OUTPUT)
+	require.NoError(t, err)
+	assert.Equal(int64(8), size)
+	require.NoError(t, w.Close())
+	assert.Equal("partial\n", readTestData(t, 2, DATA_OUTPUT))
+
+	// Data which is not being written must end with its last chunk
+	final := 4 + 16
+	for i, truncated := range [][]byte{raw[:len(raw)-final], raw[:len(raw)-final-3], raw[:10]} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "2.in"), truncated, 0644))
+		r, err := data.Read(2, DATA_INPUT)
+		if err == nil {
+			_, err = ioutil.ReadAll(r)
+			r.Close()
+		}
+		assert.Equal(ErrTruncated, err, i)
+		_, err = data.Size(2, DATA_INPUT)
+		assert.Equal(ErrTruncated, err, i)
+	}
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "2.in"), append(raw, raw[len(raw)-final:]...), 0644))
+	r, err = data.Read(2, DATA_INPUT)
+	require.NoError(t, err)
+	_, err = ioutil.ReadAll(r)
+	r.Close()
+	assert.Error(err)
+
+	// Data encrypted before its last chunk was marked is still read
+	header := append([]byte{}, encryptedMagicV1...)
+	header = append(append(header, 2), "k1"...)
+	header = append(header, make([]byte, encryptedNonceSize)...)
+	v1 := bytes.NewBuffer(append([]byte{}, header...))
+	ew := &encryptWriter{w: struct {
+		io.Writer
+		io.Closer
+	}{v1, nil}, aead: DataKeys.keys["k1"], header: header, nonce: make([]byte, encryptedNonceSize)}
+	_, err = ew.Write([]byte("before"))
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "2.in"), v1.Bytes(), 0644))
+	assert.Equal("before", readTestData(t, 2, DATA_INPUT))
+
+	// Tampered data fails to decrypt
+	tampered := append([]byte{}, raw...)
+	tampered[len(tampered)-1] ^= 1
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "3.in"), tampered, 0644))
+	r, err = data.Read(3, DATA_INPUT)
+	require.NoError(t, err)
+	_, err = ioutil.ReadAll(r)
+	r.Close()
+	assert.Error(err)
+
+	// Data written before encryption was enabled is read as is
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "4.in"), []byte("plain"), 0644))
+	assert.Equal("plain", readTestData(t, 4, DATA_INPUT))
+
+	// Rotated keys still decrypt data encrypted with the previous key
+	DataKeys, err = ParseKeyring(testKey2 + "\n" + testKey1)
+	require.NoError(t, err)
+	_, err = InitData(dir)
+	require.NoError(t, err)
+	writeTestData(t, 5, DATA_INPUT, "rotated")
+	assert.Equal(expected, readTestData(t, 1, DATA_INPUT))
+	assert.Equal("rotated", readTestData(t, 5, DATA_INPUT))
+
+	DataKeys, err = ParseKeyring(testKey2)
+	require.NoError(t, err)
+	_, err = InitData(dir)
+	require.NoError(t, err)
+	_, err = data.Read(1, DATA_INPUT)
+	assert.True(errors.Is(err, ErrUnknownKey), fmt.Sprint(err))
+
+	_, err = data.Read(6, DATA_INPUT)
+	assert.True(os.IsNotExist(err))
+}
+
+func TestEncryptedDataSeek(t *testing.T) {
+	withGlobals(t)
+	assert := assert.New(t)
+
+	t.Cleanup(func() { DataKeys = nil })
+
+	var err error
+	DataKeys, err = ParseKeyring(testKey1)
+	require.NoError(t, err)
+	dir := t.TempDir()
+	_, err = InitData(dir)
+	require.NoError(t, err)
+
+	var expected bytes.Buffer
+	w, err := data.Write(1, DATA_OUTPUT)
+	require.NoError(t, err)
+	for i := 0; i < 2000; i++ {
+		line := fmt.Sprintf("%04d %s\n", i, strings.Repeat("x", 1000))
+		expected.WriteString(line)
+		_, err = w.Write([]byte(line))
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+
+	size, err := data.Size(1, DATA_OUTPUT)
+	require.NoError(t, err)
+	assert.Equal(int64(expected.Len()), size)
+
+	read := func(offset, length int64) (string, error) {
+		r, err := readRange(1, DATA_OUTPUT, offset, length)
+		require.NoError(t, err)
+		defer r.Close()
+		buf, err := ioutil.ReadAll(r)
+		return string(buf), err
+	}
+	for _, offset := range []int64{0, 1005, 700000, 1500000, size - 10, size + 10} {
+		buf, err := read(offset, 3000)
+		require.NoError(t, err)
+		end := offset + 3000
+		if end > size {
+			end = size
+		}
+		if offset > size {
+			offset = size
+		}
+		assert.Equal(expected.String()[offset:end], buf, offset)
+	}
+
+	// Chunks before the closest one recorded are not decrypted again
+	path := filepath.Join(dir, "1.out")
+	raw, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	raw[100] ^= 1
+	require.NoError(t, ioutil.WriteFile(path, raw, 0644))
+
+	buf, err := read(1500000, 10)
+	require.NoError(t, err)
+	assert.Equal(expected.String()[1500000:1500010], buf)
+	size, err = data.Size(1, DATA_OUTPUT)
+	require.NoError(t, err)
+	assert.Equal(int64(expected.Len()), size)
+	_, err = read(0, 10)
+	assert.Error(err)
+}
+
+func TestEncryptedDataAppend(t *testing.T) {
+	withGlobals(t)
+	assert := assert.New(t)
+
+	t.Cleanup(func() { DataKeys = nil })
+
+	var err error
+	DataKeys, err = ParseKeyring(testKey1)
+	require.NoError(t, err)
+	dir := t.TempDir()
+	_, err = InitData(dir)
+	require.NoError(t, err)
+
+	appendTestData := func(id ID, s string) {
+		w, err := data.(Appender).Append(id, DATA_LOGS)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(s))
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+	}
+
+	// New chunks replace the last one without encrypting the rest again
+	writeTestData(t, 1, DATA_LOGS, "hello")
+	path := filepath.Join(dir, "1.log")
+	before, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	appendTestData(1, " world")
+	appendTestData(1, "\n")
+	after, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	final := 4 + 16
+	assert.Equal(before[:len(before)-final], after[:len(before)-final])
+	assert.Equal("hello world\n", readTestData(t, 1, DATA_LOGS))
+	size, err := data.Size(1, DATA_LOGS)
+	require.NoError(t, err)
+	assert.Equal(int64(12), size)
+
+	require.NoError(t, ioutil.WriteFile(path, after[:len(after)-final], 0644))
+	_, err = data.Size(1, DATA_LOGS)
+	assert.Equal(ErrTruncated, err)
+
+	// Missing and unencrypted data are written encrypted
+	appendTestData(2, "new")
+	assert.Equal("new", readTestData(t, 2, DATA_LOGS))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "3.log"), []byte("plain "), 0644))
+	appendTestData(3, "text")
+	assert.Equal("plain text", readTestData(t, 3, DATA_LOGS))
+	raw, err := ioutil.ReadFile(filepath.Join(dir, "3.log"))
+	require.NoError(t, err)
+	assert.True(bytes.HasPrefix(raw, encryptedMagic))
+}
+
+func TestEncryptedDataCompress(t *testing.T) {
+	withGlobals(t)
+
+	t.Cleanup(func() { DataKeys, DataCompression = nil, "" })
+
+	var err error
+	DataKeys, err = ParseKeyring(testKey1)
+	require.NoError(t, err)
+	DataCompression = COMPRESS_ZSTD
+
+	// Encrypted data cannot be compressed so the setup fails
+	_, err = InitData(t.TempDir())
+	assert.Error(t, err)
+}
@@ -0,0 +1,80 @@
+package je
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// JobEvent records a job moving from one state to another. Stores append an
+// event whenever a job is saved in a state other than the one it was last
+// saved in so that the history of a job can be reconstructed; a job's first
+// event is from the zero state.
+type JobEvent struct {
+	JobID  ID        `json:"job"`
+	From   State     `json:"from"`
+	To     State     `json:"to"`
+	At     time.Time `json:"at"`
+	Worker string    `json:"worker,omitempty"`
+	Reason string    `json:"reason,omitempty"`
+}
+
+// nextEvent returns the event to record when job is saved given the last
+// event recorded for it (nil if none) or nil if its state has not changed.
+// The caller must hold the job's lock, as when saving.
+func nextEvent(job *Job, last *JobEvent) *JobEvent {
+	var from State
+	if last != nil {
+		from = last.To
+	}
+	if job.State == from {
+		return nil
+	}
+
+	return &JobEvent{
+		JobID:  job.ID,
+		From:   from,
+		To:     job.State,
+		At:     job.stateChangedAt(),
+		Worker: job.Worker,
+		Reason: job.reason,
+	}
+}
+
+// lastEvent returns the last of events or nil if there are none
+func lastEvent(events []*JobEvent) *JobEvent {
+	if len(events) == 0 {
+		return nil
+	}
+	return events[len(events)-1]
+}
+
+// appendEvent decodes the events of a job serialized by a store as a JSON
+// array, appends the event for saving job if its state changed and returns
+// them serialized again or nil if there is nothing to record
+func appendEvent(buf []byte, job *Job) ([]byte, error) {
+	var events []*JobEvent
+	if len(buf) > 0 {
+		if err := json.Unmarshal(buf, &events); err != nil {
+			return nil, err
+		}
+	}
+
+	event := nextEvent(job, lastEvent(events))
+	if event == nil {
+		return nil, nil
+	}
+
+	return json.Marshal(append(events, event))
+}
+
+// decodeEvents decodes the events of a job serialized by appendEvent
+func decodeEvents(buf []byte) ([]*JobEvent, error) {
+	var events []*JobEvent
+	if len(buf) == 0 {
+		return events, nil
+	}
+	if err := json.Unmarshal(buf, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
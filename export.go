@@ -0,0 +1,331 @@
+package je
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// exportPageSize is the number of jobs searched for at once when exporting
+const exportPageSize = 1000
+
+// ExportedJob is a job as exported by Export and read by Import. The input,
+// output and logs of the job are only present if requested and are encoded
+// as base64 in JSON. Export streams them from the data of the job while
+// Import reads each job whole.
+type ExportedJob struct {
+	*Job
+
+	Input  []byte `json:"input,omitempty"`
+	Output []byte `json:"output,omitempty"`
+	Logs   []byte `json:"logs,omitempty"`
+}
+
+// ImportResult describes what was imported by Import
+type ImportResult struct {
+	// Imported is the number of jobs imported
+	Imported int `json:"imported"`
+	// Skipped is the number of jobs skipped as a job with the same id was
+	// already in the store
+	Skipped int `json:"skipped"`
+	// Rejected is the number of jobs renumbered that were not imported as
+	// they read their input from or are a stage of a pipeline of a job which
+	// was not imported before them
+	Rejected int `json:"rejected,omitempty"`
+	// Interrupted is the number of jobs imported that were still active
+	// when exported and are imported as errored as nothing runs them
+	Interrupted int `json:"interrupted,omitempty"`
+}
+
+// Export writes the jobs matching the query q, or every job if q is empty,
+// to w as JSON Lines in the order they were created. If withData is true the
+// input, output and logs of each job are included. It returns the number of
+// jobs exported.
+func Export(w io.Writer, q string, withData bool) (int, error) {
+	bw := bufio.NewWriter(w)
+
+	n := 0
+	options := &SearchOptions{Limit: exportPageSize}
+	for {
+		res, err := db.Search(q, options)
+		if err != nil {
+			log.Errorf("error searching jobs to export: %s", err)
+			return n, err
+		}
+
+		for _, job := range res.Jobs {
+			if err := exportJob(bw, job, withData); err != nil {
+				log.Errorf("error exporting job #%d: %s", job.ID, err)
+				return n, err
+			}
+			n++
+		}
+
+		if res.Next == "" {
+			break
+		}
+		options.Cursor = res.Next
+	}
+
+	return n, bw.Flush()
+}
+
+// exportFields are the fields of an ExportedJob holding its data
+var exportFields = []struct {
+	name  string
+	dtype DataType
+}{
+	{"input", DATA_INPUT},
+	{"output", DATA_OUTPUT},
+	{"logs", DATA_LOGS},
+}
+
+// exportJob writes job to w as an ExportedJob on a line of its own. Its data
+// is streamed into the line as base64 so that it is never held in memory.
+func exportJob(w *bufio.Writer, job *Job, withData bool) error {
+	job.RLock()
+	buf, err := json.Marshal(job)
+	job.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	if !withData {
+		w.Write(buf)
+		return w.WriteByte('\n')
+	}
+
+	// The data is written as more fields of the object
+	w.Write(buf[:len(buf)-1])
+	sep := ","
+	if len(buf) == 2 {
+		sep = ""
+	}
+	for _, field := range exportFields {
+		var size int64
+		r, err := readKept(job, field.dtype, func(n int64) (int64, int64, error) {
+			size = n
+			return 0, n, nil
+		})
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			log.Errorf("error reading %s data for job #%d: %s", field.dtype, job.ID, err)
+			return err
+		}
+		if size == 0 {
+			r.Close()
+			continue
+		}
+
+		fmt.Fprintf(w, `%s"%s":"`, sep, field.name)
+		enc := base64.NewEncoder(base64.StdEncoding, w)
+		_, err = io.Copy(enc, r)
+		r.Close()
+		if err == nil {
+			err = enc.Close()
+		}
+		if err != nil {
+			log.Errorf("error reading %s data for job #%d: %s", field.dtype, job.ID, err)
+			return err
+		}
+		w.WriteByte('"')
+		sep = ","
+	}
+	_, err = w.WriteString("}\n")
+	return err
+}
+
+// writeData writes the input, output and logs of the job if it has any
+func (j *ExportedJob) writeData() error {
+	for dtype, buf := range map[DataType][]byte{
+		DATA_INPUT:  j.Input,
+		DATA_OUTPUT: j.Output,
+		DATA_LOGS:   j.Logs,
+	} {
+		if buf == nil {
+			continue
+		}
+
+		w, err := data.Write(j.ID, dtype)
+		if err != nil {
+			log.Errorf("error writing %s data for job #%d: %s", dtype, j.ID, err)
+			return err
+		}
+
+		_, err = w.Write(buf)
+		if cerr := w.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			log.Errorf("error writing %s data for job #%d: %s", dtype, j.ID, err)
+			return err
+		}
+	}
+	return nil
+}
+
+// Import saves the jobs in a stream of JSON Lines written by Export, or by
+// anything else producing jobs in the same format, along with their data if
+// present. Jobs keep their ids and are skipped if a job with the same id is
+// already in the store unless renumber is true, in which case every job is
+// given a new id and the jobs it refers to, whose input it reads or whose
+// pipeline it is a stage of, are given theirs. Jobs are imported as they
+// are, including their state, except for jobs that were still active which
+// are imported as errored.
+func Import(r io.Reader, renumber bool) (*ImportResult, error) {
+	res := &ImportResult{}
+	ids := newRenumbering()
+
+	dec := json.NewDecoder(bufio.NewReader(r))
+	for {
+		var exported ExportedJob
+		if err := dec.Decode(&exported); err == io.EOF {
+			return res, ids.finish()
+		} else if err != nil {
+			log.Errorf("error decoding job: %s", err)
+			return res, err
+		}
+
+		job := exported.Job
+		if job == nil {
+			continue
+		}
+
+		if renumber {
+			if !ids.renumber(job) {
+				log.Warnf("rejecting import of job #%d referring to a job not imported before it", job.ID)
+				res.Rejected++
+				continue
+			}
+		} else if job.ID == 0 {
+			job.ID = db.NextId()
+		} else if _, err := db.Get(job.ID); err == nil {
+			log.Debugf("skipping import of existing job #%d", job.ID)
+			res.Skipped++
+			continue
+		} else if _, ok := err.(*KeyError); !ok {
+			return res, err
+		}
+
+		// Write the data first so that it is indexed with the job
+		if err := exported.writeData(); err != nil {
+			return res, err
+		}
+
+		job.done = make(chan bool, 1)
+		job.reason = "imported"
+		if job.interrupt("it was still active when exported") {
+			res.Interrupted++
+		}
+		if err := db.Save(job); err != nil {
+			return res, err
+		}
+		ids.imported(job.ID)
+		res.Imported++
+	}
+}
+
+// renumbering gives the jobs imported new ids and rewrites the ids of the
+// jobs they refer to
+type renumbering struct {
+	// ids are the new ids of jobs by their old ids
+	ids map[ID]ID
+	// done are the new ids of the jobs imported
+	done map[ID]bool
+	// pipelines are the new ids of the first stages imported
+	pipelines []ID
+}
+
+func newRenumbering() *renumbering {
+	return &renumbering{ids: make(map[ID]ID), done: make(map[ID]bool)}
+}
+
+// id returns the new id of the job with id old, giving it one if it has
+// none yet
+func (r *renumbering) id(old ID) ID {
+	if old == 0 {
+		return db.NextId()
+	}
+	id, ok := r.ids[old]
+	if !ok {
+		id = db.NextId()
+		r.ids[old] = id
+	}
+	return id
+}
+
+// ref returns the new id of the job with id old if it was imported
+func (r *renumbering) ref(old ID) (ID, bool) {
+	id, ok := r.ids[old]
+	return id, ok && r.done[id]
+}
+
+// renumber gives job a new id and rewrites the ids it refers to. It returns
+// false if job reads its input from or is a stage of a pipeline of a job
+// which was not imported before it.
+func (r *renumbering) renumber(job *Job) bool {
+	var ok bool
+	if job.StdinFrom != 0 {
+		if job.StdinFrom, ok = r.ref(job.StdinFrom); !ok {
+			return false
+		}
+	}
+	first := job.Pipeline != 0 && job.Pipeline == job.ID
+	if job.Pipeline != 0 && !first {
+		if job.Pipeline, ok = r.ref(job.Pipeline); !ok {
+			return false
+		}
+	}
+
+	// Later stages are given their ids before they are imported
+	job.ID = r.id(job.ID)
+	if first {
+		job.Pipeline = job.ID
+		r.pipelines = append(r.pipelines, job.ID)
+	}
+	for i, stage := range job.Stages {
+		job.Stages[i] = r.id(stage)
+	}
+	return true
+}
+
+// imported records that the job with the given new id was imported
+func (r *renumbering) imported(id ID) {
+	r.done[id] = true
+}
+
+// finish removes the stages which were not imported from the pipelines
+// imported
+func (r *renumbering) finish() error {
+	for _, id := range r.pipelines {
+		job, err := db.Get(id)
+		if err != nil {
+			log.Errorf("error fetching pipeline #%d: %s", id, err)
+			return err
+		}
+
+		job.Lock()
+		var stages []ID
+		for _, stage := range job.Stages {
+			if r.done[stage] {
+				stages = append(stages, stage)
+			}
+		}
+		if len(stages) != len(job.Stages) {
+			job.Stages = stages
+			err = db.Save(job)
+		}
+		job.Unlock()
+		if err != nil {
+			log.Errorf("error saving pipeline #%d: %s", id, err)
+			return err
+		}
+	}
+	return nil
+}
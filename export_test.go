@@ -0,0 +1,199 @@
+package je
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// exportTestStore creates a memory store with a few jobs and their data and
+// returns an export of the jobs matching q
+func exportTestStore(t *testing.T, q string, withData bool) []byte {
+	_, err := InitData(t.TempDir())
+	require.NoError(t, err)
+	store, err := InitDB("memory://")
+	require.NoError(t, err)
+	defer store.Close()
+
+	for _, name := range []string{"foo", "bar", "foo"} {
+		job := &Job{ID: db.NextId(), Name: name, State: STATE_STOPPED}
+		require.NoError(t, db.Save(job))
+		writeTestData(t, job.ID, DATA_INPUT, "input of "+name)
+		writeTestData(t, job.ID, DATA_OUTPUT, "output of "+name)
+	}
+
+	var buf bytes.Buffer
+	_, err = Export(&buf, q, withData)
+	require.NoError(t, err)
+	return buf.Bytes()
+}
+
+func TestExport(t *testing.T) {
+	withGlobals(t)
+	assert := assert.New(t)
+
+	export := exportTestStore(t, "name:foo", true)
+
+	var jobs []*ExportedJob
+	s := bufio.NewScanner(bytes.NewReader(export))
+	for s.Scan() {
+		var job ExportedJob
+		require.NoError(t, json.Unmarshal(s.Bytes(), &job))
+		jobs = append(jobs, &job)
+	}
+	require.Len(t, jobs, 2)
+
+	for _, job := range jobs {
+		assert.Equal("foo", job.Name)
+		assert.Equal("input of foo", string(job.Input))
+		assert.Equal("output of foo", string(job.Output))
+		assert.Nil(job.Logs)
+	}
+
+	// Data is base64 encoded and omitted unless requested
+	assert.Contains(string(export), `"input":"aW5wdXQgb2YgZm9v"`)
+	assert.NotContains(string(exportTestStore(t, "", false)), `"input"`)
+}
+
+func TestImport(t *testing.T) {
+	for _, dburi := range []string{"bolt://%s/je.db", "bitcask://%s/je.db", "sqlite://%s/je.db"} {
+		t.Run(strings.Split(dburi, ":")[0], func(t *testing.T) {
+			withGlobals(t)
+			assert := assert.New(t)
+
+			export := exportTestStore(t, "", true)
+
+			_, err := InitData(t.TempDir())
+			require.NoError(t, err)
+			store, err := InitDB(fmt.Sprintf(dburi, t.TempDir()))
+			require.NoError(t, err)
+			defer store.Close()
+
+			res, err := Import(bytes.NewReader(export), false)
+			require.NoError(t, err)
+			assert.Equal(&ImportResult{Imported: 3}, res)
+
+			jobs, err := db.All()
+			require.NoError(t, err)
+			sort.Slice(jobs, func(i, j int) bool { return jobs[i].ID < jobs[j].ID })
+			require.Len(t, jobs, 3)
+			for i, name := range []string{"foo", "bar", "foo"} {
+				assert.Equal(ID(i+1), jobs[i].ID)
+				assert.Equal(name, jobs[i].Name)
+				assert.Equal(STATE_STOPPED, jobs[i].State)
+				assert.Equal("input of "+name, readTestData(t, jobs[i].ID, DATA_INPUT))
+				assert.Equal("output of "+name, readTestData(t, jobs[i].ID, DATA_OUTPUT))
+			}
+
+			search, err := db.Search("name:foo", nil)
+			require.NoError(t, err)
+			assert.Len(search.Jobs, 2)
+
+			// Importing again skips the jobs already imported
+			res, err = Import(bytes.NewReader(export), false)
+			require.NoError(t, err)
+			assert.Equal(&ImportResult{Skipped: 3}, res)
+
+			// unless they are renumbered
+			res, err = Import(bytes.NewReader(export), true)
+			require.NoError(t, err)
+			assert.Equal(&ImportResult{Imported: 3}, res)
+
+			job, err := db.Get(6)
+			require.NoError(t, err)
+			assert.Equal("foo", job.Name)
+			assert.Equal("output of foo", readTestData(t, job.ID, DATA_OUTPUT))
+		})
+	}
+}
+
+func TestExportHandler(t *testing.T) {
+	assert := assert.New(t)
+
+	res, err := http.Get("http://127.0.0.1:8000/export?q=%2B")
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(http.StatusBadRequest, res.StatusCode)
+
+	res, err = http.Get("http://127.0.0.1:8000/export")
+	require.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(http.StatusOK, res.StatusCode)
+	assert.Equal("application/x-ndjson", res.Header.Get("Content-Type"))
+
+	var buf bytes.Buffer
+	_, err = buf.ReadFrom(res.Body)
+	require.NoError(t, err)
+
+	// Everything exported is already in the store
+	res, err = http.Post("http://127.0.0.1:8000/import", "application/x-ndjson", &buf)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(http.StatusOK, res.StatusCode)
+
+	var imported ImportResult
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&imported))
+	assert.Equal(0, imported.Imported)
+
+	res, err = http.Post("http://127.0.0.1:8000/import", "application/x-ndjson", strings.NewReader("{"))
+	require.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(http.StatusBadRequest, res.StatusCode)
+}
+
+func TestImportReferences(t *testing.T) {
+	withGlobals(t)
+	assert := assert.New(t)
+
+	_, err := InitData(t.TempDir())
+	require.NoError(t, err)
+	store, err := InitDB(fmt.Sprintf("bolt://%s/je.db", t.TempDir()))
+	require.NoError(t, err)
+	defer store.Close()
+
+	var export bytes.Buffer
+	enc := json.NewEncoder(&export)
+	for _, job := range []*Job{
+		// A pipeline whose last stage was still running
+		{ID: 10, Name: "a", State: STATE_STOPPED, Pipeline: 10, Stages: []ID{10, 11, 12}},
+		{ID: 11, Name: "b", State: STATE_STOPPED, Pipeline: 10, StdinFrom: 10},
+		{ID: 12, Name: "c", State: STATE_RUNNING, Pipeline: 10, StdinFrom: 11},
+		// Jobs reading from jobs that are not exported
+		{ID: 20, Name: "d", State: STATE_STOPPED, StdinFrom: 5},
+		{ID: 21, Name: "e", State: STATE_STOPPED, Pipeline: 5},
+		// A pipeline whose second stage was not exported
+		{ID: 30, Name: "f", State: STATE_STOPPED, Pipeline: 30, Stages: []ID{30, 31}},
+	} {
+		require.NoError(t, enc.Encode(&ExportedJob{Job: job}))
+	}
+
+	res, err := Import(bytes.NewReader(export.Bytes()), true)
+	require.NoError(t, err)
+	assert.Equal(&ImportResult{Imported: 4, Rejected: 2, Interrupted: 1}, res)
+
+	jobs, err := db.All()
+	require.NoError(t, err)
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].ID < jobs[j].ID })
+	require.Len(t, jobs, 4)
+	a, b, c, f := jobs[0], jobs[1], jobs[2], jobs[3]
+	assert.Equal([]string{"a", "b", "c", "f"}, []string{a.Name, b.Name, c.Name, f.Name})
+
+	assert.Equal(a.ID, a.Pipeline)
+	assert.Equal([]ID{a.ID, b.ID, c.ID}, a.Stages)
+	assert.Equal(a.ID, b.Pipeline)
+	assert.Equal(a.ID, b.StdinFrom)
+	assert.Equal(a.ID, c.Pipeline)
+	assert.Equal(b.ID, c.StdinFrom)
+	assert.Equal(STATE_ERRORED, c.State)
+	assert.Contains(readTestData(t, c.ID, DATA_LOGS), "interrupted")
+
+	assert.Equal([]ID{f.ID}, f.Stages)
+}
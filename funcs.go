@@ -0,0 +1,171 @@
+package je
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"runtime/debug"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Func is a job run in-process, for programs embedding je, instead of by
+// forking an executable. It reads its input from in and writes its output to
+// out and its logs to log like an executable would to its stdin, stdout and
+// stderr. Returning an error writes it to its logs and exits with status 1.
+// ctx is cancelled when the job is killed and the Func is expected to return
+// soon after. A Func which has not returned when its job is force killed is
+// abandoned: its job is done and what it writes from then on is dropped. Its
+// working directory, if it has input files or artifacts, is given by
+// WorkDir(ctx).
+type Func func(ctx context.Context, in io.Reader, out, log io.Writer, args []string) error
+
+var (
+	funcsLock sync.RWMutex
+	funcs     = make(map[string]Func)
+)
+
+// Register makes fn the job with the given name. Jobs with that name are run
+// by calling fn instead of the executable with that name. It panics if a job
+// is registered twice with the same name or if fn is nil.
+func Register(name string, fn Func) {
+	funcsLock.Lock()
+	defer funcsLock.Unlock()
+
+	if fn == nil {
+		panic("je: Register func is nil")
+	}
+	if _, dup := funcs[name]; dup {
+		panic("je: Register called twice for " + name)
+	}
+	funcs[name] = fn
+}
+
+// lookupFunc returns the Func registered with the given name if any
+func lookupFunc(name string) (Func, bool) {
+	funcsLock.RLock()
+	defer funcsLock.RUnlock()
+
+	fn, ok := funcs[name]
+	return fn, ok
+}
+
+type workDirKey struct{}
+
+// WorkDir returns the working directory of the Func job running with ctx, or
+// "" if the job has neither input files nor artifacts
+func WorkDir(ctx context.Context) string {
+	dir, _ := ctx.Value(workDirKey{}).(string)
+	return dir
+}
+
+// executeFunc runs the Func fn of the job with its working directory dir, if
+// it has one
+func (j *Job) executeFunc(fn Func, dir string) error {
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), workDirKey{}, dir))
+	defer cancel()
+	abandoned, abandon := context.WithCancel(context.Background())
+	defer abandon()
+
+	j.Lock()
+	j.cancel, j.abandon = cancel, abandon
+	j.Unlock()
+	defer func() {
+		j.Lock()
+		j.cancel, j.abandon = nil, nil
+		j.Unlock()
+	}()
+
+	j.RLock()
+	stdinFrom := j.StdinFrom
+	j.RUnlock()
+
+	var in io.Reader
+	if j.Interactive || stdinFrom != 0 {
+		pr, pw := io.Pipe()
+		// Writing to the input once the job is done fails
+		defer pr.Close()
+		in = pr
+
+		if j.Interactive {
+			j.Lock()
+			j.input = pw
+			j.Unlock()
+		} else {
+			go j.pipeInput(ctx, stdinFrom, pw)
+		}
+	} else {
+		stdin, err := data.Read(j.ID, DATA_INPUT)
+		if err != nil {
+			log.Errorf("error reading input for job #%d: %s", j.ID, err)
+			return err
+		}
+		defer stdin.Close()
+		in = stdin
+	}
+
+	w, err := j.openWriters()
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	// Funcs may write their output and logs from several goroutines
+	out, logs := &lockedWriter{w: w.output}, &lockedWriter{w: w.logs}
+
+	// The Func is called in a goroutine of its own so that the worker is
+	// freed when it is force killed even if it never returns
+	errs := make(chan error, 1)
+	go func() { errs <- callFunc(ctx, fn, in, out, logs, j.Args) }()
+
+	select {
+	case err := <-errs:
+		if err != nil {
+			fmt.Fprintf(logs, "%s\n", err)
+			j.Lock()
+			j.Status = 1
+			j.Unlock()
+		}
+	case <-abandoned.Done():
+		log.Warnf("job #%d was killed but its func has not returned: abandoning it", j.ID)
+		out.close()
+		logs.close()
+	}
+
+	return nil
+}
+
+// callFunc calls fn returning the value it panics with as an error
+func callFunc(ctx context.Context, fn Func, in io.Reader, out, logs io.Writer, args []string) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v\n%s", r, debug.Stack())
+		}
+	}()
+	return fn(ctx, in, out, logs, args)
+}
+
+// lockedWriter serializes writes to w until it is closed
+type lockedWriter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closed bool
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return 0, io.ErrClosedPipe
+	}
+	return l.w.Write(p)
+}
+
+// close makes every write from then on fail without writing to w, which
+// may then be closed
+func (l *lockedWriter) close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.closed = true
+}
@@ -0,0 +1,181 @@
+package je
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	Register("test.upper", func(ctx context.Context, in io.Reader, out, log io.Writer, args []string) error {
+		buf, err := ioutil.ReadAll(in)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(log, "args: %s\n", strings.Join(args, " "))
+		out.Write(bytes.ToUpper(buf))
+		if WorkDir(ctx) == "" {
+			return nil
+		}
+		return ioutil.WriteFile(filepath.Join(WorkDir(ctx), "report.txt"), buf, 0644)
+	})
+	Register("test.fail", func(ctx context.Context, in io.Reader, out, log io.Writer, args []string) error {
+		return errors.New("something went wrong")
+	})
+	Register("test.panic", func(ctx context.Context, in io.Reader, out, log io.Writer, args []string) error {
+		panic("boom")
+	})
+	Register("test.block", func(ctx context.Context, in io.Reader, out, log io.Writer, args []string) error {
+		fmt.Fprintln(out, "started")
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	Register("test.ignore", func(ctx context.Context, in io.Reader, out, log io.Writer, args []string) error {
+		fmt.Fprintln(out, "started")
+		<-ignoreRelease
+		_, err := fmt.Fprintln(out, "released")
+		ignoreErrs <- err
+		return nil
+	})
+}
+
+// ignoreRelease releases test.ignore, which ignores its context, and
+// ignoreErrs receives the error of its last write
+var (
+	ignoreRelease = make(chan struct{})
+	ignoreErrs    = make(chan error, 1)
+)
+
+func TestRegister(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Panics(func() {
+		Register("test.upper", func(context.Context, io.Reader, io.Writer, io.Writer, []string) error { return nil })
+	})
+	assert.Panics(func() { Register("test.nil", nil) })
+
+	_, ok := lookupFunc("test.upper")
+	assert.True(ok)
+	_, ok = lookupFunc("test.nil")
+	assert.False(ok)
+}
+
+func TestAPIv2_Funcs(t *testing.T) {
+	assert := assert.New(t)
+
+	qs := url.Values{"name": {"test.upper"}, "arg": {"a", "b"}, "artifact": {"*.txt"}, "wait": {"1"}}
+	status, job := createTestJob(t, qs, "text/plain", bytes.NewBufferString("hello\n"))
+	require.Equal(t, http.StatusCreated, status)
+	assert.Equal(STATE_STOPPED, job.State)
+	assert.Equal(0, job.Status)
+	assert.Equal("HELLO\n", getTestData(t, job.ID, DATA_OUTPUT))
+	assert.Equal("args: a b\n", getTestData(t, job.ID, DATA_LOGS))
+	assert.Equal([]Artifact{{Name: "report.txt", Size: 6}}, job.Artifacts)
+	dirs, err := filepath.Glob(filepath.Join(ScratchDir, fmt.Sprintf("%d-*", job.ID)))
+	assert.NoError(err)
+	assert.Empty(dirs)
+
+	// Errors and panics are logged and exit with status 1
+	for name, logs := range map[string]string{"test.fail": "something went wrong\n", "test.panic": "panic: boom\n"} {
+		qs = url.Values{"name": {name}, "wait": {"1"}}
+		status, job = createTestJob(t, qs, "text/plain", &bytes.Buffer{})
+		require.Equal(t, http.StatusCreated, status)
+		assert.Equal(STATE_STOPPED, job.State, name)
+		assert.Equal(1, job.Status, name)
+		assert.True(strings.HasPrefix(getTestData(t, job.ID, DATA_LOGS), logs), name)
+	}
+
+	// Funcs are cancelled when they are killed
+	for signal, state := range map[string]State{"INT": STATE_STOPPED, "KILL": STATE_KILLED} {
+		status, job = createTestJob(t, url.Values{"name": {"test.block"}}, "text/plain", &bytes.Buffer{})
+		require.Equal(t, http.StatusCreated, status)
+
+		for i := 0; i < 50 && getTestData(t, job.ID, DATA_OUTPUT) == ""; i++ {
+			time.Sleep(100 * time.Millisecond)
+		}
+		res, err := http.Post(fmt.Sprintf("%s/jobs/%d/signal", testAPIURL, job.ID), "application/json",
+			bytes.NewBufferString(fmt.Sprintf(`{"signal": %q}`, signal)))
+		require.NoError(t, err)
+		res.Body.Close()
+		require.Equal(t, http.StatusAccepted, res.StatusCode)
+
+		job, err = db.Get(job.ID)
+		require.NoError(t, err)
+		job.Wait()
+		job.RLock()
+		assert.Equal(state, job.State, signal)
+		job.RUnlock()
+	}
+}
+
+func TestKillDoneFunc(t *testing.T) {
+	assert := assert.New(t)
+
+	status, job := createTestJob(t, url.Values{"name": {"test.upper"}, "wait": {"1"}}, "text/plain", &bytes.Buffer{})
+	require.Equal(t, http.StatusCreated, status)
+
+	job, err := db.Get(job.ID)
+	require.NoError(t, err)
+
+	for _, force := range []bool{false, true} {
+		errs := make(chan error, 1)
+		go func() { errs <- job.Kill(force) }()
+		select {
+		case err = <-errs:
+			assert.Equal(ErrNotRunning, err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out killing a done job")
+		}
+	}
+
+	job, err = db.Get(job.ID)
+	require.NoError(t, err)
+	job.RLock()
+	assert.Equal(STATE_STOPPED, job.State)
+	job.RUnlock()
+}
+
+func TestForceKillFunc(t *testing.T) {
+	assert := assert.New(t)
+
+	job, err := NewJob("test.ignore", nil, false)
+	require.NoError(t, err)
+	_, err = writeInput(job.ID, &bytes.Buffer{})
+	require.NoError(t, err)
+
+	// Func jobs are killed even if they ignore ctx and the worker running
+	// them is freed
+	errs := make(chan error, 1)
+	go func() { errs <- job.Execute() }()
+	for i := 0; i < 50 && getTestData(t, job.ID, DATA_OUTPUT) == ""; i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+	require.NoError(t, job.Kill(true))
+	select {
+	case err = <-errs:
+		assert.NoError(err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a force killed func to be abandoned")
+	}
+	job.Wait()
+	job.RLock()
+	assert.Equal(STATE_KILLED, job.State)
+	job.RUnlock()
+
+	// What it writes once abandoned is dropped
+	close(ignoreRelease)
+	assert.Equal(io.ErrClosedPipe, <-ignoreErrs)
+	assert.Equal("started\n", getTestData(t, job.ID, DATA_OUTPUT))
+}
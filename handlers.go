@@ -3,11 +3,17 @@ package je
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"mime"
+	"mime/multipart"
 	"net/http"
 	"net/url"
+	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 
@@ -36,18 +42,35 @@ func (s *Server) SearchHandler() httprouter.Handle {
 
 		qs := r.URL.Query()
 
+		options, err := parseSearchOptions(qs, 0)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
 		if id := ParseId(p.ByName("id")); id > 0 {
 			jobs, err = db.Find(id)
 			if err != nil {
 				http.Error(w, "Not Found", http.StatusNotFound)
 				return
 			}
-		} else if q := qs.Get("q"); q != "" {
-			jobs, err = db.Search(q)
+		} else if q := qs.Get("q"); q != "" || options != nil {
+			res, err := db.Search(q, options)
 			if err != nil {
 				http.Error(w, "Not Found", http.StatusNotFound)
 				return
 			}
+			writePagination(w, r, res)
+
+			out, err := json.Marshal(searchResults(res, options))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(out)
+			return
 		} else {
 			jobs, err = db.All()
 			if err != nil {
@@ -56,7 +79,7 @@ func (s *Server) SearchHandler() httprouter.Handle {
 			}
 		}
 
-		out, err := json.Marshal(jobs)
+		out, err := json.Marshal(snapshotJobs(jobs))
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -67,6 +90,82 @@ func (s *Server) SearchHandler() httprouter.Handle {
 	}
 }
 
+// StatsHandler ...
+func (s *Server) StatsHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		var (
+			err  error
+			jobs []*Job
+		)
+
+		metrics.CounterVec("server", "requests").WithLabelValues("GET", "/stats").Inc()
+
+		qs := r.URL.Query()
+
+		hours := SafeParseInt(qs.Get("hours"), DefaultStatsHours)
+		if hours <= 0 || hours > 24*366 {
+			writeError(w, http.StatusBadRequest, "invalid hours: %s", qs.Get("hours"))
+			return
+		}
+
+		if q := qs.Get("q"); q != "" {
+			var res *SearchResult
+			res, err = db.Search(q, nil)
+			if res != nil {
+				jobs = res.Jobs
+			}
+		} else {
+			jobs, err = db.All()
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "error searching jobs: %s", err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, NewStats(jobs, time.Now(), hours))
+	}
+}
+
+// ExportHandler streams the jobs matching ?q=... (or every job) as JSON
+// Lines, with their input, output and logs if ?data=1
+func (s *Server) ExportHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		metrics.CounterVec("server", "requests").WithLabelValues("GET", "/export").Inc()
+
+		qs := r.URL.Query()
+
+		// Fail early on invalid queries before anything is written
+		if _, err := db.Search(qs.Get("q"), &SearchOptions{Limit: 1}); err != nil {
+			writeError(w, http.StatusBadRequest, "error searching jobs: %s", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+
+		if _, err := Export(w, qs.Get("q"), qs.Get("data") != ""); err != nil {
+			log.Errorf("error exporting jobs: %s", err)
+			// Abort the response so the client does not see a complete export
+			panic(http.ErrAbortHandler)
+		}
+	}
+}
+
+// ImportHandler loads jobs written by ExportHandler into the store. Jobs
+// already in the store are skipped unless ?renumber=1 gives every job a new id.
+func (s *Server) ImportHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		metrics.CounterVec("server", "requests").WithLabelValues("POST", "/import").Inc()
+
+		res, err := Import(r.Body, r.URL.Query().Get("renumber") != "")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "error importing jobs after %d: %s", res.Imported, err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, res)
+	}
+}
+
 // LogsHandler ...
 func (s *Server) LogsHandler() httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
@@ -86,42 +185,16 @@ func (s *Server) LogsHandler() httprouter.Handle {
 			return
 		}
 
-		if qs.Get("follow") == "" {
-			logs, err := data.Read(job.ID, DATA_LOGS)
-			if err != nil {
-				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-				return
-			}
-			defer logs.Close()
+		options, err := parseDataOptions(r, qs.Get("follow") != "")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 
-			w.Header().Set("Content-Type", "text/plain")
-			io.Copy(w, logs)
-		} else {
-			ctx, cancel := context.WithCancel(context.Background())
-			defer cancel()
-			lines, errors := data.Tail(job.ID, DATA_LOGS, ctx)
-			for {
-				select {
-				case line := <-lines:
-					message := []byte(fmt.Sprintf("%s\n", line))
-					// TODO: What if n < len(message)?
-					_, err = w.Write(message)
-					// TODO: Resend?
-					if err != nil {
-						log.Errorf("error streaming output for job #%d: %s", job.ID, err)
-						return
-					}
-
-					if f, ok := w.(http.Flusher); ok {
-						f.Flush()
-					} else {
-						log.Warn("no flusher")
-					}
-				case err := <-errors:
-					log.Errorf("error reading output for job #%d: %s", job.ID, err)
-					return
-				}
-			}
+		err = writeData(w, r, job, DATA_LOGS, options)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
 		}
 	}
 }
@@ -145,43 +218,16 @@ func (s *Server) OutputHandler() httprouter.Handle {
 			return
 		}
 
-		if qs.Get("follow") == "" {
-			output, err := data.Read(job.ID, DATA_OUTPUT)
-			if err != nil {
-				log.Errorf("error reading job output for #%d: %s", id, err)
-				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-				return
-			}
-			defer output.Close()
+		options, err := parseDataOptions(r, qs.Get("follow") != "")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 
-			w.Header().Set("Content-Type", "text/plain")
-			io.Copy(w, output)
-		} else {
-			ctx, cancel := context.WithCancel(context.Background())
-			defer cancel()
-			lines, errors := data.Tail(job.ID, DATA_OUTPUT, ctx)
-			for {
-				select {
-				case line := <-lines:
-					message := []byte(fmt.Sprintf("%s\n", line))
-					// TODO: What if n < len(message)?
-					_, err = w.Write(message)
-					// TODO: Resend?
-					if err != nil {
-						log.Errorf("error streaming output for job #%d: %s", job.ID, err)
-						return
-					}
-
-					if f, ok := w.(http.Flusher); ok {
-						f.Flush()
-					} else {
-						log.Warn("no flusher")
-					}
-				case err := <-errors:
-					log.Errorf("error reading output for job #%d: %s", job.ID, err)
-					return
-				}
-			}
+		err = writeData(w, r, job, DATA_OUTPUT, options)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
 		}
 	}
 }
@@ -235,38 +281,18 @@ func (s *Server) CreateHandler() httprouter.Handle {
 		args := strings.Fields(qs.Get("args"))
 		interactive := qs.Get("interactive") != ""
 
-		job, err := NewJob(name, args, interactive)
-		if err != nil {
-			log.Errorf("error creating new job: %s", err)
-			http.Error(w, "Internal Error", http.StatusInternalServerError)
-			return
-		}
-
-		input, err := data.Write(job.ID, DATA_INPUT)
+		options, err := parseJobOptions(r)
 		if err != nil {
-			log.Errorf("error creating job input for #%d: %s", job.ID, err)
-			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 
-		n, err := io.Copy(input, r.Body)
-		log.Debugf("written %d bytes of input for job #%d", n, job.ID)
-		if cl := r.ContentLength; cl != 0 && cl < n {
-			// TODO: Bump a counter?
-			log.Warnf("not all bytes %d/%d of input written to job #%d", n, cl, job.ID)
-		}
-		if err != nil {
-			log.Errorf("error writing input for job #%d: %s", job.ID, err)
-		}
-
-		err = input.Close()
+		job, err := s.createJob(name, args, interactive, options, r.Body)
 		if err != nil {
-			log.Errorf("error closing input for job #%d: %s", job.ID, err)
-		}
-
-		err = s.pool.Submit(job)
-		if err != nil {
-			log.Errorf("error submitting job to pool: %s", err)
+			if errors.Is(err, errInvalidInput) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
 			http.Error(w, "Internal Error", http.StatusInternalServerError)
 			return
 		}
@@ -347,3 +373,620 @@ func (s *Server) CloseHandler() httprouter.Handle {
 		}
 	}
 }
+
+// parseSearchOptions parses the limit, offset, cursor, sort and order query
+// parameters. If none are given nil is returned unless limit is non-zero in
+// which case it is used as the default limit.
+func parseSearchOptions(qs url.Values, limit int) (*SearchOptions, error) {
+	var given bool
+	for _, key := range []string{"limit", "offset", "cursor", "sort", "order", "highlight"} {
+		if _, ok := qs[key]; ok {
+			given = true
+		}
+	}
+	if !given && limit == 0 {
+		return nil, nil
+	}
+
+	options := &SearchOptions{
+		Limit:  limit,
+		Cursor: qs.Get("cursor"),
+		Sort:   strings.ToLower(qs.Get("sort")),
+		Order:  strings.ToLower(qs.Get("order")),
+
+		Highlight: qs.Get("highlight") != "",
+	}
+
+	if s := qs.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid limit: %s", s)
+		}
+		options.Limit = n
+	}
+
+	if s := qs.Get("offset"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid offset: %s", s)
+		}
+		options.Offset = n
+	}
+
+	if _, err := options.sortOrder(); err != nil {
+		return nil, err
+	}
+
+	return options, nil
+}
+
+// SearchHit is a job returned by a search with highlighting along with the
+// fragments of its output and logs that matched
+type SearchHit struct {
+	*Job
+	Highlights map[string][]string `json:"highlights,omitempty"`
+}
+
+// searchResults returns the jobs of a search result or if highlighting was
+// requested the jobs with their highlights
+func searchResults(res *SearchResult, options *SearchOptions) interface{} {
+	jobs := snapshotJobs(res.Jobs)
+	if options == nil || !options.Highlight {
+		return jobs
+	}
+
+	hits := make([]*SearchHit, len(jobs))
+	for i, job := range jobs {
+		hits[i] = &SearchHit{Job: job, Highlights: res.Highlights[job.ID]}
+	}
+	return hits
+}
+
+// writePagination sets the X-Total-Count header and if there are more
+// results the X-Next-Cursor and Link headers of a search response.
+func writePagination(w http.ResponseWriter, r *http.Request, res *SearchResult) {
+	w.Header().Set("X-Total-Count", strconv.FormatUint(res.Total, 10))
+	if res.Next == "" {
+		return
+	}
+
+	w.Header().Set("X-Next-Cursor", res.Next)
+
+	qs := r.URL.Query()
+	qs.Del("offset")
+	qs.Set("cursor", res.Next)
+	u := *r.URL
+	u.RawQuery = qs.Encode()
+	w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"next\"", u.RequestURI()))
+}
+
+// jobOptions are the optional settings of a new job
+type jobOptions struct {
+	// limit is the output limit of the job (nil for the default)
+	limit *OutputLimit
+	// artifacts are the globs of the artifacts of the job
+	artifacts []string
+	// combined is true if the job records a combined log
+	combined bool
+	// stdinFrom is the job whose output is the input of the job (0 for
+	// none)
+	stdinFrom ID
+	// form is the multipart/form-data body with the input and input files
+	// of the job (nil if the body is its input)
+	form *multipart.Reader
+}
+
+// parseJobOptions parses the options of a new job from the query parameters
+// max_output, output_policy, artifact (may be repeated), combined and
+// stdin_from and the content type of the request
+func parseJobOptions(r *http.Request) (*jobOptions, error) {
+	qs := r.URL.Query()
+
+	limit, err := ParseOutputLimit(qs.Get("max_output"), qs.Get("output_policy"))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, pattern := range qs["artifact"] {
+		if err := CheckArtifactPattern(pattern); err != nil {
+			return nil, err
+		}
+	}
+
+	options := &jobOptions{limit: limit, artifacts: qs["artifact"], combined: qs.Get("combined") != ""}
+
+	if s := qs.Get("stdin_from"); s != "" {
+		options.stdinFrom = ParseId(s)
+		if options.stdinFrom <= 0 {
+			return nil, fmt.Errorf("invalid stdin_from %q", s)
+		}
+		if qs.Get("interactive") != "" {
+			return nil, fmt.Errorf("interactive jobs cannot take stdin_from")
+		}
+		if _, err := db.Get(options.stdinFrom); err != nil {
+			return nil, fmt.Errorf("invalid stdin_from: job #%d not found", options.stdinFrom)
+		}
+	}
+
+	if mediatype, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err == nil && mediatype == "multipart/form-data" {
+		if options.form, err = r.MultipartReader(); err != nil {
+			return nil, err
+		}
+	}
+
+	return options, nil
+}
+
+// createJob creates a new job, writes its input and submits it to the pool
+// or, if the store is shared with other instances, enqueues it to be claimed.
+// If the input is invalid the job is deleted and the error wraps
+// errInvalidInput.
+func (s *Server) createJob(name string, args []string, interactive bool, options *jobOptions, body io.Reader) (*Job, error) {
+	job, err := s.prepareJob(name, args, interactive, options, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.submitJob(job); err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// prepareJob creates a new job and writes its input without submitting it
+func (s *Server) prepareJob(name string, args []string, interactive bool, options *jobOptions, body io.Reader) (*Job, error) {
+	job, err := NewJob(name, args, interactive)
+	if err != nil {
+		log.Errorf("error creating new job: %s", err)
+		return nil, err
+	}
+
+	files, err := s.writeJobInput(job, options, body)
+	if err != nil {
+		if e := DeleteJob(job.ID); e != nil {
+			log.Errorf("error deleting job #%d with invalid input: %s", job.ID, e)
+		}
+		return nil, err
+	}
+
+	if options.limit != nil || len(options.artifacts) > 0 || options.combined || options.stdinFrom != 0 || len(files) > 0 {
+		job.Lock()
+		job.OutputLimit = options.limit
+		job.ArtifactGlobs = options.artifacts
+		job.Combined = options.combined
+		job.StdinFrom = options.stdinFrom
+		job.InputFiles = files
+		err = db.Save(job)
+		job.Unlock()
+		if err != nil {
+			log.Errorf("error saving job #%d: %s", job.ID, err)
+			return nil, err
+		}
+	}
+
+	return job, nil
+}
+
+// submitJob submits a new job to the pool or, if the store is shared with
+// other instances, enqueues it to be claimed
+func (s *Server) submitJob(job *Job) (err error) {
+	// Interactive jobs always run here as their input is written here
+	if s.dispatcher != nil && !job.Interactive {
+		err = s.dispatcher.Enqueue(job)
+	} else {
+		err = s.pool.Submit(job)
+	}
+	if err != nil {
+		log.Errorf("error submitting job to pool: %s", err)
+	}
+	return
+}
+
+// createPipeline creates the stages of a new pipeline, each taking the
+// output of the previous one as its input, and submits them. The first stage
+// is given the input of the pipeline and each stage the options which apply
+// to it. Stages that cannot be submitted are errored.
+func (s *Server) createPipeline(req *PipelineRequest, options *jobOptions, body io.Reader) (*Pipeline, error) {
+	stages := make([]*Job, 0, len(req.Stages))
+	for i, stage := range req.Stages {
+		stageOptions := req.stageOptions(i, options)
+		if i > 0 {
+			stageOptions.stdinFrom = stages[i-1].ID
+			body = strings.NewReader("")
+		}
+
+		job, err := s.prepareJob(stage.Name, stage.Args, false, stageOptions, body)
+		if err != nil {
+			for _, job := range stages {
+				if e := DeleteJob(job.ID); e != nil {
+					log.Errorf("error deleting stage #%d of pipeline: %s", job.ID, e)
+				}
+			}
+			return nil, err
+		}
+		stages = append(stages, job)
+	}
+
+	ids := make([]ID, len(stages))
+	for i, job := range stages {
+		ids[i] = job.ID
+	}
+	for i, job := range stages {
+		job.Lock()
+		job.Pipeline = ids[0]
+		if i == 0 {
+			job.Stages = ids
+		}
+		err := db.Save(job)
+		job.Unlock()
+		if err != nil {
+			log.Errorf("error saving job #%d: %s", job.ID, err)
+			return nil, err
+		}
+	}
+
+	for i, job := range stages {
+		if err := s.submitJob(job); err != nil {
+			for _, job := range stages[i:] {
+				job.Error(fmt.Errorf("error submitting stage of pipeline #%d: %s", ids[0], err))
+			}
+			return NewPipeline(stages), err
+		}
+	}
+
+	return NewPipeline(stages), nil
+}
+
+// writeJobInput writes the input of a new job from body or the multipart
+// form of its options returning its input files. Jobs taking their input
+// from another job cannot be given any.
+func (s *Server) writeJobInput(job *Job, options *jobOptions, body io.Reader) ([]Artifact, error) {
+	if options.form != nil {
+		files, err := writeFormInput(job.ID, options.form)
+		if err != nil {
+			return nil, err
+		}
+		if options.stdinFrom != 0 {
+			if size, err := data.Size(job.ID, DATA_INPUT); err == nil && size > 0 {
+				return nil, fmt.Errorf("%w: jobs with stdin_from cannot be given an input", errInvalidInput)
+			}
+		}
+		return files, nil
+	}
+
+	n, err := writeInput(job.ID, body)
+	if err != nil {
+		return nil, err
+	}
+	if n > 0 && options.stdinFrom != 0 {
+		return nil, fmt.Errorf("%w: jobs with stdin_from cannot be given an input", errInvalidInput)
+	}
+	return nil, nil
+}
+
+// DataPollInterval is how often the data of a job is polled for new data
+// while it is being followed
+var DataPollInterval = 250 * time.Millisecond
+
+// dataOptions are the options of a request for the data of a job
+type dataOptions struct {
+	// follow streams data as it is written until the job is done
+	follow bool
+	// offset is the byte offset to start from or -1 if not given
+	offset int64
+	// tail is the number of last lines to start from or -1 if not given
+	tail int
+	// ranges is the Range header of the request
+	ranges string
+}
+
+// parseDataOptions parses the ?follow=1, ?offset=<bytes> and ?tail=<lines>
+// parameters and the Range header of a request for the data of a job. Only
+// one of offset or tail can be given and the Range header is ignored if
+// either is or when following.
+func parseDataOptions(r *http.Request, follow bool) (*dataOptions, error) {
+	qs := r.URL.Query()
+	options := &dataOptions{follow: follow, offset: -1, tail: -1}
+
+	if s := qs.Get("offset"); s != "" {
+		offset, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || offset < 0 {
+			return nil, fmt.Errorf("invalid offset %q", s)
+		}
+		options.offset = offset
+	}
+
+	if s := qs.Get("tail"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid tail %q", s)
+		}
+		if options.offset >= 0 {
+			return nil, fmt.Errorf("offset and tail cannot be used together")
+		}
+		options.tail = n
+	}
+
+	if !follow && options.offset < 0 && options.tail < 0 {
+		options.ranges = r.Header.Get("Range")
+	}
+
+	return options, nil
+}
+
+// parseRange parses a Range header with a single byte range given the size
+// of the data. ok is false if the header should be ignored, e.g. as it is
+// not a byte range or has several ranges, and err is set if the range
+// cannot be satisfied. The end of the range returned is exclusive.
+func parseRange(header string, size int64) (start, end int64, ok bool, err error) {
+	spec := strings.TrimPrefix(header, "bytes=")
+	if spec == header || strings.Contains(spec, ",") {
+		return 0, 0, false, nil
+	}
+
+	i := strings.Index(spec, "-")
+	if i < 0 {
+		return 0, 0, false, nil
+	}
+	first, last := strings.TrimSpace(spec[:i]), strings.TrimSpace(spec[i+1:])
+
+	if first == "" {
+		// bytes=-N is the last N bytes
+		n, perr := strconv.ParseInt(last, 10, 64)
+		if perr != nil || n < 0 {
+			return 0, 0, false, nil
+		}
+		if n == 0 {
+			return 0, 0, true, fmt.Errorf("unsatisfiable range %q", header)
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, size, true, nil
+	}
+
+	start, perr := strconv.ParseInt(first, 10, 64)
+	if perr != nil || start < 0 {
+		return 0, 0, false, nil
+	}
+	end = size
+	if last != "" {
+		n, perr := strconv.ParseInt(last, 10, 64)
+		if perr != nil || n < start {
+			return 0, 0, false, nil
+		}
+		if n+1 < end {
+			end = n + 1
+		}
+	}
+	if start >= size {
+		return 0, 0, true, fmt.Errorf("unsatisfiable range %q", header)
+	}
+	return start, end, true, nil
+}
+
+// writeData writes the data of the given type for a job to w from the
+// offset or last lines given by options, or only the byte range requested
+// with a Range header. If options.follow is true the data is streamed as it
+// is written until the job is done or the client goes away. An error is only
+// returned if nothing has been written to w yet.
+func writeData(w http.ResponseWriter, r *http.Request, job *Job, dtype DataType, options *dataOptions) error {
+	offset := options.offset
+	if offset < 0 {
+		offset = 0
+	}
+	if options.tail >= 0 {
+		var err error
+		offset, err = tailOffset(job.ID, dtype, options.tail)
+		if err != nil && !(options.follow && os.IsNotExist(err)) {
+			log.Errorf("error reading job %s for #%d: %s", dtype, job.ID, err)
+			return err
+		}
+	}
+
+	if options.follow {
+		followData(w, r.Context(), job, dtype, offset)
+		return nil
+	}
+
+	if options.offset < 0 && options.tail < 0 && options.ranges == "" {
+		if ok, err := writeCompressedData(w, r, job, dtype); ok || err != nil {
+			return err
+		}
+	}
+
+	// The size and what is read of it are taken between rotations
+	var size, start, end int64
+	status, rangeErr := http.StatusOK, error(nil)
+	f, err := readKept(job, dtype, func(n int64) (int64, int64, error) {
+		size, start, end = n, offset, n
+		if start > size {
+			start = size
+		}
+		if options.ranges != "" {
+			rstart, rend, ok, err := parseRange(options.ranges, size)
+			if err != nil {
+				rangeErr = err
+				return 0, 0, err
+			}
+			if ok {
+				start, end, status = rstart, rend, http.StatusPartialContent
+			}
+		}
+		return start, end - start, nil
+	})
+	if rangeErr != nil {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+		http.Error(w, "Requested Range Not Satisfiable", http.StatusRequestedRangeNotSatisfiable)
+		return nil
+	} else if err != nil {
+		log.Errorf("error reading job %s for #%d: %s", dtype, job.ID, err)
+		return err
+	}
+	defer f.Close()
+
+	if status == http.StatusPartialContent {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end-1, size))
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	w.Header().Set("Content-Length", strconv.FormatInt(end-start, 10))
+	w.Header().Set("Accept-Ranges", "bytes")
+	w.WriteHeader(status)
+	io.Copy(w, f)
+	return nil
+}
+
+// writeCompressedData writes the data of a job as it is stored if it is
+// compressed with an encoding accepted by the client and returns true if it
+// did so
+func writeCompressedData(w http.ResponseWriter, r *http.Request, job *Job, dtype DataType) (bool, error) {
+	c, ok := data.(Compressor)
+	if !ok {
+		return false, nil
+	}
+
+	w.Header().Set("Vary", "Accept-Encoding")
+
+	var encodings []string
+	for _, compression := range compressions {
+		if acceptsEncoding(r.Header.Get("Accept-Encoding"), compression.encoding) {
+			encodings = append(encodings, compression.encoding)
+		}
+	}
+	if len(encodings) == 0 {
+		return false, nil
+	}
+
+	f, encoding, size, err := c.ReadCompressed(job.ID, dtype, encodings)
+	if err != nil {
+		log.Errorf("error reading job %s for #%d: %s", dtype, job.ID, err)
+		return false, err
+	}
+	if f == nil {
+		return false, nil
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", "text/plain")
+	w.Header().Set("Content-Encoding", encoding)
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	w.WriteHeader(http.StatusOK)
+	io.Copy(w, f)
+	return true, nil
+}
+
+// followData streams the data of a job from offset as it is written until
+// the job is done. Once the job is done and everything it wrote has been
+// sent, the X-Data-Offset trailer gives the offset to resume from and the
+// X-Job-State and X-Job-Status trailers the state and exit status of the job.
+// Clients that are disconnected before then can resume with ?offset= set to
+// the number of bytes they received plus the offset they started from.
+func followData(w http.ResponseWriter, ctx context.Context, job *Job, dtype DataType, offset int64) {
+	w.Header().Set("Content-Type", "text/plain")
+	w.Header().Set("Trailer", "X-Data-Offset, X-Job-State, X-Job-Status")
+	w.WriteHeader(http.StatusOK)
+
+	final, offset, err := pollData(ctx, job.ID, dtype, offset, func(r io.Reader) (int64, error) {
+		n, err := io.Copy(w, r)
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+		return n, err
+	})
+	if err != nil {
+		log.Errorf("error streaming %s for job #%d: %s", dtype, job.ID, err)
+		return
+	}
+
+	if final != nil {
+		w.Header().Set("X-Data-Offset", strconv.FormatInt(offset, 10))
+		setJobTrailers(w, final)
+	}
+}
+
+// setJobTrailers sets the X-Job-State and X-Job-Status trailers of a follow
+// stream from the final state of its job
+func setJobTrailers(w http.ResponseWriter, job *Job) {
+	job.RLock()
+	defer job.RUnlock()
+	w.Header().Set("X-Job-State", job.State.String())
+	w.Header().Set("X-Job-Status", strconv.Itoa(job.Status))
+}
+
+// followChunkSize is the most data of a running job read at once when
+// following it
+const followChunkSize = 1 << 20
+
+// pollData calls fn with the data of a job written since offset whenever
+// the job writes, or every DataPollInterval if it runs elsewhere, until the
+// job is done and everything it wrote has been
+// read, or until ctx is done. It returns the job as it was when it was done,
+// or nil if ctx was done first, and the offset reached. Offsets count every
+// byte the job wrote, so data which was rotated continues from offset in
+// what was kept without sending any of it again, or from its start if
+// offset was rotated out of it.
+func pollData(ctx context.Context, id ID, dtype DataType, offset int64, fn func(r io.Reader) (int64, error)) (*Job, int64, error) {
+	ticker := time.NewTicker(DataPollInterval)
+	defer ticker.Stop()
+	// Nothing is left waiting for a job that is done or runs elsewhere
+	defer writes.notify(id)
+
+	for {
+		// Wait for writes from before reading so that none is missed, and
+		// check whether the job is done before reading so that everything
+		// it wrote is read before stopping
+		wake := writes.wait(id)
+		final := doneJob(id)
+
+		// Data of running jobs is read in chunks as it may be rotated
+		length := int64(followChunkSize)
+		if final != nil {
+			length = -1
+		}
+		for {
+			r, start, err := readFollowed(id, dtype, offset, length)
+			if os.IsNotExist(err) {
+				break
+			} else if err != nil {
+				return nil, offset, err
+			}
+			n, err := fn(r)
+			r.Close()
+			offset = start + n
+			if err != nil {
+				return nil, offset, err
+			}
+			if length < 0 || n < length {
+				break
+			}
+		}
+
+		if final != nil {
+			return final, offset, nil
+		}
+
+		select {
+		case <-wake:
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil, offset, nil
+		}
+	}
+}
+
+// doneJob returns the job with the given id from the store if it is done or
+// nil if it is not. Jobs no longer in the store, e.g. deleted while being
+// followed, are done in an unknown state.
+func doneJob(id ID) *Job {
+	job, err := db.Get(id)
+	if err != nil {
+		return &Job{ID: id}
+	}
+	job.RLock()
+	defer job.RUnlock()
+	if job.State.Done() {
+		return job
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package je
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	// Routing
+	"github.com/julienschmidt/httprouter"
+)
+
+// BackupHandler streams a backup archive of the store and, with ?data=1,
+// the data of every job
+func (s *Server) BackupHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		withData := r.URL.Query().Get("data") != ""
+
+		w.Header().Set("Content-Type", "application/x-tar")
+		w.Header().Set(
+			"Content-Disposition",
+			fmt.Sprintf("attachment; filename=\"je-backup-%s.tar\"", time.Now().Format("20060102T150405")),
+		)
+
+		if err := Backup(w, withData); err != nil {
+			log.Errorf("error writing backup: %s", err)
+			// Abort the response so the client does not see a valid archive
+			panic(http.ErrAbortHandler)
+		}
+	}
+}
+
+// RestoreHandler restores the jobs and data of a backup archive into an
+// empty store
+func (s *Server) RestoreHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		res, err := RestoreJobs(r.Body)
+		if errors.Is(err, ErrStoreNotEmpty) {
+			writeError(w, http.StatusConflict, err.Error())
+			return
+		} else if err != nil {
+			log.Errorf("error restoring backup: %s", err)
+			writeError(w, http.StatusBadRequest, "error restoring backup: %s", err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, res)
+	}
+}
+
+// IndexCheckHandler reports whether the search index is consistent with the store
+func (s *Server) IndexCheckHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		check, err := CheckIndex()
+		if err != nil {
+			log.Errorf("error checking index: %s", err)
+			writeError(w, http.StatusInternalServerError, "error checking index: %s", err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, check)
+	}
+}
+
+// ReindexHandler rebuilds the search index from the store in the background
+// or, with ?wait=1, before responding
+func (s *Server) ReindexHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		if r.URL.Query().Get("wait") == "" {
+			if atomic.LoadInt32(&reindexing) == 1 {
+				writeError(w, http.StatusConflict, ErrReindexing.Error())
+				return
+			}
+			go func() {
+				if _, err := Reindex(); err != nil && err != ErrReindexing {
+					log.Errorf("error rebuilding index: %s", err)
+				}
+			}()
+			writeJSON(w, http.StatusAccepted, map[string]bool{"reindexing": true})
+			return
+		}
+
+		n, err := Reindex()
+		if err == ErrReindexing {
+			writeError(w, http.StatusConflict, err.Error())
+			return
+		} else if err != nil {
+			log.Errorf("error rebuilding index: %s", err)
+			writeError(w, http.StatusInternalServerError, "error rebuilding index: %s", err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]int{"jobs": n})
+	}
+}
@@ -0,0 +1,804 @@
+package je
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	// Routing
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	// APIPrefix is the path prefix of the current (v2) API
+	APIPrefix = "/api/v2"
+
+	// DefaultSearchLimit is the page size of GET /api/v2/jobs if no limit
+	// is given
+	DefaultSearchLimit = 100
+)
+
+// APIError is the JSON error object returned by the v2 API
+type APIError struct {
+	Status  int    `json:"status"`
+	Error   string `json:"error"`
+	Message string `json:"message,omitempty"`
+}
+
+// SignalRequest is the request body of POST /api/v2/jobs/:id/signal
+type SignalRequest struct {
+	Signal string `json:"signal"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	out, err := json.Marshal(v)
+	if err != nil {
+		log.Errorf("error encoding response: %s", err)
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(out)
+}
+
+func writeError(w http.ResponseWriter, status int, format string, args ...interface{}) {
+	out, _ := json.Marshal(APIError{
+		Status:  status,
+		Error:   http.StatusText(status),
+		Message: fmt.Sprintf(format, args...),
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(out)
+}
+
+// getJob looks up the job given by the :id parameter writing an error
+// response and returning nil if it is invalid or does not exist.
+func getJob(w http.ResponseWriter, p httprouter.Params) *Job {
+	id := ParseId(p.ByName("id"))
+	if id <= 0 {
+		writeError(w, http.StatusBadRequest, "invalid job id %q", p.ByName("id"))
+		return nil
+	}
+
+	job, err := db.Get(id)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "job #%d not found", id)
+		return nil
+	}
+
+	return job
+}
+
+// OpenAPIHandler ...
+func (s *Server) OpenAPIHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		metrics.CounterVec("server", "requests").WithLabelValues("GET", APIPrefix+"/openapi.json").Inc()
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, openAPISpec)
+	}
+}
+
+// ListJobsHandler ...
+func (s *Server) ListJobsHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		metrics.CounterVec("server", "requests").WithLabelValues("GET", APIPrefix+"/jobs").Inc()
+
+		qs := r.URL.Query()
+
+		options, err := parseSearchOptions(qs, DefaultSearchLimit)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "%s", err)
+			return
+		}
+
+		terms, err := listTerms(qs, time.Now())
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "%s", err)
+			return
+		}
+
+		res, err := db.Search(strings.Join(terms, " "), options)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "error searching jobs: %s", err)
+			return
+		}
+		writePagination(w, r, res)
+
+		if res.Jobs == nil {
+			res.Jobs = []*Job{}
+		}
+
+		writeJSON(w, http.StatusOK, searchResults(res, options))
+	}
+}
+
+// listTerms returns the query string terms filtering the jobs listed by the
+// parameters in qs. Values are parsed or quoted so they cannot add terms of
+// their own to the query.
+func listTerms(qs url.Values, now time.Time) ([]string, error) {
+	var terms []string
+	if q := qs.Get("q"); q != "" {
+		terms = append(terms, q)
+	}
+	if name := qs.Get("name"); name != "" {
+		terms = append(terms, "+name:"+QuoteTerm(name))
+	}
+	if value := qs.Get("state"); value != "" {
+		state := ParseState(value)
+		if !state.Active() && !state.Done() {
+			return nil, fmt.Errorf("invalid state %q", value)
+		}
+		terms = append(terms, fmt.Sprintf("+state:%d", state))
+	}
+	if value := qs.Get("status"); value != "" {
+		status, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid status %q: expected an integer", value)
+		}
+		terms = append(terms, fmt.Sprintf("+status:%d", status))
+	}
+
+	for _, param := range []struct{ name, op string }{{"since", ">="}, {"until", "<"}} {
+		value := qs.Get(param.name)
+		if value == "" {
+			continue
+		}
+		t, err := parseQueryTime(value, now)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q: expected an RFC 3339 time or a duration", param.name, value)
+		}
+		terms = append(terms, fmt.Sprintf("+created:%s%q", param.op, t.Format(time.RFC3339Nano)))
+	}
+
+	for _, param := range []struct{ name, op string }{{"min_duration", ">="}, {"max_duration", "<="}} {
+		value := qs.Get(param.name)
+		if value == "" {
+			continue
+		}
+		d, err := parseQueryDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q: expected seconds or a duration", param.name, value)
+		}
+		terms = append(terms, fmt.Sprintf("+duration:%s%s", param.op, strconv.FormatFloat(d, 'f', -1, 64)))
+	}
+
+	return terms, nil
+}
+
+// termEscaper escapes the characters that end or escape a quoted phrase of a
+// query string
+var termEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// QuoteTerm quotes s as a phrase of a query string so that it matches as a
+// value and cannot add terms of its own to the query
+func QuoteTerm(s string) string {
+	return `"` + termEscaper.Replace(s) + `"`
+}
+
+// parseQueryTime parses an RFC 3339 time or a duration ago from now
+func parseQueryTime(s string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if d < 0 {
+		d = -d
+	}
+	return now.Add(-d), nil
+}
+
+// parseQueryDuration parses a number of seconds or a duration into seconds
+func parseQueryDuration(s string) (float64, error) {
+	if n, err := strconv.ParseFloat(s, 64); err == nil && !math.IsNaN(n) && !math.IsInf(n, 0) {
+		return n, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	return d.Seconds(), nil
+}
+
+// CreateJobHandler ...
+func (s *Server) CreateJobHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		metrics.CounterVec("server", "requests").WithLabelValues("POST", APIPrefix+"/jobs").Inc()
+
+		qs := r.URL.Query()
+
+		name := qs.Get("name")
+		if name == "" {
+			writeError(w, http.StatusBadRequest, "missing required parameter name")
+			return
+		}
+
+		args := qs["arg"]
+		if len(args) == 0 {
+			args = strings.Fields(qs.Get("args"))
+		}
+		interactive := qs.Get("interactive") != ""
+
+		options, err := parseJobOptions(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "%s", err)
+			return
+		}
+
+		job, err := s.createJob(name, args, interactive, options, r.Body)
+		if errors.Is(err, errInvalidInput) {
+			writeError(w, http.StatusBadRequest, "%s", err)
+			return
+		} else if err != nil {
+			writeError(w, http.StatusInternalServerError, "error creating job: %s", err)
+			return
+		}
+
+		if qs.Get("wait") != "" {
+			job.Wait()
+		}
+
+		w.Header().Set("Location", fmt.Sprintf("%s/jobs/%d", APIPrefix, job.ID))
+		writeJSON(w, http.StatusCreated, job.snapshot())
+	}
+}
+
+// CreatePipelineHandler ...
+func (s *Server) CreatePipelineHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		metrics.CounterVec("server", "requests").WithLabelValues("POST", APIPrefix+"/pipelines").Inc()
+
+		options, err := parseJobOptions(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "%s", err)
+			return
+		}
+
+		req, err := readPipelineRequest(r, options)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid pipeline: %s", err)
+			return
+		}
+
+		// The input of the first stage is the rest of the form if any
+		if options.form != nil && req.Input != "" {
+			writeError(w, http.StatusBadRequest, "invalid pipeline: the input of a multipart/form-data request is its %s part", STDIN_PART)
+			return
+		}
+		pipeline, err := s.createPipeline(req, options, strings.NewReader(req.Input))
+		if errors.Is(err, errInvalidInput) {
+			writeError(w, http.StatusBadRequest, "%s", err)
+			return
+		} else if err != nil {
+			writeError(w, http.StatusInternalServerError, "error creating pipeline: %s", err)
+			return
+		}
+
+		if r.URL.Query().Get("wait") != "" {
+			for _, job := range pipeline.Stages {
+				job.Wait()
+			}
+			pipeline = NewPipeline(pipeline.Stages)
+		}
+
+		w.Header().Set("Location", fmt.Sprintf("%s/pipelines/%d", APIPrefix, pipeline.ID))
+		pipeline.Stages = snapshotJobs(pipeline.Stages)
+		writeJSON(w, http.StatusCreated, pipeline)
+	}
+}
+
+// readPipelineRequest reads the definition of a new pipeline from the body
+// of a request or the first part of its multipart form
+func readPipelineRequest(r *http.Request, options *jobOptions) (*PipelineRequest, error) {
+	var body io.Reader = r.Body
+	if options.form != nil {
+		part, err := options.form.NextPart()
+		if err != nil {
+			return nil, err
+		}
+		defer part.Close()
+		if part.FormName() != PIPELINE_PART {
+			return nil, fmt.Errorf("the first part must be %q", PIPELINE_PART)
+		}
+		body = part
+	}
+
+	var req PipelineRequest
+	if err := json.NewDecoder(body).Decode(&req); err != nil {
+		return nil, err
+	}
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+// GetPipelineHandler ...
+func (s *Server) GetPipelineHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		metrics.CounterVec("server", "requests").WithLabelValues("GET", APIPrefix+"/pipelines/:id").Inc()
+
+		id := ParseId(p.ByName("id"))
+		if id <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid pipeline id %q", p.ByName("id"))
+			return
+		}
+
+		pipeline, err := GetPipeline(id)
+		if err != nil {
+			writeError(w, http.StatusNotFound, "pipeline #%d not found", id)
+			return
+		}
+
+		pipeline.Stages = snapshotJobs(pipeline.Stages)
+		writeJSON(w, http.StatusOK, pipeline)
+	}
+}
+
+// GetJobHandler ...
+func (s *Server) GetJobHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		metrics.CounterVec("server", "requests").WithLabelValues("GET", APIPrefix+"/jobs/:id").Inc()
+
+		job := getJob(w, p)
+		if job == nil {
+			return
+		}
+
+		writeJSON(w, http.StatusOK, job.snapshot())
+	}
+}
+
+// DeleteJobHandler ...
+func (s *Server) DeleteJobHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		metrics.CounterVec("server", "requests").WithLabelValues("DELETE", APIPrefix+"/jobs/:id").Inc()
+
+		job := getJob(w, p)
+		if job == nil {
+			return
+		}
+
+		job.RLock()
+		state := job.State
+		job.RUnlock()
+
+		if state.Active() {
+			writeError(w, http.StatusConflict, "job #%d is %s", job.ID, state)
+			return
+		}
+
+		if err := DeleteJob(job.ID); err != nil {
+			writeError(w, http.StatusInternalServerError, "error deleting job #%d: %s", job.ID, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// JobDataHandler serves the input, output or logs of a job
+func (s *Server) JobDataHandler(dtype DataType) httprouter.Handle {
+	path := fmt.Sprintf("%s/jobs/:id/%s", APIPrefix, dataPaths[dtype])
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		metrics.CounterVec("server", "requests").WithLabelValues("GET", path).Inc()
+
+		job := getJob(w, p)
+		if job == nil {
+			return
+		}
+
+		follow := r.URL.Query().Get("follow") != "" && dtype != DATA_INPUT
+		options, err := parseDataOptions(r, follow)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "%s", err)
+			return
+		}
+
+		if err := writeData(w, r, job, dtype, options); err != nil {
+			writeError(w, http.StatusNotFound, "no %s for job #%d", dataPaths[dtype], job.ID)
+			return
+		}
+	}
+}
+
+// JobArtifactsHandler lists the artifacts of a job
+func (s *Server) JobArtifactsHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		metrics.CounterVec("server", "requests").WithLabelValues("GET", APIPrefix+"/jobs/:id/artifacts").Inc()
+
+		job := getJob(w, p)
+		if job == nil {
+			return
+		}
+
+		job.RLock()
+		artifacts := append([]Artifact{}, job.Artifacts...)
+		job.RUnlock()
+
+		writeJSON(w, http.StatusOK, artifacts)
+	}
+}
+
+// JobArtifactHandler serves an artifact of a job
+func (s *Server) JobArtifactHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		metrics.CounterVec("server", "requests").WithLabelValues("GET", APIPrefix+"/jobs/:id/artifacts/*name").Inc()
+
+		job := getJob(w, p)
+		if job == nil {
+			return
+		}
+
+		name := strings.TrimPrefix(p.ByName("name"), "/")
+
+		var artifact *Artifact
+		job.RLock()
+		for i := range job.Artifacts {
+			if job.Artifacts[i].Name == name {
+				artifact = &job.Artifacts[i]
+			}
+		}
+		job.RUnlock()
+		if artifact == nil {
+			writeError(w, http.StatusNotFound, "no artifact %q for job #%d", name, job.ID)
+			return
+		}
+
+		f, err := data.ReadArtifact(job.ID, name)
+		if err != nil {
+			writeError(w, http.StatusNotFound, "error reading artifact %q of job #%d: %s", name, job.ID, err)
+			return
+		}
+		defer f.Close()
+
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Length", strconv.FormatInt(artifact.Size, 10))
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": path.Base(name)}))
+		w.WriteHeader(http.StatusOK)
+		io.Copy(w, f)
+	}
+}
+
+// JobCombinedHandler serves the combined log of a job: its output and logs
+// interleaved as they were written. ?timestamps=1 prefixes each line with
+// when it was written, ?since= only includes lines written since a time or
+// duration ago, ?stream=stdout|stderr only includes one stream and ?follow=1
+// streams new lines as they are written. With ?format=json the entries are
+// served as JSON Lines instead. Follow streams end once the job is done with
+// the X-Job-State and X-Job-Status trailers. Only jobs created with
+// ?combined=1 have a combined log.
+func (s *Server) JobCombinedHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		metrics.CounterVec("server", "requests").WithLabelValues("GET", APIPrefix+"/jobs/:id/combined").Inc()
+
+		job := getJob(w, p)
+		if job == nil {
+			return
+		}
+
+		job.RLock()
+		combined := job.Combined
+		job.RUnlock()
+		if !combined {
+			writeError(w, http.StatusNotFound, "no combined log for job #%d: it was not created with combined", job.ID)
+			return
+		}
+
+		qs := r.URL.Query()
+		filter, err := ParseCombinedFilter(qs.Get("since"), qs.Get("stream"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "%s", err)
+			return
+		}
+
+		var write func(entry *CombinedEntry) error
+		switch format := qs.Get("format"); format {
+		case "", "text":
+			timestamps := qs.Get("timestamps") != ""
+			write = func(entry *CombinedEntry) error {
+				if timestamps {
+					if _, err := fmt.Fprintf(w, "%s ", entry.Time.Format(time.RFC3339Nano)); err != nil {
+						return err
+					}
+				}
+				buf, err := entry.Bytes()
+				if err != nil {
+					return err
+				}
+				_, err = w.Write(buf)
+				return err
+			}
+			w.Header().Set("Content-Type", "text/plain")
+		case "json":
+			enc := json.NewEncoder(w)
+			write = func(entry *CombinedEntry) error { return enc.Encode(entry) }
+			w.Header().Set("Content-Type", "application/x-ndjson")
+		default:
+			writeError(w, http.StatusBadRequest, "invalid format %q", format)
+			return
+		}
+
+		if qs.Get("follow") == "" {
+			f, err := data.Read(job.ID, DATA_COMBINED)
+			if err != nil {
+				writeError(w, http.StatusNotFound, "no combined log for job #%d", job.ID)
+				return
+			}
+			defer f.Close()
+
+			if err := ReadCombined(f, filter, write); err != nil {
+				log.Errorf("error writing combined log for job #%d: %s", job.ID, err)
+			}
+			return
+		}
+
+		w.Header().Set("Trailer", "X-Job-State, X-Job-Status")
+		w.WriteHeader(http.StatusOK)
+
+		// Entries are only decoded once the line they are on is complete
+		var pending []byte
+		final, _, err := pollData(r.Context(), job.ID, DATA_COMBINED, 0, func(r io.Reader) (int64, error) {
+			buf, err := ioutil.ReadAll(r)
+			if err != nil {
+				return 0, err
+			}
+			pending = append(pending, buf...)
+
+			i := bytes.LastIndexByte(pending, '\n')
+			if i < 0 {
+				return int64(len(buf)), nil
+			}
+			if err := ReadCombined(bytes.NewReader(pending[:i+1]), filter, write); err != nil {
+				return int64(len(buf)), err
+			}
+			pending = append([]byte(nil), pending[i+1:]...)
+
+			if f, ok := w.(http.Flusher); ok {
+				f.Flush()
+			}
+			return int64(len(buf)), nil
+		})
+		if err != nil {
+			log.Errorf("error streaming combined log for job #%d: %s", job.ID, err)
+			return
+		}
+		if final != nil {
+			setJobTrailers(w, final)
+		}
+	}
+}
+
+// JobEventsHandler serves the state transitions of a job or, with ?follow=1
+// or Accept: text/event-stream, streams them as server-sent events until the
+// job is done
+func (s *Server) JobEventsHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		metrics.CounterVec("server", "requests").WithLabelValues("GET", APIPrefix+"/jobs/:id/events").Inc()
+
+		job := getJob(w, p)
+		if job == nil {
+			return
+		}
+
+		if r.URL.Query().Get("follow") != "" || r.Header.Get("Accept") == "text/event-stream" {
+			streamEvents(w, r, job.ID)
+			return
+		}
+
+		events, err := db.Events(job.ID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "error fetching events of job #%d: %s", job.ID, err)
+			return
+		}
+		if events == nil {
+			events = []*JobEvent{}
+		}
+
+		writeJSON(w, http.StatusOK, events)
+	}
+}
+
+// EventPollInterval is how often the events of a job are polled while they
+// are streamed
+var EventPollInterval = 500 * time.Millisecond
+
+// streamEvents writes the events of a job as server-sent events as they are
+// recorded until the job is done, is deleted or the client goes away. Each
+// event's id is its position so clients can resume with Last-Event-ID.
+func streamEvents(w http.ResponseWriter, r *http.Request, id ID) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	sent := SafeParseInt(r.Header.Get("Last-Event-ID"), 0)
+
+	ticker := time.NewTicker(EventPollInterval)
+	defer ticker.Stop()
+
+	for {
+		events, err := db.Events(id)
+		if err != nil {
+			log.Errorf("error fetching events of job #%d: %s", id, err)
+			return
+		}
+
+		for ; sent < len(events); sent++ {
+			buf, err := json.Marshal(events[sent])
+			if err != nil {
+				log.Errorf("error encoding event of job #%d: %s", id, err)
+				return
+			}
+			_, err = fmt.Fprintf(
+				w, "id: %d\nevent: %s\ndata: %s\n\n",
+				sent+1, strings.ToLower(events[sent].To.String()), buf,
+			)
+			if err != nil {
+				log.Errorf("error streaming events of job #%d: %s", id, err)
+				return
+			}
+		}
+
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+
+		if len(events) > 0 && events[len(events)-1].To.Done() {
+			return
+		}
+		if _, err := db.Get(id); err != nil {
+			return
+		}
+
+		select {
+		case <-ticker.C:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// WriteJobInputHandler ...
+func (s *Server) WriteJobInputHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		metrics.CounterVec("server", "requests").WithLabelValues("POST", APIPrefix+"/jobs/:id/input").Inc()
+
+		job := getJob(w, p)
+		if job == nil {
+			return
+		}
+
+		if !job.Interactive {
+			writeError(w, http.StatusConflict, "job #%d is not interactive", job.ID)
+			return
+		}
+
+		job.RLock()
+		running, name := job.State == STATE_RUNNING, job.Worker
+		job.RUnlock()
+
+		worker := s.pool.GetWorker(name)
+		if worker == nil || !running {
+			writeError(w, http.StatusConflict, "job #%d is not running", job.ID)
+			return
+		}
+
+		n, err := worker.Write(r.Body)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "error writing to job #%d: %s", job.ID, err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]int64{"written": n})
+	}
+}
+
+// CloseJobInputHandler ...
+func (s *Server) CloseJobInputHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		metrics.CounterVec("server", "requests").WithLabelValues("DELETE", APIPrefix+"/jobs/:id/input").Inc()
+
+		job := getJob(w, p)
+		if job == nil {
+			return
+		}
+
+		if !job.Interactive {
+			writeError(w, http.StatusConflict, "job #%d is not interactive", job.ID)
+			return
+		}
+
+		job.RLock()
+		running, name := job.State == STATE_RUNNING, job.Worker
+		job.RUnlock()
+
+		worker := s.pool.GetWorker(name)
+		if worker == nil || !running {
+			writeError(w, http.StatusConflict, "job #%d is not running", job.ID)
+			return
+		}
+
+		if err := worker.Close(); err != nil {
+			writeError(w, http.StatusInternalServerError, "error closing input of job #%d: %s", job.ID, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// SignalJobHandler ...
+func (s *Server) SignalJobHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		metrics.CounterVec("server", "requests").WithLabelValues("POST", APIPrefix+"/jobs/:id/signal").Inc()
+
+		job := getJob(w, p)
+		if job == nil {
+			return
+		}
+
+		var req SignalRequest
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+				writeError(w, http.StatusBadRequest, "invalid request body: %s", err)
+				return
+			}
+		}
+
+		var force bool
+		switch strings.TrimPrefix(strings.ToUpper(req.Signal), "SIG") {
+		case "", "INT":
+		case "KILL":
+			force = true
+		default:
+			writeError(w, http.StatusBadRequest, "unsupported signal %q", req.Signal)
+			return
+		}
+
+		job.RLock()
+		running, name := job.State == STATE_RUNNING, job.Worker
+		job.RUnlock()
+
+		worker := s.pool.GetWorker(name)
+		if worker == nil || !running {
+			writeError(w, http.StatusConflict, "job #%d is not running", job.ID)
+			return
+		}
+
+		if err := worker.Kill(force); err != nil {
+			if err == ErrNotRunning {
+				writeError(w, http.StatusConflict, "job #%d is not running", job.ID)
+				return
+			}
+			writeError(w, http.StatusInternalServerError, "error signalling job #%d: %s", job.ID, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+var dataPaths = map[DataType]string{
+	DATA_INPUT:  "input",
+	DATA_OUTPUT: "output",
+	DATA_LOGS:   "logs",
+}
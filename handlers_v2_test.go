@@ -0,0 +1,434 @@
+package je
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testAPIURL = "http://127.0.0.1:8000/api/v2"
+
+func TestOpenAPISpec(t *testing.T) {
+	assert := assert.New(t)
+
+	res, err := http.Get(testAPIURL + "/openapi.json")
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	assert.Equal(http.StatusOK, res.StatusCode)
+	assert.Equal("application/json", res.Header.Get("Content-Type"))
+
+	var spec map[string]interface{}
+	assert.NoError(json.NewDecoder(res.Body).Decode(&spec))
+	assert.Equal("3.0.3", spec["openapi"])
+}
+
+func TestAPIv2_Jobs(t *testing.T) {
+	assert := assert.New(t)
+
+	res, err := http.Post(testAPIURL+"/jobs?name=samples/hello.sh&wait=1", "text/plain", nil)
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	assert.Equal(http.StatusCreated, res.StatusCode)
+
+	var job Job
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&job))
+	assert.Equal("samples/hello.sh", job.Name)
+	assert.Equal(STATE_STOPPED, job.State)
+	assert.Equal(fmt.Sprintf("/api/v2/jobs/%d", job.ID), res.Header.Get("Location"))
+
+	res, err = http.Get(fmt.Sprintf("%s/jobs/%d", testAPIURL, job.ID))
+	require.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(http.StatusOK, res.StatusCode)
+
+	res, err = http.Get(fmt.Sprintf("%s/jobs/%d/output", testAPIURL, job.ID))
+	require.NoError(t, err)
+	defer res.Body.Close()
+	out, err := ioutil.ReadAll(res.Body)
+	assert.NoError(err)
+	assert.Equal("Hello World!\n", string(out))
+
+	req, _ := http.NewRequest("DELETE", fmt.Sprintf("%s/jobs/%d", testAPIURL, job.ID), nil)
+	res, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(http.StatusNoContent, res.StatusCode)
+
+	res, err = http.Get(fmt.Sprintf("%s/jobs/%d", testAPIURL, job.ID))
+	require.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(http.StatusNotFound, res.StatusCode)
+}
+
+func TestAPIv2_Errors(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := []struct {
+		method string
+		path   string
+		status int
+	}{
+		{"POST", "/jobs", http.StatusBadRequest},
+		{"GET", "/jobs/foo", http.StatusBadRequest},
+		{"GET", "/jobs/999999", http.StatusNotFound},
+		{"POST", "/jobs/999999/signal", http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		req, _ := http.NewRequest(test.method, testAPIURL+test.path, strings.NewReader(""))
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+
+		assert.Equal(test.status, res.StatusCode)
+		assert.Equal("application/json", res.Header.Get("Content-Type"))
+
+		var e APIError
+		assert.NoError(json.NewDecoder(res.Body).Decode(&e))
+		assert.Equal(test.status, e.Status)
+		assert.NotEmpty(e.Message)
+	}
+}
+
+func TestListTerms(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	terms, err := listTerms(url.Values{
+		"name":         {`a" +state:1`},
+		"state":        {"Stopped"},
+		"status":       {"-1"},
+		"since":        {"1h"},
+		"min_duration": {"1m"},
+		"max_duration": {"90"},
+	}, now)
+	require.NoError(t, err)
+	assert.Equal([]string{
+		`+name:"a\" +state:1"`,
+		`+state:4`,
+		`+status:-1`,
+		`+created:>="2020-05-01T11:00:00Z"`,
+		`+duration:>=60`,
+		`+duration:<=90`,
+	}, terms)
+
+	for _, qs := range []url.Values{
+		{"min_duration": {"60 +name:x"}},
+		{"max_duration": {"NaN"}},
+		{"since": {"yesterday"}},
+		{"until": {`2020" name:x`}},
+		{"state": {"done"}},
+		{"state": {"0"}},
+		{"status": {"abc"}},
+		{"status": {"0 name:x"}},
+	} {
+		_, err := listTerms(qs, now)
+		assert.Error(err, qs.Encode())
+	}
+}
+
+func TestAPIv2_ListJobs(t *testing.T) {
+	assert := assert.New(t)
+
+	res, err := http.Post(testAPIURL+"/jobs?name=samples/hello.sh&wait=1", "text/plain", nil)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+
+	var job Job
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&job))
+
+	list := func(qs url.Values) (int, []*Job) {
+		res, err := http.Get(testAPIURL + "/jobs?" + qs.Encode())
+		require.NoError(t, err)
+		defer res.Body.Close()
+
+		var jobs []*Job
+		if res.StatusCode == http.StatusOK {
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&jobs))
+		}
+		return res.StatusCode, jobs
+	}
+
+	status, jobs := list(url.Values{"name": {"samples/hello.sh"}, "min_duration": {"0"}})
+	assert.Equal(http.StatusOK, status)
+	require.NotEmpty(t, jobs)
+	assert.Equal("samples/hello.sh", jobs[len(jobs)-1].Name)
+
+	// Values cannot add terms to the query
+	status, jobs = list(url.Values{"name": {`nothing" name:"hello`}})
+	assert.Equal(http.StatusOK, status)
+	assert.Empty(jobs)
+
+	for _, d := range []string{"abc", "1 name:hello"} {
+		status, _ = list(url.Values{"min_duration": {d}})
+		assert.Equal(http.StatusBadRequest, status, d)
+		status, _ = list(url.Values{"max_duration": {d}})
+		assert.Equal(http.StatusBadRequest, status, d)
+		status, _ = list(url.Values{"state": {d}})
+		assert.Equal(http.StatusBadRequest, status, d)
+		status, _ = list(url.Values{"status": {d}})
+		assert.Equal(http.StatusBadRequest, status, d)
+	}
+}
+
+func TestAPIv2_SearchOutput(t *testing.T) {
+	assert := assert.New(t)
+
+	IndexDataLimit = 1024
+	defer func() { IndexDataLimit = 0 }()
+
+	res, err := http.Post(testAPIURL+"/jobs?name=samples/hello.sh&wait=1", "text/plain", nil)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(http.StatusCreated, res.StatusCode)
+
+	var job Job
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&job))
+
+	q := url.Values{}
+	q.Set("q", `output:"hello world"`)
+	q.Set("highlight", "1")
+	res, err = http.Get(testAPIURL + "/jobs?" + q.Encode())
+	require.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(http.StatusOK, res.StatusCode)
+
+	var hits []struct {
+		ID         ID                  `json:"id"`
+		Highlights map[string][]string `json:"highlights"`
+	}
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&hits))
+	require.Len(t, hits, 1)
+	assert.Equal(job.ID, hits[0].ID)
+	require.Len(t, hits[0].Highlights["output"], 1)
+	assert.Contains(hits[0].Highlights["output"][0], "<mark>Hello</mark>")
+}
+
+func TestAPIv2_Events(t *testing.T) {
+	assert := assert.New(t)
+
+	res, err := http.Post(testAPIURL+"/jobs?name=samples/hello.sh&wait=1", "text/plain", nil)
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	var job Job
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&job))
+
+	res, err = http.Get(fmt.Sprintf("%s/jobs/%d/events", testAPIURL, job.ID))
+	require.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(http.StatusOK, res.StatusCode)
+
+	var events []*JobEvent
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&events))
+	require.Len(t, events, 4)
+
+	for i, to := range []State{STATE_CREATED, STATE_WAITING, STATE_RUNNING, STATE_STOPPED} {
+		assert.Equal(job.ID, events[i].JobID)
+		assert.Equal(to, events[i].To)
+		if i > 0 {
+			assert.Equal(events[i-1].To, events[i].From)
+		}
+	}
+	assert.Equal("exited with status 0", events[3].Reason)
+	assert.Equal(job.Worker, events[3].Worker)
+
+	// Streams end once the job is done and resume after Last-Event-ID
+	req, _ := http.NewRequest("GET", fmt.Sprintf("%s/jobs/%d/events", testAPIURL, job.ID), nil)
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Last-Event-ID", "2")
+	res, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal("text/event-stream", res.Header.Get("Content-Type"))
+
+	body, err := ioutil.ReadAll(res.Body)
+	require.NoError(t, err)
+	assert.Equal(2, strings.Count(string(body), "data: "))
+	assert.Contains(string(body), "id: 3\nevent: running\n")
+	assert.Contains(string(body), "id: 4\nevent: stopped\n")
+}
+
+func TestAPIv2_Combined(t *testing.T) {
+	assert := assert.New(t)
+
+	res, err := http.Post(testAPIURL+"/jobs?name=samples/streams.sh&combined=1&wait=1", "text/plain", nil)
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	var job Job
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&job))
+
+	get := func(query string) (int, string) {
+		res, err := http.Get(fmt.Sprintf("%s/jobs/%d/combined?%s", testAPIURL, job.ID, query))
+		require.NoError(t, err)
+		defer res.Body.Close()
+		body, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res.StatusCode, string(body)
+	}
+
+	status, body := get("")
+	assert.Equal(http.StatusOK, status)
+	assert.Equal("out 1\nerr 1\nout 2\n", body)
+
+	status, body = get("stream=stderr")
+	assert.Equal(http.StatusOK, status)
+	assert.Equal("err 1\n", body)
+
+	status, body = get("timestamps=1")
+	assert.Equal(http.StatusOK, status)
+	lines := strings.Split(strings.TrimSpace(body), "\n")
+	require.Len(t, lines, 3)
+	ts, err := time.Parse(time.RFC3339Nano, strings.Fields(lines[1])[0])
+	require.NoError(t, err)
+	assert.WithinDuration(time.Now(), ts, time.Minute)
+	assert.True(strings.HasSuffix(lines[1], " err 1"))
+
+	status, body = get("since=" + url.QueryEscape(ts.Format(time.RFC3339Nano)))
+	assert.Equal(http.StatusOK, status)
+	assert.Equal("err 1\nout 2\n", body)
+
+	status, body = get("since=1m&format=json")
+	assert.Equal(http.StatusOK, status)
+	var entries []*CombinedEntry
+	require.NoError(t, ReadCombined(strings.NewReader(body), nil, func(entry *CombinedEntry) error {
+		entries = append(entries, entry)
+		return nil
+	}))
+	require.Len(t, entries, 3)
+	assert.Equal(STREAM_STDERR, entries[1].Stream)
+
+	status, _ = get("since=yesterday")
+	assert.Equal(http.StatusBadRequest, status)
+
+	// Jobs only record a combined log if asked to
+	res, err = http.Post(testAPIURL+"/jobs?name=samples/streams.sh&wait=1", "text/plain", nil)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	job = Job{}
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&job))
+	assert.False(job.Combined)
+
+	status, _ = get("")
+	assert.Equal(http.StatusNotFound, status)
+	_, err = data.Read(job.ID, DATA_COMBINED)
+	assert.True(os.IsNotExist(err))
+}
+
+func TestAPIv2_DataRanges(t *testing.T) {
+	assert := assert.New(t)
+
+	res, err := http.Post(testAPIURL+"/jobs?name=samples/streams.sh&wait=1", "text/plain", nil)
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	var job Job
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&job))
+
+	get := func(query, ranges string) *http.Response {
+		req, _ := http.NewRequest("GET", fmt.Sprintf("%s/jobs/%d/output?%s", testAPIURL, job.ID, query), nil)
+		if ranges != "" {
+			req.Header.Set("Range", ranges)
+		}
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		return res
+	}
+	body := func(res *http.Response) string {
+		defer res.Body.Close()
+		buf, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		return string(buf)
+	}
+
+	tests := []struct {
+		query, ranges string
+		status        int
+		body          string
+	}{
+		{"", "", http.StatusOK, "out 1\nout 2\n"},
+		{"", "bytes=0-4", http.StatusPartialContent, "out 1"},
+		{"", "bytes=6-", http.StatusPartialContent, "out 2\n"},
+		{"", "bytes=-2", http.StatusPartialContent, "2\n"},
+		{"", "bytes=100-", http.StatusRequestedRangeNotSatisfiable, ""},
+		{"", "lines=1-2", http.StatusOK, "out 1\nout 2\n"},
+		{"offset=6", "", http.StatusOK, "out 2\n"},
+		{"offset=100", "", http.StatusOK, ""},
+		{"tail=1", "", http.StatusOK, "out 2\n"},
+		{"tail=1", "bytes=0-0", http.StatusOK, "out 2\n"},
+		{"offset=-1", "", http.StatusBadRequest, ""},
+		{"offset=1&tail=1", "", http.StatusBadRequest, ""},
+	}
+	for _, test := range tests {
+		res := get(test.query, test.ranges)
+		b := body(res)
+		assert.Equal(test.status, res.StatusCode, "%s %s", test.query, test.ranges)
+		if res.StatusCode < http.StatusBadRequest {
+			assert.Equal(test.body, b, "%s %s", test.query, test.ranges)
+		}
+	}
+
+	res = get("", "bytes=6-")
+	body(res)
+	assert.Equal("bytes 6-11/12", res.Header.Get("Content-Range"))
+
+	// Follow streams end with a trailer once the job is done and can resume
+	// from an offset
+	res = get("follow=1&offset=6", "")
+	assert.Equal("out 2\n", body(res))
+	assert.Equal("STOPPED", res.Trailer.Get("X-Job-State"))
+	assert.Equal("12", res.Trailer.Get("X-Data-Offset"))
+
+	res, err = http.Post(testAPIURL+"/jobs?name=samples/streams.sh", "text/plain", nil)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&job))
+
+	res = get("follow=1", "")
+	assert.Equal("out 1\nout 2\n", body(res))
+	assert.Equal("STOPPED", res.Trailer.Get("X-Job-State"))
+}
+
+func TestAPIv2_FollowEnds(t *testing.T) {
+	assert := assert.New(t)
+
+	qs := url.Values{"name": {"sh"}, "arg": {"-c", "echo out; sleep 0.5; echo err >&2; exit 3"}, "combined": {"1"}}
+	res, err := http.Post(testAPIURL+"/jobs?"+qs.Encode(), "text/plain", nil)
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	var job Job
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&job))
+
+	// Follow streams of running jobs end with the job's exit status
+	for path, expected := range map[string]string{
+		fmt.Sprintf("%s/jobs/%d/output?follow=1", testAPIURL, job.ID):                 "out\n",
+		fmt.Sprintf("http://127.0.0.1:8000/logs/%d?follow=1", job.ID):                 "err\n",
+		fmt.Sprintf("%s/jobs/%d/combined?follow=1", testAPIURL, job.ID):               "out\nerr\n",
+		fmt.Sprintf("%s/jobs/%d/combined?follow=1&stream=stderr", testAPIURL, job.ID): "err\n",
+	} {
+		res, err := http.Get(path)
+		require.NoError(t, err)
+		body, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		require.NoError(t, err)
+
+		assert.Equal(expected, string(body), path)
+		assert.Equal("STOPPED", res.Trailer.Get("X-Job-State"), path)
+		assert.Equal("3", res.Trailer.Get("X-Job-Status"), path)
+	}
+}
@@ -1,9 +1,420 @@
 package je
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
 	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/analysis/analyzer/keyword"
+	"github.com/blevesearch/bleve/index/upsidedown"
+	"github.com/blevesearch/bleve/mapping"
+	"github.com/blevesearch/bleve/search/query"
+	bolt "go.etcd.io/bbolt"
 )
 
 // bleveIndex is an alias for Index used by the IndexBatcher to avoid a conflict
 // between the embedded Index field and the overridden Index method
 type bleveIndex bleve.Index
+
+// IndexDataLimit is the maximum number of bytes of a job's output and of its
+// logs that are indexed once it has completed so that they can be searched
+// with output:"..." and logs:"...". Zero disables indexing job data.
+var IndexDataLimit int64
+
+// dataFields maps the indexed data of a job to its field
+var dataFields = map[DataType]string{
+	DATA_OUTPUT: "output",
+	DATA_LOGS:   "logs",
+}
+
+// sortFields maps the sort keys accepted by SearchOptions to indexed fields
+var sortFields = map[string]string{
+	"created":  "created",
+	"started":  "started",
+	"stopped":  "stopped",
+	"duration": "duration",
+	"status":   "status",
+	"state":    "state",
+}
+
+// dateFields are the indexed datetime fields of a job
+var dateFields = []string{"created", "started", "stopped", "killed", "errored"}
+
+// rangeTerm matches range terms on the date and duration fields such as
+// created:>-24h or duration:>=10m
+var rangeTerm = regexp.MustCompile(`\b(created|started|stopped|killed|errored|duration):(>=|<=|>|<)?("?)([^"\s]+)"?`)
+
+// rewriteQuery rewrites relative times and durations in q into the absolute
+// values that bleve understands. Date fields accept a duration relative to
+// now (created:>-24h is "created in the last 24 hours") and duration accepts
+// Go durations (duration:>10m) in addition to seconds.
+func rewriteQuery(q string, now time.Time) string {
+	return rangeTerm.ReplaceAllStringFunc(q, func(term string) string {
+		m := rangeTerm.FindStringSubmatch(term)
+		field, op, value := m[1], m[2], m[4]
+
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return term
+		}
+
+		if field == "duration" {
+			return fmt.Sprintf("%s:%s%s", field, op, strconv.FormatFloat(d.Seconds(), 'f', -1, 64))
+		}
+
+		if d < 0 {
+			d = -d
+		}
+		return fmt.Sprintf("%s:%s\"%s\"", field, op, now.Add(-d).Format(time.RFC3339Nano))
+	})
+}
+
+// jobDocument is the document indexed for each job
+type jobDocument struct {
+	Name        string    `json:"name"`
+	Args        []string  `json:"args"`
+	Interactive bool      `json:"interactive"`
+	Worker      string    `json:"worker"`
+	State       int       `json:"state"`
+	Status      int       `json:"status"`
+	CreatedAt   time.Time `json:"created"`
+	StartedAt   time.Time `json:"started"`
+	StoppedAt   time.Time `json:"stopped"`
+	KilledAt    time.Time `json:"killed"`
+	ErroredAt   time.Time `json:"errored"`
+	Duration    float64   `json:"duration"`
+	Output      string    `json:"output,omitempty"`
+	Logs        string    `json:"logs,omitempty"`
+}
+
+// newIndexMapping returns the mapping of jobDocument with datetime fields
+// for timestamps and numeric fields for state, status and duration so that
+// they can be queried with ranges such as created:>"2020-05-01T00:00:00Z"
+func newIndexMapping() mapping.IndexMapping {
+	text := bleve.NewTextFieldMapping()
+
+	kw := bleve.NewTextFieldMapping()
+	kw.Analyzer = keyword.Name
+
+	numeric := bleve.NewNumericFieldMapping()
+	datetime := bleve.NewDateTimeFieldMapping()
+	boolean := bleve.NewBooleanFieldMapping()
+
+	doc := bleve.NewDocumentMapping()
+	doc.AddFieldMappingsAt("name", text)
+	doc.AddFieldMappingsAt("args", text)
+	doc.AddFieldMappingsAt("interactive", boolean)
+	doc.AddFieldMappingsAt("worker", kw)
+	doc.AddFieldMappingsAt("state", numeric)
+	doc.AddFieldMappingsAt("status", numeric)
+	doc.AddFieldMappingsAt("duration", numeric)
+	for _, field := range dataFields {
+		doc.AddFieldMappingsAt(field, text)
+	}
+	for _, field := range dateFields {
+		doc.AddFieldMappingsAt(field, datetime)
+	}
+
+	m := bleve.NewIndexMapping()
+	m.DefaultMapping = doc
+	return m
+}
+
+func newJobDocument(job *Job) *jobDocument {
+	doc := &jobDocument{
+		Name:        job.Name,
+		Args:        job.Args,
+		Interactive: job.Interactive,
+		Worker:      job.Worker,
+		State:       int(job.State),
+		Status:      job.Status,
+		CreatedAt:   job.CreatedAt,
+		StartedAt:   job.StartedAt,
+		StoppedAt:   job.StoppedAt,
+		KilledAt:    job.KilledAt,
+		ErroredAt:   job.ErroredAt,
+		Duration:    job.Duration().Seconds(),
+	}
+
+	if IndexDataLimit > 0 && data != nil && job.State.Done() {
+		doc.Output = readData(job.ID, DATA_OUTPUT, IndexDataLimit)
+		doc.Logs = readData(job.ID, DATA_LOGS, IndexDataLimit)
+	}
+
+	return doc
+}
+
+// readData reads up to limit bytes of the data of a job
+func readData(id ID, dtype DataType, limit int64) string {
+	f, err := data.Read(id, dtype)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warnf("error reading %s of job #%d for indexing: %s", dtype, id, err)
+		}
+		return ""
+	}
+	defer f.Close()
+
+	buf, err := ioutil.ReadAll(io.LimitReader(f, limit))
+	if err != nil {
+		log.Warnf("error reading %s of job #%d for indexing: %s", dtype, id, err)
+	}
+	return string(buf)
+}
+
+// Indexer maintains the search index of jobs shared by all Store backends
+type Indexer struct {
+	index bleve.Index
+}
+
+// indexLockTimeout is how long opening the index waits for another process
+// that has it open before giving up
+const indexLockTimeout = time.Second
+
+// NewIndexer opens the index at path creating it if it does not exist or is
+// corrupt. An empty path creates an in-memory index.
+func NewIndexer(path string) (*Indexer, error) {
+	var (
+		err   error
+		index bleve.Index
+	)
+
+	if path == "" {
+		index, err = bleve.NewMemOnly(newIndexMapping())
+	} else if _, err = os.Stat(path); err == nil {
+		if err = checkIndexLock(path); err == nil {
+			index, err = bleve.Open(path)
+		}
+		if err != nil && indexCorrupt(err) {
+			// The index only holds what is in the store so it is recreated
+			// and left for CheckIndex to find and Reindex to rebuild
+			log.Warnf("error opening index %s, recreating it: %s", path, err)
+			if err = os.RemoveAll(path); err == nil {
+				index, err = bleve.New(path, newIndexMapping())
+			}
+		}
+	} else {
+		index, err = bleve.New(path, newIndexMapping())
+	}
+	if err != nil {
+		log.Errorf("error creating index: %s", err)
+		return nil, err
+	}
+
+	return &Indexer{index: index}, nil
+}
+
+// checkIndexLock returns an error if the store of the index at path is held
+// by another process. Opening it would otherwise wait for it forever.
+func checkIndexLock(path string) error {
+	store := filepath.Join(path, "store")
+	if _, err := os.Stat(store); err != nil {
+		return nil
+	}
+
+	db, err := bolt.Open(store, 0600, &bolt.Options{ReadOnly: true, Timeout: indexLockTimeout})
+	if err == bolt.ErrTimeout {
+		return fmt.Errorf("index %s is locked by another process", path)
+	} else if err != nil {
+		// Left for bleve.Open to report
+		return nil
+	}
+	return db.Close()
+}
+
+// indexCorrupt returns true if err opening an index means it is corrupt or
+// was written by an incompatible version and can be safely recreated
+func indexCorrupt(err error) bool {
+	switch err {
+	case bleve.ErrorIndexMetaMissing, bleve.ErrorIndexMetaCorrupt,
+		bleve.ErrorUnknownIndexType, bleve.ErrorUnknownStorageType,
+		upsidedown.IncompatibleVersion,
+		bolt.ErrInvalid, bolt.ErrVersionMismatch, bolt.ErrChecksum:
+		return true
+	}
+	return false
+}
+
+// Close closes the index
+func (i *Indexer) Close() error {
+	return i.index.Close()
+}
+
+// Index adds or updates the job in the index
+func (i *Indexer) Index(job *Job) error {
+	t := time.Now()
+	err := i.index.Index(job.ID.String(), newJobDocument(job))
+	metrics.Summary("job", "index").Observe(time.Now().Sub(t).Seconds())
+	if err != nil {
+		log.Errorf("error indexing job #%d: %s", job.ID, err)
+	}
+	return err
+}
+
+// IndexBatch indexes many jobs at once
+func (i *Indexer) IndexBatch(jobs []*Job) error {
+	batch := i.index.NewBatch()
+	for _, job := range jobs {
+		job.RLock()
+		doc := newJobDocument(job)
+		job.RUnlock()
+		if err := batch.Index(job.ID.String(), doc); err != nil {
+			log.Errorf("error indexing job #%d: %s", job.ID, err)
+			return err
+		}
+	}
+
+	if err := i.index.Batch(batch); err != nil {
+		log.Errorf("error indexing %d jobs: %s", len(jobs), err)
+		return err
+	}
+
+	return nil
+}
+
+// Delete removes the job from the index
+func (i *Indexer) Delete(id ID) error {
+	return i.index.Delete(id.String())
+}
+
+// DeleteBatch removes many jobs from the index at once
+func (i *Indexer) DeleteBatch(ids []ID) error {
+	batch := i.index.NewBatch()
+	for _, id := range ids {
+		batch.Delete(id.String())
+	}
+
+	if err := i.index.Batch(batch); err != nil {
+		log.Errorf("error removing %d jobs from index: %s", len(ids), err)
+		return err
+	}
+
+	return nil
+}
+
+// IDs returns the ids of every job in the index
+func (i *Indexer) IDs() ([]ID, error) {
+	count, err := i.index.DocCount()
+	if err != nil {
+		log.Errorf("error getting index size: %s", err)
+		return nil, err
+	}
+	if count == 0 {
+		return nil, nil
+	}
+
+	req := bleve.NewSearchRequestOptions(bleve.NewMatchAllQuery(), int(count), 0, false)
+	res, err := i.index.Search(req)
+	if err != nil {
+		log.Errorf("error listing index: %s", err)
+		return nil, err
+	}
+
+	ids := make([]ID, 0, len(res.Hits))
+	for _, hit := range res.Hits {
+		ids = append(ids, ParseId(hit.ID))
+	}
+	return ids, nil
+}
+
+// Search returns the ids of jobs matching the query q in the order and page
+// given by options along with a result holding the total number of matches,
+// the cursor of the next page (if any) and highlights if requested. The Jobs
+// of the result are left for the Store to fill in.
+func (i *Indexer) Search(q string, options *SearchOptions) ([]ID, *SearchResult, error) {
+	if options == nil {
+		options = &SearchOptions{}
+	}
+
+	size := options.Limit
+	if size <= 0 {
+		count, err := i.index.DocCount()
+		if err != nil {
+			log.Errorf("error getting index size: %s", err)
+			return nil, nil, err
+		}
+		size = int(count)
+	}
+
+	req := bleve.NewSearchRequestOptions(searchQuery(q), size, options.Offset, false)
+
+	order, err := options.sortOrder()
+	if err != nil {
+		return nil, nil, err
+	}
+	req.SortBy(order)
+
+	if options.Cursor != "" {
+		after, err := decodeCursor(options.Cursor)
+		if err != nil || len(after) != len(order) {
+			return nil, nil, fmt.Errorf("invalid cursor: %s", options.Cursor)
+		}
+		req.From = 0
+		req.SetSearchAfter(after)
+	}
+
+	if options.Highlight {
+		req.Highlight = bleve.NewHighlight()
+		for _, field := range dataFields {
+			req.Highlight.AddField(field)
+		}
+	}
+
+	res, err := i.index.Search(req)
+	if err != nil {
+		log.Errorf("error performing index search %s: %s", q, err)
+		return nil, nil, err
+	}
+
+	result := &SearchResult{Total: res.Total}
+
+	var ids []ID
+	for _, hit := range res.Hits {
+		id := ParseId(hit.ID)
+		ids = append(ids, id)
+
+		if len(hit.Fragments) > 0 {
+			if result.Highlights == nil {
+				result.Highlights = make(map[ID]map[string][]string)
+			}
+			result.Highlights[id] = hit.Fragments
+		}
+	}
+
+	if n := len(res.Hits); n > 0 && n == size && options.Limit > 0 {
+		result.Next = encodeCursor(res.Hits[n-1].Sort)
+	}
+
+	return ids, result, nil
+}
+
+func searchQuery(q string) query.Query {
+	if q == "" {
+		return bleve.NewMatchAllQuery()
+	}
+	return bleve.NewQueryStringQuery(rewriteQuery(q, time.Now()))
+}
+
+func encodeCursor(sort []string) string {
+	buf, _ := json.Marshal(sort)
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+func decodeCursor(cursor string) (sort []string, err error) {
+	buf, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(buf, &sort)
+	return
+}
@@ -2,6 +2,7 @@ package je
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -47,12 +48,34 @@ func InitMetrics(name string) *Metrics {
 		[]string{"name"},
 	)
 
+	// job reaped counter
+	metrics.NewCounter(
+		"job", "reaped",
+		"Number of jobs deleted by retention policies",
+	)
+
 	// job index summary
 	metrics.NewSummary(
 		"job", "index",
 		"Index duration in seconds",
 	)
 
+	// index reindex gauges
+	metrics.NewGauge(
+		"index", "reindex_jobs",
+		"Number of jobs being reindexed",
+	)
+	metrics.NewGauge(
+		"index", "reindex_indexed",
+		"Number of jobs reindexed so far",
+	)
+
+	// index reindexes counter
+	metrics.NewCounter(
+		"index", "reindexes",
+		"Number of times the search index was rebuilt",
+	)
+
 	return metrics
 }
 
@@ -63,6 +86,12 @@ func InitDB(uri string) (Store, error) {
 		return nil, err
 	}
 
+	options, err := ParseStoreOptions(u.Query)
+	if err != nil {
+		log.Errorf("error parsing db uri %s: %s", uri, err)
+		return nil, err
+	}
+
 	switch u.Type {
 	case "memory":
 		db, err = NewMemoryStore()
@@ -73,7 +102,7 @@ func InitDB(uri string) (Store, error) {
 		log.Infof("Using MemoryStore %s", uri)
 		return db, nil
 	case "bolt":
-		db, err = NewBoltStore(u.Path)
+		db, err = NewBoltStore(u.Path, options)
 		if err != nil {
 			log.Errorf("error creating store %s: %s", uri, err)
 			return nil, err
@@ -81,13 +110,34 @@ func InitDB(uri string) (Store, error) {
 		log.Infof("Using BoltStore %s", uri)
 		return db, nil
 	case "bitcask":
-		db, err = NewBitcaskStore(u.Path)
+		db, err = NewBitcaskStore(u.Path, options)
 		if err != nil {
 			log.Errorf("error creating store %s: %s", uri, err)
 			return nil, err
 		}
 		log.Infof("Using BitcaskStore %s", uri)
 		return db, nil
+	case "sqlite":
+		db, err = NewSQLiteStore(u.Path, options)
+		if err != nil {
+			log.Errorf("error creating store %s: %s", uri, err)
+			return nil, err
+		}
+		log.Infof("Using SQLiteStore %s", uri)
+		return db, nil
+	case "postgres", "postgresql":
+		dsn, err := postgresDSN(uri)
+		if err != nil {
+			log.Errorf("error parsing db uri %s: %s", uri, err)
+			return nil, err
+		}
+		db, err = NewPostgresStore(dsn, options)
+		if err != nil {
+			log.Errorf("error creating store %s: %s", uri, err)
+			return nil, err
+		}
+		log.Infof("Using PostgresStore %s", uri)
+		return db, nil
 	default:
 		err := fmt.Errorf("unsupported db uri: %s", uri)
 		log.Error(err)
@@ -95,7 +145,64 @@ func InitDB(uri string) (Store, error) {
 	}
 }
 
-func InitData(path string) (Data, error) {
+// InitData sets up where the input, output and logs of jobs are stored given
+// a path to a local directory (optionally as a file:// uri) or an s3:// uri
+// (see ParseS3URI). The data is encrypted with DataKeys if set.
+func InitData(uri string) (Data, error) {
+	d, err := initData(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	if DataKeys != nil {
+		data = NewEncryptedData(d, DataKeys)
+		log.Infof("Encrypting data with key %s", DataKeys.Current())
+	}
+
+	// Rather than leave the data of jobs uncompressed without a word
+	if _, ok := data.(Compressor); DataCompression != "" && !ok {
+		err := fmt.Errorf("cannot compress data %s with %s: only unencrypted local data can be compressed", uri, DataCompression)
+		log.Error(err)
+		return nil, err
+	}
+	return data, nil
+}
+
+func initData(uri string) (Data, error) {
+	if !strings.Contains(uri, "://") {
+		return initLocalData(uri)
+	}
+
+	u, err := ParseURI(uri)
+	if err != nil {
+		log.Errorf("error parsing data uri %s: %s", uri, err)
+		return nil, err
+	}
+
+	switch u.Type {
+	case "file", "local":
+		return initLocalData(u.Path)
+	case "s3":
+		bucket, prefix, options, err := ParseS3URI(uri)
+		if err != nil {
+			log.Errorf("error parsing data uri %s: %s", uri, err)
+			return nil, err
+		}
+		data, err = NewS3Data(bucket, prefix, options)
+		if err != nil {
+			log.Errorf("error creating data %s: %s", uri, err)
+			return nil, err
+		}
+		log.Infof("Using S3Data %s", uri)
+		return data, nil
+	default:
+		err := fmt.Errorf("unsupported data uri: %s", uri)
+		log.Error(err)
+		return nil, err
+	}
+}
+
+func initLocalData(path string) (Data, error) {
 	var err error
 
 	data, err = NewLocalData(path)
@@ -0,0 +1,161 @@
+package je
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// STDIN_PART is the name of the part of a multipart/form-data request
+// creating a job that is its input. Every other part is an input file.
+const STDIN_PART = "stdin"
+
+// errInvalidInput is returned when the input of a new job is invalid
+var errInvalidInput = errors.New("invalid input")
+
+// writeInput writes the input of a job from r
+func writeInput(id ID, r io.Reader) (int64, error) {
+	input, err := data.Write(id, DATA_INPUT)
+	if err != nil {
+		log.Errorf("error creating job input for #%d: %s", id, err)
+		return 0, err
+	}
+
+	n, err := io.Copy(input, r)
+	log.Debugf("written %d bytes of input for job #%d", n, id)
+	if err != nil {
+		log.Errorf("error writing input for job #%d: %s", id, err)
+	}
+
+	if e := input.Close(); e != nil {
+		log.Errorf("error closing input for job #%d: %s", id, e)
+		if err == nil {
+			err = e
+		}
+	}
+	return n, err
+}
+
+// writeFormInput writes the input of a job from the stdin part of form and
+// each of its other parts as an input file named after the part, returning
+// the input files written. The input is empty if there is no stdin part.
+func writeFormInput(id ID, form *multipart.Reader) ([]Artifact, error) {
+	var (
+		stdin bool
+		files []Artifact
+	)
+	seen := make(map[string]bool)
+
+	for {
+		part, err := form.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", errInvalidInput, err)
+		}
+
+		name := part.FormName()
+		if seen[name] {
+			part.Close()
+			return nil, fmt.Errorf("%w: duplicate part %q", errInvalidInput, name)
+		}
+		seen[name] = true
+
+		if name == STDIN_PART {
+			stdin = true
+			_, err = writeInput(id, part)
+			part.Close()
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if !validArtifactName(name) {
+			part.Close()
+			return nil, fmt.Errorf("%w: invalid input file name %q: must be relative to the working directory", errInvalidInput, name)
+		}
+
+		n, err := writeInputFile(id, name, part)
+		part.Close()
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, Artifact{Name: name, Size: n})
+	}
+
+	if !stdin {
+		if _, err := writeInput(id, strings.NewReader("")); err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+func writeInputFile(id ID, name string, r io.Reader) (int64, error) {
+	w, err := data.WriteInputFile(id, name)
+	if err != nil {
+		log.Errorf("error creating input file %s for job #%d: %s", name, id, err)
+		return 0, err
+	}
+
+	n, err := io.Copy(w, r)
+	if err != nil {
+		w.Close()
+		log.Errorf("error writing input file %s for job #%d: %s", name, id, err)
+		return n, err
+	}
+	return n, w.Close()
+}
+
+// copyInputFiles copies the input files of the job with the given id into
+// its working directory dir
+func copyInputFiles(id ID, dir string, files []Artifact) error {
+	for _, file := range files {
+		if err := copyInputFile(id, dir, file.Name); err != nil {
+			return fmt.Errorf("error copying input file %s: %s", file.Name, err)
+		}
+	}
+	return nil
+}
+
+func copyInputFile(id ID, dir, name string) error {
+	r, err := data.ReadInputFile(id, name)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	path := filepath.Join(dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// pipeOutput writes the output of the job with the given id to w as it is
+// written until that job is done or ctx is cancelled and then closes w
+func pipeOutput(ctx context.Context, id ID, w io.WriteCloser) error {
+	defer w.Close()
+	_, _, err := pollData(ctx, id, DATA_OUTPUT, 0, func(r io.Reader) (int64, error) {
+		return io.Copy(w, r)
+	})
+	return err
+}
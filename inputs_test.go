@@ -0,0 +1,130 @@
+package je
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createTestJob creates a job with the v2 API and returns it with the status
+// of the response
+func createTestJob(t *testing.T, qs url.Values, contentType string, body *bytes.Buffer) (int, *Job) {
+	res, err := http.Post(testAPIURL+"/jobs?"+qs.Encode(), contentType, body)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusCreated {
+		return res.StatusCode, nil
+	}
+
+	var job Job
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&job))
+	return res.StatusCode, &job
+}
+
+func getTestData(t *testing.T, id ID, dtype DataType) string {
+	res, err := http.Get(fmt.Sprintf("%s/jobs/%d/%s", testAPIURL, id, dataPaths[dtype]))
+	require.NoError(t, err)
+	defer res.Body.Close()
+	buf, err := ioutil.ReadAll(res.Body)
+	require.NoError(t, err)
+	return string(buf)
+}
+
+func TestAPIv2_InputFiles(t *testing.T) {
+	assert := assert.New(t)
+
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	w, err := mw.CreateFormFile("conf/app.ini", "app.ini")
+	require.NoError(t, err)
+	w.Write([]byte("debug=1\n"))
+	w, err = mw.CreateFormFile(STDIN_PART, "input.txt")
+	require.NoError(t, err)
+	w.Write([]byte("hello\n"))
+	require.NoError(t, mw.Close())
+
+	qs := url.Values{"name": {"sh"}, "arg": {"-c", "cat; cat conf/app.ini"}, "wait": {"1"}}
+	status, job := createTestJob(t, qs, mw.FormDataContentType(), body)
+	require.Equal(t, http.StatusCreated, status)
+	assert.Equal(STATE_STOPPED, job.State)
+	assert.Equal([]Artifact{{Name: "conf/app.ini", Size: 8}}, job.InputFiles)
+	assert.Equal("hello\n", getTestData(t, job.ID, DATA_INPUT))
+	assert.Equal("hello\ndebug=1\n", getTestData(t, job.ID, DATA_OUTPUT))
+
+	require.NoError(t, DeleteJob(job.ID))
+	_, err = data.ReadInputFile(job.ID, "conf/app.ini")
+	assert.True(os.IsNotExist(err))
+
+	// Jobs with invalid input files are not created
+	body.Reset()
+	mw = multipart.NewWriter(body)
+	w, err = mw.CreateFormFile("../app.ini", "app.ini")
+	require.NoError(t, err)
+	w.Write([]byte("debug=1\n"))
+	require.NoError(t, mw.Close())
+
+	next := db.NextId()
+	status, _ = createTestJob(t, url.Values{"name": {"true"}}, mw.FormDataContentType(), body)
+	assert.Equal(http.StatusBadRequest, status)
+	_, err = db.Get(next + 1)
+	assert.Error(err)
+}
+
+func TestAPIv2_StdinFrom(t *testing.T) {
+	assert := assert.New(t)
+
+	// The output is read as it is written until the job is done
+	qs := url.Values{"name": {"sh"}, "arg": {"-c", "echo hello; sleep 1; echo world"}}
+	status, from := createTestJob(t, qs, "text/plain", &bytes.Buffer{})
+	require.Equal(t, http.StatusCreated, status)
+
+	qs = url.Values{"name": {"tr"}, "arg": {"a-z", "A-Z"}, "stdin_from": {fmt.Sprint(from.ID)}, "wait": {"1"}}
+	status, job := createTestJob(t, qs, "text/plain", &bytes.Buffer{})
+	require.Equal(t, http.StatusCreated, status)
+	assert.Equal(STATE_STOPPED, job.State)
+	assert.Equal(from.ID, job.StdinFrom)
+	assert.Equal("HELLO\nWORLD\n", getTestData(t, job.ID, DATA_OUTPUT))
+
+	// Jobs exiting before reading all of it are not held up by it
+	qs = url.Values{"name": {"sh"}, "arg": {"-c", "while :; do echo y; sleep 0.1; done"}}
+	status, from = createTestJob(t, qs, "text/plain", &bytes.Buffer{})
+	require.Equal(t, http.StatusCreated, status)
+	defer func() {
+		j, err := db.Get(from.ID)
+		require.NoError(t, err)
+		require.NoError(t, j.Kill(true))
+		j.Wait()
+	}()
+
+	qs = url.Values{"name": {"head"}, "arg": {"-n", "2"}, "stdin_from": {fmt.Sprint(from.ID)}, "wait": {"1"}}
+	status, job = createTestJob(t, qs, "text/plain", &bytes.Buffer{})
+	require.Equal(t, http.StatusCreated, status)
+	assert.Equal(STATE_STOPPED, job.State)
+	assert.Equal("y\ny\n", getTestData(t, job.ID, DATA_OUTPUT))
+
+	for _, test := range []struct {
+		stdinFrom string
+		input     string
+	}{
+		{"0", ""},
+		{"12345678", ""},
+		{fmt.Sprint(from.ID), "input"},
+	} {
+		qs = url.Values{"name": {"cat"}, "stdin_from": {test.stdinFrom}}
+		status, _ = createTestJob(t, qs, "text/plain", bytes.NewBufferString(test.input))
+		assert.Equal(http.StatusBadRequest, status, test.stdinFrom)
+	}
+
+	qs = url.Values{"name": {"cat"}, "stdin_from": {fmt.Sprint(from.ID)}, "interactive": {"1"}}
+	status, _ = createTestJob(t, qs, "text/plain", &bytes.Buffer{})
+	assert.Equal(http.StatusBadRequest, status)
+}
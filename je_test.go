@@ -2,9 +2,11 @@ package je
 
 import (
 	"io/ioutil"
+	"net"
 	"net/http"
 	"os"
 	"testing"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 
@@ -19,6 +21,13 @@ func TestMain(m *testing.M) {
 	}
 	defer os.RemoveAll(datadir)
 
+	ScratchDir, err = ioutil.TempDir("", "jescratch")
+	if err != nil {
+		log.Errorf("error creating test scratch dir: %s", err)
+		os.Exit(1)
+	}
+	defer os.RemoveAll(ScratchDir)
+
 	_, err = InitData(datadir)
 	if err != nil {
 		log.Errorf("error initializing data: %s", err)
@@ -36,6 +45,16 @@ func TestMain(m *testing.M) {
 
 	go NewServer(":8000", nil).ListenAndServe()
 
+	// Wait for the server to start listening
+	for i := 0; i < 50; i++ {
+		conn, err := net.Dial("tcp", "127.0.0.1:8000")
+		if err == nil {
+			conn.Close()
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
 	os.Exit(m.Run())
 }
 
@@ -1,10 +1,15 @@
 package je
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
@@ -12,6 +17,10 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+// ErrNotRunning is returned when killing a job that is not running, e.g.
+// one that is already done
+var ErrNotRunning = errors.New("job is not running")
+
 // Job ...
 type Job struct {
 	sync.RWMutex
@@ -29,9 +38,53 @@ type Job struct {
 	KilledAt    time.Time `json:"killed"`
 	ErroredAt   time.Time `json:"errored"`
 
+	// OutputLimit caps the output and logs of the job under the
+	// DefaultOutputLimit
+	OutputLimit *OutputLimit `json:"output_limit,omitempty"`
+	// Truncated is how many bytes of output or logs were dropped by
+	// the output limit of the job by the name of the data
+	Truncated map[string]int64 `json:"truncated,omitempty"`
+	// Rotated is how many bytes were rotated out of the start of the
+	// output or logs of the job by the name of the data. Offsets in the
+	// data of followers count them.
+	Rotated map[string]int64 `json:"rotated,omitempty"`
+
+	// ArtifactGlobs are the patterns of the files in the working
+	// directory of the job kept as its artifacts once it is done
+	ArtifactGlobs []string `json:"artifact_globs,omitempty"`
+	// Artifacts are the files kept
+	Artifacts []Artifact `json:"artifacts,omitempty"`
+
+	// InputFiles are the files copied into the working directory of the
+	// job before it runs
+	InputFiles []Artifact `json:"input_files,omitempty"`
+	// Combined is true if the output and logs of the job are recorded in
+	// its combined log
+	Combined bool `json:"combined,omitempty"`
+
+	// StdinFrom is the job whose output is the input of the job, read as
+	// it is written until that job is done
+	StdinFrom ID `json:"stdin_from,omitempty"`
+
+	// Pipeline is the id of the pipeline the job is a stage of, which is
+	// the id of its first stage
+	Pipeline ID `json:"pipeline,omitempty"`
+	// Stages are the ids of the stages of the pipeline in order if the job
+	// is its first stage
+	Stages []ID `json:"stages,omitempty"`
+
 	input io.WriteCloser
 	cmd   *exec.Cmd
 	done  chan bool
+
+	// cancel cancels the context of a running Func job
+	cancel context.CancelFunc
+	// abandon stops waiting for a running Func job to return
+	abandon context.CancelFunc
+
+	// reason is why the job entered its current state and is recorded in
+	// the event stores append when it is saved
+	reason string
 }
 
 func NewJob(name string, args []string, interactive bool) (job *Job, err error) {
@@ -40,9 +93,11 @@ func NewJob(name string, args []string, interactive bool) (job *Job, err error)
 		Name:        name,
 		Args:        args,
 		Interactive: interactive,
+		State:       STATE_CREATED,
 		CreatedAt:   time.Now(),
 
-		done: make(chan bool, 1),
+		done:   make(chan bool, 1),
+		reason: "created",
 	}
 	err = db.Save(job)
 	if err == nil {
@@ -51,16 +106,137 @@ func NewJob(name string, args []string, interactive bool) (job *Job, err error)
 	return
 }
 
+// DeleteJob deletes a job from the store and index and removes its data
+func DeleteJob(id ID) error {
+	if err := db.Delete(id); err != nil {
+		log.Errorf("error deleting job #%d: %s", id, err)
+		return err
+	}
+
+	if err := data.Delete(id); err != nil {
+		log.Errorf("error deleting data for job #%d: %s", id, err)
+		return err
+	}
+
+	return nil
+}
+
 func (j *Job) Id() ID {
 	j.RLock()
 	defer j.RUnlock()
 	return j.ID
 }
 
+// snapshot returns a copy of the exported fields of the job taken with the
+// lock held so it can be encoded while the job is still running
+func (j *Job) snapshot() *Job {
+	j.RLock()
+	defer j.RUnlock()
+
+	c := &Job{
+		ID:            j.ID,
+		Name:          j.Name,
+		Args:          j.Args,
+		Interactive:   j.Interactive,
+		Worker:        j.Worker,
+		State:         j.State,
+		Status:        j.Status,
+		CreatedAt:     j.CreatedAt,
+		StartedAt:     j.StartedAt,
+		StoppedAt:     j.StoppedAt,
+		KilledAt:      j.KilledAt,
+		ErroredAt:     j.ErroredAt,
+		OutputLimit:   j.OutputLimit,
+		ArtifactGlobs: j.ArtifactGlobs,
+		Artifacts:     j.Artifacts,
+		InputFiles:    j.InputFiles,
+		Combined:      j.Combined,
+		StdinFrom:     j.StdinFrom,
+		Pipeline:      j.Pipeline,
+		Stages:        j.Stages,
+	}
+	c.Truncated = copyCounts(j.Truncated)
+	c.Rotated = copyCounts(j.Rotated)
+	return c
+}
+
+// copyCounts returns a copy of counts by name
+func copyCounts(counts map[string]int64) map[string]int64 {
+	if counts == nil {
+		return nil
+	}
+	c := make(map[string]int64, len(counts))
+	for name, n := range counts {
+		c[name] = n
+	}
+	return c
+}
+
+// snapshotJobs returns a snapshot of each of the jobs
+func snapshotJobs(jobs []*Job) []*Job {
+	if jobs == nil {
+		return nil
+	}
+	snapshots := make([]*Job, len(jobs))
+	for i, job := range jobs {
+		snapshots[i] = job.snapshot()
+	}
+	return snapshots
+}
+
+// FinishedAt returns when the job stopped, was killed or errored or the zero
+// time if it has not yet finished.
+func (j *Job) FinishedAt() time.Time {
+	for _, t := range []time.Time{j.StoppedAt, j.KilledAt, j.ErroredAt} {
+		if !t.IsZero() {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// Duration returns how long the job ran for or has been running. It does not
+// lock the job as it is called while saving with the lock held.
+func (j *Job) Duration() time.Duration {
+	if j.StartedAt.IsZero() {
+		return 0
+	}
+
+	if t := j.FinishedAt(); !t.IsZero() {
+		return t.Sub(j.StartedAt)
+	}
+
+	return time.Since(j.StartedAt)
+}
+
+// stateChangedAt returns when the job entered its current state or now if
+// the job has no timestamp for it. It does not lock the job as it is called
+// while saving with the lock held.
+func (j *Job) stateChangedAt() time.Time {
+	var t time.Time
+	switch j.State {
+	case STATE_CREATED:
+		t = j.CreatedAt
+	case STATE_RUNNING:
+		t = j.StartedAt
+	case STATE_STOPPED:
+		t = j.StoppedAt
+	case STATE_KILLED:
+		t = j.KilledAt
+	case STATE_ERRORED:
+		t = j.ErroredAt
+	}
+	if t.IsZero() {
+		return time.Now()
+	}
+	return t
+}
+
 func (j *Job) Enqueue() error {
 	j.Lock()
 	defer j.Unlock()
 	j.State = STATE_WAITING
+	j.reason = "queued"
 	return db.Save(j)
 }
 
@@ -70,59 +246,159 @@ func (j *Job) Start(worker string) error {
 	j.Worker = worker
 	j.State = STATE_RUNNING
 	j.StartedAt = time.Now()
+	j.reason = "started"
 	return db.Save(j)
 }
 
 func (j *Job) Kill(force bool) (err error) {
+	return j.kill(force, "killed")
+}
+
+// kill kills the job recording reason as why it was killed if force is true
+func (j *Job) kill(force bool, reason string) (err error) {
 	j.Lock()
 	defer j.Unlock()
+	// Killing a job that is done would overwrite its state and block on done
+	if j.State.Done() || (j.cancel == nil && j.cmd == nil) {
+		return ErrNotRunning
+	}
+	// Func jobs are cancelled and expected to return
+	if j.cancel != nil {
+		j.cancel()
+	}
 	if force {
-		err = j.cmd.Process.Kill()
-		if err != nil {
-			log.Errorf("error killing job #%d: %s", j.ID, err)
-			return
+		if j.cancel == nil {
+			err = j.cmd.Process.Kill()
+			if err != nil {
+				log.Errorf("error killing job #%d: %s", j.ID, err)
+				return
+			}
+		} else {
+			// Func jobs which do not return are left behind
+			j.abandon()
 		}
 
-		j.done <- true
 		j.State = STATE_KILLED
 		j.KilledAt = time.Now()
+		j.reason = reason
 		metrics.SummaryVec("job", "duration").WithLabelValues(j.Name).Observe(j.KilledAt.Sub(j.StartedAt).Seconds())
-		return db.Save(j)
+		err = db.Save(j)
+		j.done <- true
+		writes.notify(j.ID)
+		return
+	}
+	if j.cancel != nil {
+		return nil
 	}
 	return j.cmd.Process.Signal(os.Interrupt)
 }
 
+// dropped records that n bytes of the given data were dropped by the output
+// limit of the job. The job is saved the first time the data is truncated.
+// Nothing is recorded once the job is done, e.g. killed for its output.
+func (j *Job) dropped(dtype DataType, n int64) {
+	j.Lock()
+	defer j.Unlock()
+
+	if j.State.Done() {
+		return
+	}
+
+	name := dataPaths[dtype]
+	_, seen := j.Truncated[name]
+	if j.Truncated == nil {
+		j.Truncated = make(map[string]int64)
+	}
+	j.Truncated[name] += n
+
+	if !seen {
+		if err := db.Save(j); err != nil {
+			log.Errorf("error saving job #%d: %s", j.ID, err)
+		}
+	}
+}
+
+// rotated records that n bytes were rotated out of the start of the output
+// or logs of the job and saves it so that followers know where they are
+func (j *Job) rotated(dtype DataType, n int64) {
+	j.Lock()
+	defer j.Unlock()
+
+	name := dataPaths[dtype]
+	if j.Truncated == nil {
+		j.Truncated = make(map[string]int64)
+	}
+	if j.Rotated == nil {
+		j.Rotated = make(map[string]int64)
+	}
+	j.Truncated[name] += n
+	j.Rotated[name] += n
+
+	if err := db.Save(j); err != nil {
+		log.Errorf("error saving job #%d: %s", j.ID, err)
+	}
+}
+
 func (j *Job) Stop() error {
 	j.Lock()
 	defer j.Unlock()
-	j.done <- true
 	j.State = STATE_STOPPED
 	j.StoppedAt = time.Now()
+	j.reason = fmt.Sprintf("exited with status %d", j.Status)
 	metrics.SummaryVec("job", "duration").WithLabelValues(j.Name).Observe(j.StoppedAt.Sub(j.StartedAt).Seconds())
-	return db.Save(j)
+	err := db.Save(j)
+	compressData(j.ID)
+	j.done <- true
+	writes.notify(j.ID)
+	return err
 }
 
 func (j *Job) Error(err error) error {
 	j.Lock()
 	defer j.Unlock()
-	j.done <- true
 	j.State = STATE_ERRORED
 	j.ErroredAt = time.Now()
+	j.reason = err.Error()
 	j.Log(err.Error())
 	metrics.SummaryVec("job", "duration").WithLabelValues(j.Name).Observe(j.ErroredAt.Sub(j.StartedAt).Seconds())
-	return db.Save(j)
+	err = db.Save(j)
+	compressData(j.ID)
+	j.done <- true
+	writes.notify(j.ID)
+	return err
+}
+
+// interrupt marks a job that is still active but which nothing runs
+// anymore, e.g. as it was restored or imported, as errored with a line in
+// its logs saying why. It returns false if the job is done. The job must be
+// locked and is not saved.
+func (j *Job) interrupt(why string) bool {
+	if j.State.Done() {
+		return false
+	}
+	j.State = STATE_ERRORED
+	j.ErroredAt = time.Now()
+	j.reason = "interrupted"
+	j.Log("job was interrupted: " + why)
+	return true
 }
 
+// Log adds msg as a line to the logs of the job after what it wrote
 func (j *Job) Log(msg string) error {
-	f, err := data.Write(j.ID, DATA_LOGS)
+	f, err := appendData(j.ID, DATA_LOGS)
 	if err != nil {
-		log.Errorf("error creating logs for job #%s: %s", j.ID, err)
+		log.Errorf("error opening logs for job #%d: %s", j.ID, err)
 		return err
 	}
-	defer f.Close()
 
-	_, err = f.Write([]byte(msg))
-	return err
+	if !strings.HasSuffix(msg, "\n") {
+		msg += "\n"
+	}
+	if _, err = f.Write([]byte(msg)); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
 }
 
 func (j *Job) Wait() {
@@ -151,9 +427,75 @@ func (j *Job) Killed() bool {
 	return j.State == STATE_KILLED
 }
 
+// Execute runs the job. Its output and logs are compressed once it is done
+// and saved: by Stop or Error, or here for jobs that were killed as their
+// output is only closed once they return.
 func (j *Job) Execute() (err error) {
+	defer func() {
+		if err == nil && j.Killed() {
+			compressData(j.ID)
+		}
+	}()
+
+	j.RLock()
+	files, globs := j.InputFiles, j.ArtifactGlobs
+	j.RUnlock()
+
+	// Only jobs with input files or artifacts get a scratch directory of
+	// their own to run in
+	var dir string
+	if len(files) > 0 || len(globs) > 0 {
+		if dir, err = newScratchDir(j.ID); err != nil {
+			log.Errorf("error creating working directory for job #%d: %s", j.ID, err)
+			return err
+		}
+		defer os.RemoveAll(dir)
+
+		if err = copyInputFiles(j.ID, dir, files); err != nil {
+			log.Errorf("error preparing working directory for job #%d: %s", j.ID, err)
+			return err
+		}
+	}
+
+	if fn, ok := lookupFunc(j.Name); ok {
+		err = j.executeFunc(fn, dir)
+	} else {
+		err = j.executeCmd(dir)
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(globs) > 0 {
+		j.collectArtifacts(dir, globs)
+	}
+
+	return nil
+}
+
+// executeCmd runs the executable of the job with its working directory dir,
+// if it has one, and otherwise in the daemon's directory so that relative
+// paths given to it are still resolved from there.
+func (j *Job) executeCmd(dir string) (err error) {
 	cmd := exec.Command(j.Name, j.Args...)
 
+	// Executables given by a relative path are still looked up from the
+	// daemon's directory
+	if strings.ContainsRune(j.Name, filepath.Separator) && !filepath.IsAbs(j.Name) {
+		if cmd.Path, err = filepath.Abs(j.Name); err != nil {
+			log.Errorf("error resolving path of job #%d: %s", j.ID, err)
+			return err
+		}
+	}
+	if dir != "" {
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "JE_WORKDIR="+dir)
+	}
+
+	j.RLock()
+	stdinFrom := j.StdinFrom
+	j.RUnlock()
+
 	if j.Interactive {
 		stdin, err := cmd.StdinPipe()
 		if err != nil {
@@ -164,6 +506,15 @@ func (j *Job) Execute() (err error) {
 		j.Lock()
 		j.input = stdin
 		j.Unlock()
+	} else if stdinFrom != 0 {
+		stdin, err := cmd.StdinPipe()
+		if err != nil {
+			log.Errorf("error creating input for job #%d: %s", j.ID, err)
+			return err
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go j.pipeInput(ctx, stdinFrom, stdin)
 	} else {
 		stdin, err := data.Read(j.ID, DATA_INPUT)
 		if err != nil {
@@ -190,21 +541,12 @@ func (j *Job) Execute() (err error) {
 		return err
 	}
 
-	logs, err := data.Write(j.ID, DATA_LOGS)
-	if err != nil {
-		log.Errorf("error creating logs for job #%s: %s", j.ID, err)
-		return err
-	}
-	// TODO: Check for errors? Retry RINTR?
-	defer logs.Close()
-
-	output, err := data.Write(j.ID, DATA_OUTPUT)
+	w, err := j.openWriters()
 	if err != nil {
-		log.Errorf("error creating output for job #%s: %s", j.ID, err)
 		return err
 	}
 	// TODO: Check for errors? Retry RINTR?
-	defer output.Close()
+	defer w.Close()
 
 	if err = cmd.Start(); err != nil {
 		log.Errorf("error starting job #%d: %s", j.ID, err)
@@ -216,7 +558,8 @@ func (j *Job) Execute() (err error) {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		n, err := io.Copy(logs, stderr)
+		n, err := io.Copy(w.logs, stderr)
+		w.stderr.Flush()
 		log.Debugf("written %d bytes of logs for job #%d", n, j.ID)
 		if err != nil {
 			log.Errorf("error writing logs for job #%d: %s", j.ID, err)
@@ -230,7 +573,8 @@ func (j *Job) Execute() (err error) {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		n, err := io.Copy(output, stdout)
+		n, err := io.Copy(w.output, stdout)
+		w.stdout.Flush()
 		log.Debugf("written %d bytes of output for job #%d", n, j.ID)
 		if err != nil {
 			log.Errorf("error writing output for job #%d: %s", j.ID, err)
@@ -253,10 +597,111 @@ func (j *Job) Execute() (err error) {
 			// defined for both Unix and Windows and in both cases has
 			// an ExitStatus() method with the same signature.
 			if status, ok := exiterr.Sys().(syscall.WaitStatus); ok {
+				j.Lock()
 				j.Status = status.ExitStatus()
+				j.Unlock()
 			}
 		}
 	}
 
 	return nil
 }
+
+// pipeInput writes the output of the job with the given id to the input of
+// the job as it is written until that job is done or ctx is cancelled
+func (j *Job) pipeInput(ctx context.Context, id ID, stdin io.WriteCloser) {
+	// Jobs exiting before reading all of it is not an error
+	if err := pipeOutput(ctx, id, stdin); err != nil {
+		log.Debugf("error piping output of job #%d to job #%d: %s", id, j.ID, err)
+	}
+}
+
+// jobWriters are the output and logs of a running job, limited by its
+// output limit and recorded in its combined log if it has one
+type jobWriters struct {
+	output, logs   *limitedWriter
+	stdout, stderr *combinedStream
+	combined       io.Closer
+}
+
+// openWriters creates the output, logs and, if the job records them, the
+// combined log of the job
+func (j *Job) openWriters() (*jobWriters, error) {
+	j.RLock()
+	limit := DefaultOutputLimit.effective(j.OutputLimit)
+	combined := j.Combined
+	j.RUnlock()
+
+	w := &jobWriters{}
+	var stdout, stderr io.Writer = ioutil.Discard, ioutil.Discard
+	if combined {
+		f, err := data.Write(j.ID, DATA_COMBINED)
+		if err != nil {
+			log.Errorf("error creating combined log for job #%d: %s", j.ID, err)
+			return nil, err
+		}
+		clog := newCombinedLog(f)
+		w.stdout, w.stderr, w.combined = clog.stream(STREAM_STDOUT), clog.stream(STREAM_STDERR), f
+		stdout, stderr = w.stdout, w.stderr
+	}
+
+	logs, err := data.Write(j.ID, DATA_LOGS)
+	if err != nil {
+		log.Errorf("error creating logs for job #%s: %s", j.ID, err)
+		w.closeCombined()
+		return nil, err
+	}
+	// The logs are rewritten when rotated so close what they end up as
+	w.logs = newLimitedWriter(j, DATA_LOGS, limit, logs, stderr)
+
+	output, err := data.Write(j.ID, DATA_OUTPUT)
+	if err != nil {
+		log.Errorf("error creating output for job #%s: %s", j.ID, err)
+		w.logs.Close()
+		w.closeCombined()
+		return nil, err
+	}
+	w.output = newLimitedWriter(j, DATA_OUTPUT, limit, output, stdout)
+
+	return w, nil
+}
+
+// closeCombined records what is left of the output and logs in the combined
+// log, if there is one, and closes it
+func (w *jobWriters) closeCombined() error {
+	if w.combined == nil {
+		return nil
+	}
+	w.stdout.Flush()
+	w.stderr.Flush()
+	return w.combined.Close()
+}
+
+// Close closes the output, logs and combined log
+func (w *jobWriters) Close() error {
+	err := w.closeCombined()
+	if e := w.output.Close(); err == nil {
+		err = e
+	}
+	if e := w.logs.Close(); err == nil {
+		err = e
+	}
+	return err
+}
+
+// collectArtifacts keeps the files in the working directory of the job
+// matching globs as its artifacts. Failing to collect them is logged but
+// does not fail the job.
+func (j *Job) collectArtifacts(dir string, globs []string) {
+	artifacts, err := collectArtifacts(j.ID, dir, globs)
+	if err != nil {
+		log.Errorf("error collecting artifacts of job #%d: %s", j.ID, err)
+	}
+
+	j.Lock()
+	defer j.Unlock()
+	j.Artifacts = artifacts
+	if err := db.Save(j); err != nil {
+		log.Errorf("error saving job #%d: %s", j.ID, err)
+	}
+}
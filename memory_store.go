@@ -2,11 +2,6 @@ package je
 
 import (
 	"sync"
-	"time"
-
-	log "github.com/sirupsen/logrus"
-
-	"github.com/blevesearch/bleve"
 )
 
 type MemoryStore struct {
@@ -14,11 +9,12 @@ type MemoryStore struct {
 
 	nextid ID
 	data   map[ID]*Job
-	index  bleve.Index
+	events map[ID][]*JobEvent
+	index  *Indexer
 }
 
 func (store *MemoryStore) Close() error {
-	return nil
+	return store.index.Close()
 }
 
 func (store *MemoryStore) NextId() ID {
@@ -30,15 +26,35 @@ func (store *MemoryStore) NextId() ID {
 }
 
 func (store *MemoryStore) Save(job *Job) error {
+	if job.ID == ID(0) {
+		job.ID = store.NextId()
+	}
+
 	store.Lock()
+	if job.ID > store.nextid {
+		store.nextid = job.ID
+	}
 	store.data[job.ID] = job
+	if event := nextEvent(job, lastEvent(store.events[job.ID])); event != nil {
+		store.events[job.ID] = append(store.events[job.ID], event)
+	}
 	store.Unlock()
 
-	t := time.Now()
-	store.index.Index(job.ID.String(), job)
-	metrics.Summary("job", "index").Observe(time.Now().Sub(t).Seconds())
+	return store.index.Index(job)
+}
+
+func (store *MemoryStore) Delete(id ID) error {
+	store.Lock()
+	_, ok := store.data[id]
+	delete(store.data, id)
+	delete(store.events, id)
+	store.Unlock()
+
+	if !ok {
+		return &KeyError{id, ErrNotExist}
+	}
 
-	return nil
+	return store.index.Delete(id)
 }
 
 func (store *MemoryStore) Get(id ID) (job *Job, err error) {
@@ -78,44 +94,40 @@ func (store *MemoryStore) All() (jobs []*Job, err error) {
 	return
 }
 
-func (store *MemoryStore) Search(q string) (jobs []*Job, err error) {
-	size, err := store.index.DocCount()
-	if err != nil {
-		log.Errorf("error getting index size: %s", err)
-		return
-	}
+func (store *MemoryStore) Events(id ID) ([]*JobEvent, error) {
+	store.RLock()
+	defer store.RUnlock()
+
+	return append([]*JobEvent{}, store.events[id]...), nil
+}
+
+func (store *MemoryStore) indexer() *Indexer {
+	return store.index
+}
 
-	query := bleve.NewQueryStringQuery(q)
-	req := bleve.NewSearchRequestOptions(query, int(size), 0, false)
-	res, err := store.index.Search(req)
+func (store *MemoryStore) Search(q string, options *SearchOptions) (*SearchResult, error) {
+	ids, res, err := store.index.Search(q, options)
 	if err != nil {
-		log.Errorf("error performing index search %s: %s", q, err)
-		return
+		return nil, err
 	}
 
-	for _, hit := range res.Hits {
-		store.RLock()
-		job, ok := store.data[ParseId(hit.ID)]
-		store.RUnlock()
-		if !ok {
-			log.Warnf("job #%s missing from store but exists in index!", hit.ID)
-			continue
-		}
-		jobs = append(jobs, job)
+	res.Jobs, err = store.Find(ids...)
+	if err != nil {
+		return nil, err
 	}
 
-	return
+	return res, nil
 }
 
 func NewMemoryStore() (Store, error) {
-	index, err := bleve.NewMemOnly(bleve.NewIndexMapping())
+	index, err := NewIndexer("")
 	if err != nil {
-		log.Errorf("error creating index: %s", err)
 		return nil, err
 	}
 
 	return &MemoryStore{
-		data:  make(map[ID]*Job),
-		index: index,
+		data:   make(map[ID]*Job),
+		events: make(map[ID][]*JobEvent),
+		index:  index,
 	}, nil
 }
@@ -0,0 +1,41 @@
+package je
+
+import (
+	"sync"
+)
+
+// writes wakes up whatever is following the data of a job, such as the
+// next stage of a pipeline, as soon as the job writes or is done instead of
+// at its next poll. Jobs run by other instances are only polled.
+var writes = &notifier{waiting: make(map[ID]chan struct{})}
+
+// notifier wakes up what waits for something to happen to a job
+type notifier struct {
+	sync.Mutex
+	waiting map[ID]chan struct{}
+}
+
+// wait returns a channel which is closed the next time notify is called for
+// the job with the given id
+func (n *notifier) wait(id ID) <-chan struct{} {
+	n.Lock()
+	defer n.Unlock()
+
+	ch, ok := n.waiting[id]
+	if !ok {
+		ch = make(chan struct{})
+		n.waiting[id] = ch
+	}
+	return ch
+}
+
+// notify wakes up everything waiting for the job with the given id
+func (n *notifier) notify(id ID) {
+	n.Lock()
+	defer n.Unlock()
+
+	if ch, ok := n.waiting[id]; ok {
+		close(ch)
+		delete(n.waiting, id)
+	}
+}
@@ -0,0 +1,488 @@
+package je
+
+// openAPISpec is the OpenAPI 3 document describing the v2 API served at
+// GET /api/v2/openapi.json
+const openAPISpec = `{
+  "openapi": "3.0.3",
+  "info": {
+    "title": "Job Engine",
+    "description": "Resource-oriented API for submitting, viewing and managing jobs",
+    "version": "2.0.0"
+  },
+  "servers": [
+    {"url": "/api/v2"}
+  ],
+  "paths": {
+    "/jobs": {
+      "get": {
+        "summary": "List or search jobs",
+        "operationId": "listJobs",
+        "parameters": [
+          {"name": "q", "in": "query", "description": "Bleve query string", "schema": {"type": "string"}},
+          {"name": "name", "in": "query", "description": "Only jobs with this name", "schema": {"type": "string"}},
+          {"name": "state", "in": "query", "description": "Only jobs in this state", "schema": {"$ref": "#/components/schemas/State"}},
+          {"name": "status", "in": "query", "description": "Only jobs that exited with this status", "schema": {"type": "integer"}},
+          {"name": "since", "in": "query", "description": "Only jobs created at or after this RFC 3339 time or duration ago (e.g. 24h)", "schema": {"type": "string"}},
+          {"name": "until", "in": "query", "description": "Only jobs created before this RFC 3339 time or duration ago", "schema": {"type": "string"}},
+          {"name": "min_duration", "in": "query", "description": "Only jobs that ran for at least this long (seconds or a duration such as 10m)", "schema": {"type": "string"}},
+          {"name": "max_duration", "in": "query", "description": "Only jobs that ran for at most this long (seconds or a duration such as 10m)", "schema": {"type": "string"}},
+          {"name": "limit", "in": "query", "description": "Maximum number of jobs to return (0 for no limit)", "schema": {"type": "integer", "default": 100}},
+          {"name": "offset", "in": "query", "description": "Number of matching jobs to skip", "schema": {"type": "integer"}},
+          {"name": "cursor", "in": "query", "description": "Continue from the X-Next-Cursor of a previous page", "schema": {"type": "string"}},
+          {"name": "sort", "in": "query", "schema": {"type": "string", "enum": ["created", "started", "stopped", "duration", "status", "state"], "default": "created"}},
+          {"name": "order", "in": "query", "schema": {"type": "string", "enum": ["asc", "desc"], "default": "asc"}},
+          {"name": "highlight", "in": "query", "description": "Include fragments of the output and logs matching q (returns SearchHit objects)", "schema": {"type": "boolean"}}
+        ],
+        "responses": {
+          "200": {
+            "description": "Matching jobs",
+            "headers": {
+              "X-Total-Count": {"description": "Number of matching jobs across all pages", "schema": {"type": "integer"}},
+              "X-Next-Cursor": {"description": "Cursor of the next page if there is one", "schema": {"type": "string"}},
+              "Link": {"description": "URL of the next page with rel=\"next\"", "schema": {"type": "string"}}
+            },
+            "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/Job"}}}}
+          },
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "post": {
+        "summary": "Create and submit a new job",
+        "operationId": "createJob",
+        "parameters": [
+          {"name": "name", "in": "query", "required": true, "description": "Name of the executable to run", "schema": {"type": "string"}},
+          {"name": "arg", "in": "query", "description": "Argument to the job (may be repeated)", "schema": {"type": "array", "items": {"type": "string"}}, "explode": true},
+          {"name": "args", "in": "query", "description": "Space separated arguments (used if no arg is given)", "schema": {"type": "string"}},
+          {"name": "interactive", "in": "query", "description": "Keep the job's stdin open", "schema": {"type": "boolean"}},
+          {"name": "max_output", "in": "query", "description": "Most bytes of output and of logs to keep, e.g. 10MB", "schema": {"type": "string"}},
+          {"name": "output_policy", "in": "query", "description": "What to do once max_output is reached", "schema": {"type": "string", "enum": ["truncate", "rotate", "kill"]}},
+          {"name": "stdin_from", "in": "query", "description": "Id of a job whose output is the input of the job, read as it is written until that job is done", "schema": {"type": "integer", "format": "uint64"}},
+          {"name": "artifact", "in": "query", "description": "Glob of files in the working directory to keep as artifacts once the job is done", "schema": {"type": "array", "items": {"type": "string"}}, "explode": true},
+          {"name": "combined", "in": "query", "description": "Record the output and logs interleaved in the combined log of the job", "schema": {"type": "boolean"}},
+          {"name": "wait", "in": "query", "description": "Wait for the job to complete before responding", "schema": {"type": "boolean"}}
+        ],
+        "requestBody": {
+          "description": "Standard input of the job or, as multipart/form-data, its stdin part and input files by their path in its working directory",
+          "content": {
+            "application/octet-stream": {"schema": {"type": "string", "format": "binary"}},
+            "multipart/form-data": {
+              "schema": {
+                "type": "object",
+                "properties": {"stdin": {"type": "string", "format": "binary"}},
+                "additionalProperties": {"type": "string", "format": "binary"}
+              }
+            }
+          }
+        },
+        "responses": {
+          "201": {
+            "description": "Job created",
+            "headers": {"Location": {"description": "URL of the new job", "schema": {"type": "string"}}},
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Job"}}}
+          },
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/stats": {
+      "get": {
+        "summary": "Aggregate statistics over jobs",
+        "operationId": "getStats",
+        "parameters": [
+          {"name": "q", "in": "query", "description": "Only consider jobs matching this query", "schema": {"type": "string"}},
+          {"name": "hours", "in": "query", "description": "Number of hours covered by the histogram of created jobs", "schema": {"type": "integer", "default": 24}}
+        ],
+        "responses": {
+          "200": {
+            "description": "Statistics",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Stats"}}}
+          },
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/jobs/{id}": {
+      "parameters": [{"$ref": "#/components/parameters/ID"}],
+      "get": {
+        "summary": "Get a job",
+        "operationId": "getJob",
+        "responses": {
+          "200": {
+            "description": "The job",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Job"}}}
+          },
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "delete": {
+        "summary": "Delete a finished job and its data",
+        "operationId": "deleteJob",
+        "responses": {
+          "204": {"description": "Job deleted"},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/jobs/{id}/input": {
+      "parameters": [{"$ref": "#/components/parameters/ID"}],
+      "get": {
+        "summary": "Get the input of a job",
+        "operationId": "getJobInput",
+        "responses": {
+          "200": {"$ref": "#/components/responses/Data"},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "post": {
+        "summary": "Write to the input of a running interactive job",
+        "operationId": "writeJobInput",
+        "requestBody": {
+          "required": true,
+          "content": {"application/octet-stream": {"schema": {"type": "string", "format": "binary"}}}
+        },
+        "responses": {
+          "200": {
+            "description": "Input written",
+            "content": {"application/json": {"schema": {"type": "object", "properties": {"written": {"type": "integer"}}}}}
+          },
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "delete": {
+        "summary": "Close the input of a running interactive job",
+        "operationId": "closeJobInput",
+        "responses": {
+          "204": {"description": "Input closed"},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/jobs/{id}/output": {
+      "parameters": [{"$ref": "#/components/parameters/ID"}, {"$ref": "#/components/parameters/Follow"}],
+      "get": {
+        "summary": "Get the output (stdout) of a job",
+        "operationId": "getJobOutput",
+        "responses": {
+          "200": {"$ref": "#/components/responses/Data"},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/jobs/{id}/logs": {
+      "parameters": [{"$ref": "#/components/parameters/ID"}, {"$ref": "#/components/parameters/Follow"}],
+      "get": {
+        "summary": "Get the logs (stderr) of a job",
+        "operationId": "getJobLogs",
+        "responses": {
+          "200": {"$ref": "#/components/responses/Data"},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/jobs/{id}/combined": {
+      "parameters": [
+        {"$ref": "#/components/parameters/ID"},
+        {"$ref": "#/components/parameters/Follow"},
+        {"name": "timestamps", "in": "query", "description": "Prefix each line with when it was written", "schema": {"type": "boolean"}},
+        {"name": "since", "in": "query", "description": "Only lines written since a duration ago (e.g. 5m), an RFC 3339 or a Unix timestamp", "schema": {"type": "string"}},
+        {"name": "stream", "in": "query", "description": "Only lines of one stream", "schema": {"type": "string", "enum": ["stdout", "stderr"]}},
+        {"name": "format", "in": "query", "schema": {"type": "string", "enum": ["text", "json"], "default": "text"}}
+      ],
+      "get": {
+        "summary": "Get the output and logs of a job created with combined interleaved as they were written",
+        "operationId": "getJobCombined",
+        "responses": {
+          "200": {
+            "description": "The combined log of the job",
+            "content": {
+              "text/plain": {"schema": {"type": "string"}},
+              "application/x-ndjson": {"schema": {"$ref": "#/components/schemas/CombinedEntry"}}
+            }
+          },
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/jobs/{id}/artifacts": {
+      "parameters": [{"$ref": "#/components/parameters/ID"}],
+      "get": {
+        "summary": "List the artifacts of a job",
+        "operationId": "listJobArtifacts",
+        "responses": {
+          "200": {
+            "description": "The artifacts of the job",
+            "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/Artifact"}}}}
+          },
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/jobs/{id}/artifacts/{name}": {
+      "parameters": [
+        {"$ref": "#/components/parameters/ID"},
+        {"name": "name", "in": "path", "required": true, "description": "Path of the artifact relative to the working directory", "schema": {"type": "string"}}
+      ],
+      "get": {
+        "summary": "Download an artifact of a job",
+        "operationId": "getJobArtifact",
+        "responses": {
+          "200": {
+            "description": "The artifact",
+            "content": {"application/octet-stream": {"schema": {"type": "string", "format": "binary"}}}
+          },
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/pipelines": {
+      "post": {
+        "summary": "Create a pipeline",
+        "operationId": "createPipeline",
+        "parameters": [
+          {"name": "wait", "in": "query", "description": "Wait for every stage to be done", "schema": {"type": "boolean"}},
+          {"name": "stdin_from", "in": "query", "description": "Id of a job whose output is the input of the first stage", "schema": {"type": "integer", "format": "uint64"}},
+          {"name": "max_output", "in": "query", "description": "Most bytes of output, and of logs, the last stage keeps (e.g. 10MB) unless it has a max_output of its own", "schema": {"type": "string"}},
+          {"name": "output_policy", "in": "query", "description": "What to do once max_output is reached", "schema": {"type": "string", "enum": ["truncate", "rotate", "kill"]}},
+          {"name": "artifact", "in": "query", "description": "Glob of files in the working directory of the last stage to keep as artifacts unless it has artifacts of its own", "schema": {"type": "array", "items": {"type": "string"}}, "explode": true},
+          {"name": "combined", "in": "query", "description": "Record a combined log of the output and logs of the last stage", "schema": {"type": "boolean"}}
+        ],
+        "requestBody": {
+          "required": true,
+          "description": "The stages of the pipeline and the input of its first stage or, as multipart/form-data, them as the first pipeline part followed by the stdin part and input files of the first stage",
+          "content": {
+            "application/json": {"schema": {"$ref": "#/components/schemas/PipelineRequest"}},
+            "multipart/form-data": {
+              "schema": {
+                "type": "object",
+                "properties": {
+                  "pipeline": {"$ref": "#/components/schemas/PipelineRequest"},
+                  "stdin": {"type": "string", "format": "binary"}
+                },
+                "additionalProperties": {"type": "string", "format": "binary"}
+              }
+            }
+          }
+        },
+        "responses": {
+          "201": {
+            "description": "Pipeline created",
+            "headers": {"Location": {"description": "URL of the new pipeline", "schema": {"type": "string"}}},
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Pipeline"}}}
+          },
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/pipelines/{id}": {
+      "parameters": [{"name": "id", "in": "path", "required": true, "description": "Pipeline ID, the ID of its first stage", "schema": {"type": "integer", "format": "uint64"}}],
+      "get": {
+        "summary": "Get a pipeline",
+        "operationId": "getPipeline",
+        "responses": {
+          "200": {"description": "The pipeline", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Pipeline"}}}},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/jobs/{id}/signal": {
+      "parameters": [{"$ref": "#/components/parameters/ID"}],
+      "post": {
+        "summary": "Send a signal to a running job",
+        "operationId": "signalJob",
+        "requestBody": {
+          "content": {
+            "application/json": {
+              "schema": {
+                "type": "object",
+                "properties": {"signal": {"type": "string", "enum": ["INT", "KILL"], "default": "INT"}}
+              }
+            }
+          }
+        },
+        "responses": {
+          "202": {"description": "Signal sent"},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/jobs/{id}/events": {
+      "parameters": [{"$ref": "#/components/parameters/ID"}, {"$ref": "#/components/parameters/Follow"}],
+      "get": {
+        "summary": "Get the state transitions of a job",
+        "description": "With follow or Accept: text/event-stream the events are streamed as server-sent events until the job is done.",
+        "operationId": "getJobEvents",
+        "responses": {
+          "200": {
+            "description": "The events of the job in order",
+            "content": {
+              "application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/JobEvent"}}},
+              "text/event-stream": {"schema": {"type": "string"}}
+            }
+          },
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    }
+  },
+  "components": {
+    "parameters": {
+      "ID": {"name": "id", "in": "path", "required": true, "description": "Job ID", "schema": {"type": "integer", "format": "uint64"}},
+      "Follow": {"name": "follow", "in": "query", "description": "Stream data as it is written", "schema": {"type": "boolean"}}
+    },
+    "responses": {
+      "Data": {
+        "description": "Raw job data",
+        "content": {"text/plain": {"schema": {"type": "string"}}}
+      },
+      "Error": {
+        "description": "Error",
+        "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Error"}}}
+      }
+    },
+    "schemas": {
+      "State": {
+        "type": "integer",
+        "description": "1 CREATED, 2 WAITING, 3 RUNNING, 4 STOPPED, 5 KILLED, 6 ERRORED",
+        "enum": [1, 2, 3, 4, 5, 6]
+      },
+      "Job": {
+        "type": "object",
+        "properties": {
+          "id": {"type": "integer", "format": "uint64"},
+          "name": {"type": "string"},
+          "args": {"type": "array", "items": {"type": "string"}},
+          "interactive": {"type": "boolean"},
+          "worker": {"type": "string"},
+          "state": {"$ref": "#/components/schemas/State"},
+          "status": {"type": "integer"},
+          "created": {"type": "string", "format": "date-time"},
+          "started": {"type": "string", "format": "date-time"},
+          "stopped": {"type": "string", "format": "date-time"},
+          "killed": {"type": "string", "format": "date-time"},
+          "errored": {"type": "string", "format": "date-time"},
+          "output_limit": {
+            "type": "object",
+            "properties": {
+              "max": {"type": "integer", "format": "int64"},
+              "policy": {"type": "string", "enum": ["truncate", "rotate", "kill"]}
+            }
+          },
+          "truncated": {"type": "object", "description": "Bytes dropped by the output limit by output or logs", "additionalProperties": {"type": "integer", "format": "int64"}},
+          "rotated": {"type": "object", "description": "Bytes rotated out of the start of the output or logs, counted in the offsets of followers", "additionalProperties": {"type": "integer", "format": "int64"}},
+          "artifact_globs": {"type": "array", "items": {"type": "string"}},
+          "artifacts": {"type": "array", "items": {"$ref": "#/components/schemas/Artifact"}},
+          "input_files": {"type": "array", "items": {"$ref": "#/components/schemas/Artifact"}},
+          "combined": {"type": "boolean", "description": "Whether the job has a combined log"},
+          "stdin_from": {"type": "integer", "format": "uint64"},
+          "pipeline": {"type": "integer", "format": "uint64", "description": "ID of the pipeline the job is a stage of"},
+          "stages": {"type": "array", "description": "IDs of the stages of the pipeline the job is the first stage of", "items": {"type": "integer", "format": "uint64"}}
+        }
+      },
+      "PipelineRequest": {
+        "type": "object",
+        "required": ["stages"],
+        "properties": {
+          "stages": {
+            "type": "array",
+            "items": {
+              "type": "object",
+              "required": ["name"],
+              "properties": {
+                "name": {"type": "string"},
+                "args": {"type": "array", "items": {"type": "string"}},
+                "max_output": {"type": "string", "description": "Most bytes of output, and of logs, the stage keeps"},
+                "output_policy": {"type": "string", "enum": ["truncate", "rotate", "kill"]},
+                "artifacts": {"type": "array", "description": "Globs of files in the working directory of the stage to keep as artifacts", "items": {"type": "string"}},
+                "combined": {"type": "boolean", "description": "Record a combined log of the output and logs of the stage"}
+              }
+            }
+          },
+          "input": {"type": "string", "description": "Input of the first stage, unless the request is multipart/form-data"}
+        }
+      },
+      "Pipeline": {
+        "type": "object",
+        "properties": {
+          "id": {"type": "integer", "format": "uint64"},
+          "state": {"$ref": "#/components/schemas/State"},
+          "status": {"type": "integer", "description": "Status of the last stage that exited with a non-zero status or 0"},
+          "stages": {"type": "array", "items": {"$ref": "#/components/schemas/Job"}}
+        }
+      },
+      "Artifact": {
+        "type": "object",
+        "properties": {
+          "name": {"type": "string"},
+          "size": {"type": "integer", "format": "int64"}
+        }
+      },
+      "JobEvent": {
+        "type": "object",
+        "properties": {
+          "job": {"type": "integer", "format": "uint64"},
+          "from": {"type": "integer", "description": "0 for the first event of a job, otherwise a State"},
+          "to": {"$ref": "#/components/schemas/State"},
+          "at": {"type": "string", "format": "date-time"},
+          "worker": {"type": "string"},
+          "reason": {"type": "string"}
+        }
+      },
+      "CombinedEntry": {
+        "type": "object",
+        "properties": {
+          "time": {"type": "string", "format": "date-time"},
+          "stream": {"type": "string", "enum": ["stdout", "stderr"]},
+          "data": {"type": "string"},
+          "encoding": {"type": "string", "enum": ["base64"], "description": "Set if data is base64 encoded as it is not valid UTF-8"}
+        }
+      },
+      "Stats": {
+        "type": "object",
+        "properties": {
+          "total": {"type": "integer"},
+          "states": {"type": "object", "additionalProperties": {"type": "integer"}},
+          "workers": {"type": "object", "additionalProperties": {"type": "integer"}},
+          "names": {
+            "type": "object",
+            "additionalProperties": {
+              "type": "object",
+              "properties": {
+                "count": {"type": "integer"},
+                "succeeded": {"type": "integer"},
+                "failed": {"type": "integer"},
+                "success_rate": {"type": "number"},
+                "p50": {"type": "number", "description": "Median duration in seconds"},
+                "p95": {"type": "number", "description": "95th percentile duration in seconds"}
+              }
+            }
+          },
+          "hourly": {
+            "type": "array",
+            "items": {"type": "object", "properties": {"hour": {"type": "string", "format": "date-time"}, "count": {"type": "integer"}}}
+          }
+        }
+      },
+      "SearchHit": {
+        "allOf": [
+          {"$ref": "#/components/schemas/Job"},
+          {
+            "type": "object",
+            "properties": {
+              "highlights": {"type": "object", "additionalProperties": {"type": "array", "items": {"type": "string"}}}
+            }
+          }
+        ]
+      },
+      "Error": {
+        "type": "object",
+        "required": ["status", "error"],
+        "properties": {
+          "status": {"type": "integer"},
+          "error": {"type": "string"},
+          "message": {"type": "string"}
+        }
+      }
+    }
+  }
+}
+`
@@ -0,0 +1,321 @@
+package je
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+
+	humanize "github.com/dustin/go-humanize"
+	log "github.com/sirupsen/logrus"
+)
+
+// OutputPolicy is what happens to a job once its output or logs reach their
+// limit
+type OutputPolicy string
+
+const (
+	// OUTPUT_TRUNCATE discards everything written past the limit
+	OUTPUT_TRUNCATE OutputPolicy = "truncate"
+	// OUTPUT_ROTATE keeps the last Max bytes written. The data is rewritten
+	// with its last Max bytes whenever it grows to twice that.
+	OUTPUT_ROTATE OutputPolicy = "rotate"
+	// OUTPUT_KILL kills the job
+	OUTPUT_KILL OutputPolicy = "kill"
+)
+
+// ParseOutputPolicy parses the name of an output policy
+func ParseOutputPolicy(s string) (OutputPolicy, error) {
+	switch policy := OutputPolicy(strings.ToLower(s)); policy {
+	case OUTPUT_TRUNCATE, OUTPUT_ROTATE, OUTPUT_KILL:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("invalid output policy %q: expected truncate, rotate or kill", s)
+	}
+}
+
+// ParseSize parses a number of bytes with an optional unit, e.g. 10MB
+func ParseSize(s string) (int64, error) {
+	n, err := humanize.ParseBytes(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q: %s", s, err)
+	}
+	return int64(n), nil
+}
+
+// OutputLimit caps how many bytes of output, and separately of logs, a job
+// keeps
+type OutputLimit struct {
+	// Max is the most bytes kept (0 for no limit)
+	Max int64 `json:"max,omitempty"`
+	// Policy is what happens once Max is reached (truncate by default)
+	Policy OutputPolicy `json:"policy,omitempty"`
+}
+
+// DefaultOutputLimit is the limit of every job. Jobs can lower the maximum
+// and choose another policy.
+var DefaultOutputLimit OutputLimit
+
+// ParseOutputLimit parses the limit of a job from its maximum size and
+// policy, either of which may be empty. It returns nil if both are.
+func ParseOutputLimit(max, policy string) (*OutputLimit, error) {
+	if max == "" && policy == "" {
+		return nil, nil
+	}
+
+	limit := &OutputLimit{}
+	if max != "" {
+		n, err := ParseSize(max)
+		if err != nil {
+			return nil, err
+		}
+		limit.Max = n
+	}
+	if policy != "" {
+		p, err := ParseOutputPolicy(policy)
+		if err != nil {
+			return nil, err
+		}
+		limit.Policy = p
+	}
+	return limit, nil
+}
+
+// String returns the limit as e.g. "10 MB (rotate)" or "none"
+func (l OutputLimit) String() string {
+	if l.Max <= 0 {
+		return "none"
+	}
+	return fmt.Sprintf("%s (%s)", humanize.Bytes(uint64(l.Max)), l.Policy)
+}
+
+// effective returns the limit of a job with the given limit under limit l:
+// the lower of the two maximums and the job's policy if it has one
+func (l OutputLimit) effective(job *OutputLimit) OutputLimit {
+	if job != nil {
+		if job.Max > 0 && (l.Max <= 0 || job.Max < l.Max) {
+			l.Max = job.Max
+		}
+		if job.Policy != "" {
+			l.Policy = job.Policy
+		}
+	}
+	if l.Policy == "" {
+		l.Policy = OUTPUT_TRUNCATE
+	}
+	return l
+}
+
+// limitedWriter enforces the output limit of a job on its output or logs.
+// What is written is recorded in the combined log until the limit is
+// reached. It never fails writes past the limit so that the job is not
+// blocked or broken by a closed pipe.
+type limitedWriter struct {
+	job    *Job
+	dtype  DataType
+	limit  OutputLimit
+	w      io.WriteCloser
+	record io.Writer
+
+	// written is the number of bytes in the data
+	written int64
+	// reached is set once the limit has been reached
+	reached bool
+}
+
+func newLimitedWriter(job *Job, dtype DataType, limit OutputLimit, w io.WriteCloser, record io.Writer) *limitedWriter {
+	return &limitedWriter{job: job, dtype: dtype, limit: limit, w: w, record: record}
+}
+
+func (l *limitedWriter) Write(p []byte) (int, error) {
+	defer writes.notify(l.job.ID)
+
+	if l.limit.Max <= 0 {
+		return l.write(p)
+	}
+
+	if l.limit.Policy == OUTPUT_ROTATE {
+		if !l.reached && l.written+int64(len(p)) > l.limit.Max {
+			l.exceeded()
+		}
+		if _, err := l.w.Write(p); err != nil {
+			return 0, err
+		}
+		if !l.reached {
+			l.record.Write(p)
+		}
+		l.written += int64(len(p))
+		if l.written >= 2*l.limit.Max {
+			if err := l.rotate(); err != nil {
+				return 0, err
+			}
+		}
+		return len(p), nil
+	}
+
+	room := l.limit.Max - l.written
+	if int64(len(p)) <= room {
+		return l.write(p)
+	}
+
+	if room > 0 {
+		if _, err := l.write(p[:room]); err != nil {
+			return 0, err
+		}
+	}
+	if !l.reached {
+		l.exceeded()
+	}
+	l.job.dropped(l.dtype, int64(len(p))-room)
+	return len(p), nil
+}
+
+func (l *limitedWriter) write(p []byte) (int, error) {
+	n, err := l.w.Write(p)
+	l.written += int64(n)
+	if n > 0 {
+		l.record.Write(p[:n])
+	}
+	return n, err
+}
+
+// exceeded records that the limit was reached and kills the job if that is
+// its policy
+func (l *limitedWriter) exceeded() {
+	l.reached = true
+	log.Warnf("job #%d reached its %s limit of %s", l.job.ID, dataPaths[l.dtype], l.limit)
+
+	l.job.dropped(l.dtype, 0)
+	if l.limit.Policy == OUTPUT_KILL {
+		go func() {
+			reason := fmt.Sprintf("killed: %s reached its limit of %s", dataPaths[l.dtype], l.limit)
+			if err := l.job.kill(true, reason); err != nil && err != ErrNotRunning {
+				log.Errorf("error killing job #%d: %s", l.job.ID, err)
+			}
+		}()
+	}
+}
+
+// rotate rewrites the data with its last limit.Max bytes
+func (l *limitedWriter) rotate() error {
+	if err := l.w.Close(); err != nil {
+		return err
+	}
+
+	// What is kept is spooled to a temporary file as it may be large
+	keep := l.limit.Max
+	r, err := readRange(l.job.ID, l.dtype, l.written-keep, keep)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile("", "je-rotate-")
+	if err != nil {
+		r.Close()
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	n, err := io.Copy(tmp, r)
+	r.Close()
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	rotating.Lock()
+	defer rotating.Unlock()
+
+	if l.w, err = data.Write(l.job.ID, l.dtype); err != nil {
+		return err
+	}
+	if _, err := io.Copy(l.w, tmp); err != nil {
+		return err
+	}
+
+	l.job.rotated(l.dtype, l.written-n)
+	l.written = n
+	return nil
+}
+
+// Close closes the data, which may have been replaced when rotating
+func (l *limitedWriter) Close() error {
+	return l.w.Close()
+}
+
+// rotating is locked while the output or logs of a job are rotated and the
+// job saved with how much of them was rotated, and read locked while they
+// are opened, so that they are never read half rewritten
+var rotating sync.RWMutex
+
+// readFollowed reads length bytes, or everything if length is negative, of
+// the data of a job from offset counted from the first byte it wrote. If the
+// data was rotated past offset it reads from the start of what was kept and
+// returns its offset. Data which is still written may be rotated at any time,
+// so a positive length is read at once with the rotation locked.
+func readFollowed(id ID, dtype DataType, offset, length int64) (io.ReadCloser, int64, error) {
+	rotating.RLock()
+	defer rotating.RUnlock()
+
+	var base int64
+	if job, err := db.Get(id); err == nil {
+		job.RLock()
+		base = job.Rotated[dataPaths[dtype]]
+		job.RUnlock()
+	}
+	if offset < base {
+		offset = base
+	}
+	r, err := readDataRange(data, id, dtype, offset-base, length)
+	if err != nil || length < 0 {
+		return r, offset, err
+	}
+	defer r.Close()
+
+	buf, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, offset, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(buf)), offset, nil
+}
+
+// mayRotate returns true if the output and logs of a job may still be
+// rotated
+func mayRotate(job *Job) bool {
+	job.RLock()
+	defer job.RUnlock()
+	return !job.State.Done() && DefaultOutputLimit.effective(job.OutputLimit).Policy == OUTPUT_ROTATE
+}
+
+// readKept reads the data of a job as it is kept between rotations. pick is
+// called with its size and returns the offset and length to read, or an
+// error to read nothing. Data which may still be rotated is read at once.
+func readKept(job *Job, dtype DataType, pick func(size int64) (offset, length int64, err error)) (io.ReadCloser, error) {
+	rotating.RLock()
+	defer rotating.RUnlock()
+
+	size, err := data.Size(job.ID, dtype)
+	if err != nil {
+		return nil, err
+	}
+	offset, length, err := pick(size)
+	if err != nil {
+		return nil, err
+	}
+	r, err := readDataRange(data, job.ID, dtype, offset, length)
+	if err != nil || !mayRotate(job) {
+		return r, err
+	}
+	defer r.Close()
+
+	buf, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(buf)), nil
+}
@@ -0,0 +1,177 @@
+package je
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseOutputLimit(t *testing.T) {
+	assert := assert.New(t)
+
+	limit, err := ParseOutputLimit("", "")
+	require.NoError(t, err)
+	assert.Nil(limit)
+
+	limit, err = ParseOutputLimit("10MB", "Rotate")
+	require.NoError(t, err)
+	assert.Equal(&OutputLimit{Max: 10000000, Policy: OUTPUT_ROTATE}, limit)
+
+	limit, err = ParseOutputLimit("", "kill")
+	require.NoError(t, err)
+	assert.Equal(&OutputLimit{Policy: OUTPUT_KILL}, limit)
+
+	_, err = ParseOutputLimit("lots", "")
+	assert.Error(err)
+	_, err = ParseOutputLimit("1KB", "drop")
+	assert.Error(err)
+}
+
+func TestOutputLimitEffective(t *testing.T) {
+	assert := assert.New(t)
+
+	global := OutputLimit{Max: 100, Policy: OUTPUT_ROTATE}
+	assert.Equal(OutputLimit{Max: 100, Policy: OUTPUT_ROTATE}, global.effective(nil))
+	assert.Equal(OutputLimit{Max: 10, Policy: OUTPUT_ROTATE}, global.effective(&OutputLimit{Max: 10}))
+	assert.Equal(OutputLimit{Max: 100, Policy: OUTPUT_KILL}, global.effective(&OutputLimit{Max: 1000, Policy: OUTPUT_KILL}))
+
+	var none OutputLimit
+	assert.Equal(OutputLimit{Policy: OUTPUT_TRUNCATE}, none.effective(nil))
+	assert.Equal(OutputLimit{Max: 10, Policy: OUTPUT_TRUNCATE}, none.effective(&OutputLimit{Max: 10}))
+}
+
+func TestAPIv2_OutputLimit(t *testing.T) {
+	assert := assert.New(t)
+
+	// seq 1 2000 writes 8893 bytes
+	const script = "seq 1 2000; seq 1 2000 >&2"
+
+	run := func(params url.Values) (*Job, string, string) {
+		params.Set("wait", "1")
+		res, err := http.Post(testAPIURL+"/jobs?"+params.Encode(), "text/plain", nil)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusCreated, res.StatusCode)
+
+		var job Job
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&job))
+
+		read := func(path string) string {
+			res, err := http.Get(fmt.Sprintf("%s/jobs/%d/%s", testAPIURL, job.ID, path))
+			require.NoError(t, err)
+			defer res.Body.Close()
+			buf, err := ioutil.ReadAll(res.Body)
+			require.NoError(t, err)
+			return string(buf)
+		}
+		return &job, read("output"), read("logs")
+	}
+
+	job, output, logs := run(url.Values{
+		"name": {"sh"}, "arg": {"-c", script},
+		"max_output": {"1KB"},
+	})
+	assert.Equal(STATE_STOPPED, job.State)
+	assert.Equal(&OutputLimit{Max: 1000}, job.OutputLimit)
+	assert.Equal(map[string]int64{"output": 7893, "logs": 7893}, job.Truncated)
+	assert.Len(output, 1000)
+	assert.True(strings.HasPrefix(output, "1\n2\n3\n"))
+	assert.Equal(output, logs)
+
+	job, output, _ = run(url.Values{
+		"name": {"sh"}, "arg": {"-c", script},
+		"max_output": {"1KB"}, "output_policy": {"rotate"},
+	})
+	assert.Equal(STATE_STOPPED, job.State)
+	assert.True(len(output) >= 1000 && len(output) < 2000, len(output))
+	assert.True(strings.HasSuffix(output, "\n1999\n2000\n"))
+	assert.Equal(int64(8893-len(output)), job.Truncated["output"])
+	assert.Equal(job.Truncated["output"], job.Rotated["output"])
+
+	job, _, _ = run(url.Values{
+		"name": {"yes"}, "max_output": {"1KB"}, "output_policy": {"kill"},
+	})
+	assert.Equal(STATE_KILLED, job.State)
+	assert.Contains(job.Truncated, "output")
+
+	res, err := http.Post(testAPIURL+"/jobs?name=true&output_policy=drop", "text/plain", nil)
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(http.StatusBadRequest, res.StatusCode)
+}
+
+func TestAPIv2_StdinFromRotated(t *testing.T) {
+	assert := assert.New(t)
+
+	// Jobs following rotated output never get any of it twice
+	script := "for i in $(seq 0 99); do seq $((i*10+1)) $((i*10+10)); sleep 0.02; done"
+	qs := url.Values{"name": {"sh"}, "arg": {"-c", script}, "max_output": {"1KB"}, "output_policy": {"rotate"}}
+	status, from := createTestJob(t, qs, "text/plain", &bytes.Buffer{})
+	require.Equal(t, http.StatusCreated, status)
+
+	qs = url.Values{"name": {"cat"}, "stdin_from": {fmt.Sprint(from.ID)}, "wait": {"1"}}
+	status, job := createTestJob(t, qs, "text/plain", &bytes.Buffer{})
+	require.Equal(t, http.StatusCreated, status)
+	assert.Equal(STATE_STOPPED, job.State)
+
+	lines := strings.Fields(getTestData(t, job.ID, DATA_OUTPUT))
+	require.NotEmpty(t, lines)
+	assert.Equal("1000", lines[len(lines)-1])
+	for i := 1; i < len(lines); i++ {
+		prev, _ := strconv.Atoi(lines[i-1])
+		next, _ := strconv.Atoi(lines[i])
+		if !assert.True(prev < next, "line %d: %d after %d", i, next, prev) {
+			break
+		}
+	}
+}
+
+func TestReadFollowedRestarted(t *testing.T) {
+	assert := assert.New(t)
+	withGlobals(t)
+
+	tmpdir := t.TempDir()
+	_, err := InitData(filepath.Join(tmpdir, "data"))
+	require.NoError(t, err)
+	dburi := fmt.Sprintf("bolt://%s/je.db", tmpdir)
+	store, err := InitDB(dburi)
+	require.NoError(t, err)
+
+	job := &Job{ID: db.NextId(), Name: "foo", State: STATE_RUNNING}
+	require.NoError(t, db.Save(job))
+	writeTestData(t, job.ID, DATA_OUTPUT, "0123456789")
+	job.rotated(DATA_OUTPUT, 100)
+	require.NoError(t, store.Close())
+
+	// How much was rotated is known after a restart
+	store, err = InitDB(dburi)
+	require.NoError(t, err)
+	defer store.Close()
+
+	read := func(offset int64) (string, int64) {
+		r, offset, err := readFollowed(job.ID, DATA_OUTPUT, offset, -1)
+		require.NoError(t, err)
+		defer r.Close()
+		buf, err := ioutil.ReadAll(r)
+		require.NoError(t, err)
+		return string(buf), offset
+	}
+
+	s, offset := read(0)
+	assert.Equal("0123456789", s)
+	assert.Equal(int64(100), offset)
+
+	s, offset = read(105)
+	assert.Equal("56789", s)
+	assert.Equal(int64(105), offset)
+}
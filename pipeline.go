@@ -0,0 +1,168 @@
+package je
+
+import (
+	"fmt"
+)
+
+// PIPELINE_PART is the name of the first part of a multipart/form-data
+// request creating a pipeline which is its PipelineRequest. The rest are the
+// input and input files of its first stage.
+const PIPELINE_PART = "pipeline"
+
+// PipelineRequest is the definition of a new pipeline
+type PipelineRequest struct {
+	Stages []PipelineStage `json:"stages"`
+	// Input is the input of the first stage of a pipeline created without
+	// a multipart/form-data request
+	Input string `json:"input,omitempty"`
+}
+
+// PipelineStage is the job run by a stage of a pipeline and its options
+// which, unlike those given as query parameters, apply to it only
+type PipelineStage struct {
+	Name         string   `json:"name"`
+	Args         []string `json:"args,omitempty"`
+	MaxOutput    string   `json:"max_output,omitempty"`
+	OutputPolicy string   `json:"output_policy,omitempty"`
+	Artifacts    []string `json:"artifacts,omitempty"`
+	Combined     bool     `json:"combined,omitempty"`
+}
+
+// Validate returns an error if the pipeline has no stages or a stage has no
+// name or invalid options
+func (r *PipelineRequest) Validate() error {
+	if len(r.Stages) == 0 {
+		return fmt.Errorf("a pipeline needs at least one stage")
+	}
+	for i, stage := range r.Stages {
+		if stage.Name == "" {
+			return fmt.Errorf("stage %d has no name", i+1)
+		}
+		if _, err := ParseOutputLimit(stage.MaxOutput, stage.OutputPolicy); err != nil {
+			return fmt.Errorf("stage %d: %s", i+1, err)
+		}
+		for _, pattern := range stage.Artifacts {
+			if err := CheckArtifactPattern(pattern); err != nil {
+				return fmt.Errorf("stage %d: %s", i+1, err)
+			}
+		}
+	}
+	return nil
+}
+
+// stageOptions returns the options of the stage at index i of a pipeline
+// given the options of the pipeline. The input, input files and stdin_from
+// of the pipeline are those of its first stage and its output limit,
+// artifacts and combined log those of its last, whose output is that of the
+// pipeline, unless the stage has options of its own.
+func (r *PipelineRequest) stageOptions(i int, options *jobOptions) *jobOptions {
+	stage := r.Stages[i]
+
+	var stageOptions jobOptions
+	if i == 0 {
+		stageOptions.stdinFrom, stageOptions.form = options.stdinFrom, options.form
+	}
+	if i == len(r.Stages)-1 {
+		stageOptions.limit, stageOptions.artifacts, stageOptions.combined = options.limit, options.artifacts, options.combined
+	}
+
+	// Validate has already checked the options of the stage
+	if limit, _ := ParseOutputLimit(stage.MaxOutput, stage.OutputPolicy); limit != nil {
+		stageOptions.limit = limit
+	}
+	if len(stage.Artifacts) > 0 {
+		stageOptions.artifacts = stage.Artifacts
+	}
+	if stage.Combined {
+		stageOptions.combined = true
+	}
+	return &stageOptions
+}
+
+// Pipeline is a chain of jobs, its stages, each reading the output of the
+// previous one as it is written. Its id is the id of its first stage and its
+// state and status are derived from those of its stages.
+type Pipeline struct {
+	ID     ID     `json:"id"`
+	State  State  `json:"state"`
+	Status int    `json:"status"`
+	Stages []*Job `json:"stages"`
+}
+
+// NewPipeline returns the pipeline made of the given stages in order
+func NewPipeline(stages []*Job) *Pipeline {
+	p := &Pipeline{Stages: stages}
+	if len(stages) > 0 {
+		p.ID = stages[0].Id()
+	}
+	p.State, p.Status = pipelineState(stages)
+	return p
+}
+
+// pipelineState derives the state and status of a pipeline from its stages.
+// It is running as soon as any stage has started until every stage is done.
+// It has then errored if any stage did, or else been killed if any stage
+// was, and otherwise stopped. Its status is that of the last stage that
+// exited with a non-zero status, or 0 if none did, like a shell pipeline
+// with pipefail.
+func pipelineState(stages []*Job) (state State, status int) {
+	var active, started, waiting, killed, errored bool
+	for _, job := range stages {
+		job.RLock()
+		switch job.State {
+		case STATE_CREATED:
+			active = true
+		case STATE_WAITING:
+			active, waiting = true, true
+		case STATE_RUNNING:
+			active, started = true, true
+		case STATE_STOPPED:
+			started = true
+			if job.Status != 0 {
+				status = job.Status
+			}
+		case STATE_KILLED:
+			started, killed = true, true
+		case STATE_ERRORED:
+			started, errored = true, true
+		}
+		job.RUnlock()
+	}
+
+	switch {
+	case active && started:
+		return STATE_RUNNING, status
+	case active && waiting:
+		return STATE_WAITING, status
+	case active:
+		return STATE_CREATED, status
+	case errored:
+		return STATE_ERRORED, status
+	case killed:
+		return STATE_KILLED, status
+	default:
+		return STATE_STOPPED, status
+	}
+}
+
+// GetPipeline returns the pipeline with the given id from the store
+func GetPipeline(id ID) (*Pipeline, error) {
+	job, err := db.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	job.RLock()
+	ids := job.Stages
+	pipeline := job.Pipeline
+	job.RUnlock()
+	if pipeline != id || len(ids) == 0 {
+		return nil, fmt.Errorf("job #%d is not a pipeline", id)
+	}
+
+	stages, err := db.Find(ids...)
+	if err != nil {
+		return nil, err
+	}
+	return NewPipeline(stages), nil
+}
@@ -0,0 +1,196 @@
+package je
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPipelineState(t *testing.T) {
+	assert := assert.New(t)
+
+	stages := func(states ...State) []*Job {
+		var jobs []*Job
+		for i, state := range states {
+			jobs = append(jobs, &Job{ID: ID(i + 1), State: state})
+		}
+		return jobs
+	}
+
+	for _, test := range []struct {
+		stages []*Job
+		state  State
+	}{
+		{stages(STATE_CREATED, STATE_CREATED), STATE_CREATED},
+		{stages(STATE_WAITING, STATE_CREATED), STATE_WAITING},
+		{stages(STATE_STOPPED, STATE_WAITING), STATE_RUNNING},
+		{stages(STATE_RUNNING, STATE_RUNNING), STATE_RUNNING},
+		{stages(STATE_STOPPED, STATE_STOPPED), STATE_STOPPED},
+		{stages(STATE_KILLED, STATE_STOPPED), STATE_KILLED},
+		{stages(STATE_KILLED, STATE_ERRORED), STATE_ERRORED},
+	} {
+		p := NewPipeline(test.stages)
+		assert.Equal(ID(1), p.ID)
+		assert.Equal(test.state, p.State)
+	}
+
+	jobs := stages(STATE_STOPPED, STATE_STOPPED, STATE_STOPPED)
+	assert.Equal(0, NewPipeline(jobs).Status)
+	jobs[0].Status = 2
+	assert.Equal(2, NewPipeline(jobs).Status)
+	jobs[1].Status = 1
+	assert.Equal(1, NewPipeline(jobs).Status)
+}
+
+func TestAPIv2_Pipelines(t *testing.T) {
+	assert := assert.New(t)
+
+	req := PipelineRequest{Stages: []PipelineStage{
+		{Name: "sh", Args: []string{"-c", "cat; cat words"}},
+		{Name: "sort"},
+		{Name: "tr", Args: []string{"a-z", "A-Z"}},
+	}}
+
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	w, err := mw.CreateFormField(PIPELINE_PART)
+	require.NoError(t, err)
+	require.NoError(t, json.NewEncoder(w).Encode(req))
+	w, err = mw.CreateFormFile(STDIN_PART, "input")
+	require.NoError(t, err)
+	w.Write([]byte("pear\n"))
+	w, err = mw.CreateFormFile("words", "words")
+	require.NoError(t, err)
+	w.Write([]byte("fig\napple\n"))
+	require.NoError(t, mw.Close())
+
+	res, err := http.Post(testAPIURL+"/pipelines?wait=1", mw.FormDataContentType(), body)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+
+	var pipeline Pipeline
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&pipeline))
+	assert.Equal(STATE_STOPPED, pipeline.State)
+	assert.Equal(0, pipeline.Status)
+	require.Len(t, pipeline.Stages, 3)
+	first := pipeline.Stages[0]
+	assert.Equal(first.ID, pipeline.ID)
+	assert.Equal(fmt.Sprintf("%s/pipelines/%d", APIPrefix, pipeline.ID), res.Header.Get("Location"))
+	for i, job := range pipeline.Stages {
+		assert.Equal(pipeline.ID, job.Pipeline)
+		if i > 0 {
+			assert.Equal(pipeline.Stages[i-1].ID, job.StdinFrom)
+		}
+	}
+	assert.Equal([]ID{first.ID, pipeline.Stages[1].ID, pipeline.Stages[2].ID}, first.Stages)
+	assert.Equal("APPLE\nFIG\nPEAR\n", getTestData(t, pipeline.Stages[2].ID, DATA_OUTPUT))
+
+	res, err = http.Get(fmt.Sprintf("%s/pipelines/%d", testAPIURL, pipeline.ID))
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	var got Pipeline
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&got))
+	assert.Equal(pipeline.ID, got.ID)
+	assert.Equal(STATE_STOPPED, got.State)
+	assert.Len(got.Stages, 3)
+
+	// Stages are not pipelines
+	res, err = http.Get(fmt.Sprintf("%s/pipelines/%d", testAPIURL, pipeline.Stages[1].ID))
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(http.StatusNotFound, res.StatusCode)
+
+	// The status is that of the last stage to fail
+	res, err = http.Post(testAPIURL+"/pipelines?wait=1", "application/json",
+		bytes.NewBufferString(`{"stages": [{"name": "sh", "args": ["-c", "echo x; exit 3"]}, {"name": "cat"}]}`))
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&pipeline))
+	assert.Equal(STATE_STOPPED, pipeline.State)
+	assert.Equal(3, pipeline.Status)
+	assert.Equal("x\n", getTestData(t, pipeline.Stages[1].ID, DATA_OUTPUT))
+
+	for _, body := range []string{`{"stages": []}`, `{"stages": [{"args": ["x"]}]}`, `not json`} {
+		res, err = http.Post(testAPIURL+"/pipelines", "application/json", bytes.NewBufferString(body))
+		require.NoError(t, err)
+		res.Body.Close()
+		assert.Equal(http.StatusBadRequest, res.StatusCode, body)
+	}
+}
+
+func TestAPIv2_PipelineOptions(t *testing.T) {
+	assert := assert.New(t)
+
+	// Stages are woken up by the writes of the previous one, not polled
+	interval := DataPollInterval
+	DataPollInterval = time.Hour
+	defer func() { DataPollInterval = interval }()
+
+	body := `{
+		"stages": [
+			{"name": "sh", "args": ["-c", "cat; echo out > first.txt"], "artifacts": ["*.txt"]},
+			{"name": "cat"},
+			{"name": "tr", "args": ["a-z", "A-Z"]}
+		],
+		"input": "hello\n"
+	}`
+	start := time.Now()
+	res, err := http.Post(testAPIURL+"/pipelines?wait=1&max_output=1KB&combined=1", "application/json", bytes.NewBufferString(body))
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+	assert.Less(time.Since(start), 10*time.Second)
+
+	var pipeline Pipeline
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&pipeline))
+	assert.Equal(STATE_STOPPED, pipeline.State)
+	require.Len(t, pipeline.Stages, 3)
+	assert.Equal("HELLO\n", getTestData(t, pipeline.Stages[2].ID, DATA_OUTPUT))
+
+	// The options of the pipeline apply to its last stage and those of a
+	// stage to it only
+	first, middle, last := pipeline.Stages[0], pipeline.Stages[1], pipeline.Stages[2]
+	assert.Equal([]string{"*.txt"}, first.ArtifactGlobs)
+	assert.Len(first.Artifacts, 1)
+	assert.Nil(first.OutputLimit)
+	assert.False(first.Combined)
+	assert.Nil(middle.ArtifactGlobs)
+	assert.Nil(middle.OutputLimit)
+	assert.False(middle.Combined)
+	assert.Nil(last.ArtifactGlobs)
+	require.NotNil(t, last.OutputLimit)
+	assert.Equal(int64(1000), last.OutputLimit.Max)
+	assert.True(last.Combined)
+
+	// The input of a multipart request is its stdin part
+	mbody := &bytes.Buffer{}
+	mw := multipart.NewWriter(mbody)
+	w, err := mw.CreateFormField(PIPELINE_PART)
+	require.NoError(t, err)
+	w.Write([]byte(`{"stages": [{"name": "cat"}], "input": "x"}`))
+	require.NoError(t, mw.Close())
+	res, err = http.Post(testAPIURL+"/pipelines", mw.FormDataContentType(), mbody)
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(http.StatusBadRequest, res.StatusCode)
+
+	for _, body := range []string{
+		`{"stages": [{"name": "cat", "max_output": "lots"}]}`,
+		`{"stages": [{"name": "cat", "artifacts": ["../x"]}]}`,
+	} {
+		res, err = http.Post(testAPIURL+"/pipelines", "application/json", bytes.NewBufferString(body))
+		require.NoError(t, err)
+		res.Body.Close()
+		assert.Equal(http.StatusBadRequest, res.StatusCode, body)
+	}
+}
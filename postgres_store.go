@@ -0,0 +1,508 @@
+package je
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	// PostgreSQL driver
+	_ "github.com/lib/pq"
+
+	"github.com/prologic/je/codec"
+)
+
+// postgresMigrationsLock is the key of the advisory lock held while
+// migrating so that several je instances can start at the same time
+const postgresMigrationsLock = 0x6a65
+
+// postgresMigrations are the schema migrations of the PostgresStore. They are
+// applied in order and recorded in the schema_migrations table; new ones must
+// only ever be appended.
+var postgresMigrations = []string{
+	`
+	CREATE SEQUENCE job_ids;
+
+	CREATE TABLE jobs (
+		id          BIGINT           PRIMARY KEY,
+		name        TEXT             NOT NULL,
+		worker      TEXT             NOT NULL DEFAULT '',
+		interactive BOOLEAN          NOT NULL DEFAULT FALSE,
+		state       INTEGER          NOT NULL DEFAULT 0,
+		status      INTEGER          NOT NULL DEFAULT 0,
+		duration    DOUBLE PRECISION NOT NULL DEFAULT 0,
+		created     TIMESTAMPTZ      NOT NULL,
+		started     TIMESTAMPTZ      NOT NULL,
+		stopped     TIMESTAMPTZ      NOT NULL,
+		killed      TIMESTAMPTZ      NOT NULL,
+		errored     TIMESTAMPTZ      NOT NULL,
+		data        BYTEA            NOT NULL
+	);
+
+	CREATE INDEX jobs_state ON jobs (state, created);
+	CREATE INDEX jobs_name ON jobs (name, created);
+	CREATE INDEX jobs_created ON jobs (created);
+	CREATE INDEX jobs_started ON jobs (started);
+	CREATE INDEX jobs_stopped ON jobs (stopped);
+	`,
+	`
+	CREATE TABLE meta (
+		key   TEXT PRIMARY KEY,
+		value TEXT NOT NULL
+	);
+	`,
+	`
+	CREATE TABLE events (
+		id         BIGSERIAL   PRIMARY KEY,
+		job        BIGINT      NOT NULL,
+		from_state INTEGER     NOT NULL,
+		to_state   INTEGER     NOT NULL,
+		at         TIMESTAMPTZ NOT NULL,
+		data       TEXT        NOT NULL
+	);
+
+	CREATE INDEX events_job ON events (job, id);
+	`,
+}
+
+// PostgresStore stores jobs in a PostgreSQL database that can be shared by
+// several je instances. Job IDs are allocated from a sequence and waiting
+// jobs are claimed with SELECT ... FOR UPDATE SKIP LOCKED so that each job
+// is only ever run by one instance.
+type PostgresStore struct {
+	db    *sql.DB
+	index *Indexer
+	codec codec.MarshalUnmarshaler
+}
+
+// Placeholder implements sqlDialect
+func (store *PostgresStore) Placeholder(n int) string {
+	return fmt.Sprintf("$%d", n)
+}
+
+// Time implements sqlDialect. The zero time is stored as is so that jobs
+// which have not yet started or finished sort before all others.
+func (store *PostgresStore) Time(t time.Time) interface{} {
+	return t.UTC()
+}
+
+func (store *PostgresStore) Close() error {
+	if err := store.index.Close(); err != nil {
+		log.Errorf("error closing index: %s", err)
+	}
+	return store.db.Close()
+}
+
+func (store *PostgresStore) NextId() ID {
+	var id int64
+	if err := store.db.QueryRow("SELECT nextval('job_ids')").Scan(&id); err != nil {
+		log.Errorf("error generating new job id: %s", err)
+		return ID(0)
+	}
+	return ID(id)
+}
+
+func (store *PostgresStore) Save(job *Job) error {
+	if job.ID == ID(0) {
+		job.ID = store.NextId()
+	} else {
+		// Reserve IDs of jobs saved with one, e.g. when restoring
+		_, err := store.db.Exec(`
+			SELECT setval('job_ids', $1) FROM job_ids
+			WHERE $1 >= CASE WHEN is_called THEN last_value + 1 ELSE last_value END`,
+			int64(job.ID),
+		)
+		if err != nil {
+			log.Errorf("error reserving job id #%d: %s", job.ID, err)
+			return err
+		}
+	}
+
+	buf, err := store.codec.Marshal(job)
+	if err != nil {
+		log.Errorf("error serializing job: %s", err)
+		return err
+	}
+
+	tx, err := store.db.Begin()
+	if err != nil {
+		log.Errorf("error starting transaction: %s", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO jobs (
+			id, name, worker, interactive, state, status, duration,
+			created, started, stopped, killed, errored, data
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		ON CONFLICT (id) DO UPDATE SET
+			name = excluded.name,
+			worker = excluded.worker,
+			interactive = excluded.interactive,
+			state = excluded.state,
+			status = excluded.status,
+			duration = excluded.duration,
+			created = excluded.created,
+			started = excluded.started,
+			stopped = excluded.stopped,
+			killed = excluded.killed,
+			errored = excluded.errored,
+			data = excluded.data`,
+		int64(job.ID), job.Name, job.Worker, job.Interactive,
+		int(job.State), job.Status, job.Duration().Seconds(),
+		store.Time(job.CreatedAt), store.Time(job.StartedAt),
+		store.Time(job.StoppedAt), store.Time(job.KilledAt),
+		store.Time(job.ErroredAt), buf,
+	)
+	if err == nil {
+		err = sqlAppendEvent(tx, store, job)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Errorf("error saving job: %s", err)
+		return err
+	}
+
+	return store.index.Index(job)
+}
+
+func (store *PostgresStore) Delete(id ID) error {
+	res, err := store.db.Exec("DELETE FROM jobs WHERE id = $1", int64(id))
+	if err != nil {
+		log.Errorf("error deleting job #%d: %s", id, err)
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return &KeyError{id, ErrNotExist}
+	}
+
+	if _, err := store.db.Exec("DELETE FROM events WHERE job = $1", int64(id)); err != nil {
+		log.Errorf("error deleting events of job #%d: %s", id, err)
+		return err
+	}
+
+	return store.index.Delete(id)
+}
+
+func (store *PostgresStore) Get(id ID) (*Job, error) {
+	var buf []byte
+
+	err := store.db.QueryRow("SELECT data FROM jobs WHERE id = $1", int64(id)).Scan(&buf)
+	if err == sql.ErrNoRows {
+		return nil, &KeyError{id, ErrNotExist}
+	} else if err != nil {
+		log.Errorf("error fetching job #%d: %s", id, err)
+		return nil, err
+	}
+
+	var job Job
+	if err := store.codec.Unmarshal(buf, &job); err != nil {
+		log.Errorf("error deserializing job #%d: %s", id, err)
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+func (store *PostgresStore) Find(ids ...ID) ([]*Job, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	args := make([]interface{}, len(ids))
+	placeholders := make([]string, len(ids))
+	for i, id := range ids {
+		args[i] = int64(id)
+		placeholders[i] = store.Placeholder(i + 1)
+	}
+
+	query := fmt.Sprintf(
+		"SELECT data FROM jobs WHERE id IN (%s)",
+		strings.Join(placeholders, ","),
+	)
+
+	found, err := store.query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return orderJobs(ids, found), nil
+}
+
+func (store *PostgresStore) All() ([]*Job, error) {
+	return store.query("SELECT data FROM jobs ORDER BY id")
+}
+
+func (store *PostgresStore) Events(id ID) ([]*JobEvent, error) {
+	return sqlEvents(store.db, store, id)
+}
+
+func (store *PostgresStore) indexer() *Indexer {
+	return store.index
+}
+
+func (store *PostgresStore) Search(q string, options *SearchOptions) (*SearchResult, error) {
+	if options == nil || !options.Highlight {
+		if where, args, ok := compileQuery(q, store, time.Now()); ok {
+			return searchSQL(store.db, store, where, args, options, store.Find)
+		}
+	}
+
+	ids, res, err := store.index.Search(q, options)
+	if err != nil {
+		return nil, err
+	}
+
+	res.Jobs, err = store.Find(ids...)
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// Claim implements Claimer by locking the oldest waiting job not already
+// locked by another instance and marking it as running on worker.
+// Interactive jobs are never claimed as their input is written to the
+// instance that created them.
+func (store *PostgresStore) Claim(worker string) (*Job, error) {
+	tx, err := store.db.Begin()
+	if err != nil {
+		log.Errorf("error starting transaction: %s", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var buf []byte
+	err = tx.QueryRow(`
+		SELECT data FROM jobs
+		WHERE state = $1 AND NOT interactive
+		ORDER BY created, id
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED`,
+		int(STATE_WAITING),
+	).Scan(&buf)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		log.Errorf("error claiming job: %s", err)
+		return nil, err
+	}
+
+	job := &Job{done: make(chan bool, 1)}
+	if err := store.codec.Unmarshal(buf, job); err != nil {
+		log.Errorf("error deserializing job: %s", err)
+		return nil, err
+	}
+
+	job.Worker = worker
+	job.State = STATE_RUNNING
+	job.StartedAt = time.Now()
+	job.reason = fmt.Sprintf("claimed by %s", worker)
+
+	if buf, err = store.codec.Marshal(job); err != nil {
+		log.Errorf("error serializing job: %s", err)
+		return nil, err
+	}
+
+	_, err = tx.Exec(
+		"UPDATE jobs SET worker = $2, state = $3, started = $4, data = $5 WHERE id = $1",
+		int64(job.ID), job.Worker, int(job.State), store.Time(job.StartedAt), buf,
+	)
+	if err != nil {
+		log.Errorf("error claiming job #%d: %s", job.ID, err)
+		return nil, err
+	}
+
+	if err := sqlAppendEvent(tx, store, job); err != nil {
+		log.Errorf("error recording event for job #%d: %s", job.ID, err)
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Errorf("error claiming job #%d: %s", job.ID, err)
+		return nil, err
+	}
+
+	return job, store.index.Index(job)
+}
+
+func (store *PostgresStore) query(query string, args ...interface{}) (jobs []*Job, err error) {
+	rows, err := store.db.Query(query, args...)
+	if err != nil {
+		log.Errorf("error querying jobs: %s", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var buf []byte
+		if err := rows.Scan(&buf); err != nil {
+			log.Errorf("error scanning job: %s", err)
+			return nil, err
+		}
+
+		var job Job
+		if err := store.codec.Unmarshal(buf, &job); err != nil {
+			log.Errorf("error deserializing job: %s", err)
+			return nil, err
+		}
+		jobs = append(jobs, &job)
+	}
+
+	return jobs, rows.Err()
+}
+
+// migrate applies any migrations not yet recorded in schema_migrations
+func (store *PostgresStore) migrate() error {
+	conn, err := store.db.Conn(context.Background())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ctx := context.Background()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", postgresMigrationsLock); err != nil {
+		log.Errorf("error locking schema migrations: %s", err)
+		return err
+	}
+	defer conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", postgresMigrationsLock)
+
+	_, err = conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER     PRIMARY KEY,
+			applied TIMESTAMPTZ NOT NULL DEFAULT now()
+		)`,
+	)
+	if err != nil {
+		log.Errorf("error creating schema_migrations: %s", err)
+		return err
+	}
+
+	var version int
+	err = conn.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version)
+	if err != nil {
+		log.Errorf("error reading schema version: %s", err)
+		return err
+	}
+
+	for i := version; i < len(postgresMigrations); i++ {
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(postgresMigrations[i]); err != nil {
+			tx.Rollback()
+			log.Errorf("error applying migration %d: %s", i+1, err)
+			return err
+		}
+
+		if _, err := tx.Exec("INSERT INTO schema_migrations (version) VALUES ($1)", i+1); err != nil {
+			tx.Rollback()
+			log.Errorf("error recording migration %d: %s", i+1, err)
+			return err
+		}
+
+		if err := tx.Commit(); err != nil {
+			log.Errorf("error applying migration %d: %s", i+1, err)
+			return err
+		}
+
+		log.Infof("applied schema migration %d", i+1)
+	}
+
+	return nil
+}
+
+func (store *PostgresStore) Codec() codec.MarshalUnmarshaler {
+	return store.codec
+}
+
+// Recode implements Recoder rewriting all jobs in a single transaction.
+// Other instances sharing the database must be stopped while recoding.
+func (store *PostgresStore) Recode(to codec.MarshalUnmarshaler) (int, error) {
+	n, err := recodeSQL(store.db, store, store.codec, to)
+	if err != nil {
+		return 0, err
+	}
+	store.codec = to
+	return n, nil
+}
+
+func (store *PostgresStore) getMeta(key string) (string, error) {
+	return sqlGetMeta(store.db, store, key)
+}
+
+func (store *PostgresStore) setMeta(key, value string) error {
+	return sqlSetMeta(store.db, store, key, value)
+}
+
+// postgresDSN removes the je specific store options (see ParseStoreOptions)
+// from a postgres:// uri as libpq rejects unknown parameters
+func postgresDSN(uri string) (string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", err
+	}
+
+	qs := u.Query()
+	qs.Del("codec")
+	qs.Del("index")
+	u.RawQuery = qs.Encode()
+
+	return u.String(), nil
+}
+
+// NewPostgresStore opens the PostgreSQL database at uri (a libpq connection
+// URI) and migrates its schema. The search index is local to each instance
+// and kept in memory unless options gives an IndexPath.
+func NewPostgresStore(uri string, options *StoreOptions) (Store, error) {
+	if options == nil {
+		options = &StoreOptions{}
+	}
+
+	db, err := sql.Open("postgres", uri)
+	if err != nil {
+		log.Errorf("error opening store %s: %s", uri, err)
+		return nil, err
+	}
+
+	store := &PostgresStore{db: db}
+
+	if err := store.migrate(); err != nil {
+		log.Errorf("error migrating store %s: %s", uri, err)
+		db.Close()
+		return nil, err
+	}
+
+	empty, err := sqlEmpty(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	store.codec, err = openCodec(store, options.Codec, empty)
+	if err != nil {
+		log.Errorf("error opening store %s: %s", uri, err)
+		db.Close()
+		return nil, err
+	}
+
+	store.index, err = NewIndexer(options.indexPath(""))
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return store, nil
+}
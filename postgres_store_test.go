@@ -0,0 +1,165 @@
+package je
+
+import (
+	"database/sql"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestPostgresStore returns a PostgresStore on an empty database given by
+// $JE_POSTGRES_URI, e.g. postgres://je:je@localhost/je_test?sslmode=disable
+func newTestPostgresStore(t *testing.T) *PostgresStore {
+	uri := os.Getenv("JE_POSTGRES_URI")
+	if uri == "" {
+		t.Skip("JE_POSTGRES_URI not set")
+	}
+
+	conn, err := sql.Open("postgres", uri)
+	require.NoError(t, err)
+	_, err = conn.Exec(`
+		DROP TABLE IF EXISTS jobs, meta, events, schema_migrations;
+		DROP SEQUENCE IF EXISTS job_ids;
+	`)
+	require.NoError(t, err)
+	require.NoError(t, conn.Close())
+
+	store, err := NewPostgresStore(uri, nil)
+	require.NoError(t, err)
+
+	// Migrations are only applied once
+	again, err := NewPostgresStore(uri, nil)
+	require.NoError(t, err)
+	require.NoError(t, again.Close())
+
+	return store.(*PostgresStore)
+}
+
+func TestPostgresStore(t *testing.T) {
+	assert := assert.New(t)
+
+	store := newTestPostgresStore(t)
+	defer store.Close()
+
+	now := time.Now().Truncate(time.Second)
+	for i := 1; i <= 5; i++ {
+		job := &Job{
+			ID:        store.NextId(),
+			Name:      "postgres",
+			State:     STATE_STOPPED,
+			Status:    i % 2,
+			CreatedAt: now.Add(time.Duration(i) * time.Hour),
+			StartedAt: now,
+			StoppedAt: now.Add(time.Duration(i) * time.Minute),
+		}
+		require.NoError(t, store.Save(job))
+		assert.Equal(ID(i), job.ID)
+	}
+
+	job, err := store.Get(ID(3))
+	assert.NoError(err)
+	assert.Equal("postgres", job.Name)
+
+	_, err = store.Get(ID(42))
+	assert.IsType(&KeyError{}, err)
+
+	jobs, err := store.Find(ID(4), ID(42), ID(2))
+	assert.NoError(err)
+	require.Len(t, jobs, 2)
+	assert.Equal(ID(4), jobs[0].ID)
+
+	res, err := store.Search("+name:postgres +status:1 +duration:>90", &SearchOptions{Sort: "duration", Order: "desc"})
+	assert.NoError(err)
+	assert.Equal(uint64(2), res.Total)
+	require.Len(t, res.Jobs, 2)
+	assert.Equal(ID(5), res.Jobs[0].ID)
+
+	var ids []ID
+	options := &SearchOptions{Limit: 2, Sort: "created", Order: "desc"}
+	for {
+		res, err := store.Search("name:postgres", options)
+		require.NoError(t, err)
+		for _, job := range res.Jobs {
+			ids = append(ids, job.ID)
+		}
+		if res.Next == "" {
+			break
+		}
+		options.Cursor = res.Next
+	}
+	assert.Equal([]ID{5, 4, 3, 2, 1}, ids)
+
+	assert.NoError(store.Delete(ID(1)))
+	assert.Error(store.Delete(ID(1)))
+}
+
+func TestPostgresStore_Claim(t *testing.T) {
+	assert := assert.New(t)
+
+	store := newTestPostgresStore(t)
+	defer store.Close()
+
+	const n = 20
+	for i := 0; i < n; i++ {
+		require.NoError(t, store.Save(&Job{
+			Name:      "claim",
+			State:     STATE_WAITING,
+			CreatedAt: time.Now(),
+		}))
+	}
+	require.NoError(t, store.Save(&Job{
+		Name:        "interactive",
+		Interactive: true,
+		State:       STATE_WAITING,
+		CreatedAt:   time.Now(),
+	}))
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		claimed = make(map[ID]int)
+	)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				job, err := store.Claim("w")
+				if !assert.NoError(err) || job == nil {
+					return
+				}
+				assert.Equal(STATE_RUNNING, job.State)
+				mu.Lock()
+				claimed[job.ID]++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Len(claimed, n)
+	for id, count := range claimed {
+		assert.Equal(1, count, "job #%d claimed %d times", id, count)
+	}
+
+	res, err := store.Search("+state:2", nil)
+	assert.NoError(err)
+	require.Len(t, res.Jobs, 1)
+	assert.True(res.Jobs[0].Interactive)
+}
+
+func TestPostgresDSN(t *testing.T) {
+	assert := assert.New(t)
+
+	dsn, err := postgresDSN("postgres://je@db/je?index=%2Fvar%2Fje%2Findex.db&codec=msgpack&sslmode=disable")
+	assert.NoError(err)
+	assert.Equal("postgres://je@db/je?sslmode=disable", dsn)
+
+	dsn, err = postgresDSN("postgres://je@db/je")
+	assert.NoError(err)
+	assert.Equal("postgres://je@db/je", dsn)
+}
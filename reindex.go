@@ -0,0 +1,172 @@
+package je
+
+import (
+	"errors"
+	"sort"
+	"sync/atomic"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// reindexBatchSize is the number of jobs indexed at once when rebuilding the
+// search index
+const reindexBatchSize = 1000
+
+// ErrReindexing is returned when the search index is already being rebuilt
+var ErrReindexing = errors.New("search index is already being rebuilt")
+
+// indexed is implemented by stores with a search index
+type indexed interface {
+	indexer() *Indexer
+}
+
+// reindexing is set while the search index is being rebuilt
+var reindexing int32
+
+// IndexCheck is the result of comparing the search index with the store
+type IndexCheck struct {
+	// Jobs is the number of jobs in the store
+	Jobs int `json:"jobs"`
+	// Indexed is the number of jobs in the search index
+	Indexed int `json:"indexed"`
+	// Missing is the number of jobs in the store missing from the index
+	Missing int `json:"missing"`
+	// Stale is the number of jobs in the index no longer in the store
+	Stale int `json:"stale"`
+	// Reindexing is true while the index is being rebuilt
+	Reindexing bool `json:"reindexing"`
+}
+
+// Consistent returns true if the index has every job in the store and
+// nothing else
+func (c *IndexCheck) Consistent() bool {
+	return c.Missing == 0 && c.Stale == 0
+}
+
+// CheckIndex compares the ids of the jobs in the search index with those in
+// the store. Stores without a search index are always consistent.
+func CheckIndex() (*IndexCheck, error) {
+	jobs, err := db.All()
+	if err != nil {
+		log.Errorf("error fetching jobs to check index: %s", err)
+		return nil, err
+	}
+
+	check := &IndexCheck{
+		Jobs:       len(jobs),
+		Indexed:    len(jobs),
+		Reindexing: atomic.LoadInt32(&reindexing) == 1,
+	}
+
+	store, ok := db.(indexed)
+	if !ok {
+		return check, nil
+	}
+
+	ids, err := store.indexer().IDs()
+	if err != nil {
+		return nil, err
+	}
+	check.Indexed = len(ids)
+
+	stored := make(map[ID]bool, len(jobs))
+	for _, job := range jobs {
+		stored[job.ID] = true
+	}
+	for _, id := range ids {
+		if stored[id] {
+			delete(stored, id)
+		} else {
+			check.Stale++
+		}
+	}
+	check.Missing = len(stored)
+
+	return check, nil
+}
+
+// Reindex rebuilds the search index from the store. Every job in the store
+// is indexed again and jobs no longer in the store are removed from the
+// index. Searches may miss jobs until it completes. Progress is reported by
+// the index_reindex_jobs and index_reindex_indexed metrics.
+func Reindex() (int, error) {
+	if !atomic.CompareAndSwapInt32(&reindexing, 0, 1) {
+		return 0, ErrReindexing
+	}
+	defer atomic.StoreInt32(&reindexing, 0)
+
+	jobs, err := db.All()
+	if err != nil {
+		log.Errorf("error fetching jobs to reindex: %s", err)
+		return 0, err
+	}
+
+	store, ok := db.(indexed)
+	if !ok {
+		return len(jobs), nil
+	}
+	index := store.indexer()
+
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].ID < jobs[j].ID })
+
+	metrics.Gauge("index", "reindex_jobs").Set(float64(len(jobs)))
+	metrics.Gauge("index", "reindex_indexed").Set(0)
+
+	ids, err := index.IDs()
+	if err != nil {
+		return 0, err
+	}
+
+	stored := make(map[ID]bool, len(jobs))
+	for _, job := range jobs {
+		stored[job.ID] = true
+	}
+
+	var stale []ID
+	for _, id := range ids {
+		if !stored[id] {
+			stale = append(stale, id)
+		}
+	}
+	if len(stale) > 0 {
+		if err := index.DeleteBatch(stale); err != nil {
+			return 0, err
+		}
+		log.Infof("removed %d stale jobs from the search index", len(stale))
+	}
+
+	for i := 0; i < len(jobs); i += reindexBatchSize {
+		end := i + reindexBatchSize
+		if end > len(jobs) {
+			end = len(jobs)
+		}
+		if err := index.IndexBatch(jobs[i:end]); err != nil {
+			return i, err
+		}
+		metrics.Gauge("index", "reindex_indexed").Set(float64(end))
+	}
+
+	metrics.Counter("index", "reindexes").Inc()
+
+	return len(jobs), nil
+}
+
+// RepairIndex checks the search index and rebuilds it if it is missing jobs
+// or has jobs no longer in the store, e.g. after index.db was deleted or
+// found corrupted. It returns the number of jobs reindexed.
+func RepairIndex() (int, error) {
+	check, err := CheckIndex()
+	if err != nil {
+		return 0, err
+	}
+	if check.Consistent() {
+		return 0, nil
+	}
+
+	log.Warnf(
+		"search index is inconsistent with the store (%d jobs, %d indexed, %d missing, %d stale), rebuilding it",
+		check.Jobs, check.Indexed, check.Missing, check.Stale,
+	)
+
+	return Reindex()
+}
@@ -0,0 +1,142 @@
+package je
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepairIndex(t *testing.T) {
+	tests := []struct {
+		name    string
+		corrupt func(path string) error
+	}{
+		{"Deleted", os.RemoveAll},
+		{"Corrupted", func(path string) error {
+			return ioutil.WriteFile(filepath.Join(path, "index_meta.json"), []byte("garbage"), 0644)
+		}},
+		{"CorruptedStore", func(path string) error {
+			return ioutil.WriteFile(filepath.Join(path, "store"), bytes.Repeat([]byte("garbage"), 4096), 0600)
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withGlobals(t)
+			assert := assert.New(t)
+
+			tmpdir := t.TempDir()
+			dburi := fmt.Sprintf("bolt://%s/je.db", tmpdir)
+
+			store, err := InitDB(dburi)
+			require.NoError(t, err)
+			for _, name := range []string{"foo", "bar", "baz"} {
+				require.NoError(t, db.Save(&Job{ID: db.NextId(), Name: name}))
+			}
+			require.NoError(t, store.Close())
+
+			require.NoError(t, test.corrupt(filepath.Join(tmpdir, "index.db")))
+
+			store, err = InitDB(dburi)
+			require.NoError(t, err)
+			defer store.Close()
+
+			res, err := store.Search("", nil)
+			require.NoError(t, err)
+			assert.Len(res.Jobs, 0)
+
+			check, err := CheckIndex()
+			require.NoError(t, err)
+			assert.False(check.Consistent())
+			assert.Equal(IndexCheck{Jobs: 3, Indexed: 0, Missing: 3}, *check)
+
+			n, err := RepairIndex()
+			require.NoError(t, err)
+			assert.Equal(3, n)
+
+			res, err = store.Search("name:bar", nil)
+			require.NoError(t, err)
+			require.Len(t, res.Jobs, 1)
+			assert.Equal("bar", res.Jobs[0].Name)
+
+			n, err = RepairIndex()
+			require.NoError(t, err)
+			assert.Equal(0, n)
+		})
+	}
+}
+
+func TestNewIndexerKeepsIndex(t *testing.T) {
+	assert := assert.New(t)
+
+	path := filepath.Join(t.TempDir(), "index.db")
+	indexer, err := NewIndexer(path)
+	require.NoError(t, err)
+
+	// An index open elsewhere is locked and not recreated
+	_, err = NewIndexer(path)
+	if assert.Error(err) {
+		assert.Contains(err.Error(), "locked")
+	}
+	require.NoError(t, indexer.Close())
+
+	// Nor is an index that cannot be opened for any other reason
+	store := filepath.Join(path, "store")
+	require.NoError(t, os.Remove(store))
+	require.NoError(t, os.Mkdir(store, 0700))
+	_, err = NewIndexer(path)
+	assert.Error(err)
+	_, err = os.Stat(filepath.Join(path, "index_meta.json"))
+	assert.NoError(err)
+}
+
+func TestReindexStale(t *testing.T) {
+	withGlobals(t)
+	assert := assert.New(t)
+
+	store, err := InitDB("memory://")
+	require.NoError(t, err)
+	defer store.Close()
+
+	require.NoError(t, db.Save(&Job{ID: db.NextId(), Name: "foo"}))
+	require.NoError(t, db.(indexed).indexer().Index(&Job{ID: 42, Name: "gone"}))
+
+	check, err := CheckIndex()
+	require.NoError(t, err)
+	assert.Equal(IndexCheck{Jobs: 1, Indexed: 2, Stale: 1}, *check)
+
+	n, err := Reindex()
+	require.NoError(t, err)
+	assert.Equal(1, n)
+
+	check, err = CheckIndex()
+	require.NoError(t, err)
+	assert.True(check.Consistent())
+	assert.Equal(1, check.Indexed)
+}
+
+func TestReindexHandler(t *testing.T) {
+	assert := assert.New(t)
+
+	res, err := http.Post("http://127.0.0.1:8000/admin/reindex?wait=1", "", nil)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(http.StatusOK, res.StatusCode)
+
+	res, err = http.Get("http://127.0.0.1:8000/admin/index")
+	require.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(http.StatusOK, res.StatusCode)
+
+	var check IndexCheck
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&check))
+	assert.True(check.Consistent())
+}
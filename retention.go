@@ -0,0 +1,237 @@
+package je
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultReapInterval is how often retention policies are enforced
+const DefaultReapInterval = time.Minute
+
+// RetentionPolicy describes which completed jobs to keep. Active jobs are
+// never deleted.
+type RetentionPolicy struct {
+	// Name restricts the policy to jobs with this name (empty for all)
+	Name string
+	// State restricts the policy to jobs in this state (0 for all
+	// completed jobs)
+	State State
+	// MaxAge deletes jobs that finished longer ago than this (0 for none)
+	MaxAge time.Duration
+	// MaxCount keeps at most this many of the most recent jobs (0 for none)
+	MaxCount int
+}
+
+// ParseRetentionPolicy parses a policy of the form
+// name=backup,state=stopped,max-age=720h,max-count=100 where every key is
+// optional but at least one of max-age or max-count must be given.
+func ParseRetentionPolicy(s string) (policy RetentionPolicy, err error) {
+	for _, field := range strings.Split(s, ",") {
+		kv := strings.SplitN(strings.TrimSpace(field), "=", 2)
+		if len(kv) != 2 {
+			return policy, fmt.Errorf("invalid retention policy field: %q", field)
+		}
+
+		key, value := strings.ToLower(kv[0]), kv[1]
+		switch key {
+		case "name":
+			policy.Name = value
+		case "state":
+			policy.State = ParseState(value)
+			if !policy.State.Done() {
+				return policy, fmt.Errorf("invalid retention policy state: %q", value)
+			}
+		case "max-age":
+			policy.MaxAge, err = time.ParseDuration(value)
+			if err != nil || policy.MaxAge < 0 {
+				return policy, fmt.Errorf("invalid retention policy max-age: %q", value)
+			}
+		case "max-count":
+			policy.MaxCount, err = strconv.Atoi(value)
+			if err != nil || policy.MaxCount < 0 {
+				return policy, fmt.Errorf("invalid retention policy max-count: %q", value)
+			}
+		default:
+			return policy, fmt.Errorf("invalid retention policy key: %q", key)
+		}
+	}
+
+	if policy.MaxAge == 0 && policy.MaxCount == 0 {
+		return policy, fmt.Errorf("retention policy %q has no max-age or max-count", s)
+	}
+
+	return policy, nil
+}
+
+func (p RetentionPolicy) String() string {
+	var fields []string
+	if p.Name != "" {
+		fields = append(fields, "name="+p.Name)
+	}
+	if p.State != 0 {
+		fields = append(fields, "state="+strings.ToLower(p.State.String()))
+	}
+	if p.MaxAge > 0 {
+		fields = append(fields, "max-age="+p.MaxAge.String())
+	}
+	if p.MaxCount > 0 {
+		fields = append(fields, "max-count="+strconv.Itoa(p.MaxCount))
+	}
+	return strings.Join(fields, ",")
+}
+
+// matches returns true if the policy applies to the job, which must be a
+// snapshot or locked
+func (p RetentionPolicy) matches(job *Job) bool {
+	if !job.State.Done() {
+		return false
+	}
+	if p.Name != "" && job.Name != p.Name {
+		return false
+	}
+	if p.State != 0 && job.State != p.State {
+		return false
+	}
+	return true
+}
+
+// expired returns the ids of the jobs that this policy does not retain.
+// The jobs are read from snapshots as they may still be running.
+func (p RetentionPolicy) expired(jobs []*Job, now time.Time) (ids []ID) {
+	var matched []*Job
+	for _, job := range snapshotJobs(jobs) {
+		if p.matches(job) {
+			matched = append(matched, job)
+		}
+	}
+
+	// Most recent first
+	sort.Slice(matched, func(i, j int) bool {
+		return matched[i].CreatedAt.After(matched[j].CreatedAt)
+	})
+
+	for i, job := range matched {
+		if p.MaxCount > 0 && i >= p.MaxCount {
+			ids = append(ids, job.ID)
+		} else if p.MaxAge > 0 && now.Sub(job.FinishedAt()) > p.MaxAge {
+			ids = append(ids, job.ID)
+		}
+	}
+
+	return
+}
+
+// RetentionPolicies is a list of policies that can be used as a flag.Value
+type RetentionPolicies []RetentionPolicy
+
+func (ps *RetentionPolicies) String() string {
+	var policies []string
+	for _, p := range *ps {
+		policies = append(policies, p.String())
+	}
+	return strings.Join(policies, " ")
+}
+
+// Set parses and appends a policy
+func (ps *RetentionPolicies) Set(s string) error {
+	policy, err := ParseRetentionPolicy(s)
+	if err != nil {
+		return err
+	}
+	*ps = append(*ps, policy)
+	return nil
+}
+
+// Reaper periodically deletes completed jobs along with their data once
+// any of its policies expires them, so a job is only kept if it is retained
+// by every policy that applies to it
+type Reaper struct {
+	sync.Mutex
+
+	policies RetentionPolicies
+	interval time.Duration
+	stop     chan bool
+}
+
+// NewReaper returns a reaper enforcing the given policies every interval,
+// or every DefaultReapInterval if interval is not positive. It does nothing
+// until Run is called.
+func NewReaper(policies RetentionPolicies, interval time.Duration) *Reaper {
+	if interval <= 0 {
+		interval = DefaultReapInterval
+	}
+
+	return &Reaper{
+		policies: policies,
+		interval: interval,
+		stop:     make(chan bool),
+	}
+}
+
+// Reap deletes all jobs that have expired as of now returning the number
+// of jobs deleted
+func (r *Reaper) Reap(now time.Time) (int, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	jobs, err := db.All()
+	if err != nil {
+		log.Errorf("error listing jobs to reap: %s", err)
+		return 0, err
+	}
+
+	expired := make(map[ID]bool)
+	for _, policy := range r.policies {
+		for _, id := range policy.expired(jobs, now) {
+			expired[id] = true
+		}
+	}
+
+	var n int
+	for id := range expired {
+		if err := DeleteJob(id); err != nil {
+			log.Errorf("error reaping job #%d: %s", id, err)
+			continue
+		}
+		n++
+	}
+
+	if n > 0 {
+		metrics.Counter("job", "reaped").Add(float64(n))
+		log.Infof("reaped %d jobs", n)
+	}
+
+	return n, nil
+}
+
+// Run enforces the retention policies every interval until stopped
+func (r *Reaper) Run() {
+	if len(r.policies) == 0 {
+		return
+	}
+
+	log.Infof("reaping jobs every %s with policies: %s", r.interval, r.policies.String())
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.Reap(time.Now())
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+// Stop stops a running reaper
+func (r *Reaper) Stop() {
+	close(r.stop)
+}
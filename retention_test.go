@@ -0,0 +1,113 @@
+package je
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRetentionPolicy(t *testing.T) {
+	assert := assert.New(t)
+
+	policy, err := ParseRetentionPolicy("name=backup,state=errored,max-age=24h,max-count=10")
+	assert.NoError(err)
+	assert.Equal(RetentionPolicy{
+		Name:     "backup",
+		State:    STATE_ERRORED,
+		MaxAge:   24 * time.Hour,
+		MaxCount: 10,
+	}, policy)
+	assert.Equal("name=backup,state=errored,max-age=24h0m0s,max-count=10", policy.String())
+
+	for _, s := range []string{"", "name=backup", "max-age=foo", "max-count=-1", "state=running,max-count=1", "foo=bar"} {
+		_, err := ParseRetentionPolicy(s)
+		assert.Error(err, s)
+	}
+}
+
+func TestReaper(t *testing.T) {
+	withGlobals(t)
+	assert := assert.New(t)
+
+	// The running job is never finished so keep it out of the server's store
+	store, err := InitDB("memory://")
+	require.NoError(t, err)
+	defer store.Close()
+
+	now := time.Now()
+
+	save := func(state State, finished time.Duration) *Job {
+		job := &Job{
+			ID:        db.NextId(),
+			Name:      "reaper",
+			State:     state,
+			CreatedAt: now.Add(-finished - time.Minute),
+			StartedAt: now.Add(-finished - time.Minute),
+		}
+		if state.Done() {
+			job.StoppedAt = now.Add(-finished)
+		}
+		require.NoError(t, db.Save(job))
+		return job
+	}
+
+	old := save(STATE_STOPPED, 48*time.Hour)
+	running := save(STATE_RUNNING, 72*time.Hour)
+	recent := []*Job{
+		save(STATE_STOPPED, 3*time.Hour),
+		save(STATE_STOPPED, 2*time.Hour),
+		save(STATE_STOPPED, 1*time.Hour),
+	}
+
+	reaper := NewReaper(RetentionPolicies{
+		{Name: "reaper", MaxAge: 24 * time.Hour},
+		{Name: "reaper", MaxCount: 2},
+	}, 0)
+
+	n, err := reaper.Reap(now)
+	assert.NoError(err)
+	assert.Equal(2, n)
+
+	for _, job := range []*Job{old, recent[0]} {
+		_, err := db.Get(job.ID)
+		assert.Error(err)
+	}
+	for _, job := range []*Job{running, recent[1], recent[2]} {
+		_, err := db.Get(job.ID)
+		assert.NoError(err)
+	}
+}
+
+func TestReaperAnyPolicy(t *testing.T) {
+	withGlobals(t)
+	assert := assert.New(t)
+
+	store, err := InitDB("memory://")
+	require.NoError(t, err)
+	defer store.Close()
+
+	now := time.Now()
+	job := &Job{
+		ID:        db.NextId(),
+		Name:      "reaper",
+		State:     STATE_STOPPED,
+		CreatedAt: now.Add(-49 * time.Hour),
+		StartedAt: now.Add(-49 * time.Hour),
+		StoppedAt: now.Add(-48 * time.Hour),
+	}
+	require.NoError(t, db.Save(job))
+
+	// The job is among the 10 most recent but older than a day
+	reaper := NewReaper(RetentionPolicies{
+		{Name: "reaper", MaxCount: 10},
+		{MaxAge: 24 * time.Hour},
+	}, 0)
+
+	n, err := reaper.Reap(now)
+	assert.NoError(err)
+	assert.Equal(1, n)
+	_, err = db.Get(job.ID)
+	assert.Error(err)
+}
@@ -0,0 +1,572 @@
+package je
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultS3Endpoint is the endpoint used by s3:// data uris without one
+	DefaultS3Endpoint = "s3.amazonaws.com"
+
+	// DefaultS3PollInterval is how often Tail checks for new data written
+	// by other nodes
+	DefaultS3PollInterval = time.Second
+
+	// s3PartSize is the size of the parts of multipart uploads
+	s3PartSize = 16 << 20
+)
+
+// S3Options configures an S3Data
+type S3Options struct {
+	// Endpoint is the host[:port] of the S3 compatible service
+	Endpoint string
+	// Region is the region of the bucket, looked up if empty
+	Region string
+	// Insecure uses http instead of https
+	Insecure bool
+	// PathStyle addresses buckets by path instead of by virtual host as
+	// most S3 compatible services other than AWS expect
+	PathStyle bool
+	// PollInterval is how often Tail checks for new data written by other
+	// nodes
+	PollInterval time.Duration
+}
+
+// ParseS3URI parses a data uri of the form
+// s3://bucket/prefix?endpoint=host:port&region=...&insecure=1&path_style=1&poll=1s
+// into its bucket, key prefix and options
+func ParseS3URI(uri string) (bucket, prefix string, options *S3Options, err error) {
+	u, err := ParseURI(uri)
+	if err != nil {
+		return "", "", nil, err
+	}
+	if u.Type != "s3" {
+		return "", "", nil, fmt.Errorf("invalid s3 uri: %s", uri)
+	}
+
+	parts := strings.SplitN(u.Path, "/", 2)
+	bucket = parts[0]
+	if bucket == "" {
+		return "", "", nil, fmt.Errorf("invalid s3 uri %s: no bucket", uri)
+	}
+	if len(parts) == 2 {
+		prefix = strings.Trim(parts[1], "/")
+	}
+
+	options = &S3Options{
+		Endpoint:     u.Query.Get("endpoint"),
+		Region:       u.Query.Get("region"),
+		PollInterval: DefaultS3PollInterval,
+	}
+	if options.Endpoint == "" {
+		options.Endpoint = DefaultS3Endpoint
+	}
+
+	for name, value := range map[string]*bool{
+		"insecure":   &options.Insecure,
+		"path_style": &options.PathStyle,
+	} {
+		if s := u.Query.Get(name); s != "" {
+			if *value, err = strconv.ParseBool(s); err != nil {
+				return "", "", nil, fmt.Errorf("invalid s3 uri %s: %s: %s", uri, name, err)
+			}
+		}
+	}
+
+	if s := u.Query.Get("poll"); s != "" {
+		if options.PollInterval, err = time.ParseDuration(s); err != nil {
+			return "", "", nil, fmt.Errorf("invalid s3 uri %s: poll: %s", uri, err)
+		}
+		if options.PollInterval <= 0 {
+			return "", "", nil, fmt.Errorf("invalid s3 uri %s: poll must be positive", uri)
+		}
+	}
+
+	return bucket, prefix, options, nil
+}
+
+// S3Data stores the data of jobs as objects in a bucket of Amazon S3 or any
+// S3 compatible service such as MinIO, so that several je daemons can share
+// it. Objects are written with streaming multipart uploads and only become
+// visible to other daemons once they are complete, i.e. when a job ends.
+// Until then what has been written is also spooled to a temporary file so
+// that the daemon running the job can read and follow it as it is written.
+type S3Data struct {
+	client  *minio.Client
+	bucket  string
+	prefix  string
+	options *S3Options
+
+	sync.Mutex
+	uploads map[string]*s3Upload
+}
+
+// NewS3Data returns an S3Data storing objects in bucket under prefix. The
+// credentials are read from the environment ($AWS_ACCESS_KEY_ID and
+// $AWS_SECRET_ACCESS_KEY or $MINIO_ROOT_USER and $MINIO_ROOT_PASSWORD), from
+// ~/.aws/credentials or from the IAM role of the instance.
+func NewS3Data(bucket, prefix string, options *S3Options) (Data, error) {
+	if options == nil {
+		options = &S3Options{Endpoint: DefaultS3Endpoint}
+	}
+	if options.PollInterval <= 0 {
+		options.PollInterval = DefaultS3PollInterval
+	}
+
+	lookup := minio.BucketLookupAuto
+	if options.PathStyle {
+		lookup = minio.BucketLookupPath
+	}
+
+	client, err := minio.New(options.Endpoint, &minio.Options{
+		Creds: credentials.NewChainCredentials([]credentials.Provider{
+			&credentials.EnvAWS{},
+			&credentials.EnvMinio{},
+			&credentials.FileAWSCredentials{},
+			&credentials.IAM{},
+		}),
+		Secure:       !options.Insecure,
+		Region:       options.Region,
+		BucketLookup: lookup,
+	})
+	if err != nil {
+		log.Errorf("error creating s3 client for %s: %s", options.Endpoint, err)
+		return nil, err
+	}
+
+	ok, err := client.BucketExists(context.Background(), bucket)
+	if err != nil {
+		log.Errorf("error checking s3 bucket %s: %s", bucket, err)
+		return nil, err
+	}
+	if !ok {
+		err := fmt.Errorf("s3 bucket %s does not exist", bucket)
+		log.Error(err)
+		return nil, err
+	}
+
+	return &S3Data{
+		client:  client,
+		bucket:  bucket,
+		prefix:  prefix,
+		options: options,
+		uploads: make(map[string]*s3Upload),
+	}, nil
+}
+
+func (d *S3Data) makekey(id ID, dtype DataType) string {
+	return path.Join(d.prefix, fmt.Sprintf("%d.%s", id, dtype))
+}
+
+// upload returns the upload in progress of key or nil if there is none
+func (d *S3Data) upload(key string) *s3Upload {
+	d.Lock()
+	defer d.Unlock()
+	return d.uploads[key]
+}
+
+// s3Error returns an error satisfying os.IsNotExist for missing objects so
+// that callers can treat S3Data like LocalData
+func s3Error(op, key string, err error) error {
+	switch minio.ToErrorResponse(err).Code {
+	case "NoSuchKey", "NotFound":
+		return &os.PathError{Op: op, Path: key, Err: os.ErrNotExist}
+	}
+	return err
+}
+
+func (d *S3Data) Size(id ID, dtype DataType) (int64, error) {
+	key := d.makekey(id, dtype)
+	if up := d.upload(key); up != nil {
+		return up.size(), nil
+	}
+
+	info, err := d.client.StatObject(context.Background(), d.bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return 0, s3Error("stat", key, err)
+	}
+	return info.Size, nil
+}
+
+func (d *S3Data) Read(id ID, dtype DataType) (io.ReadCloser, error) {
+	return d.ReadRange(id, dtype, 0, -1)
+}
+
+// ReadRange reads length bytes of the data of a job from offset, or
+// everything from offset if length is negative, with a ranged GET
+func (d *S3Data) ReadRange(id ID, dtype DataType, offset, length int64) (io.ReadCloser, error) {
+	key := d.makekey(id, dtype)
+	if up := d.upload(key); up != nil {
+		r, err := up.reader(offset, length)
+		// Unless the upload has just completed and its spool is gone
+		if !os.IsNotExist(err) {
+			return r, err
+		}
+	}
+
+	opts := minio.GetObjectOptions{}
+	if offset > 0 || length >= 0 {
+		end := int64(0)
+		if length >= 0 {
+			if length == 0 {
+				return ioutil.NopCloser(bytes.NewReader(nil)), nil
+			}
+			end = offset + length - 1
+		}
+		if err := opts.SetRange(offset, end); err != nil {
+			return nil, err
+		}
+	}
+
+	// The low level GetObject of Core sends the request straight away
+	core := minio.Core{Client: d.client}
+	body, _, _, err := core.GetObject(context.Background(), d.bucket, key, opts)
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "InvalidRange" {
+			return ioutil.NopCloser(bytes.NewReader(nil)), nil
+		}
+		return nil, s3Error("open", key, err)
+	}
+	return body, nil
+}
+
+// Write starts a streaming multipart upload of the data of a job which is
+// completed when the returned writer is closed
+func (d *S3Data) Write(id ID, dtype DataType) (io.WriteCloser, error) {
+	key := d.makekey(id, dtype)
+
+	pr, pw := io.Pipe()
+	up, err := newS3Upload(pw)
+	if err != nil {
+		log.Errorf("error spooling %s data for job #%d: %s", dtype, id, err)
+		return nil, err
+	}
+
+	d.Lock()
+	d.uploads[key] = up
+	d.Unlock()
+
+	go func() {
+		defer close(up.done)
+		_, err := d.client.PutObject(
+			context.Background(), d.bucket, key, pr, -1,
+			minio.PutObjectOptions{
+				ContentType: "application/octet-stream",
+				PartSize:    s3PartSize,
+			},
+		)
+		if err != nil {
+			log.Errorf("error uploading %s data for job #%d: %s", dtype, id, err)
+		}
+		up.err = err
+		pr.CloseWithError(err)
+	}()
+
+	return &s3Writer{data: d, key: key, upload: up}, nil
+}
+
+func (d *S3Data) artifactkey(id ID, name string) string {
+	return path.Join(d.prefix, fmt.Sprintf("%d.artifacts", id), name)
+}
+
+func (d *S3Data) inputfilekey(id ID, name string) string {
+	return path.Join(d.prefix, fmt.Sprintf("%d.inputs", id), name)
+}
+
+// WriteArtifact starts a streaming upload of an artifact of a job which is
+// completed when the returned writer is closed
+func (d *S3Data) WriteArtifact(id ID, name string) (io.WriteCloser, error) {
+	return d.putFile(id, d.artifactkey(id, name))
+}
+
+func (d *S3Data) ReadArtifact(id ID, name string) (io.ReadCloser, error) {
+	return d.getFile(d.artifactkey(id, name))
+}
+
+// WriteInputFile starts a streaming upload of an input file of a job which
+// is completed when the returned writer is closed
+func (d *S3Data) WriteInputFile(id ID, name string) (io.WriteCloser, error) {
+	return d.putFile(id, d.inputfilekey(id, name))
+}
+
+func (d *S3Data) ReadInputFile(id ID, name string) (io.ReadCloser, error) {
+	return d.getFile(d.inputfilekey(id, name))
+}
+
+// putFile starts a streaming upload of a file of a job to key
+func (d *S3Data) putFile(id ID, key string) (io.WriteCloser, error) {
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		_, err := d.client.PutObject(
+			context.Background(), d.bucket, key, pr, -1,
+			minio.PutObjectOptions{
+				ContentType: "application/octet-stream",
+				PartSize:    s3PartSize,
+			},
+		)
+		if err != nil {
+			log.Errorf("error uploading %s for job #%d: %s", key, id, err)
+		}
+		pr.CloseWithError(err)
+		done <- err
+	}()
+
+	return &s3FileWriter{pw: pw, done: done}, nil
+}
+
+// getFile reads a file of a job from key
+func (d *S3Data) getFile(key string) (io.ReadCloser, error) {
+	core := minio.Core{Client: d.client}
+	body, _, _, err := core.GetObject(context.Background(), d.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, s3Error("open", key, err)
+	}
+	return body, nil
+}
+
+func (d *S3Data) Delete(id ID) error {
+	for _, prefix := range []string{d.artifactkey(id, ""), d.inputfilekey(id, "")} {
+		objects := d.client.ListObjects(context.Background(), d.bucket, minio.ListObjectsOptions{Prefix: prefix + "/", Recursive: true})
+		for object := range objects {
+			if object.Err != nil {
+				log.Errorf("error listing files for job #%d: %s", id, object.Err)
+				return object.Err
+			}
+			err := d.client.RemoveObject(context.Background(), d.bucket, object.Key, minio.RemoveObjectOptions{})
+			if err != nil {
+				log.Errorf("error deleting %s for job #%d: %s", object.Key, id, err)
+				return err
+			}
+		}
+	}
+
+	for _, dtype := range dataTypes {
+		key := d.makekey(id, dtype)
+		err := d.client.RemoveObject(context.Background(), d.bucket, key, minio.RemoveObjectOptions{})
+		if err != nil && !os.IsNotExist(s3Error("remove", key, err)) {
+			log.Errorf("error deleting %s data for job #%d: %s", dtype, id, err)
+			return err
+		}
+	}
+	return nil
+}
+
+// Tail follows the data of a job. Data being written by this daemon is read
+// from its spool as it is written, otherwise the object is polled for new
+// data every PollInterval with ranged GETs.
+func (d *S3Data) Tail(id ID, dtype DataType, ctx context.Context) (lines chan string, errors chan error) {
+	lines = make(chan string)
+	errors = make(chan error)
+
+	key := d.makekey(id, dtype)
+
+	go func() {
+		ticker := time.NewTicker(d.options.PollInterval)
+		defer ticker.Stop()
+
+		var (
+			offset  int64
+			pending []byte
+		)
+		for {
+			// Wait for the next write rather than polling while uploading
+			var written <-chan struct{}
+			if up := d.upload(key); up != nil {
+				written = up.wait()
+			}
+
+			r, err := d.ReadRange(id, dtype, offset, -1)
+			if err == nil {
+				var buf []byte
+				buf, err = ioutil.ReadAll(r)
+				r.Close()
+				offset += int64(len(buf))
+				pending = append(pending, buf...)
+			}
+			if err != nil && !os.IsNotExist(err) {
+				select {
+				case errors <- err:
+				case <-ctx.Done():
+				}
+				return
+			}
+
+			for {
+				i := bytes.IndexByte(pending, '\n')
+				if i < 0 {
+					break
+				}
+				select {
+				case lines <- string(pending[:i]):
+				case <-ctx.Done():
+					return
+				}
+				pending = pending[i+1:]
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-written:
+			case <-ticker.C:
+			}
+		}
+	}()
+	return
+}
+
+// s3Upload is an object being uploaded and the spool of what has been
+// written to it
+type s3Upload struct {
+	sync.RWMutex
+	spool   *os.File
+	n       int64
+	written chan struct{}
+
+	pw   *io.PipeWriter
+	done chan struct{}
+	err  error
+}
+
+// newS3Upload returns an upload writing to pw spooled to a temporary file
+func newS3Upload(pw *io.PipeWriter) (*s3Upload, error) {
+	spool, err := ioutil.TempFile("", "je-s3-")
+	if err != nil {
+		return nil, err
+	}
+	return &s3Upload{
+		spool:   spool,
+		written: make(chan struct{}),
+		pw:      pw,
+		done:    make(chan struct{}),
+	}, nil
+}
+
+func (u *s3Upload) size() int64 {
+	u.RLock()
+	defer u.RUnlock()
+	return u.n
+}
+
+// reader reads length bytes written from offset, or everything written from
+// offset if length is negative, from the spool. It fails with an error
+// satisfying os.IsNotExist once the upload has ended.
+func (u *s3Upload) reader(offset, length int64) (io.ReadCloser, error) {
+	u.RLock()
+	n := u.n
+	u.RUnlock()
+
+	// The spool is opened again so that it can still be read once removed
+	f, err := os.Open(u.spool.Name())
+	if err != nil {
+		return nil, err
+	}
+
+	if offset > n {
+		offset = n
+	}
+	if length < 0 || offset+length > n {
+		length = n - offset
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.NewSectionReader(f, offset, length), f}, nil
+}
+
+// write writes p to the upload and its spool
+func (u *s3Upload) write(p []byte) (int, error) {
+	n, err := u.pw.Write(p)
+
+	u.Lock()
+	defer u.Unlock()
+	if _, werr := u.spool.Write(p[:n]); werr != nil && err == nil {
+		err = werr
+	}
+	u.n += int64(n)
+	u.notify()
+
+	return n, err
+}
+
+// end removes the spool once the upload is done and wakes up everything
+// waiting for a write
+func (u *s3Upload) end() {
+	u.Lock()
+	defer u.Unlock()
+
+	u.spool.Close()
+	os.Remove(u.spool.Name())
+	u.notify()
+}
+
+// wait returns a channel closed on the next write or when the upload ends
+func (u *s3Upload) wait() <-chan struct{} {
+	u.RLock()
+	defer u.RUnlock()
+	return u.written
+}
+
+// notify wakes up everything waiting for a write
+func (u *s3Upload) notify() {
+	close(u.written)
+	u.written = make(chan struct{})
+}
+
+// s3Writer writes to an upload
+type s3Writer struct {
+	data   *S3Data
+	key    string
+	upload *s3Upload
+}
+
+func (w *s3Writer) Write(p []byte) (int, error) {
+	return w.upload.write(p)
+}
+
+// Close completes the upload and waits for it to finish
+func (w *s3Writer) Close() error {
+	w.upload.pw.Close()
+	<-w.upload.done
+
+	w.data.Lock()
+	if w.data.uploads[w.key] == w.upload {
+		delete(w.data.uploads, w.key)
+	}
+	w.data.Unlock()
+
+	w.upload.end()
+
+	return w.upload.err
+}
+
+// s3FileWriter writes to the upload of an artifact or input file
+type s3FileWriter struct {
+	pw   *io.PipeWriter
+	done chan error
+}
+
+func (w *s3FileWriter) Write(p []byte) (int, error) {
+	return w.pw.Write(p)
+}
+
+// Close completes the upload and waits for it to finish
+func (w *s3FileWriter) Close() error {
+	w.pw.Close()
+	return <-w.done
+}
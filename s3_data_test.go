@@ -0,0 +1,197 @@
+package je
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseS3URI(t *testing.T) {
+	assert := assert.New(t)
+
+	bucket, prefix, options, err := ParseS3URI("s3://je/jobs/data/?endpoint=localhost:9000&insecure=1&path_style=true&poll=250ms")
+	require.NoError(t, err)
+	assert.Equal("je", bucket)
+	assert.Equal("jobs/data", prefix)
+	assert.Equal(&S3Options{
+		Endpoint:     "localhost:9000",
+		Insecure:     true,
+		PathStyle:    true,
+		PollInterval: 250 * time.Millisecond,
+	}, options)
+
+	bucket, prefix, options, err = ParseS3URI("s3://je?region=eu-west-1")
+	require.NoError(t, err)
+	assert.Equal("je", bucket)
+	assert.Equal("", prefix)
+	assert.Equal(&S3Options{
+		Endpoint:     DefaultS3Endpoint,
+		Region:       "eu-west-1",
+		PollInterval: DefaultS3PollInterval,
+	}, options)
+
+	for _, uri := range []string{
+		"s3://",
+		"s3:///prefix",
+		"s3://je?insecure=maybe",
+		"s3://je?poll=0s",
+		"file:///data",
+	} {
+		_, _, _, err := ParseS3URI(uri)
+		assert.Error(err, uri)
+	}
+}
+
+func TestInitData(t *testing.T) {
+	withGlobals(t)
+	assert := assert.New(t)
+
+	for _, uri := range []string{t.TempDir(), "file://" + t.TempDir()} {
+		d, err := InitData(uri)
+		require.NoError(t, err)
+		assert.IsType(&LocalData{}, d)
+	}
+
+	_, err := InitData("ftp://example.com/data")
+	assert.Error(err)
+}
+
+func TestS3UploadSpool(t *testing.T) {
+	assert := assert.New(t)
+
+	pr, pw := io.Pipe()
+	uploaded := make(chan []byte, 1)
+	go func() {
+		buf, _ := ioutil.ReadAll(pr)
+		uploaded <- buf
+	}()
+
+	up, err := newS3Upload(pw)
+	require.NoError(t, err)
+
+	read := func(offset, length int64) string {
+		r, err := up.reader(offset, length)
+		require.NoError(t, err)
+		defer r.Close()
+		buf, err := ioutil.ReadAll(r)
+		require.NoError(t, err)
+		return string(buf)
+	}
+
+	written := up.wait()
+	_, err = up.write([]byte("hello\nworld\n"))
+	require.NoError(t, err)
+	<-written
+
+	assert.Equal(int64(12), up.size())
+	assert.Equal("hello\nworld\n", read(0, -1))
+	assert.Equal("world", read(6, 5))
+	assert.Equal("", read(20, -1))
+
+	// Readers keep reading the spool once the upload has ended
+	r, err := up.reader(6, -1)
+	require.NoError(t, err)
+	defer r.Close()
+
+	pw.Close()
+	assert.Equal("hello\nworld\n", string(<-uploaded))
+	up.end()
+
+	buf, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal("world\n", string(buf))
+
+	_, err = up.reader(0, -1)
+	assert.True(os.IsNotExist(err))
+}
+
+// TestS3Data runs against the bucket given by $JE_S3_URI, e.g.
+// s3://je-test/data?endpoint=localhost:9000&insecure=1&path_style=1 with the
+// credentials in $MINIO_ROOT_USER and $MINIO_ROOT_PASSWORD
+func TestS3Data(t *testing.T) {
+	uri := os.Getenv("JE_S3_URI")
+	if uri == "" {
+		t.Skip("JE_S3_URI not set")
+	}
+
+	withGlobals(t)
+	assert := assert.New(t)
+
+	d, err := InitData(uri)
+	require.NoError(t, err)
+	require.IsType(t, &S3Data{}, d)
+
+	id := ID(time.Now().UnixNano())
+	t.Cleanup(func() { d.Delete(id) })
+
+	_, err = d.Size(id, DATA_OUTPUT)
+	assert.True(os.IsNotExist(err))
+	_, err = d.Read(id, DATA_OUTPUT)
+	assert.True(os.IsNotExist(err))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	lines, errors := d.Tail(id, DATA_OUTPUT, ctx)
+
+	w, err := d.Write(id, DATA_OUTPUT)
+	require.NoError(t, err)
+	_, err = w.Write([]byte("hello\nwor"))
+	require.NoError(t, err)
+
+	// What is being uploaded can be read and followed before it completes
+	size, err := d.Size(id, DATA_OUTPUT)
+	require.NoError(t, err)
+	assert.Equal(int64(9), size)
+	assert.Equal("hello\nwor", readTestData(t, id, DATA_OUTPUT))
+
+	nextLine := func() string {
+		select {
+		case line := <-lines:
+			return line
+		case err := <-errors:
+			require.NoError(t, err)
+		case <-time.After(10 * time.Second):
+			t.Fatal("timed out tailing data")
+		}
+		return ""
+	}
+	assert.Equal("hello", nextLine())
+
+	_, err = w.Write([]byte("ld\n"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	assert.Equal("world", nextLine())
+
+	// Once uploaded it is read from the bucket
+	assert.Equal("hello\nworld\n", readTestData(t, id, DATA_OUTPUT))
+	r, err := d.(RangeReader).ReadRange(id, DATA_OUTPUT, 6, 5)
+	require.NoError(t, err)
+	buf, err := ioutil.ReadAll(r)
+	r.Close()
+	require.NoError(t, err)
+	assert.Equal("world", string(buf))
+
+	w, err = d.WriteArtifact(id, "out/report.txt")
+	require.NoError(t, err)
+	_, err = w.Write([]byte("report"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	r, err = d.ReadArtifact(id, "out/report.txt")
+	require.NoError(t, err)
+	buf, err = ioutil.ReadAll(r)
+	r.Close()
+	require.NoError(t, err)
+	assert.Equal("report", string(buf))
+
+	require.NoError(t, d.Delete(id))
+	_, err = d.Size(id, DATA_OUTPUT)
+	assert.True(os.IsNotExist(err))
+	_, err = d.ReadArtifact(id, "out/report.txt")
+	assert.True(os.IsNotExist(err))
+}
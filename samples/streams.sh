@@ -0,0 +1,7 @@
+#!/bin/sh
+
+echo "out 1"
+sleep 0.1
+echo "err 1" >&2
+sleep 0.1
+echo "out 2"
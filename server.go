@@ -36,6 +36,9 @@ type Server struct {
 	// Worker Pool
 	pool *worker.Pool
 
+	// Dispatcher of jobs in a store shared with other instances
+	dispatcher *dispatcher
+
 	// Router
 	router *httprouter.Router
 
@@ -45,6 +48,9 @@ type Server struct {
 
 // ListenAndServe ...
 func (s *Server) ListenAndServe() {
+	if s.dispatcher != nil {
+		go s.dispatcher.Run()
+	}
 	log.Fatal(s.server.ListenAndServe())
 }
 
@@ -53,6 +59,9 @@ func (s *Server) AddRoute(method, path string, handler http.Handler) {
 }
 
 func (s *Server) Shutdown() {
+	if s.dispatcher != nil {
+		s.dispatcher.Stop()
+	}
 	if err := s.server.Shutdown(context.Background()); err != nil {
 		log.Errorf("error shutting down server: %v", err)
 	}
@@ -68,6 +77,35 @@ func (s *Server) initRoutes() {
 	s.router.POST("/close/:id", s.CloseHandler())
 	s.router.GET("/search", s.SearchHandler())
 	s.router.GET("/search/:id", s.SearchHandler())
+	s.router.GET("/stats", s.StatsHandler())
+	s.router.GET("/export", s.ExportHandler())
+	s.router.POST("/import", s.ImportHandler())
+
+	// v2 API
+	s.router.GET(APIPrefix+"/openapi.json", s.OpenAPIHandler())
+	s.router.GET(APIPrefix+"/jobs", s.ListJobsHandler())
+	s.router.POST(APIPrefix+"/jobs", s.CreateJobHandler())
+	s.router.GET(APIPrefix+"/jobs/:id", s.GetJobHandler())
+	s.router.DELETE(APIPrefix+"/jobs/:id", s.DeleteJobHandler())
+	s.router.GET(APIPrefix+"/jobs/:id/input", s.JobDataHandler(DATA_INPUT))
+	s.router.POST(APIPrefix+"/jobs/:id/input", s.WriteJobInputHandler())
+	s.router.DELETE(APIPrefix+"/jobs/:id/input", s.CloseJobInputHandler())
+	s.router.GET(APIPrefix+"/jobs/:id/output", s.JobDataHandler(DATA_OUTPUT))
+	s.router.GET(APIPrefix+"/jobs/:id/logs", s.JobDataHandler(DATA_LOGS))
+	s.router.GET(APIPrefix+"/jobs/:id/combined", s.JobCombinedHandler())
+	s.router.GET(APIPrefix+"/jobs/:id/artifacts", s.JobArtifactsHandler())
+	s.router.GET(APIPrefix+"/jobs/:id/artifacts/*name", s.JobArtifactHandler())
+	s.router.POST(APIPrefix+"/jobs/:id/signal", s.SignalJobHandler())
+	s.router.GET(APIPrefix+"/jobs/:id/events", s.JobEventsHandler())
+	s.router.POST(APIPrefix+"/pipelines", s.CreatePipelineHandler())
+	s.router.GET(APIPrefix+"/pipelines/:id", s.GetPipelineHandler())
+	s.router.GET(APIPrefix+"/stats", s.StatsHandler())
+
+	// Admin
+	s.router.GET("/admin/backup", s.BackupHandler())
+	s.router.POST("/admin/restore", s.RestoreHandler())
+	s.router.GET("/admin/index", s.IndexCheckHandler())
+	s.router.POST("/admin/reindex", s.ReindexHandler())
 }
 
 // NewServer ...
@@ -107,6 +145,15 @@ func NewServer(bind string, options *Options) *Server {
 		router: router,
 	}
 
+	// Jobs are only claimed by other instances if they can read their data
+	if claimer, ok := db.(Claimer); ok {
+		if sharedData(data) {
+			server.dispatcher = newDispatcher(claimer, server.pool, DefaultClaimInterval)
+		} else {
+			log.Warn("not sharing jobs with other instances as their data is local: use s3:// for -datadir to share them")
+		}
+	}
+
 	server.initRoutes()
 
 	return server
@@ -0,0 +1,534 @@
+package je
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/prologic/je/codec"
+)
+
+// sqlDialect abstracts the differences between the SQL databases used by
+// the SQL Store backends
+type sqlDialect interface {
+	// Placeholder returns the placeholder of the nth (1-based) argument
+	Placeholder(n int) string
+	// Time converts a time into the value stored in timestamp columns
+	Time(t time.Time) interface{}
+}
+
+// sqlColumns maps indexed fields to the columns of the jobs table
+var sqlColumns = map[string]string{
+	"name":        "name",
+	"worker":      "worker",
+	"interactive": "interactive",
+	"state":       "state",
+	"status":      "status",
+	"duration":    "duration",
+	"created":     "created",
+	"started":     "started",
+	"stopped":     "stopped",
+	"killed":      "killed",
+	"errored":     "errored",
+}
+
+// sqlQuery accumulates the conditions and arguments of a WHERE clause
+type sqlQuery struct {
+	dialect sqlDialect
+	args    []interface{}
+}
+
+func (q *sqlQuery) arg(v interface{}) string {
+	q.args = append(q.args, v)
+	return q.dialect.Placeholder(len(q.args))
+}
+
+// sqlTerm is a compiled query term of a single condition on a column
+type sqlTerm struct {
+	format string
+	arg    interface{}
+}
+
+func (q *sqlQuery) cond(t sqlTerm) string {
+	return fmt.Sprintf(t.format, q.arg(t.arg))
+}
+
+// compileQuery compiles the subset of the bleve query string syntax that
+// only consists of field terms such as +worker:w1 -state:4 duration:>=600
+// into a SQL condition. It returns false if q uses anything else (free text,
+// terms on tokenised fields such as name, fuzzy or regexp terms, ...) in
+// which case the caller should fall back to the search index.
+func compileQuery(q string, dialect sqlDialect, now time.Time) (string, []interface{}, bool) {
+	var must, mustNot, should []sqlTerm
+	for _, term := range splitQuery(rewriteQuery(q, now)) {
+		prefix := term[0]
+		if prefix == '+' || prefix == '-' {
+			term = term[1:]
+		}
+
+		t, ok := compileTerm(term, dialect)
+		if !ok {
+			return "", nil, false
+		}
+
+		switch prefix {
+		case '+':
+			must = append(must, t)
+		case '-':
+			mustNot = append(mustNot, t)
+		default:
+			should = append(should, t)
+		}
+	}
+
+	// Arguments are bound in the order conditions appear in the clause
+	query := &sqlQuery{dialect: dialect}
+
+	var conds []string
+	for _, t := range must {
+		conds = append(conds, query.cond(t))
+	}
+	for _, t := range mustNot {
+		conds = append(conds, fmt.Sprintf("NOT (%s)", query.cond(t)))
+	}
+	// As with bleve should terms are optional if there are must terms
+	if len(must) == 0 && len(should) > 0 {
+		var any []string
+		for _, t := range should {
+			any = append(any, query.cond(t))
+		}
+		conds = append(conds, fmt.Sprintf("(%s)", strings.Join(any, " OR ")))
+	}
+
+	if len(conds) == 0 {
+		return "1 = 1", nil, true
+	}
+
+	return strings.Join(conds, " AND "), query.args, true
+}
+
+func compileTerm(term string, dialect sqlDialect) (sqlTerm, bool) {
+	kv := strings.SplitN(term, ":", 2)
+	if len(kv) != 2 {
+		return sqlTerm{}, false
+	}
+
+	field, value := kv[0], kv[1]
+	column, ok := sqlColumns[field]
+	if !ok {
+		return sqlTerm{}, false
+	}
+
+	op := "="
+	for _, o := range []string{">=", "<=", ">", "<"} {
+		if strings.HasPrefix(value, o) {
+			op, value = o, value[len(o):]
+			break
+		}
+	}
+
+	if unquoted, ok := unquoteTerm(value); ok {
+		value = unquoted
+	}
+
+	format := column + " " + op + " %s"
+
+	switch field {
+	case "name":
+		// Names are tokenised by the search index, so that name:backup
+		// also finds "backup daily" and "Backup", which = cannot match
+		return sqlTerm{}, false
+	case "worker":
+		// Workers are indexed as keywords and only match exactly
+		if op != "=" || strings.ContainsAny(value, "*?~^") {
+			return sqlTerm{}, false
+		}
+		return sqlTerm{format, value}, true
+	case "interactive":
+		b, err := strconv.ParseBool(value)
+		if err != nil || op != "=" {
+			return sqlTerm{}, false
+		}
+		return sqlTerm{format, b}, true
+	case "state", "status", "duration":
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return sqlTerm{}, false
+		}
+		return sqlTerm{format, n}, true
+	default:
+		t, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return sqlTerm{}, false
+		}
+		return sqlTerm{format, dialect.Time(t)}, true
+	}
+}
+
+// queryReserved are the characters of the query string syntax that lose
+// their backslash when escaped in a quoted phrase
+const queryReserved = "+-=&|><!(){}[]^\"~*?:\\/ "
+
+// unquoteTerm returns the phrase quoted by s with its escapes read as bleve
+// reads them or false if s is not quoted
+func unquoteTerm(s string) (string, bool) {
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return s, false
+	}
+
+	var (
+		value   strings.Builder
+		escaped bool
+	)
+	for _, r := range s[1 : len(s)-1] {
+		switch {
+		case escaped:
+			escaped = false
+			if !strings.ContainsRune(queryReserved, r) {
+				value.WriteRune('\\')
+			}
+			value.WriteRune(r)
+		case r == '\\':
+			escaped = true
+		default:
+			value.WriteRune(r)
+		}
+	}
+	return value.String(), true
+}
+
+// splitQuery splits a query string into terms on whitespace outside quotes
+func splitQuery(q string) (terms []string) {
+	var (
+		term            strings.Builder
+		quoted, escaped bool
+	)
+
+	for _, r := range q {
+		switch {
+		case escaped:
+			escaped = false
+			term.WriteRune(r)
+		case r == '\\':
+			escaped = true
+			term.WriteRune(r)
+		case r == '"':
+			quoted = !quoted
+			term.WriteRune(r)
+		case !quoted && (r == ' ' || r == '\t' || r == '\n'):
+			if term.Len() > 0 {
+				terms = append(terms, term.String())
+				term.Reset()
+			}
+		default:
+			term.WriteRune(r)
+		}
+	}
+
+	if term.Len() > 0 {
+		terms = append(terms, term.String())
+	}
+
+	return
+}
+
+// sqlSearch builds the SELECT of the ids of jobs matching where in the order
+// and page given by options along with the count of all matches. Cursors are
+// the sort column value and id of the last row of the previous page.
+func sqlSearch(dialect sqlDialect, where string, args []interface{}, options *SearchOptions) (query, count string, queryArgs []interface{}, err error) {
+	if options == nil {
+		options = &SearchOptions{}
+	}
+
+	order, err := options.sortOrder()
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	column := strings.TrimPrefix(order[0], "-")
+	dir, cmp := "ASC", ">"
+	if strings.HasPrefix(order[0], "-") {
+		dir, cmp = "DESC", "<"
+	}
+
+	count = fmt.Sprintf("SELECT COUNT(*) FROM jobs WHERE %s", where)
+
+	q := &sqlQuery{dialect: dialect, args: append([]interface{}{}, args...)}
+	if options.Cursor != "" {
+		after, err := decodeCursor(options.Cursor)
+		if err != nil || len(after) != 2 {
+			return "", "", nil, fmt.Errorf("invalid cursor: %s", options.Cursor)
+		}
+		where = fmt.Sprintf(
+			"(%s) AND (%s, id) %s (%s, %s)",
+			where, column, cmp, q.arg(sqlCursorArg(after[0])), q.arg(SafeParseUint64(after[1], 0)),
+		)
+	}
+
+	query = fmt.Sprintf("SELECT id, %s FROM jobs WHERE %s ORDER BY %s %s, id %s", column, where, column, dir, dir)
+	if options.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", options.Limit)
+		if options.Cursor == "" && options.Offset > 0 {
+			query += fmt.Sprintf(" OFFSET %d", options.Offset)
+		}
+	} else if options.Cursor == "" && options.Offset > 0 {
+		query += fmt.Sprintf(" LIMIT %d OFFSET %d", math.MaxInt64, options.Offset)
+	}
+
+	return query, count, q.args, nil
+}
+
+// searchSQL performs a search of the jobs table returning a result with the
+// jobs filled in by find
+func searchSQL(db *sql.DB, dialect sqlDialect, where string, args []interface{}, options *SearchOptions, find func(ids ...ID) ([]*Job, error)) (*SearchResult, error) {
+	query, count, queryArgs, err := sqlSearch(dialect, where, args, options)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &SearchResult{}
+	if err := db.QueryRow(count, args...).Scan(&res.Total); err != nil {
+		log.Errorf("error counting jobs: %s", err)
+		return nil, err
+	}
+
+	rows, err := db.Query(query, queryArgs...)
+	if err != nil {
+		log.Errorf("error searching jobs: %s", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var (
+		ids  []ID
+		last interface{}
+	)
+	for rows.Next() {
+		var id ID
+		if err := rows.Scan(&id, &last); err != nil {
+			log.Errorf("error scanning job: %s", err)
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if n := len(ids); n > 0 && options != nil && n == options.Limit {
+		res.Next = encodeCursor([]string{sqlCursorValue(last), ids[n-1].String()})
+	}
+
+	res.Jobs, err = find(ids...)
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// sqlCursorArg converts a value of a cursor back into a query argument
+func sqlCursorArg(s string) interface{} {
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return n
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f
+	}
+	return s
+}
+
+func sqlCursorValue(v interface{}) string {
+	switch v := v.(type) {
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// sqlGetMeta returns the value of a key in the meta table or "" if not set
+func sqlGetMeta(db *sql.DB, dialect sqlDialect, key string) (string, error) {
+	var value string
+	err := db.QueryRow(
+		fmt.Sprintf("SELECT value FROM meta WHERE key = %s", dialect.Placeholder(1)), key,
+	).Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return value, err
+}
+
+// sqlSetMeta sets the value of a key in the meta table
+func sqlSetMeta(db sqlExecer, dialect sqlDialect, key, value string) error {
+	_, err := db.Exec(
+		fmt.Sprintf(
+			"INSERT INTO meta (key, value) VALUES (%s, %s) ON CONFLICT (key) DO UPDATE SET value = excluded.value",
+			dialect.Placeholder(1), dialect.Placeholder(2),
+		),
+		key, value,
+	)
+	return err
+}
+
+// sqlEmpty returns true if the jobs table is empty
+func sqlEmpty(db *sql.DB) (bool, error) {
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM (SELECT id FROM jobs LIMIT 1) AS t").Scan(&n); err != nil {
+		return false, err
+	}
+	return n == 0, nil
+}
+
+// sqlExecer is satisfied by both *sql.DB and *sql.Tx
+type sqlExecer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// sqlQueryer is satisfied by both *sql.DB and *sql.Tx
+type sqlQueryer interface {
+	sqlExecer
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// sqlAppendEvent records the event of saving job in the events table if its
+// state changed since it was last saved
+func sqlAppendEvent(db sqlQueryer, dialect sqlDialect, job *Job) error {
+	var (
+		last  *JobEvent
+		state int
+	)
+
+	err := db.QueryRow(
+		fmt.Sprintf("SELECT to_state FROM events WHERE job = %s ORDER BY id DESC LIMIT 1", dialect.Placeholder(1)),
+		int64(job.ID),
+	).Scan(&state)
+	if err == nil {
+		last = &JobEvent{To: State(state)}
+	} else if err != sql.ErrNoRows {
+		return err
+	}
+
+	event := nextEvent(job, last)
+	if event == nil {
+		return nil
+	}
+
+	buf, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(
+		fmt.Sprintf(
+			"INSERT INTO events (job, from_state, to_state, at, data) VALUES (%s, %s, %s, %s, %s)",
+			dialect.Placeholder(1), dialect.Placeholder(2), dialect.Placeholder(3),
+			dialect.Placeholder(4), dialect.Placeholder(5),
+		),
+		int64(job.ID), int(event.From), int(event.To), dialect.Time(event.At), string(buf),
+	)
+	return err
+}
+
+// sqlEvents returns the events of a job in the events table
+func sqlEvents(db *sql.DB, dialect sqlDialect, id ID) ([]*JobEvent, error) {
+	rows, err := db.Query(
+		fmt.Sprintf("SELECT data FROM events WHERE job = %s ORDER BY id", dialect.Placeholder(1)),
+		int64(id),
+	)
+	if err != nil {
+		log.Errorf("error fetching events of job #%d: %s", id, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []*JobEvent{}
+	for rows.Next() {
+		var buf string
+		if err := rows.Scan(&buf); err != nil {
+			return nil, err
+		}
+
+		var event JobEvent
+		if err := json.Unmarshal([]byte(buf), &event); err != nil {
+			log.Errorf("error deserializing events of job #%d: %s", id, err)
+			return nil, err
+		}
+		events = append(events, &event)
+	}
+
+	return events, rows.Err()
+}
+
+// recodeSQL rewrites the data of every job in the jobs table from one codec
+// to another and records the new codec in a single transaction
+func recodeSQL(db *sql.DB, dialect sqlDialect, from, to codec.MarshalUnmarshaler) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		log.Errorf("error starting transaction: %s", err)
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query("SELECT id, data FROM jobs")
+	if err != nil {
+		log.Errorf("error querying jobs: %s", err)
+		return 0, err
+	}
+
+	data := make(map[int64][]byte)
+	for rows.Next() {
+		var (
+			id  int64
+			buf []byte
+		)
+		if err := rows.Scan(&id, &buf); err != nil {
+			rows.Close()
+			log.Errorf("error scanning job: %s", err)
+			return 0, err
+		}
+		data[id] = buf
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	update := fmt.Sprintf(
+		"UPDATE jobs SET data = %s WHERE id = %s",
+		dialect.Placeholder(1), dialect.Placeholder(2),
+	)
+	for id, buf := range data {
+		buf, err := recodeJob(buf, from, to)
+		if err != nil {
+			log.Errorf("error recoding job #%d: %s", id, err)
+			return 0, err
+		}
+		if _, err := tx.Exec(update, buf, id); err != nil {
+			log.Errorf("error saving job #%d: %s", id, err)
+			return 0, err
+		}
+	}
+
+	if err := sqlSetMeta(tx, dialect, "codec", to.Name()); err != nil {
+		log.Errorf("error recording codec: %s", err)
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Errorf("error committing recode: %s", err)
+		return 0, err
+	}
+
+	return len(data), nil
+}
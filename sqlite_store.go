@@ -0,0 +1,411 @@
+package je
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	// SQLite driver (pure Go)
+	_ "modernc.org/sqlite"
+
+	"github.com/prologic/je/codec"
+)
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS meta (
+	key   TEXT PRIMARY KEY,
+	value TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS ids (
+	id INTEGER PRIMARY KEY AUTOINCREMENT
+);
+
+CREATE TABLE IF NOT EXISTS jobs (
+	id          INTEGER PRIMARY KEY,
+	name        TEXT    NOT NULL,
+	worker      TEXT    NOT NULL DEFAULT '',
+	interactive INTEGER NOT NULL DEFAULT 0,
+	state       INTEGER NOT NULL DEFAULT 0,
+	status      INTEGER NOT NULL DEFAULT 0,
+	duration    REAL    NOT NULL DEFAULT 0,
+	created     INTEGER NOT NULL DEFAULT 0,
+	started     INTEGER NOT NULL DEFAULT 0,
+	stopped     INTEGER NOT NULL DEFAULT 0,
+	killed      INTEGER NOT NULL DEFAULT 0,
+	errored     INTEGER NOT NULL DEFAULT 0,
+	data        BLOB    NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS jobs_state ON jobs (state, created);
+CREATE INDEX IF NOT EXISTS jobs_name ON jobs (name, created);
+CREATE INDEX IF NOT EXISTS jobs_created ON jobs (created);
+CREATE INDEX IF NOT EXISTS jobs_started ON jobs (started);
+CREATE INDEX IF NOT EXISTS jobs_stopped ON jobs (stopped);
+
+CREATE TABLE IF NOT EXISTS events (
+	id         INTEGER PRIMARY KEY AUTOINCREMENT,
+	job        INTEGER NOT NULL,
+	from_state INTEGER NOT NULL,
+	to_state   INTEGER NOT NULL,
+	at         INTEGER NOT NULL,
+	data       TEXT    NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS events_job ON events (job, id);
+`
+
+// SQLiteStore stores jobs in a SQLite database with indexed columns for
+// filtering, sorting and paging. Queries that cannot be expressed in SQL
+// (such as free text over job output) fall back to the search index.
+type SQLiteStore struct {
+	path  string
+	db    *sql.DB
+	index *Indexer
+	codec codec.MarshalUnmarshaler
+}
+
+// Placeholder implements sqlDialect
+func (store *SQLiteStore) Placeholder(n int) string {
+	return "?"
+}
+
+// Time implements sqlDialect storing times as nanoseconds since the epoch
+func (store *SQLiteStore) Time(t time.Time) interface{} {
+	if t.IsZero() {
+		return int64(0)
+	}
+	return t.UnixNano()
+}
+
+func (store *SQLiteStore) Close() error {
+	if err := store.index.Close(); err != nil {
+		log.Errorf("error closing index: %s", err)
+	}
+	return store.db.Close()
+}
+
+func (store *SQLiteStore) NextId() ID {
+	res, err := store.db.Exec("INSERT INTO ids DEFAULT VALUES")
+	if err != nil {
+		log.Errorf("error generating new job id: %s", err)
+		return ID(0)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		log.Errorf("error generating new job id: %s", err)
+		return ID(0)
+	}
+
+	// AUTOINCREMENT never reuses ids so previous ones need not be kept
+	if _, err := store.db.Exec("DELETE FROM ids WHERE id < ?", id); err != nil {
+		log.Warnf("error pruning job ids: %s", err)
+	}
+
+	return ID(id)
+}
+
+func (store *SQLiteStore) Save(job *Job) error {
+	if job.ID == ID(0) {
+		job.ID = store.NextId()
+	} else {
+		// Reserve IDs of jobs saved with one, e.g. when restoring
+		_, err := store.db.Exec(
+			"INSERT INTO ids (id) SELECT ?1 WHERE ?1 > (SELECT COALESCE(MAX(id), 0) FROM ids)",
+			uint64(job.ID),
+		)
+		if err != nil {
+			log.Errorf("error reserving job id #%d: %s", job.ID, err)
+			return err
+		}
+	}
+
+	buf, err := store.codec.Marshal(job)
+	if err != nil {
+		log.Errorf("error serializing job: %s", err)
+		return err
+	}
+
+	tx, err := store.db.Begin()
+	if err != nil {
+		log.Errorf("error starting transaction: %s", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO jobs (
+			id, name, worker, interactive, state, status, duration,
+			created, started, stopped, killed, errored, data
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			name = excluded.name,
+			worker = excluded.worker,
+			interactive = excluded.interactive,
+			state = excluded.state,
+			status = excluded.status,
+			duration = excluded.duration,
+			created = excluded.created,
+			started = excluded.started,
+			stopped = excluded.stopped,
+			killed = excluded.killed,
+			errored = excluded.errored,
+			data = excluded.data`,
+		uint64(job.ID), job.Name, job.Worker, job.Interactive,
+		int(job.State), job.Status, job.Duration().Seconds(),
+		store.Time(job.CreatedAt), store.Time(job.StartedAt),
+		store.Time(job.StoppedAt), store.Time(job.KilledAt),
+		store.Time(job.ErroredAt), buf,
+	)
+	if err == nil {
+		err = sqlAppendEvent(tx, store, job)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Errorf("error saving job: %s", err)
+		return err
+	}
+
+	return store.index.Index(job)
+}
+
+func (store *SQLiteStore) Delete(id ID) error {
+	res, err := store.db.Exec("DELETE FROM jobs WHERE id = ?", uint64(id))
+	if err != nil {
+		log.Errorf("error deleting job #%d: %s", id, err)
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return &KeyError{id, ErrNotExist}
+	}
+
+	if _, err := store.db.Exec("DELETE FROM events WHERE job = ?", uint64(id)); err != nil {
+		log.Errorf("error deleting events of job #%d: %s", id, err)
+		return err
+	}
+
+	return store.index.Delete(id)
+}
+
+func (store *SQLiteStore) Get(id ID) (*Job, error) {
+	var buf []byte
+
+	err := store.db.QueryRow("SELECT data FROM jobs WHERE id = ?", uint64(id)).Scan(&buf)
+	if err == sql.ErrNoRows {
+		return nil, &KeyError{id, ErrNotExist}
+	} else if err != nil {
+		log.Errorf("error fetching job #%d: %s", id, err)
+		return nil, err
+	}
+
+	var job Job
+	if err := store.codec.Unmarshal(buf, &job); err != nil {
+		log.Errorf("error deserializing job #%d: %s", id, err)
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+func (store *SQLiteStore) Find(ids ...ID) ([]*Job, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = uint64(id)
+	}
+
+	query := fmt.Sprintf(
+		"SELECT data FROM jobs WHERE id IN (%s)",
+		strings.TrimSuffix(strings.Repeat("?,", len(ids)), ","),
+	)
+
+	found, err := store.query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return orderJobs(ids, found), nil
+}
+
+func (store *SQLiteStore) All() ([]*Job, error) {
+	return store.query("SELECT data FROM jobs ORDER BY id")
+}
+
+func (store *SQLiteStore) Events(id ID) ([]*JobEvent, error) {
+	return sqlEvents(store.db, store, id)
+}
+
+func (store *SQLiteStore) indexer() *Indexer {
+	return store.index
+}
+
+func (store *SQLiteStore) Search(q string, options *SearchOptions) (*SearchResult, error) {
+	if options == nil || !options.Highlight {
+		if where, args, ok := compileQuery(q, store, time.Now()); ok {
+			return searchSQL(store.db, store, where, args, options, store.Find)
+		}
+	}
+
+	ids, res, err := store.index.Search(q, options)
+	if err != nil {
+		return nil, err
+	}
+
+	res.Jobs, err = store.Find(ids...)
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (store *SQLiteStore) query(query string, args ...interface{}) (jobs []*Job, err error) {
+	rows, err := store.db.Query(query, args...)
+	if err != nil {
+		log.Errorf("error querying jobs: %s", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var buf []byte
+		if err := rows.Scan(&buf); err != nil {
+			log.Errorf("error scanning job: %s", err)
+			return nil, err
+		}
+
+		var job Job
+		if err := store.codec.Unmarshal(buf, &job); err != nil {
+			log.Errorf("error deserializing job: %s", err)
+			return nil, err
+		}
+		jobs = append(jobs, &job)
+	}
+
+	return jobs, rows.Err()
+}
+
+// orderJobs returns the jobs in the order of ids skipping missing ones
+func orderJobs(ids []ID, jobs []*Job) []*Job {
+	byID := make(map[ID]*Job, len(jobs))
+	for _, job := range jobs {
+		byID[job.ID] = job
+	}
+
+	ordered := make([]*Job, 0, len(ids))
+	for _, id := range ids {
+		if job, ok := byID[id]; ok {
+			ordered = append(ordered, job)
+		}
+	}
+	return ordered
+}
+
+// Snapshot implements Snapshotter with a VACUUM INTO a temporary database
+func (store *SQLiteStore) Snapshot(fn func(name string, size int64, r io.Reader) error) error {
+	dir, err := ioutil.TempDir("", "je-snapshot")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	snapshot := filepath.Join(dir, filepath.Base(store.path))
+	if _, err := store.db.Exec("VACUUM INTO ?", snapshot); err != nil {
+		log.Errorf("error snapshotting %s: %s", store.path, err)
+		return err
+	}
+
+	f, err := os.Open(snapshot)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	return fn(filepath.Base(store.path), fi.Size(), f)
+}
+
+func (store *SQLiteStore) Codec() codec.MarshalUnmarshaler {
+	return store.codec
+}
+
+// Recode implements Recoder rewriting all jobs in a single transaction
+func (store *SQLiteStore) Recode(to codec.MarshalUnmarshaler) (int, error) {
+	n, err := recodeSQL(store.db, store, store.codec, to)
+	if err != nil {
+		return 0, err
+	}
+	store.codec = to
+	return n, nil
+}
+
+func (store *SQLiteStore) getMeta(key string) (string, error) {
+	return sqlGetMeta(store.db, store, key)
+}
+
+func (store *SQLiteStore) setMeta(key, value string) error {
+	return sqlSetMeta(store.db, store, key, value)
+}
+
+func NewSQLiteStore(dbpath string, options *StoreOptions) (Store, error) {
+	if options == nil {
+		options = &StoreOptions{}
+	}
+
+	db, err := sql.Open("sqlite", dbpath)
+	if err != nil {
+		log.Errorf("error opening store %s: %s", dbpath, err)
+		return nil, err
+	}
+
+	// SQLite only supports a single writer
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		log.Errorf("error creating schema in %s: %s", dbpath, err)
+		db.Close()
+		return nil, err
+	}
+
+	store := &SQLiteStore{path: dbpath, db: db}
+
+	empty, err := sqlEmpty(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	store.codec, err = openCodec(store, options.Codec, empty)
+	if err != nil {
+		log.Errorf("error opening store %s: %s", dbpath, err)
+		db.Close()
+		return nil, err
+	}
+
+	store.index, err = NewIndexer(options.indexPath(path.Join(path.Dir(dbpath), "index.db")))
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return store, nil
+}
@@ -0,0 +1,114 @@
+package je
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLiteStore(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "je-sqlite")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	store, err := NewSQLiteStore(filepath.Join(dir, "je.db"), nil)
+	require.NoError(t, err)
+	defer store.Close()
+
+	now := time.Now().Truncate(time.Second)
+	for i := 1; i <= 5; i++ {
+		job := &Job{
+			ID:        store.NextId(),
+			Name:      "sqlite",
+			State:     STATE_STOPPED,
+			Status:    i % 2,
+			CreatedAt: now.Add(time.Duration(i) * time.Hour),
+			StartedAt: now,
+			StoppedAt: now.Add(time.Duration(i) * time.Minute),
+		}
+		require.NoError(t, store.Save(job))
+		assert.Equal(ID(i), job.ID)
+	}
+
+	job, err := store.Get(ID(3))
+	assert.NoError(err)
+	assert.Equal("sqlite", job.Name)
+	assert.True(job.CreatedAt.Equal(now.Add(3 * time.Hour)))
+
+	_, err = store.Get(ID(42))
+	assert.IsType(&KeyError{}, err)
+
+	jobs, err := store.Find(ID(4), ID(42), ID(2))
+	assert.NoError(err)
+	require.Len(t, jobs, 2)
+	assert.Equal(ID(4), jobs[0].ID)
+	assert.Equal(ID(2), jobs[1].ID)
+
+	res, err := store.Search("+name:sqlite +status:1 +duration:>90", &SearchOptions{Sort: "duration", Order: "desc"})
+	assert.NoError(err)
+	assert.Equal(uint64(2), res.Total)
+	require.Len(t, res.Jobs, 2)
+	assert.Equal(ID(5), res.Jobs[0].ID)
+	assert.Equal(ID(3), res.Jobs[1].ID)
+
+	var ids []ID
+	options := &SearchOptions{Limit: 2, Sort: "created", Order: "desc"}
+	for {
+		res, err := store.Search("name:sqlite", options)
+		require.NoError(t, err)
+		for _, job := range res.Jobs {
+			ids = append(ids, job.ID)
+		}
+		if res.Next == "" {
+			break
+		}
+		options.Cursor = res.Next
+	}
+	assert.Equal([]ID{5, 4, 3, 2, 1}, ids)
+
+	res, err = store.Search("created:>-2h", &SearchOptions{Offset: 1})
+	assert.NoError(err)
+	assert.Len(res.Jobs, 4)
+
+	assert.NoError(store.Delete(ID(1)))
+	assert.Error(store.Delete(ID(1)))
+
+	all, err := store.All()
+	assert.NoError(err)
+	assert.Len(all, 4)
+}
+
+func TestCompileQuery(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)
+	dialect := &SQLiteStore{}
+
+	where, args, ok := compileQuery(`+worker:w1 -state:4 +created:>-24h`, dialect, now)
+	assert.True(ok)
+	assert.Equal(`worker = ? AND created > ? AND NOT (state = ?)`, where)
+	assert.Equal([]interface{}{"w1", now.Add(-24 * time.Hour).UnixNano(), 4.0}, args)
+
+	where, _, ok = compileQuery(`worker:foo worker:bar`, dialect, now)
+	assert.True(ok)
+	assert.Equal(`(worker = ? OR worker = ?)`, where)
+
+	// Escaped quotes do not end quoted values
+	where, args, ok = compileQuery(`+worker:"a\" +state:1" +status:0`, dialect, now)
+	assert.True(ok)
+	assert.Equal(`worker = ? AND status = ?`, where)
+	assert.Equal([]interface{}{`a" +state:1`, 0.0}, args)
+
+	// Free text, data, patterns and tokenised names are left to the index
+	for _, q := range []string{`hello`, `logs:"connection refused"`, `worker:w*`, `name:backup`} {
+		_, _, ok := compileQuery(q, dialect, now)
+		assert.False(ok, q)
+	}
+}
@@ -41,6 +41,26 @@ func ParseState(s string) State {
 	}
 }
 
+// Active returns true if the job has not yet completed
+func (s State) Active() bool {
+	switch s {
+	case STATE_CREATED, STATE_WAITING, STATE_RUNNING:
+		return true
+	default:
+		return false
+	}
+}
+
+// Done returns true if the job has stopped, been killed or errored
+func (s State) Done() bool {
+	switch s {
+	case STATE_STOPPED, STATE_KILLED, STATE_ERRORED:
+		return true
+	default:
+		return false
+	}
+}
+
 func (s State) String() string {
 	switch s {
 	case STATE_CREATED:
@@ -0,0 +1,114 @@
+package je
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// DefaultStatsHours is the number of hours covered by the histogram of
+// created jobs if not otherwise given
+const DefaultStatsHours = 24
+
+// Stats are aggregate statistics over a set of jobs
+type Stats struct {
+	Total   int                   `json:"total"`
+	States  map[string]int        `json:"states"`
+	Workers map[string]int        `json:"workers"`
+	Names   map[string]*NameStats `json:"names"`
+	Hourly  []*HourStats          `json:"hourly"`
+}
+
+// NameStats are statistics of all jobs with the same name. Durations are
+// in seconds and only consider completed jobs.
+type NameStats struct {
+	Count       int     `json:"count"`
+	Succeeded   int     `json:"succeeded"`
+	Failed      int     `json:"failed"`
+	SuccessRate float64 `json:"success_rate"`
+	P50         float64 `json:"p50"`
+	P95         float64 `json:"p95"`
+
+	durations []float64
+}
+
+// HourStats is the number of jobs created in the hour starting at Hour
+type HourStats struct {
+	Hour  time.Time `json:"hour"`
+	Count int       `json:"count"`
+}
+
+// Succeeded returns true if the job stopped with a zero exit status. It does
+// not lock the job, which must be a snapshot or locked.
+func (j *Job) Succeeded() bool {
+	return j.State == STATE_STOPPED && j.Status == 0
+}
+
+// NewStats computes statistics over jobs with a histogram of the jobs
+// created in each of the given number of hours up to now. The jobs are read
+// from snapshots as they may still be running.
+func NewStats(jobs []*Job, now time.Time, hours int) *Stats {
+	stats := &Stats{
+		Total:   len(jobs),
+		States:  make(map[string]int),
+		Workers: make(map[string]int),
+		Names:   make(map[string]*NameStats),
+	}
+
+	end := now.Truncate(time.Hour)
+	start := end.Add(-time.Duration(hours-1) * time.Hour)
+	for i := 0; i < hours; i++ {
+		stats.Hourly = append(stats.Hourly, &HourStats{Hour: start.Add(time.Duration(i) * time.Hour)})
+	}
+
+	for _, job := range snapshotJobs(jobs) {
+		stats.States[job.State.String()]++
+		if job.Worker != "" {
+			stats.Workers[job.Worker]++
+		}
+
+		ns, ok := stats.Names[job.Name]
+		if !ok {
+			ns = &NameStats{}
+			stats.Names[job.Name] = ns
+		}
+		ns.Count++
+
+		if job.State.Done() {
+			if job.Succeeded() {
+				ns.Succeeded++
+			} else {
+				ns.Failed++
+			}
+			ns.durations = append(ns.durations, job.Duration().Seconds())
+		}
+
+		hour := job.CreatedAt.Truncate(time.Hour)
+		if !hour.Before(start) && !hour.After(end) {
+			stats.Hourly[int(hour.Sub(start)/time.Hour)].Count++
+		}
+	}
+
+	for _, ns := range stats.Names {
+		if done := ns.Succeeded + ns.Failed; done > 0 {
+			ns.SuccessRate = float64(ns.Succeeded) / float64(done)
+		}
+		sort.Float64s(ns.durations)
+		ns.P50 = percentile(ns.durations, 0.50)
+		ns.P95 = percentile(ns.durations, 0.95)
+	}
+
+	return stats
+}
+
+// percentile returns the nearest-rank percentile p of the sorted values
+func percentile(values []float64, p float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p*float64(len(values)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return values[rank]
+}
@@ -0,0 +1,60 @@
+package je
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewStats(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Date(2020, 5, 1, 12, 30, 0, 0, time.UTC)
+
+	job := func(name string, state State, status int, created time.Time, d time.Duration) *Job {
+		return &Job{
+			Name:      name,
+			Worker:    "w1",
+			State:     state,
+			Status:    status,
+			CreatedAt: created,
+			StartedAt: created,
+			StoppedAt: created.Add(d),
+		}
+	}
+
+	jobs := []*Job{
+		job("backup", STATE_STOPPED, 0, now.Add(-3*time.Hour), 10*time.Second),
+		job("backup", STATE_STOPPED, 0, now.Add(-2*time.Hour), 20*time.Second),
+		job("backup", STATE_STOPPED, 1, now.Add(-2*time.Hour), 30*time.Second),
+		job("backup", STATE_STOPPED, 0, now.Add(-48*time.Hour), 40*time.Second),
+		job("report", STATE_RUNNING, 0, now, 0),
+	}
+
+	stats := NewStats(jobs, now, 4)
+
+	assert.Equal(5, stats.Total)
+	assert.Equal(map[string]int{"STOPPED": 4, "RUNNING": 1}, stats.States)
+	assert.Equal(map[string]int{"w1": 5}, stats.Workers)
+
+	backup := stats.Names["backup"]
+	assert.Equal(4, backup.Count)
+	assert.Equal(3, backup.Succeeded)
+	assert.Equal(1, backup.Failed)
+	assert.Equal(0.75, backup.SuccessRate)
+	assert.Equal(20.0, backup.P50)
+	assert.Equal(40.0, backup.P95)
+
+	report := stats.Names["report"]
+	assert.Equal(1, report.Count)
+	assert.Equal(0.0, report.SuccessRate)
+
+	assert.Len(stats.Hourly, 4)
+	assert.Equal(time.Date(2020, 5, 1, 9, 0, 0, 0, time.UTC), stats.Hourly[0].Hour)
+	var counts []int
+	for _, h := range stats.Hourly {
+		counts = append(counts, h.Count)
+	}
+	assert.Equal([]int{1, 2, 0, 1}, counts)
+}
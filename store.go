@@ -4,6 +4,7 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"strings"
 	"sync"
 )
 
@@ -53,8 +54,70 @@ type Store interface {
 	Close() error
 	NextId() ID
 	Save(job *Job) error
+	Delete(id ID) error
 	Get(id ID) (*Job, error)
 	Find(id ...ID) ([]*Job, error)
 	All() ([]*Job, error)
-	Search(q string) ([]*Job, error)
+	Search(q string, options *SearchOptions) (*SearchResult, error)
+	// Events returns the state transitions of a job in the order they
+	// happened. Events are deleted along with their job.
+	Events(id ID) ([]*JobEvent, error)
+}
+
+// Claimer is implemented by stores shared between several je instances.
+// Claim atomically marks the oldest waiting non-interactive job as running
+// on worker so no other instance can claim it and returns nil if there are
+// none waiting.
+type Claimer interface {
+	Claim(worker string) (*Job, error)
+}
+
+// SearchOptions controls the order and paging of search results
+type SearchOptions struct {
+	// Limit is the maximum number of jobs to return (0 for no limit)
+	Limit int
+	// Offset is the number of matching jobs to skip
+	Offset int
+	// Cursor continues a previous search after the last job it returned
+	// and takes precedence over Offset
+	Cursor string
+	// Sort is one of created, started, stopped, duration, status or state
+	Sort string
+	// Order is either asc or desc
+	Order string
+	// Highlight returns fragments of the output and logs matching the query
+	Highlight bool
+}
+
+func (o *SearchOptions) sortOrder() ([]string, error) {
+	sort := o.Sort
+	if sort == "" {
+		sort = "created"
+	}
+
+	field, ok := sortFields[sort]
+	if !ok {
+		return nil, fmt.Errorf("invalid sort: %s", o.Sort)
+	}
+
+	switch strings.ToLower(o.Order) {
+	case "", "asc":
+		return []string{field, "_id"}, nil
+	case "desc":
+		return []string{"-" + field, "-_id"}, nil
+	default:
+		return nil, fmt.Errorf("invalid order: %s", o.Order)
+	}
+}
+
+// SearchResult is a page of jobs returned by Search
+type SearchResult struct {
+	Jobs []*Job
+	// Total is the number of matching jobs across all pages
+	Total uint64
+	// Next is the cursor of the next page or empty if this is the last page
+	Next string
+	// Highlights are the matching fragments of each job by field if
+	// requested
+	Highlights map[ID]map[string][]string
 }
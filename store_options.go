@@ -0,0 +1,141 @@
+package je
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/prologic/je/codec"
+	"github.com/prologic/je/codec/json"
+	"github.com/prologic/je/codec/msgpack"
+)
+
+// DefaultCodec is the codec of new stores created without one and of stores
+// created before the codec was recorded in them
+var DefaultCodec codec.MarshalUnmarshaler = json.Codec
+
+// codecs are the codecs jobs can be stored with. The gob codec is not among
+// them as it cannot encode the lock embedded in a Job.
+var codecs = map[string]codec.MarshalUnmarshaler{
+	json.Codec.Name():    json.Codec,
+	msgpack.Codec.Name(): msgpack.Codec,
+}
+
+// ParseCodec returns the codec with the given name
+func ParseCodec(name string) (codec.MarshalUnmarshaler, error) {
+	if c, ok := codecs[strings.ToLower(name)]; ok {
+		return c, nil
+	}
+
+	var names []string
+	for name := range codecs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return nil, fmt.Errorf("unsupported codec %q (expected one of %s)", name, strings.Join(names, ", "))
+}
+
+// StoreOptions are options common to the persistent stores
+type StoreOptions struct {
+	// Codec serializes jobs. If nil the codec recorded in the store is used
+	// or DefaultCodec for new stores. Opening a store with a codec other than
+	// the one it was created with is an error; see Recoder.
+	Codec codec.MarshalUnmarshaler
+
+	// IndexPath is where the search index is kept. It defaults to index.db
+	// next to the store's database or to an in-memory index for stores
+	// without a local database.
+	IndexPath string
+}
+
+// ParseStoreOptions parses the store options in the query of a db uri, e.g.
+// bolt:///data/je.db?codec=msgpack&index=/data/index.db
+func ParseStoreOptions(qs url.Values) (*StoreOptions, error) {
+	options := &StoreOptions{IndexPath: qs.Get("index")}
+
+	if name := qs.Get("codec"); name != "" {
+		c, err := ParseCodec(name)
+		if err != nil {
+			return nil, err
+		}
+		options.Codec = c
+	}
+
+	return options, nil
+}
+
+// indexPath returns the configured index path or def
+func (options *StoreOptions) indexPath(def string) string {
+	if options != nil && options.IndexPath != "" {
+		return options.IndexPath
+	}
+	return def
+}
+
+// Recoder is implemented by stores that serialize jobs with a codec so that
+// existing records can be rewritten with another one
+type Recoder interface {
+	// Codec returns the codec the store serializes jobs with
+	Codec() codec.MarshalUnmarshaler
+	// Recode rewrites every job with the given codec, records it as the
+	// store's codec and returns the number of jobs rewritten
+	Recode(to codec.MarshalUnmarshaler) (int, error)
+}
+
+// metaStore is implemented by stores that record metadata about themselves
+// such as their codec
+type metaStore interface {
+	// getMeta returns the value of key or "" if it is not set
+	getMeta(key string) (string, error)
+	setMeta(key, value string) error
+}
+
+// openCodec returns the codec of a store, recording it if the store has no
+// codec recorded yet. Stores that are not empty and have no codec recorded
+// were created before codecs were recorded and use DefaultCodec.
+func openCodec(store metaStore, requested codec.MarshalUnmarshaler, empty bool) (codec.MarshalUnmarshaler, error) {
+	name, err := store.getMeta("codec")
+	if err != nil {
+		return nil, err
+	}
+
+	if name == "" {
+		name = DefaultCodec.Name()
+		if empty && requested != nil {
+			name = requested.Name()
+		}
+		if err := store.setMeta("codec", name); err != nil {
+			return nil, err
+		}
+	}
+
+	c, err := ParseCodec(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if requested != nil && requested.Name() != c.Name() {
+		return nil, fmt.Errorf(
+			"store uses the %s codec not %s (use je migrate %s to convert it)",
+			c.Name(), requested.Name(), requested.Name(),
+		)
+	}
+
+	return c, nil
+}
+
+// recodeJob re-encodes a serialized job from one codec to another. Jobs that
+// are already encoded with the new codec, e.g. by an interrupted migration,
+// are returned as is.
+func recodeJob(buf []byte, from, to codec.MarshalUnmarshaler) ([]byte, error) {
+	var job Job
+	if err := from.Unmarshal(buf, &job); err != nil {
+		if to.Unmarshal(buf, &job) == nil {
+			return buf, nil
+		}
+		return nil, err
+	}
+	return to.Marshal(&job)
+}
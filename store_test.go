@@ -0,0 +1,152 @@
+package je_test
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/prologic/je"
+	"github.com/prologic/je/codec/json"
+	"github.com/prologic/je/codec/msgpack"
+	"github.com/prologic/je/storetest"
+)
+
+func TestMemoryStore_Conformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) je.Store {
+		store, err := je.NewMemoryStore()
+		require.NoError(t, err)
+		return store
+	})
+}
+
+func TestBoltStore_Conformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) je.Store {
+		store, err := je.NewBoltStore(filepath.Join(t.TempDir(), "je.db"), nil)
+		require.NoError(t, err)
+		return store
+	})
+}
+
+func TestBoltStore_ConformanceMsgpack(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) je.Store {
+		store, err := je.NewBoltStore(filepath.Join(t.TempDir(), "je.db"), &je.StoreOptions{Codec: msgpack.Codec})
+		require.NoError(t, err)
+		return store
+	})
+}
+
+func TestBitcaskStore_Conformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) je.Store {
+		store, err := je.NewBitcaskStore(filepath.Join(t.TempDir(), "je.db"), nil)
+		require.NoError(t, err)
+		return store
+	})
+}
+
+func TestSQLiteStore_Conformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) je.Store {
+		store, err := je.NewSQLiteStore(filepath.Join(t.TempDir(), "je.db"), nil)
+		require.NoError(t, err)
+		return store
+	})
+}
+
+func TestPostgresStore_Conformance(t *testing.T) {
+	uri := os.Getenv("JE_POSTGRES_URI")
+	if uri == "" {
+		t.Skip("JE_POSTGRES_URI not set")
+	}
+
+	storetest.Run(t, func(t *testing.T) je.Store {
+		conn, err := sql.Open("postgres", uri)
+		require.NoError(t, err)
+		_, err = conn.Exec(`
+			DROP TABLE IF EXISTS jobs, meta, events, schema_migrations;
+			DROP SEQUENCE IF EXISTS job_ids;
+		`)
+		require.NoError(t, err)
+		require.NoError(t, conn.Close())
+
+		store, err := je.NewPostgresStore(uri, nil)
+		require.NoError(t, err)
+		return store
+	})
+}
+
+func TestStore_NextIdPersisted(t *testing.T) {
+	stores := map[string]func(string, *je.StoreOptions) (je.Store, error){
+		"bolt":    je.NewBoltStore,
+		"bitcask": je.NewBitcaskStore,
+		"sqlite":  je.NewSQLiteStore,
+	}
+
+	for name, open := range stores {
+		open := open
+		t.Run(name, func(t *testing.T) {
+			dbpath := filepath.Join(t.TempDir(), "je.db")
+
+			store, err := open(dbpath, nil)
+			require.NoError(t, err)
+			last := store.NextId()
+			require.NoError(t, store.Close())
+
+			store, err = open(dbpath, nil)
+			require.NoError(t, err)
+			defer store.Close()
+			require.Greater(t, uint64(store.NextId()), uint64(last))
+		})
+	}
+}
+
+func TestStore_Codec(t *testing.T) {
+	stores := map[string]func(string, *je.StoreOptions) (je.Store, error){
+		"bolt":    je.NewBoltStore,
+		"bitcask": je.NewBitcaskStore,
+		"sqlite":  je.NewSQLiteStore,
+	}
+
+	for name, open := range stores {
+		open := open
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			dbpath := filepath.Join(t.TempDir(), "je.db")
+
+			store, err := open(dbpath, &je.StoreOptions{Codec: msgpack.Codec})
+			require.NoError(t, err)
+			job := &je.Job{Name: "codec", Args: []string{"a"}}
+			require.NoError(t, store.Save(job))
+			require.NoError(t, store.Close())
+
+			// The recorded codec is used by default
+			store, err = open(dbpath, nil)
+			require.NoError(t, err)
+			assert.Equal("msgpack", store.(je.Recoder).Codec().Name())
+			got, err := store.Get(job.ID)
+			assert.NoError(err)
+			assert.Equal([]string{"a"}, got.Args)
+			require.NoError(t, store.Close())
+
+			// A different codec must be migrated to
+			_, err = open(dbpath, &je.StoreOptions{Codec: json.Codec})
+			assert.Error(err)
+
+			store, err = open(dbpath, nil)
+			require.NoError(t, err)
+			n, err := store.(je.Recoder).Recode(json.Codec)
+			assert.NoError(err)
+			assert.Equal(1, n)
+			require.NoError(t, store.Close())
+
+			store, err = open(dbpath, &je.StoreOptions{Codec: json.Codec})
+			require.NoError(t, err)
+			defer store.Close()
+			got, err = store.Get(job.ID)
+			assert.NoError(err)
+			assert.Equal("codec", got.Name)
+		})
+	}
+}
@@ -0,0 +1,419 @@
+// Package storetest provides a conformance test suite for implementations of
+// je.Store so that every backend behaves the same way. Stores index jobs as
+// they are saved so callers must have called je.InitMetrics beforehand, for
+// example in TestMain.
+package storetest
+
+import (
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/prologic/je"
+)
+
+// Factory returns a new empty Store. It is called once for each test and the
+// store is closed at the end of the test.
+type Factory func(t *testing.T) je.Store
+
+// Run runs the behavioural contract of a Store against stores created by
+// newStore:
+//
+//   - NextId returns unique, increasing and non-zero IDs
+//   - Save assigns an ID to jobs without one, reserves the IDs of jobs with
+//     one and replaces existing jobs
+//   - Get returns what was saved or a *je.KeyError wrapping je.ErrNotExist
+//   - Find returns jobs in the order of the IDs given skipping missing ones
+//   - Delete removes jobs or returns a *je.KeyError if they do not exist
+//   - All returns every job saved
+//   - Saves, gets and searches are safe for concurrent use
+//   - Search matches, counts, sorts and pages jobs
+//   - Names are matched by their words whatever their case
+//   - Saves record an event when a job's state changes and Events returns
+//     them in order until the job is deleted
+func Run(t *testing.T, newStore Factory) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, store je.Store)
+	}{
+		{"NextId", testNextId},
+		{"SaveGet", testSaveGet},
+		{"NotFound", testNotFound},
+		{"Find", testFind},
+		{"Delete", testDelete},
+		{"All", testAll},
+		{"Concurrent", testConcurrent},
+		{"Search", testSearch},
+		{"SearchNames", testSearchNames},
+		{"Events", testEvents},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			store := newStore(t)
+			defer func() {
+				assert.NoError(t, store.Close())
+			}()
+			tt.test(t, store)
+		})
+	}
+}
+
+// newJob returns a finished job created d after a fixed point in time
+func newJob(name string, d time.Duration) *je.Job {
+	created := time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC).Add(d)
+	return &je.Job{
+		Name:      name,
+		Args:      []string{"-v", name},
+		Worker:    "w1",
+		State:     je.STATE_STOPPED,
+		CreatedAt: created,
+		StartedAt: created.Add(time.Second),
+		StoppedAt: created.Add(time.Minute),
+	}
+}
+
+func ids(jobs []*je.Job) []je.ID {
+	ids := make([]je.ID, len(jobs))
+	for i, job := range jobs {
+		ids[i] = job.ID
+	}
+	return ids
+}
+
+func sortedIds(jobs []*je.Job) []je.ID {
+	ids := ids(jobs)
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func assertNotFound(t *testing.T, err error, id je.ID) {
+	t.Helper()
+
+	require.Error(t, err)
+	kerr, ok := err.(*je.KeyError)
+	require.True(t, ok, "expected *je.KeyError got %T: %s", err, err)
+	assert.Equal(t, id, kerr.Key)
+	assert.Equal(t, je.ErrNotExist, kerr.Err)
+}
+
+func testNextId(t *testing.T, store je.Store) {
+	var last je.ID
+	for i := 0; i < 10; i++ {
+		id := store.NextId()
+		assert.NotEqual(t, je.ID(0), id)
+		assert.True(t, id > last, "NextId %d not greater than %d", id, last)
+		last = id
+	}
+
+	// Saving a job without an ID allocates one from the same sequence
+	job := newJob("nextid", 0)
+	require.NoError(t, store.Save(job))
+	assert.True(t, job.ID > last, "saved job ID %d not greater than %d", job.ID, last)
+
+	// Saving a job with an ID reserves it, e.g. when restoring
+	reserved := newJob("reserved", 0)
+	reserved.ID = job.ID + 100
+	require.NoError(t, store.Save(reserved))
+	id := store.NextId()
+	assert.True(t, id > reserved.ID, "NextId %d not greater than reserved ID %d", id, reserved.ID)
+}
+
+func testSaveGet(t *testing.T, store je.Store) {
+	job := newJob("roundtrip", 0)
+	job.ID = store.NextId()
+	job.Interactive = true
+	job.Status = 2
+	require.NoError(t, store.Save(job))
+
+	got, err := store.Get(job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, job.ID, got.ID)
+	assert.Equal(t, job.Name, got.Name)
+	assert.Equal(t, job.Args, got.Args)
+	assert.Equal(t, job.Interactive, got.Interactive)
+	assert.Equal(t, job.Worker, got.Worker)
+	assert.Equal(t, job.State, got.State)
+	assert.Equal(t, job.Status, got.Status)
+	assert.True(t, job.CreatedAt.Equal(got.CreatedAt))
+	assert.True(t, job.StartedAt.Equal(got.StartedAt))
+	assert.True(t, job.StoppedAt.Equal(got.StoppedAt))
+	assert.True(t, got.KilledAt.IsZero())
+	assert.True(t, got.ErroredAt.IsZero())
+
+	// Saving again replaces the job
+	updated := newJob("roundtrip", 0)
+	updated.ID = job.ID
+	updated.State = je.STATE_ERRORED
+	updated.ErroredAt = updated.StoppedAt
+	require.NoError(t, store.Save(updated))
+
+	got, err = store.Get(job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, je.STATE_ERRORED, got.State)
+	assert.True(t, updated.ErroredAt.Equal(got.ErroredAt))
+
+	all, err := store.All()
+	require.NoError(t, err)
+	assert.Len(t, all, 1)
+}
+
+func testNotFound(t *testing.T, store je.Store) {
+	// Before anything has been saved
+	job, err := store.Get(je.ID(42))
+	assert.Nil(t, job)
+	assertNotFound(t, err, je.ID(42))
+
+	require.NoError(t, store.Save(newJob("exists", 0)))
+
+	job, err = store.Get(je.ID(42))
+	assert.Nil(t, job)
+	assertNotFound(t, err, je.ID(42))
+}
+
+func testFind(t *testing.T, store je.Store) {
+	jobs, err := store.Find()
+	assert.NoError(t, err)
+	assert.Empty(t, jobs)
+
+	// Before anything has been saved
+	jobs, err = store.Find(je.ID(42))
+	assert.NoError(t, err)
+	assert.Empty(t, jobs)
+
+	var saved []*je.Job
+	for i := 0; i < 3; i++ {
+		job := newJob("find", time.Duration(i)*time.Hour)
+		require.NoError(t, store.Save(job))
+		saved = append(saved, job)
+	}
+
+	missing := saved[2].ID + 100
+	jobs, err = store.Find(saved[2].ID, missing, saved[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, []je.ID{saved[2].ID, saved[0].ID}, ids(jobs))
+
+	jobs, err = store.Find(missing)
+	assert.NoError(t, err)
+	assert.Empty(t, jobs)
+}
+
+func testDelete(t *testing.T, store je.Store) {
+	assertNotFound(t, store.Delete(je.ID(42)), je.ID(42))
+
+	job := newJob("delete", 0)
+	require.NoError(t, store.Save(job))
+	require.NoError(t, store.Delete(job.ID))
+
+	_, err := store.Get(job.ID)
+	assertNotFound(t, err, job.ID)
+
+	assertNotFound(t, store.Delete(job.ID), job.ID)
+
+	res, err := store.Search("name:delete", nil)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), res.Total)
+	assert.Empty(t, res.Jobs)
+}
+
+func testAll(t *testing.T, store je.Store) {
+	jobs, err := store.All()
+	assert.NoError(t, err)
+	assert.Empty(t, jobs)
+
+	var want []*je.Job
+	for i := 0; i < 5; i++ {
+		job := newJob("all", time.Duration(i)*time.Hour)
+		require.NoError(t, store.Save(job))
+		want = append(want, job)
+	}
+
+	jobs, err = store.All()
+	require.NoError(t, err)
+	assert.Equal(t, sortedIds(want), sortedIds(jobs))
+}
+
+func testConcurrent(t *testing.T, store je.Store) {
+	const (
+		workers = 8
+		saves   = 25
+	)
+
+	var (
+		wg  sync.WaitGroup
+		mu  sync.Mutex
+		all []*je.Job
+	)
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < saves; i++ {
+				job := newJob("concurrent", time.Duration(w*saves+i)*time.Second)
+				if i%2 == 0 {
+					job.ID = store.NextId()
+				}
+				if !assert.NoError(t, store.Save(job)) {
+					return
+				}
+
+				_, err := store.Get(job.ID)
+				assert.NoError(t, err)
+
+				_, err = store.Search("name:concurrent", &je.SearchOptions{Limit: 10})
+				assert.NoError(t, err)
+
+				mu.Lock()
+				all = append(all, job)
+				mu.Unlock()
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	seen := make(map[je.ID]bool)
+	for _, job := range all {
+		assert.False(t, seen[job.ID], "job ID %d allocated more than once", job.ID)
+		seen[job.ID] = true
+	}
+
+	jobs, err := store.All()
+	require.NoError(t, err)
+	assert.Len(t, jobs, workers*saves)
+
+	res, err := store.Search("name:concurrent", nil)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(workers*saves), res.Total)
+	assert.Len(t, res.Jobs, workers*saves)
+}
+
+func testSearch(t *testing.T, store je.Store) {
+	var want []je.ID
+	for i := 0; i < 5; i++ {
+		job := newJob("search", time.Duration(i)*time.Hour)
+		job.Status = i % 2
+		require.NoError(t, store.Save(job))
+		want = append(want, job.ID)
+	}
+	require.NoError(t, store.Save(newJob("other", 0)))
+
+	res, err := store.Search("name:search", nil)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(5), res.Total)
+	assert.ElementsMatch(t, want, ids(res.Jobs))
+
+	res, err = store.Search("+name:search +status:1", nil)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), res.Total)
+	assert.ElementsMatch(t, []je.ID{want[1], want[3]}, ids(res.Jobs))
+
+	res, err = store.Search("name:nothing", nil)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), res.Total)
+	assert.Empty(t, res.Jobs)
+
+	// Newest first one page at a time
+	var paged []je.ID
+	options := &je.SearchOptions{Limit: 2, Sort: "created", Order: "desc"}
+	for page := 0; ; page++ {
+		require.True(t, page < 5, "too many pages")
+
+		res, err := store.Search("name:search", options)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(5), res.Total)
+		paged = append(paged, ids(res.Jobs)...)
+
+		if res.Next == "" {
+			break
+		}
+		options.Cursor = res.Next
+	}
+	assert.Equal(t, []je.ID{want[4], want[3], want[2], want[1], want[0]}, paged)
+
+	res, err = store.Search("name:search", &je.SearchOptions{Offset: 3, Sort: "created"})
+	require.NoError(t, err)
+	assert.Equal(t, []je.ID{want[3], want[4]}, ids(res.Jobs))
+
+	_, err = store.Search("name:search", &je.SearchOptions{Sort: "bogus"})
+	assert.Error(t, err, "sorting by an unknown field")
+}
+
+func testSearchNames(t *testing.T, store je.Store) {
+	byName := make(map[string]je.ID)
+	for _, name := range []string{"hello world", "Hello", "samples/hello.sh", "goodbye"} {
+		job := newJob(name, 0)
+		require.NoError(t, store.Save(job))
+		byName[name] = job.ID
+	}
+
+	res, err := store.Search("name:hello", nil)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []je.ID{byName["hello world"], byName["Hello"]}, ids(res.Jobs))
+
+	res, err = store.Search("+name:hello.sh +worker:w1", nil)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []je.ID{byName["samples/hello.sh"]}, ids(res.Jobs))
+
+	res, err = store.Search(`name:"samples/hello.sh"`, nil)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []je.ID{byName["samples/hello.sh"]}, ids(res.Jobs))
+}
+
+func testEvents(t *testing.T, store je.Store) {
+	events, err := store.Events(je.ID(42))
+	require.NoError(t, err)
+	assert.Empty(t, events)
+
+	job := newJob("events", 0)
+	job.State = je.STATE_CREATED
+	require.NoError(t, store.Save(job))
+
+	job.State = je.STATE_RUNNING
+	require.NoError(t, store.Save(job))
+
+	// Saves that do not change the state are not recorded
+	job.Status = 1
+	require.NoError(t, store.Save(job))
+
+	job.State = je.STATE_STOPPED
+	require.NoError(t, store.Save(job))
+
+	other := newJob("events", time.Hour)
+	require.NoError(t, store.Save(other))
+
+	events, err = store.Events(job.ID)
+	require.NoError(t, err)
+	require.Len(t, events, 3)
+
+	want := []struct {
+		from, to je.State
+		at       time.Time
+	}{
+		{0, je.STATE_CREATED, job.CreatedAt},
+		{je.STATE_CREATED, je.STATE_RUNNING, job.StartedAt},
+		{je.STATE_RUNNING, je.STATE_STOPPED, job.StoppedAt},
+	}
+	for i, w := range want {
+		assert.Equal(t, job.ID, events[i].JobID)
+		assert.Equal(t, w.from, events[i].From)
+		assert.Equal(t, w.to, events[i].To)
+		assert.True(t, w.at.Equal(events[i].At), "event %d at %s not %s", i, events[i].At, w.at)
+		assert.Equal(t, "w1", events[i].Worker)
+	}
+
+	require.NoError(t, store.Delete(job.ID))
+
+	events, err = store.Events(job.ID)
+	require.NoError(t, err)
+	assert.Empty(t, events)
+
+	events, err = store.Events(other.ID)
+	require.NoError(t, err)
+	assert.Len(t, events, 1)
+}
@@ -2,23 +2,38 @@ package je
 
 import (
 	"fmt"
+	"net/url"
 	"strconv"
 	"strings"
 )
 
 type URI struct {
-	Type string
-	Path string
+	Type  string
+	Path  string
+	Query url.Values
 }
 
 func (u *URI) String() string {
+	if len(u.Query) > 0 {
+		return fmt.Sprintf("%s://%s?%s", u.Type, u.Path, u.Query.Encode())
+	}
 	return fmt.Sprintf("%s://%s", u.Type, u.Path)
 }
 
 func ParseURI(uri string) (*URI, error) {
 	parts := strings.Split(uri, "://")
 	if len(parts) == 2 {
-		return &URI{Type: strings.ToLower(parts[0]), Path: parts[1]}, nil
+		path, query := parts[1], ""
+		if i := strings.Index(path, "?"); i >= 0 {
+			path, query = path[:i], path[i+1:]
+		}
+
+		qs, err := url.ParseQuery(query)
+		if err != nil {
+			return nil, err
+		}
+
+		return &URI{Type: strings.ToLower(parts[0]), Path: path, Query: qs}, nil
 	}
 	return nil, fmt.Errorf("invalid uri: %s", uri)
 }
@@ -45,7 +45,7 @@ func (p *Pool) Resize(n int) {
 		p.wg.Add(1)
 		worker := NewWorker(xid.New().String())
 		p.workers[worker.Id()] = worker
-		go worker.Run(p.queue.Channel(), p.kill, p.wg)
+		go worker.Run(p.queue.Channel(), p.kill, &p.wg)
 	}
 	for p.size > n {
 		p.size--
@@ -61,6 +61,21 @@ func (p *Pool) Wait() {
 	p.wg.Wait()
 }
 
+// Idle returns the number of workers not running a task less the number of
+// tasks waiting in the queue
+func (p *Pool) Idle() int {
+	p.RLock()
+	defer p.RUnlock()
+
+	n := 0
+	for _, worker := range p.workers {
+		if !worker.Busy() {
+			n++
+		}
+	}
+	return n - len(p.queue.Channel())
+}
+
 func (p *Pool) Submit(task Task) (err error) {
 	err = p.queue.Submit(task)
 	return
@@ -70,6 +85,7 @@ type Worker struct {
 	sync.RWMutex
 
 	id   string
+	busy bool
 	task Task
 }
 
@@ -84,6 +100,14 @@ func (w *Worker) Id() string {
 	return w.id
 }
 
+// Busy returns true if the worker is running a task
+func (w *Worker) Busy() bool {
+	w.RLock()
+	defer w.RUnlock()
+
+	return w.busy
+}
+
 func (w *Worker) Kill(force bool) error {
 	w.RLock()
 	defer w.RUnlock()
@@ -91,7 +115,7 @@ func (w *Worker) Kill(force bool) error {
 	return w.task.Kill(force)
 }
 
-func (w Worker) Close() error {
+func (w *Worker) Close() error {
 	w.RLock()
 	defer w.RUnlock()
 
@@ -105,7 +129,7 @@ func (w *Worker) Write(input io.Reader) (int64, error) {
 	return w.task.Write(input)
 }
 
-func (w *Worker) Run(tasks chan Task, kill chan bool, wg sync.WaitGroup) {
+func (w *Worker) Run(tasks chan Task, kill chan bool, wg *sync.WaitGroup) {
 	defer wg.Done()
 	for {
 		select {
@@ -115,6 +139,7 @@ func (w *Worker) Run(tasks chan Task, kill chan bool, wg sync.WaitGroup) {
 			}
 
 			w.Lock()
+			w.busy = true
 			w.task = task
 			w.Unlock()
 
@@ -128,6 +153,10 @@ func (w *Worker) Run(tasks chan Task, kill chan bool, wg sync.WaitGroup) {
 					task.Stop()
 				}
 			}
+
+			w.Lock()
+			w.busy = false
+			w.Unlock()
 		case <-kill:
 			return
 		}